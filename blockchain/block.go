@@ -20,11 +20,23 @@ type Block struct {
 	Difficulty   int    `json:"difficulty"` //n개의 0을 앞에 가지는 hash
 	Nonce        int    `json:"nonce"`      // 채굴자들이 변경할 수 있는 유일한 값. Nonce를 변경해서 n개의 0을 가지는 hash를 찾는다
 	Timestamp    int    `json:"timestamp"`
+	MerkleRoot   string `json:"merkleRoot,omitempty"` // Transactions의 id로 만든 merkle root. hash에 포함되므로 block의 tx들을 바꿀 수 없음
+}
+
+//block에서 Transactions를 뺀 부분. block의 hash는 header로 계산하므로 tx 없이도 hash를 다시 계산할 수 있음
+type Header struct {
+	Hash       string `json:"hash"`
+	PrevHash   string `json:"prevHash,omitempty"`
+	Height     int    `json:"height"`
+	Difficulty int    `json:"difficulty"`
+	Nonce      int    `json:"nonce"`
+	Timestamp  int    `json:"timestamp"`
+	MerkleRoot string `json:"merkleRoot,omitempty"`
 }
 
 var ErrNotFound = errors.New("Block not found")
 
-//block 초기화 후 block의 transactions에 mempool에서 가져온 tx를 대입. 그 후 block에 hash를 저장하고 db에 block 저장 후 block 리턴
+//block 초기화 후 block의 transactions에 mempool에서 가져온 tx를 대입. 그 후 block에 hash를 저장하고 block 리턴. db에는 blockchain과 함께 저장함
 func createBlock(prevHash string, height int, diff int) *Block { //블록 생성하는 함수
 	block := Block{
 		//Data:       data,
@@ -38,9 +50,9 @@ func createBlock(prevHash string, height int, diff int) *Block { //블록 생성
 	}
 	// payload := block.Data + block.PrevHash + fmt.Sprint(block.Height)
 	// block.Hash = fmt.Sprintf("%x", sha256.Sum256([]byte(payload))) //payload hashing
-	block.Transactions = Mempool().TxToConfirm()
+	block.Transactions = Mempool().TxToConfirm(height)
+	block.MerkleRoot = merkleRoot(block.Transactions)
 	block.mine()
-	persistBlock(&block)
 	return &block
 }
 
@@ -49,7 +61,7 @@ func (b *Block) mine() { // nonce값 변경해가면서 난이도에 맞는 bloc
 	target := strings.Repeat("0", b.Difficulty)
 	for {
 		b.Timestamp = int(time.Now().Unix()) //Unix : int64로 return.
-		hash := utils.GetHash(b)
+		hash := b.Header().calculateHash()
 		if strings.HasPrefix(hash, target) {
 			b.Hash = hash
 			// fmt.Printf("Hash:%s, target:%s, nonce:%d", hash, target, b.Nonce)
@@ -62,9 +74,24 @@ func (b *Block) mine() { // nonce값 변경해가면서 난이도에 맞는 bloc
 
 }
 
-//block을 []byte로 변환시킨 것을 db에 저장
-func persistBlock(b *Block) { //override. db에 block을 저장하는 함수
-	db.SaveBlock(b.Hash, utils.ToBytes(b))
+//block의 header를 리턴.
+func (b *Block) Header() *Header {
+	return &Header{
+		Hash:       b.Hash,
+		PrevHash:   b.PrevHash,
+		Height:     b.Height,
+		Difficulty: b.Difficulty,
+		Nonce:      b.Nonce,
+		Timestamp:  b.Timestamp,
+		MerkleRoot: b.MerkleRoot,
+	}
+}
+
+//Hash를 제외한 header의 값들로 hash를 계산.
+func (h *Header) calculateHash() string {
+	payload := *h
+	payload.Hash = ""
+	return utils.GetHash(payload)
 }
 
 //block을 []byte로 변환시켰던 것을 다시 block 형태로 변환.
@@ -76,6 +103,9 @@ func (b *Block) fromBytes(data []byte) { //data를 decoding해서 block으로 
 func FindBlock(hash string) (*Block, error) { // 특정 hash값을 가지는 block을 찾는 함수
 	blockBytes := db.Block(hash)
 	if blockBytes == nil {
+		if FindHeader(hash) != nil { // header만 남은 block
+			return nil, ErrBlockPruned
+		}
 		return nil, ErrNotFound
 	}
 	block := &Block{}           //block을 Block type으로 초기화
@@ -2,6 +2,7 @@ package blockchain
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"sync"
@@ -23,9 +24,11 @@ const (
 )
 
 type blockchain struct {
-	NewestHash     string `json:"newestHash"`
-	Height         int    `json:"height"`
-	CurrDifficulty int    `json:"currDifficulty"` //현재의 difficulty point
+	NewestHash     string        `json:"newestHash"`
+	Height         int           `json:"height"`
+	CurrDifficulty int           `json:"currDifficulty"`         //현재의 difficulty point
+	PrunedHeight   int           `json:"prunedHeight,omitempty"` // 이 height까지의 block은 지우고 header만 남김
+	Snapshot       *SnapshotInfo `json:"snapshot,omitempty"`     // UTXO snapshot으로 시작했으면 그 snapshot
 	m              sync.Mutex
 }
 
@@ -46,17 +49,28 @@ func recalculateDifficulty(b *blockchain) int { //difficulty 다시 계산해서
 	allBlocks := Blocks(b)
 	newestBlock := allBlocks[0]
 	lastCalculatedBlock := allBlocks[difficultyInterval-1]
-	timeInterval := (newestBlock.Timestamp - lastCalculatedBlock.Timestamp) / 60 // newestBlock 과 lastCalculatedBlock 사이의 시간 간격. 실제 걸린 시간
-	expectedTime := difficultyInterval * blockInterval                           // 예상 난이도 계산 시간
-	if timeInterval > (expectedTime + timeRange) {                               // 걸린 시간에 따른 난이도 설정
-		return b.CurrDifficulty - 1
+	return adjustDifficulty(b.CurrDifficulty, newestBlock.Timestamp, lastCalculatedBlock.Timestamp)
+}
+
+//newest와 lastCalculated block의 timestamp로 curr 난이도를 조절. light node도 header로 같은 계산을 함.
+func adjustDifficulty(curr int, newest int, lastCalculated int) int {
+	timeInterval := (newest - lastCalculated) / 60     // newestBlock 과 lastCalculatedBlock 사이의 시간 간격. 실제 걸린 시간
+	expectedTime := difficultyInterval * blockInterval // 예상 난이도 계산 시간
+	if timeInterval > (expectedTime + timeRange) {     // 걸린 시간에 따른 난이도 설정
+		return curr - 1
 	} else if (expectedTime - timeRange) < timeInterval {
-		return b.CurrDifficulty
+		return curr
 	} else {
-		return b.CurrDifficulty + 1
+		return curr + 1
 	}
 }
 
+var ErrOrphanBlock = errors.New("previous block not found")
+var ErrBlockTooFar = errors.New("block is too far ahead of the newest block")
+var ErrBlockNotConnectable = errors.New("block does not extend the newest block")
+var ErrDifferentGenesis = errors.New("block is on a chain with a different genesis block")
+var ErrChainNotLonger = errors.New("chain is not longer than the newest chain")
+
 var b *blockchain  //singleton
 var once sync.Once // 병렬처리해도 한번만 작동될 수 있도록
 
@@ -68,12 +82,14 @@ func Blockchain() *blockchain {
 		} // blockchain초기화. 텅 빈 blockchain
 		// fmt.Printf("newesthash: %s\n height: %d\n", b.NewestHash, b.Height)
 		checkpoint := db.Checkpoint()
-		if checkpoint == nil { //db에 checkpoint의 key값으로 저장된  value가 없으면
-			b.AddBlock() //Genesis block 생성
-			fmt.Println("Genesis Block created")
-		} else { //checkpoint로 저장된 값이 있으면
+		if checkpoint != nil { //checkpoint로 저장된 값이 있으면
 			// fmt.Println("now decoding...")
 			b.fromBytes(checkpoint) //checkpoint에서 decoding해서 blockchain에 값 저장
+			b.repair()              // checkpoint와 block, UTXO set이 맞지 않으면 고침. 고칠 수 없으면 빈 blockchain이 됨
+		}
+		if b.NewestHash == "" { //db에 checkpoint의 key값으로 저장된  value가 없으면
+			b.AddBlock() //Genesis block 생성
+			fmt.Println("Genesis Block created")
 		}
 
 	})
@@ -91,6 +107,31 @@ func Txs(b *blockchain) []*Tx {
 	return txs
 }
 
+//TxOut을 받은 적이 있는 address들. HD wallet이 사용한 address를 찾을 때 사용.
+//pruned node는 지운 block에서는 아직 사용하지 않은 TxOut의 address만 찾고, light node는 받은 wallet tx에서 찾음.
+func UsedAddresses() map[string]bool {
+	used := make(map[string]bool)
+	if Light() {
+		for _, tx := range lightTxs() {
+			for _, txOut := range tx.Tx.TxOuts {
+				used[txOut.Address] = true
+			}
+		}
+		return used
+	}
+	for _, tx := range Txs(Blockchain()) {
+		for _, txOut := range tx.TxOuts {
+			used[txOut.Address] = true
+		}
+	}
+	for _, data := range db.UTxOs() {
+		txOut := &TxOut{}
+		utils.FromBytes(txOut, data)
+		used[txOut.Address] = true
+	}
+	return used
+}
+
 //모든 Tx중 ID가 targetID와 같은 Tx를 찾아서 리턴
 func FindTx(b *blockchain, targetID string) *Tx {
 	for _, tx := range Txs(b) {
@@ -107,11 +148,26 @@ func (b *blockchain) AddBlock() *Block { //새로운 블록 추가하는 함수
 	b.NewestHash = block.Hash                                     // 새로운 블록의 hash 설정
 	b.Height = block.Height                                       // 새로운 블록의 height 설정
 	b.CurrDifficulty = block.Difficulty                           // 새로운 블록의 난이도 설정
-	persistBlockchain(b)                                          //SaveBlockchain() 호출
 	//블록이 생성될때마다 DB를 업데이트해주어야함
+	b.persistConnect(block)
 	return block
 }
 
+//새로 연결한 block과 blockchain, UTXO set의 변경, pruning으로 지우는 block을 하나의 transaction으로 저장.
+//중간에 node가 꺼져도 checkpoint가 없는 block을 가리키거나 UTXO set이 다른 block의 것이 되지 않음.
+func (b *blockchain) persistConnect(block *Block) {
+	batch := db.NewBatch()
+	batch.SaveBlock(block.Hash, utils.ToBytes(block))
+	applyBlock(batch, block)
+	b.prune(batch, block.PrevHash)
+	batch.SaveBlockchain(utils.ToBytes(b))
+	touched := watch().connect(block.Transactions, block.Height, FindUTxO) // UTXO set이 바뀌기 전에 사용한 TxOut을 찾음
+	batch.Commit()
+	if touched { // xpub wallet이 다음 address를 받았으면 더 지켜봄
+		go RefreshWatched()
+	}
+}
+
 //blockchain을 []byte로 변환시켜서 db에 저장.
 func persistBlockchain(b *blockchain) { //override. blockchain을 db에 저장하는 함수
 	db.SaveBlockchain(utils.ToBytes(b))
@@ -122,14 +178,22 @@ func (b *blockchain) fromBytes(data []byte) { // db에서 decoding해서 blockch
 	utils.FromBytes(b, data)
 }
 
-//해당 blockchain의 block을 역순으로 찾아서 blocks에 대입 후 리턴. 가장 최근 block이 blocks[0].
+//해당 blockchain의 block을 역순으로 찾아서 blocks에 대입 후 리턴. 가장 최근 block이 blocks[0]. pruned node는 지우지 않은 block까지만 리턴.
 func Blocks(b *blockchain) []*Block { //NewestHash로 prevHash를 갖는 블록을 찾고 그 prevHash로 또 전 블록찾고...해서 []*Block 리턴
 	b.m.Lock()
 	defer b.m.Unlock()
+	return b.blocks()
+}
+
+//Blocks와 같지만 b.m을 가지고 있어야함.
+func (b *blockchain) blocks() []*Block {
 	var blocks []*Block
 	hashCursor := b.NewestHash
 	for {
-		block, _ := FindBlock(hashCursor)
+		block, err := FindBlock(hashCursor)
+		if err != nil { // pruning으로 지운 block
+			break
+		}
 		blocks = append(blocks, block) //newest를 찾고 append하고 newest-1을 찾고 append하므로 가장 최근것이 blocks[0]에 온다
 		if block.PrevHash != "" {      //Genesis block에 도달하기 전까지 blocks에 append
 			hashCursor = block.PrevHash
@@ -165,44 +229,12 @@ func Blocks(b *blockchain) []*Block { //NewestHash로 prevHash를 갖는 블록
 // return txOutsAddress
 // }
 
-//모든 TxOut에 대해 해당 address의 TxOut이 사용되었나 creatorTxs에 넣어서 판단함. (tx에는 없으나 mempool에 있을 수도 있으므로)사용되지 않은 TxOut을 초기화한 uTxOut에 대입해서 uTxOut으로 만들고 mempool에 있는지 확인해서 없으면 uTxOuts에 대입.
+//UTXO set에서 해당 address의 사용되지 않은 TxOut을 찾아서 uTxOut으로 만듬. mempool의 tx가 이미 사용한 TxOut은 제외.
+//block과 따로 저장된 UTXO set을 사용하므로 오래된 block을 지운 pruned node에서도 사용할 수 있음.
 func UTxOutsByAddress(address string, b *blockchain) []*UTxOut { // address의 unspent tx outs
-	var uTxOuts []*UTxOut
-	creatorTxs := make(map[string]bool)
-	for _, block := range Blocks(b) { //모든 블록 중
-		for _, tx := range block.Transactions { // 모든 트랜잭션 중
-			for _, input := range tx.TxIns { //모든 TxIn 중
-				if input.Signature == "COINBASE" {
-					break //signature가 coinbase면 break
-
-				}
-				if FindTx(b, input.TxID).TxOuts[input.Index].Address == address {
-					creatorTxs[input.TxID] = true // TxIn의 Owner가 address와 같다면 -> 사용자가 TxIn에서 사용하고 있는 TxOut
-				}
-			}
-			for index, output := range tx.TxOuts {
-				// _, ok := creatorTxs[tx.Id]
-				// if !ok{
-				// }
-				if output.Address == address { // 해당 주소의 txout
-					if _, ok := creatorTxs[tx.Id]; !ok { // 해당 txout이 어느 txin에서도 참조되지 않았을 경우
-						uTxOut := &UTxOut{
-							TxID:   tx.Id,
-							Index:  index,
-							Amount: output.Amount,
-						}
-						if !isOnMempool(uTxOut) { //mempool에 없어야 uTxOut
-							uTxOuts = append(uTxOuts, uTxOut)
-						}
-
-					}
-				}
-
-			}
-		}
-	}
-	return uTxOuts
-
+	b.m.Lock()
+	defer b.m.Unlock()
+	return utxosByAddress(address)
 }
 
 //해당 address를 가지고 사용되지 않은 TxOuts의 amount를 모두 더해서 리턴.
@@ -264,35 +296,119 @@ func Status(b *blockchain, rw http.ResponseWriter) {
 }
 
 //역순으로 들어온 newBlocks의 newestBlock에서 hash, height, difficulty를 가져오고 blockchain에 저장. 그 후 db에 blockchain을 업데이트.
-//blocks에 대해서도 db를 비우고 다시 newBlocks를 db에 저장.
-func (b *blockchain) Replace(newBlocks []*Block) {
+//blocks에 대해서도 db를 비우고 다시 newBlocks를 db에 저장. 모든 변경은 하나의 transaction으로 저장하므로 중간에 꺼져도 이전 chain이 남음.
+//newBlocks는 genesis부터 검증하고, 지금의 chain보다 길지 않거나 검증에 실패하면 아무것도 바꾸지 않음.
+func (b *blockchain) Replace(newBlocks []*Block) error {
 	b.m.Lock()
 	defer b.m.Unlock()
+	if len(newBlocks) == 0 || newBlocks[0].Height <= b.Height {
+		return ErrChainNotLonger
+	}
+	if err := validateChain(newBlocks); err != nil {
+		return err
+	}
 	b.NewestHash = newBlocks[0].Hash
 	b.Height = len(newBlocks)
 	b.CurrDifficulty = newBlocks[0].Difficulty
-	persistBlockchain(b) // db에 blockchain update
+	b.PrunedHeight = 0
 
 	//db에 새로운 blocks 저장
-	db.EmptyBlocks()
+	batch := db.NewBatch()
+	batch.EmptyBlocks()
+	batch.EmptyHeaders() // 이전 chain에서 지웠던 block의 header
+	target := b.Height - pruneDepth
 	for _, block := range newBlocks {
-		persistBlock(block)
+		if pruneDepth > 0 && block.Height <= target { // pruned node는 오래된 block을 저장하지 않고 header만 남김
+			batch.SaveHeader(block.Hash, utils.ToBytes(block.Header()))
+		} else {
+			batch.SaveBlock(block.Hash, utils.ToBytes(block))
+		}
+	}
+	if pruneDepth > 0 && target > 0 {
+		b.PrunedHeight = target
 	}
+	rebuildUTxOs(batch, newBlocks)
+	batch.SaveBlockchain(utils.ToBytes(b)) // db에 blockchain update
+	batch.Commit()
+	watch().reorg(chainTxs(newBlocks), unspentTxOuts())
+	go RefreshWatched()
+	return nil
+}
 
+//peer에게 받은 newBlock을 blockchain에 연결. 이전 block이 없으면 orphan pool에 보관하고 ErrOrphanBlock을 리턴해서 이전 block을 요청할 수 있게 함.
+//newBlock이 연결되면 newBlock을 기다리던 orphan block들과 newBlock의 tx를 기다리던 orphan tx들도 처리함.
+func (b *blockchain) AddPeerBlock(newBlock *Block) error { //새로 블록을 채굴할 때 실행
+	connected, err := b.connectPeerBlock(newBlock)
+	if err != nil {
+		return err
+	}
+	for _, block := range connected { // 연결된 block의 tx를 기다리던 orphan tx 처리
+		for _, tx := range block.Transactions {
+			Mempool().processOrphanTxs(tx.Id)
+		}
+	}
+	return nil
 }
 
-//blockchain의 height, hash, difficulty를 newestBlock의 것으로 바꾸고 db에 blockchain과 newBlock 저장.
-//newBlock에 mempool의 tx 가 들어있으면(tx.id로 확인) mempool에서 tx 삭제.
-func (b *blockchain) AddPeerBlock(newBlock *Block) { //새로 블록을 채굴할 때 실행
+//newBlock과 newBlock을 기다리던 orphan block들을 검증해서 연결하고 연결된 block들을 리턴. 검증에 실패한 orphan block은 버림.
+func (b *blockchain) connectPeerBlock(newBlock *Block) ([]*Block, error) {
 	b.m.Lock()
-	m.m.Lock()
+	Mempool().m.Lock() // mining이나 tx 없이 peer block부터 받는 node도 있으므로 mempool을 초기화
 	defer b.m.Unlock()
 	defer m.m.Unlock()
-	b.Height += 1
+	if _, err := FindBlock(newBlock.Hash); err == nil { // 이미 가지고 있는 block
+		return nil, nil
+	}
+	if newBlock.PrevHash != b.NewestHash {
+		if _, err := FindBlock(newBlock.PrevHash); err != ErrNotFound {
+			return nil, ErrBlockNotConnectable // 이전 block은 있지만 가장 최근 block이 아님
+		}
+		if newBlock.PrevHash == "" { // 이전 block을 따라가다가 다른 genesis block에 도달함
+			return nil, ErrDifferentGenesis
+		}
+		if orphans.hasBlock(newBlock) {
+			return nil, ErrBlockNotConnectable
+		}
+		if newBlock.Height > b.Height+maxOrphanBlocks { // 너무 멀리 떨어진 block은 하나씩 요청하지 않음
+			return nil, ErrBlockTooFar
+		}
+		if err := orphans.addBlock(newBlock); err != nil {
+			return nil, err
+		}
+		return nil, ErrOrphanBlock
+	}
+	if newBlock.Height != b.Height+1 {
+		return nil, ErrBlockNotConnectable
+	}
+
+	var connected []*Block
+	queue := []*Block{newBlock}
+	for len(queue) > 0 {
+		block := queue[0]
+		queue = queue[1:]
+		if block.PrevHash != b.NewestHash || block.Height != b.Height+1 { // 같은 이전 block을 가지는 orphan이 여럿이면 먼저 연결된 것만 사용
+			continue
+		}
+		if err := b.validateBlock(block); err != nil {
+			if block == newBlock {
+				return nil, err
+			}
+			continue
+		}
+		b.connectBlock(block)
+		connected = append(connected, block)
+		queue = append(queue, orphans.takeBlocks(block.Hash)...) // block을 기다리던 orphan block들
+	}
+	return connected, nil
+}
+
+//blockchain의 height, hash, difficulty를 block의 것으로 바꾸고 db에 blockchain과 block을 한번에 저장.
+//block에 mempool의 tx 가 들어있으면(tx.id로 확인) mempool에서 tx 삭제. b.m과 m.m을 잡은 상태에서 호출해야함.
+func (b *blockchain) connectBlock(newBlock *Block) {
+	b.Height = newBlock.Height
 	b.NewestHash = newBlock.Hash
 	b.CurrDifficulty = newBlock.Difficulty
-	persistBlockchain(b)
-	persistBlock(newBlock)
+	b.persistConnect(newBlock)
 
 	//mempool
 	for _, tx := range newBlock.Transactions {
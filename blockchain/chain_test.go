@@ -0,0 +1,154 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yyuurriiaa/ProjectMSSP/db"
+	"github.com/yyuurriiaa/ProjectMSSP/utils"
+	"github.com/yyuurriiaa/ProjectMSSP/wallet"
+)
+
+var testWalletOnce sync.Once
+
+//임시 폴더의 새 db로 blockchain을 처음부터 시작함. blockchain, mempool, orphan pool singleton을 비우고
+//test가 끝나면 db를 닫고 원래 폴더로 돌아감. 채굴 보상을 받는 기본 wallet은 처음 한번만 만듬.
+func newTestChain(t *testing.T) string {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	testWalletOnce.Do(func() {
+		if _, _, err := wallet.Wallets().Create(wallet.DefaultName, "passphrase"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	db.SetPort("test")
+	resetChain()
+	t.Cleanup(func() {
+		db.Close()
+		resetChain()
+		pruneDepth = 0
+		os.Chdir(wd)
+	})
+	return dir
+}
+
+//다음 Blockchain() 호출이 db의 checkpoint부터 다시 시작하도록 singleton을 비움. node를 다시 시작한 것과 같음.
+func resetChain() {
+	b, once = nil, sync.Once{}
+	m, memOnce = nil, sync.Once{}
+	orphans = newOrphanPool()
+}
+
+//prev 다음에 올 block을 db에 저장하지 않고 채굴함. txs 뒤에 miner에게 주는 coinbase tx를 붙임.
+//난이도는 difficultyInterval까지 바뀌지 않으므로 그 height까지의 block만 만들 수 있음.
+func testBlock(prev *Block, miner string, txs ...*Tx) *Block {
+	block := &Block{PrevHash: prev.Hash, Height: prev.Height + 1, Difficulty: defaultDifficulty}
+	block.Transactions = append(txs, makeCoinbaseTx(miner, block.Height, 0))
+	block.MerkleRoot = merkleRoot(block.Transactions)
+	block.mine()
+	return block
+}
+
+//miner에게 보상을 주는 다른 genesis block. 이 genesis부터 만든 block들은 지금의 chain과 이어지지 않음.
+func testGenesis(miner string) *Block {
+	genesis := &Block{Height: 1, Difficulty: defaultDifficulty}
+	genesis.Transactions = []*Tx{makeCoinbaseTx(miner, 1, 0)}
+	genesis.MerkleRoot = merkleRoot(genesis.Transactions)
+	genesis.mine()
+	return genesis
+}
+
+//genesis부터 n개의 block으로 된 chain. 가장 최근 block이 blocks[0].
+func testChain(genesis *Block, miner string, n int) []*Block {
+	blocks := []*Block{genesis}
+	for len(blocks) < n {
+		blocks = append([]*Block{testBlock(blocks[0], miner)}, blocks...)
+	}
+	return blocks
+}
+
+//기본 wallet에서 address에게 amount를 보내는 tx를 mempool에 넣음. 다음에 채굴하는 block에 들어감.
+func sendTo(t *testing.T, address string, amount int) *Tx {
+	t.Helper()
+	if err := wallet.Wallet().Unlock("passphrase", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	tx, _, err := Mempool().AddTx(wallet.DefaultName, []*TxOut{{address, amount}}, SendOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+//UTXO set의 address별 amount 합.
+func utxoBalances() map[string]int {
+	balances := make(map[string]int)
+	for _, data := range db.UTxOs() {
+		txOut := &TxOut{}
+		utils.FromBytes(txOut, data)
+		balances[txOut.Address] += txOut.Amount
+	}
+	return balances
+}
+
+func TestReplace(t *testing.T) {
+	newTestChain(t)
+	chain := Blockchain()
+	chain.AddBlock()
+	chain.AddBlock()
+	spend := sendTo(t, testRecipient, 7) // 지금의 chain에만 있는 TxOut을 사용하는 tx
+	newestHash, balances := chain.NewestHash, utxoBalances()
+
+	genesis := testGenesis(testRecipient)
+	candidate := testChain(genesis, testRecipient, 4)
+	spending := []*Block{testBlock(genesis, testRecipient, spend)}
+	for len(spending) < 3 {
+		spending = append([]*Block{testBlock(spending[0], testRecipient)}, spending...)
+	}
+	spending = append(spending, genesis)
+	changed := append([]*Block{}, candidate...)
+	block := *changed[1]
+	block.Transactions = []*Tx{makeCoinbaseTx(wallet.Wallet().Address, block.Height, 0)}
+	changed[1] = &block
+
+	invalid := []struct {
+		name   string
+		blocks []*Block
+		err    error
+	}{
+		{"empty", nil, ErrChainNotLonger},
+		{"not longer", candidate[1:], ErrChainNotLonger},
+		{"not from genesis", candidate[:3], ErrBlockNotValid},
+		{"changed tx", changed, ErrBlockNotValid},
+		{"spends a coin of the other chain", spending, ErrBlockNotValid},
+	}
+	for _, test := range invalid {
+		if err := chain.Replace(test.blocks); !errors.Is(err, test.err) {
+			t.Errorf("%s: Expected %v, got %v", test.name, test.err, err)
+		}
+		if chain.NewestHash != newestHash || fmt.Sprint(utxoBalances()) != fmt.Sprint(balances) {
+			t.Fatalf("%s: Expected the chain not to change", test.name)
+		}
+	}
+
+	if err := chain.Replace(candidate); err != nil {
+		t.Fatal(err)
+	}
+	if chain.NewestHash != candidate[0].Hash || chain.Height != 4 {
+		t.Errorf("Expected the candidate chain, got %s at %d", chain.NewestHash, chain.Height)
+	}
+	if got := utxoBalances(); len(got) != 1 || got[testRecipient] != 4*minerReward {
+		t.Errorf("Expected every reward to go to the recipient, got %v", got)
+	}
+}
@@ -0,0 +1,105 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/yyuurriiaa/ProjectMSSP/codec"
+	"github.com/yyuurriiaa/ProjectMSSP/db"
+)
+
+//chain 파일은 codec frame들로 되어있음. 처음 frame은 chainFileHeader이고 그 다음부터 genesis부터 height 순서로 block 하나씩.
+//frame마다 길이와 checksum이 있으므로 잘리거나 손상된 파일을 알 수 있음. payload는 json.
+const (
+	chainFileVersion int = 1
+
+	frameChainHeader uint16 = 1
+	frameChainBlock  uint16 = 2
+)
+
+//chain 파일의 처음 frame.
+type chainFileHeader struct {
+	Version    int    `json:"version"`
+	Height     int    `json:"height"` // 파일에 있는 block의 수
+	NewestHash string `json:"newestHash"`
+}
+
+var ErrChainPruned = errors.New("blocks were pruned, cannot export the whole chain")
+var ErrChainFileNotValid = errors.New("not a chain file")
+var ErrChainFileTruncated = errors.New("chain file ended before the last block")
+
+//genesis부터 가장 최근 block까지 height 순서로 w에 씀. 오래된 block을 지운 node는 export할 수 없음.
+func ExportChain(w io.Writer) (int, error) {
+	if db.Checkpoint() == nil {
+		return 0, ErrNoBlockchain
+	}
+	b := Blockchain()
+	headers := chainHeaders(b)
+	if b.PrunedHeight > 0 {
+		return 0, ErrChainPruned
+	}
+	header := chainFileHeader{Version: chainFileVersion, Height: len(headers), NewestHash: b.NewestHash}
+	if err := writeChainFrame(w, frameChainHeader, header); err != nil {
+		return 0, err
+	}
+	for i, h := range headers {
+		block, err := FindBlock(h.Hash)
+		if err != nil {
+			return i, err
+		}
+		if err := writeChainFrame(w, frameChainBlock, block); err != nil {
+			return i, err
+		}
+	}
+	return len(headers), nil
+}
+
+func writeChainFrame(w io.Writer, command uint16, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return codec.Encode(w, codec.Frame{Command: command, Payload: data})
+}
+
+//r의 block들을 peer에게 받은 block처럼 하나씩 검증해서 blockchain에 연결하고 새로 연결한 block의 수를 리턴.
+//db가 비어있으면 genesis block도 파일에서 받음. 이미 가지고 있는 block은 건너뜀.
+func ImportChain(r io.Reader) (int, error) {
+	f, err := codec.Decode(r)
+	if err != nil || f.Command != frameChainHeader {
+		return 0, ErrChainFileNotValid
+	}
+	var header chainFileHeader
+	if err := json.Unmarshal(f.Payload, &header); err != nil || header.Version != chainFileVersion {
+		return 0, ErrChainFileNotValid
+	}
+	if db.Checkpoint() == nil {
+		once.Do(func() { b = &blockchain{} }) // genesis block을 새로 만들지 않고 파일의 genesis block을 연결
+	}
+	chain := Blockchain()
+	start := chain.Height
+	read := 0
+	for {
+		f, err := codec.Decode(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return chain.Height - start, err
+		}
+		var block Block
+		if f.Command != frameChainBlock || json.Unmarshal(f.Payload, &block) != nil {
+			return chain.Height - start, ErrChainFileNotValid
+		}
+		read++
+		if err := chain.AddPeerBlock(&block); err != nil {
+			return chain.Height - start, fmt.Errorf("block %d: %w", block.Height, err)
+		}
+	}
+	if read != header.Height {
+		return chain.Height - start, ErrChainFileTruncated
+	}
+	return chain.Height - start, nil
+}
@@ -0,0 +1,89 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/yyuurriiaa/ProjectMSSP/codec"
+	"github.com/yyuurriiaa/ProjectMSSP/db"
+)
+
+//header frame과 blocks로 chain 파일을 만듬. blocks는 genesis부터 height 순서.
+func testChainFile(t *testing.T, height int, blocks ...*Block) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := writeChainFrame(&buf, frameChainHeader, chainFileHeader{Version: chainFileVersion, Height: height}); err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range blocks {
+		if err := writeChainFrame(&buf, frameChainBlock, block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &buf
+}
+
+func TestChainFile(t *testing.T) {
+	newTestChain(t)
+	chain := Blockchain()
+	chain.AddBlock()
+	sendTo(t, testRecipient, 7)
+	chain.AddBlock()
+	newestHash, balances := chain.NewestHash, utxoBalances()
+	var file bytes.Buffer
+	if n, err := ExportChain(&file); err != nil || n != 3 {
+		t.Fatalf("Expected 3 blocks to be exported, got %d %v", n, err)
+	}
+	data := file.Bytes()
+
+	db.Close()
+	newTestChain(t) // 새 node
+
+	t.Run("round trip", func(t *testing.T) {
+		if n, err := ImportChain(bytes.NewReader(data)); err != nil || n != 3 {
+			t.Fatalf("Expected 3 blocks to be imported, got %d %v", n, err)
+		}
+		if Blockchain().NewestHash != newestHash || fmt.Sprint(utxoBalances()) != fmt.Sprint(balances) {
+			t.Errorf("Expected the exported chain, got %s with %v", Blockchain().NewestHash, utxoBalances())
+		}
+		if n, err := ImportChain(bytes.NewReader(data)); err != nil || n != 0 { // 이미 가지고 있는 block은 건너뜀
+			t.Errorf("Expected nothing new, got %d %v", n, err)
+		}
+	})
+
+	db.Close()
+	newTestChain(t)
+
+	t.Run("corrupt or invalid files", func(t *testing.T) {
+		genesis := testGenesis(testRecipient)
+		next := testBlock(genesis, testRecipient)
+		overpaid := *next
+		overpaid.Transactions = []*Tx{makeCoinbaseTx(testRecipient, next.Height, 0)}
+		overpaid.Transactions[0].TxOuts[0].Amount = 2 * minerReward
+		overpaid.MerkleRoot = merkleRoot(overpaid.Transactions)
+		overpaid.mine()
+
+		corrupt := testChainFile(t, 2, genesis, next).Bytes()
+		corrupt[len(corrupt)-2] ^= 0xff // 마지막 block frame의 payload
+		tests := []struct {
+			name string
+			data []byte
+			err  error
+		}{
+			{"not a chain file", []byte("not a chain file"), ErrChainFileNotValid},
+			{"corrupt frame", corrupt, codec.ErrBadChecksum},
+			{"invalid block", testChainFile(t, 2, genesis, &overpaid).Bytes(), ErrBlockNotValid},
+			{"truncated", testChainFile(t, 2, genesis).Bytes(), ErrChainFileTruncated},
+		}
+		for _, test := range tests {
+			if _, err := ImportChain(bytes.NewReader(test.data)); !errors.Is(err, test.err) {
+				t.Errorf("%s: Expected %v, got %v", test.name, test.err, err)
+			}
+		}
+		if chain := Blockchain(); chain.NewestHash != genesis.Hash || chain.Height != 1 {
+			t.Errorf("Expected only the valid genesis block, got %s at %d", chain.NewestHash, chain.Height)
+		}
+	})
+}
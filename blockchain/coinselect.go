@@ -0,0 +1,289 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+//tx에 사용할 TxOut을 고르는 방법의 이름. tx를 만들 때마다 고를 수 있음.
+const (
+	LargestFirst   string = "largest-first"    // 큰 TxOut부터 사용해서 TxIn 수와 fee가 적음
+	SmallestFirst  string = "smallest-first"   // 작은 TxOut부터 사용해서 작은 TxOut들을 정리함
+	BranchAndBound string = "branch-and-bound" // change가 필요 없는 조합을 찾고 없으면 largest-first
+	RandomImprove  string = "random-improve"   // 무작위로 고르고 change가 보내는 금액과 비슷해지도록 더 고름
+)
+
+//fee를 계산할 때 어림한 tx의 크기(byte).
+const (
+	txBaseSize int = 48  // tx id, timestamp와 TxIn, TxOut의 수
+	txInSize   int = 133 // tx id 32, index 4, signature 64, 압축한 public key 33
+	txOutSize  int = 33  // address 25, amount 8
+
+	bnbMaxTries int = 100000 // branch-and-bound에서 확인하는 조합의 최대 수
+)
+
+var ErrUnknownStrategy = errors.New("unknown coin selection strategy")
+var ErrCoinNotSpendable = errors.New("coin is not a spendable TxOut of the wallet")
+var ErrDustAmount = errors.New("amount is not more than the fee to spend it")
+var ErrFeeRate = errors.New("fee rate cannot be negative")
+
+//wallet이 사용할 수 있는 TxOut과 그 TxOut을 받은 address.
+type Coin struct {
+	UTxOut
+	Address string `json:"address"`
+}
+
+//보낼 금액과 fee. fee는 tx 크기 1000 byte마다 FeeRate이고 tx를 block에 넣은 채굴자가 coinbase로 받음.
+type CoinTarget struct {
+	Amount  int // 받는 사람들에게 보내는 금액의 합
+	Outputs int // 받는 사람 TxOut의 수
+	FeeRate int
+}
+
+//고른 TxOut들과 fee. Change가 0이면 change TxOut을 만들지 않음.
+type Selection struct {
+	Coins  []*Coin
+	Fee    int
+	Change int
+}
+
+//target의 금액과 fee를 낼 수 있도록 coins 중에서 사용할 TxOut들을 고름. 부족하면 ErrorNotFund.
+//change와 fee는 selectCoins가 계산하므로 fee를 낼 수 있는 만큼만 고르면 됨.
+type CoinSelector interface {
+	SelectCoins(coins []*Coin, target CoinTarget) ([]*Coin, error)
+}
+
+var coinSelectors = map[string]CoinSelector{
+	LargestFirst:   largestFirst{},
+	SmallestFirst:  smallestFirst{},
+	BranchAndBound: branchAndBound{},
+	RandomImprove:  randomImprove{},
+}
+
+//이름으로 coin selector를 찾음. 비어있으면 largest-first.
+func coinSelector(strategy string) (CoinSelector, error) {
+	if strategy == "" {
+		strategy = LargestFirst
+	}
+	selector, ok := coinSelectors[strategy]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownStrategy, strategy)
+	}
+	return selector, nil
+}
+
+//inputs개의 TxIn이 있는 tx의 크기. change이면 change TxOut도 있음.
+func (t CoinTarget) size(inputs int, change bool) int {
+	outputs := t.Outputs
+	if change {
+		outputs++
+	}
+	return txBaseSize + inputs*txInSize + outputs*txOutSize
+}
+
+func (t CoinTarget) fee(inputs int, change bool) int {
+	return (t.FeeRate*t.size(inputs, change) + 999) / 1000
+}
+
+//이 금액 이하의 TxOut은 사용할 때 내는 fee가 더 크므로 만들거나 사용하지 않음. fee가 0이면 0.
+func (t CoinTarget) dust() int {
+	return (t.FeeRate*txInSize + 999) / 1000
+}
+
+//inputs개의 TxOut의 합 total로 change 없이 보낼 수 있는지.
+func (t CoinTarget) covered(total int, inputs int) bool {
+	return total >= t.Amount+t.fee(inputs, false)
+}
+
+//selector로 coins 중에서 TxOut을 고르고 fee와 change를 계산함.
+func selectCoins(selector CoinSelector, coins []*Coin, target CoinTarget) (*Selection, error) {
+	if err := target.check(); err != nil {
+		return nil, err
+	}
+	selected, err := selector.SelectCoins(coins, target)
+	if err != nil {
+		return nil, err
+	}
+	return finishSelection(selected, target)
+}
+
+//coin control. coins 중에서 outpoints("txID:index")의 TxOut만 모두 사용함. wallet이 사용할 수 없는 TxOut이면 ErrCoinNotSpendable.
+func selectOutpoints(coins []*Coin, outpoints []string, target CoinTarget) (*Selection, error) {
+	if err := target.check(); err != nil {
+		return nil, err
+	}
+	spendable := make(map[string]*Coin)
+	for _, coin := range coins {
+		spendable[utxoKey(coin.TxID, coin.Index)] = coin
+	}
+	var selected []*Coin
+	for _, outpoint := range outpoints {
+		coin, ok := spendable[outpoint]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrCoinNotSpendable, outpoint)
+		}
+		delete(spendable, outpoint) // 같은 TxOut을 두 번 쓰지 않도록
+		selected = append(selected, coin)
+	}
+	return finishSelection(selected, target)
+}
+
+func (t CoinTarget) check() error {
+	if t.FeeRate < 0 {
+		return ErrFeeRate
+	}
+	if t.Amount <= t.dust() {
+		return ErrDustAmount
+	}
+	return nil
+}
+
+//고른 TxOut들로 fee를 내고 남은 금액이 dust보다 크면 change로 돌려받고 아니면 fee로 줌.
+func finishSelection(selected []*Coin, target CoinTarget) (*Selection, error) {
+	total := 0
+	for _, coin := range selected {
+		total += coin.Amount
+	}
+	if len(selected) == 0 || !target.covered(total, len(selected)) {
+		return nil, ErrorNotFund
+	}
+	s := &Selection{Coins: selected}
+	if change := total - target.Amount - target.fee(len(selected), true); change > target.dust() {
+		s.Change = change
+		s.Fee = target.fee(len(selected), true)
+	} else {
+		s.Fee = total - target.Amount
+	}
+	return s, nil
+}
+
+//coins의 순서대로 금액과 fee를 낼 수 있을 때까지 고름. dust인 TxOut은 사용하지 않음.
+func accumulate(coins []*Coin, target CoinTarget) ([]*Coin, error) {
+	var selected []*Coin
+	total := 0
+	for _, coin := range coins {
+		if coin.Amount <= target.dust() {
+			continue
+		}
+		selected = append(selected, coin)
+		total += coin.Amount
+		if target.covered(total, len(selected)) {
+			return selected, nil
+		}
+	}
+	return nil, ErrorNotFund
+}
+
+//coins를 복사해서 정렬함. 금액이 같으면 원래 순서를 유지함.
+func sortedCoins(coins []*Coin, less func(a, b *Coin) bool) []*Coin {
+	sorted := append([]*Coin(nil), coins...)
+	sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	return sorted
+}
+
+type largestFirst struct{}
+
+func (largestFirst) SelectCoins(coins []*Coin, target CoinTarget) ([]*Coin, error) {
+	return accumulate(sortedCoins(coins, func(a, b *Coin) bool { return a.Amount > b.Amount }), target)
+}
+
+type smallestFirst struct{}
+
+func (smallestFirst) SelectCoins(coins []*Coin, target CoinTarget) ([]*Coin, error) {
+	return accumulate(sortedCoins(coins, func(a, b *Coin) bool { return a.Amount < b.Amount }), target)
+}
+
+//change TxOut이 필요 없는 조합을 depth first로 찾음. 합에서 fee를 뺀 금액이 보낼 금액부터 change를 만들고 사용하는 fee까지 사이이면
+//change 대신 남는 금액을 fee로 줌. 그 중 남는 금액이 가장 적은 조합을 고름. fee가 0이면 정확히 같은 금액만 찾음.
+//찾지 못하면 largest-first로 고름.
+type branchAndBound struct{}
+
+func (branchAndBound) SelectCoins(coins []*Coin, target CoinTarget) ([]*Coin, error) {
+	// 1000 byte당 fee를 정수로 계산하기 위해 금액을 1000배 함
+	effective := func(coin *Coin) int { return coin.Amount*1000 - target.FeeRate*txInSize }
+	var pool []*Coin
+	for _, coin := range sortedCoins(coins, func(a, b *Coin) bool { return a.Amount > b.Amount }) {
+		if effective(coin) > 0 {
+			pool = append(pool, coin)
+		}
+	}
+	low := target.Amount*1000 + target.FeeRate*target.size(0, false)
+	high := low + target.FeeRate*(txOutSize+txInSize)
+	remaining := make([]int, len(pool)+1) // remaining[i]는 pool[i:]의 effective 합
+	for i := len(pool) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + effective(pool[i])
+	}
+
+	tries, bestWaste := 0, -1
+	var best []*Coin
+	var selected []*Coin
+	var search func(i int, sum int)
+	search = func(i int, sum int) {
+		tries++
+		if tries > bnbMaxTries || sum > high || sum+remaining[i] < low {
+			return
+		}
+		if sum >= low {
+			if waste := sum - low; bestWaste < 0 || waste < bestWaste {
+				bestWaste = waste
+				best = append([]*Coin(nil), selected...)
+			}
+			return
+		}
+		if i == len(pool) {
+			return
+		}
+		selected = append(selected, pool[i])
+		search(i+1, sum+effective(pool[i]))
+		selected = selected[:len(selected)-1]
+		search(i+1, sum)
+	}
+	search(0, 0)
+	if best == nil {
+		return largestFirst{}.SelectCoins(coins, target)
+	}
+	return best, nil
+}
+
+//무작위로 금액을 채운 후, fee를 뺀 합이 보낼 금액의 2배에 가까워지고 3배를 넘지 않는 동안 무작위로 더 고름.
+//change가 보내는 금액과 비슷해져서 다음에 비슷한 금액을 보낼 때 쓸 수 있는 TxOut이 남음.
+type randomImprove struct{}
+
+func (randomImprove) SelectCoins(coins []*Coin, target CoinTarget) ([]*Coin, error) {
+	pool := append([]*Coin(nil), coins...)
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	random.Shuffle(len(pool), func(i, j int) { pool[i], pool[j] = pool[j], pool[i] })
+	selected, err := accumulate(pool, target)
+	if err != nil {
+		return nil, err
+	}
+
+	chosen := make(map[*Coin]bool)
+	total := 0
+	for _, coin := range selected {
+		chosen[coin] = true
+		total += coin.Amount
+	}
+	distance := func(total int, inputs int) int {
+		d := 2*target.Amount - (total - target.fee(inputs, true))
+		if d < 0 {
+			return -d
+		}
+		return d
+	}
+	for _, coin := range pool {
+		if chosen[coin] || coin.Amount <= target.dust() {
+			continue
+		}
+		next := total + coin.Amount
+		if next-target.fee(len(selected)+1, true) > 3*target.Amount || distance(next, len(selected)+1) >= distance(total, len(selected)) {
+			break
+		}
+		selected = append(selected, coin)
+		total = next
+	}
+	return selected, nil
+}
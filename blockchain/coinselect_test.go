@@ -0,0 +1,214 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/yyuurriiaa/ProjectMSSP/wallet"
+)
+
+func makeCoins(amounts ...int) []*Coin {
+	var coins []*Coin
+	for i, amount := range amounts {
+		coins = append(coins, &Coin{UTxOut: UTxOut{TxID: fmt.Sprint("tx", i), Index: 0, Amount: amount}, Address: "me"})
+	}
+	return coins
+}
+
+func amountsOf(coins []*Coin) []int {
+	var amounts []int
+	for _, coin := range coins {
+		amounts = append(amounts, coin.Amount)
+	}
+	return amounts
+}
+
+func TestCoinSelection(t *testing.T) {
+	coins := makeCoins(5, 50, 20, 3, 10)
+
+	tests := []struct {
+		strategy string
+		amount   int
+		selected string
+		change   int
+	}{
+		{LargestFirst, 30, "[50]", 20},
+		{SmallestFirst, 30, "[3 5 10 20]", 8},
+		{BranchAndBound, 30, "[20 10]", 0}, // change가 필요 없는 조합
+		{BranchAndBound, 83, "[50 20 10 3]", 0},
+		{BranchAndBound, 49, "[50]", 1}, // 정확한 조합이 없으면 largest-first
+	}
+	for _, test := range tests {
+		selector, err := coinSelector(test.strategy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := selectCoins(selector, coins, CoinTarget{Amount: test.amount, Outputs: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(amountsOf(s.Coins)); got != test.selected || s.Change != test.change || s.Fee != 0 {
+			t.Errorf("%s %d: Expected %s with change %d, got %s with change %d fee %d", test.strategy, test.amount, test.selected, test.change, got, s.Change, s.Fee)
+		}
+	}
+
+	t.Run("not enough funds", func(t *testing.T) {
+		for strategy, selector := range coinSelectors {
+			if _, err := selectCoins(selector, coins, CoinTarget{Amount: 89, Outputs: 1}); err != ErrorNotFund {
+				t.Errorf("%s: Expected ErrorNotFund, got %v", strategy, err)
+			}
+		}
+	})
+
+	t.Run("unknown strategy", func(t *testing.T) {
+		if _, err := coinSelector("first-fit"); !errors.Is(err, ErrUnknownStrategy) {
+			t.Errorf("Expected ErrUnknownStrategy, got %v", err)
+		}
+	})
+
+	t.Run("fees and dust", func(t *testing.T) {
+		target := CoinTarget{Amount: 30, Outputs: 1, FeeRate: 10} // TxIn 하나의 fee가 2이므로 2 이하는 dust
+		if target.dust() != 2 {
+			t.Fatalf("Expected dust of 2, got %d", target.dust())
+		}
+		s, err := selectCoins(smallestFirst{}, makeCoins(2, 1, 31, 40), target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 31은 fee(1 TxIn, 1 TxOut = 214 byte → 3)를 내지 못하므로 40을 더함. change는 2개의 TxOut이 있는 fee 4를 뺀 37
+		if got := fmt.Sprint(amountsOf(s.Coins)); got != "[31 40]" || s.Fee != 4 || s.Change != 37 {
+			t.Errorf("Expected [31 40] with fee 4 and change 37, got %s fee %d change %d", got, s.Fee, s.Change)
+		}
+		s, err = selectCoins(largestFirst{}, makeCoins(35), target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Change != 0 || s.Fee != 5 { // change 1은 dust이므로 fee로 줌
+			t.Errorf("Expected the dust change to be the fee, got fee %d change %d", s.Fee, s.Change)
+		}
+		if _, err := selectCoins(largestFirst{}, makeCoins(35), CoinTarget{Amount: 2, Outputs: 1, FeeRate: 10}); err != ErrDustAmount {
+			t.Errorf("Expected ErrDustAmount, got %v", err)
+		}
+	})
+
+	t.Run("random improve", func(t *testing.T) {
+		many := makeCoins(10, 10, 10, 10, 10, 10, 10, 10, 10, 10)
+		for i := 0; i < 20; i++ {
+			s, err := selectCoins(randomImprove{}, many, CoinTarget{Amount: 20, Outputs: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(s.Coins) != 4 || s.Change != 20 { // 보낼 금액의 2배까지 고름
+				t.Errorf("Expected change close to the amount, got %v change %d", amountsOf(s.Coins), s.Change)
+			}
+		}
+	})
+
+	t.Run("coin control", func(t *testing.T) {
+		s, err := selectOutpoints(coins, []string{"tx0:0", "tx2:0"}, CoinTarget{Amount: 10, Outputs: 1})
+		if err != nil || fmt.Sprint(amountsOf(s.Coins)) != "[5 20]" || s.Change != 15 {
+			t.Errorf("Expected the listed coins, got %+v %v", s, err)
+		}
+		if _, err := selectOutpoints(coins, []string{"tx0:0", "tx0:0"}, CoinTarget{Amount: 1, Outputs: 1}); !errors.Is(err, ErrCoinNotSpendable) {
+			t.Errorf("Expected ErrCoinNotSpendable for a coin listed twice, got %v", err)
+		}
+		if _, err := selectOutpoints(coins, []string{"tx9:0"}, CoinTarget{Amount: 1, Outputs: 1}); !errors.Is(err, ErrCoinNotSpendable) {
+			t.Errorf("Expected ErrCoinNotSpendable, got %v", err)
+		}
+		if _, err := selectOutpoints(coins, []string{"tx3:0"}, CoinTarget{Amount: 10, Outputs: 1}); err != ErrorNotFund {
+			t.Errorf("Expected ErrorNotFund, got %v", err)
+		}
+	})
+}
+
+func TestCheckOutputs(t *testing.T) {
+	alice, bob := "M93wFBKSudzvJBb52xkAuFLWqtL9X87fdC", testRecipient
+	outputs := []*TxOut{{alice, 20}, {bob, 30}, {alice, 5}}
+	total, err := checkOutputs(outputs, 0)
+	if err != nil || total != 55 {
+		t.Fatalf("Expected a total of 55, got %d %v", total, err)
+	}
+	target := CoinTarget{Amount: total, Outputs: len(outputs), FeeRate: 10}
+	s, err := selectCoins(largestFirst{}, makeCoins(5, 50, 20, 3, 10), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Fee != target.fee(len(s.Coins), true) || target.size(len(s.Coins), true) != txBaseSize+2*txInSize+4*txOutSize {
+		t.Errorf("Expected the fee of two inputs, three outputs and one change, got %+v", s)
+	}
+
+	invalid := []struct {
+		outputs []*TxOut
+		dust    int
+		err     error
+	}{
+		{nil, 0, ErrNoRecipients},
+		{make([]*TxOut, maxTxOuts+1), 0, ErrTooManyRecipients},
+		{[]*TxOut{{alice, 60}, {bob, -10}}, 0, ErrInvalidAmount}, // 음수로 합을 맞출 수 없음
+		{[]*TxOut{{alice, 60}, {bob, 0}}, 0, ErrInvalidAmount},
+		{[]*TxOut{{alice, 60}, {bob, 3}}, 3, ErrDustAmount},
+		{[]*TxOut{{alice, math.MaxInt}, {bob, 1}}, 0, ErrorNotFund},
+		{[]*TxOut{{alice, 10}, {bob[:len(bob)-1] + "D", 10}}, 0, wallet.ErrAddressChecksum},
+	}
+	for _, test := range invalid {
+		if _, err := checkOutputs(test.outputs, test.dust); !errors.Is(err, test.err) {
+			t.Errorf("Expected %v, got %v", test.err, err)
+		}
+	}
+}
+
+func TestBuildTx(t *testing.T) {
+	newTestChain(t)
+	for i := 0; i < 3; i++ {
+		Blockchain().AddBlock()
+	}
+	alice := "M93wFBKSudzvJBb52xkAuFLWqtL9X87fdC"
+	outputs := []*TxOut{{alice, 20}, {testRecipient, 60}, {alice, 5}}
+
+	tx, s, err := buildTx(wallet.DefaultName, outputs, SendOptions{FeeRate: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipients := map[string]bool{alice: true, testRecipient: true}
+	var change []*TxOut
+	var paid []*TxOut
+	for _, txOut := range tx.TxOuts {
+		if recipients[txOut.Address] {
+			paid = append(paid, txOut)
+		} else {
+			change = append(change, txOut)
+		}
+	}
+	if len(paid) != len(outputs) {
+		t.Fatalf("Expected %d recipients to be paid, got %d", len(outputs), len(paid))
+	}
+	for i, txOut := range paid {
+		if *txOut != *outputs[i] {
+			t.Errorf("Expected %+v to be paid, got %+v", *outputs[i], *txOut)
+		}
+	}
+	if len(change) != 1 || change[0].Amount != s.Change || s.Change == 0 {
+		t.Fatalf("Expected one change output of %d, got %v", s.Change, change)
+	}
+
+	if len(tx.TxIns) != len(s.Coins) {
+		t.Fatalf("Expected %d inputs, got %d", len(s.Coins), len(tx.TxIns))
+	}
+	in := 0
+	for i, txIn := range tx.TxIns {
+		if txIn.TxID != s.Coins[i].TxID || txIn.Index != s.Coins[i].Index {
+			t.Errorf("input %d: Expected %s:%d, got %s:%d", i, s.Coins[i].TxID, s.Coins[i].Index, txIn.TxID, txIn.Index)
+		}
+		in += FindUTxO(txIn.TxID, txIn.Index).Amount
+	}
+	out := 0
+	for _, txOut := range tx.TxOuts {
+		out += txOut.Amount
+	}
+	target := CoinTarget{Outputs: len(outputs), FeeRate: 10}
+	if in-out != s.Fee || s.Fee != target.fee(len(tx.TxIns), true) {
+		t.Errorf("Expected a fee of %d, got %d in the tx and %d returned", target.fee(len(tx.TxIns), true), in-out, s.Fee)
+	}
+}
@@ -0,0 +1,131 @@
+package blockchain
+
+import (
+	"errors"
+
+	"github.com/yyuurriiaa/ProjectMSSP/utils"
+)
+
+const (
+	shortIDLength int = 12     // short tx id의 길이(hex). 6 byte
+	maxCompactTxs int = 100000 // compact block 하나에 들어갈 수 있는 최대 tx 수
+)
+
+//새 block을 알릴 때 tx 전체 대신 header와 short tx id만 보내는 block.
+//받는 peer는 대부분의 tx를 이미 mempool에 가지고 있으므로 short id로 mempool에서 찾아서 block을 다시 만듬.
+type CompactBlock struct {
+	Header    *Header       `json:"header"`
+	ShortIDs  []string      `json:"shortIds"`  // Prefilled를 제외한 tx들의 short id. block 안의 순서대로
+	Prefilled []PrefilledTx `json:"prefilled"` // 받는 peer가 가지고 있을 수 없는 tx(coinbase)는 그대로 보냄
+}
+
+type PrefilledTx struct {
+	Index int `json:"index"` // block 안에서의 위치
+	Tx    *Tx `json:"tx"`
+}
+
+var ErrCompactNotValid = errors.New("compact block not valid")
+
+//block hash와 tx id로 만든 short tx id. block마다 달라지므로 다른 block에서 충돌한 short id가 계속 충돌하지 않음.
+func shortTxID(blockHash string, txID string) string {
+	return utils.GetHash(blockHash + txID)[:shortIDLength]
+}
+
+//block을 compact block으로 변환. coinbase tx는 Prefilled로 그대로 보냄.
+func NewCompactBlock(b *Block) *CompactBlock {
+	cb := &CompactBlock{
+		Header: b.Header(),
+	}
+	for i, tx := range b.Transactions {
+		if isCoinbase(tx) {
+			cb.Prefilled = append(cb.Prefilled, PrefilledTx{Index: i, Tx: tx})
+			continue
+		}
+		cb.ShortIDs = append(cb.ShortIDs, shortTxID(b.Hash, tx.Id))
+	}
+	return cb
+}
+
+//compact block의 short id로 mempool에서 tx를 찾아서 block을 다시 만듬.
+//찾지 못한 tx의 위치는 nil로 남겨두고 그 위치들을 리턴. 모든 tx를 찾았는지는 CheckMerkleRoot로 확인해야함.
+func ReconstructBlock(cb *CompactBlock) (*Block, []int, error) {
+	if cb == nil || cb.Header == nil {
+		return nil, nil, ErrCompactNotValid
+	}
+	total := len(cb.ShortIDs) + len(cb.Prefilled)
+	if total > maxCompactTxs {
+		return nil, nil, ErrCompactNotValid
+	}
+	txs := make([]*Tx, total)
+	for _, prefilled := range cb.Prefilled {
+		if prefilled.Index < 0 || prefilled.Index >= total || txs[prefilled.Index] != nil || prefilled.Tx == nil {
+			return nil, nil, ErrCompactNotValid
+		}
+		txs[prefilled.Index] = prefilled.Tx
+	}
+
+	byShortID := mempoolByShortID(cb.Header.Hash)
+	var missing []int
+	next := 0
+	for i := range txs {
+		if txs[i] != nil {
+			continue
+		}
+		tx, ok := byShortID[cb.ShortIDs[next]]
+		next++
+		if !ok || tx == nil { // mempool에 없거나 같은 short id를 가진 tx가 여럿이면 요청해야함
+			missing = append(missing, i)
+			continue
+		}
+		txs[i] = tx
+	}
+
+	h := cb.Header
+	block := &Block{
+		Transactions: txs,
+		Hash:         h.Hash,
+		PrevHash:     h.PrevHash,
+		Height:       h.Height,
+		Difficulty:   h.Difficulty,
+		Nonce:        h.Nonce,
+		Timestamp:    h.Timestamp,
+		MerkleRoot:   h.MerkleRoot,
+	}
+	return block, missing, nil
+}
+
+//ReconstructBlock에서 찾지 못한 missing 위치에 peer에게 받은 txs를 채움.
+func FillBlock(block *Block, missing []int, txs []*Tx) error {
+	if len(missing) != len(txs) {
+		return ErrCompactNotValid
+	}
+	for i, index := range missing {
+		if index < 0 || index >= len(block.Transactions) || txs[i] == nil {
+			return ErrCompactNotValid
+		}
+		block.Transactions[index] = txs[i]
+	}
+	return nil
+}
+
+//mempool의 tx들을 blockHash로 만든 short id로 찾을 수 있게 map으로 만듬. 충돌한 short id는 nil.
+func mempoolByShortID(blockHash string) map[string]*Tx {
+	m := Mempool()
+	m.m.Lock()
+	defer m.m.Unlock()
+	byShortID := make(map[string]*Tx)
+	for _, tx := range m.Txs {
+		id := shortTxID(blockHash, tx.Id)
+		if _, ok := byShortID[id]; ok {
+			byShortID[id] = nil
+			continue
+		}
+		byShortID[id] = tx
+	}
+	return byShortID
+}
+
+//coinbase tx인지 확인.
+func isCoinbase(tx *Tx) bool {
+	return len(tx.TxIns) == 1 && tx.TxIns[0].Signature == "COINBASE"
+}
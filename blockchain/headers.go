@@ -0,0 +1,181 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/yyuurriiaa/ProjectMSSP/db"
+	"github.com/yyuurriiaa/ProjectMSSP/utils"
+)
+
+const MaxHeaders int = 2000 // 한번에 주고받는 header의 최대 수
+
+//light node가 가지는 header만으로 된 chain. block 대신 header를 db에 저장함.
+type headerChain struct {
+	NewestHash     string `json:"newestHash"`
+	Height         int    `json:"height"`
+	CurrDifficulty int    `json:"currDifficulty"`
+	Scanned        int    `json:"scanned"` // 이 height까지의 block에서 wallet tx를 받았음
+	m              sync.Mutex
+}
+
+var ErrHeaderNotValid = errors.New("header not valid")
+var ErrHeaderNotConnectable = errors.New("header does not extend the newest header")
+
+var hc *headerChain
+var headersOnce sync.Once
+
+//singleton으로 header chain 초기화. db에 저장된 header chain이 있으면 불러옴.
+func Headers() *headerChain {
+	headersOnce.Do(func() {
+		hc = &headerChain{}
+		if data := db.HeaderChain(); data != nil {
+			utils.FromBytes(hc, data)
+		}
+	})
+	return hc
+}
+
+//header chain을 보여줌.
+func HeaderStatus(h *headerChain, rw http.ResponseWriter) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	utils.HandleErr(json.NewEncoder(rw).Encode(h))
+}
+
+//hash를 가지는 header를 db에서 찾음. 없으면 nil.
+func FindHeader(hash string) *Header {
+	data := db.Header(hash)
+	if data == nil {
+		return nil
+	}
+	header := &Header{}
+	utils.FromBytes(header, data)
+	return header
+}
+
+//peer에게 받은 headers를 header chain에 연결. headers는 오래된 것부터 순서대로 있어야함.
+//가장 최근 header에 이어지면 하나씩 검증해서 연결하고, genesis부터 시작하는 더 긴 chain이면 header chain을 바꿈.
+//검증에 실패하면 그 전까지 연결된 header는 그대로 두고 ErrHeaderNotValid를 리턴.
+func (h *headerChain) AddHeaders(headers []*Header) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+	all := headers
+	for len(headers) > 0 && FindHeader(headers[0].Hash) != nil { // 이미 가지고 있는 header
+		headers = headers[1:]
+	}
+	if len(headers) == 0 {
+		return nil
+	}
+	if headers[0].PrevHash == h.NewestHash {
+		defer persistHeaderChain(h)
+		for _, header := range headers {
+			if err := h.verifyNext(header, FindHeader); err != nil {
+				return err
+			}
+			db.SaveHeader(header.Hash, utils.ToBytes(header))
+			h.connect(header)
+		}
+		return nil
+	}
+	if all[0].PrevHash != "" {
+		return ErrHeaderNotConnectable
+	}
+	return h.replace(all) // 가지고 있는 header가 앞부분에 있을 수 있으므로 genesis부터 모두 사용
+
+}
+
+//genesis부터 시작하는 headers를 검증하고 지금의 header chain보다 길면 header chain을 바꿈. 이전 chain의 wallet tx도 지움.
+func (h *headerChain) replace(headers []*Header) error {
+	if len(headers) <= h.Height {
+		return nil
+	}
+	candidate := &headerChain{}
+	batch := make(map[string]*Header)
+	for _, header := range headers {
+		if err := candidate.verifyNext(header, func(hash string) *Header { return batch[hash] }); err != nil {
+			return err
+		}
+		batch[header.Hash] = header
+		candidate.connect(header)
+	}
+	save := db.NewBatch() // header를 비운 상태로 header chain이 남지 않도록 한번에 저장
+	save.EmptyHeaders()
+	for _, header := range headers {
+		save.SaveHeader(header.Hash, utils.ToBytes(header))
+	}
+	h.NewestHash = candidate.NewestHash
+	h.Height = candidate.Height
+	h.CurrDifficulty = candidate.CurrDifficulty
+	h.Scanned = 0
+	save.SaveHeaderChain(utils.ToBytes(h))
+	save.Commit()
+	watch().reorg(nil, nil) // wallet tx는 새 chain에서 다시 받음
+	return nil
+}
+
+//header가 h의 가장 최근 header 다음에 올 수 있는지 검증. 이전 header와 이어지는지, 난이도가 맞는지, hash가 난이도를 만족하는지 확인.
+func (h *headerChain) verifyNext(header *Header, find func(hash string) *Header) error {
+	if header.PrevHash != h.NewestHash || header.Height != h.Height+1 {
+		return ErrHeaderNotValid
+	}
+	if header.Difficulty != h.nextDifficulty(find) {
+		return ErrHeaderNotValid
+	}
+	if header.calculateHash() != header.Hash && !legacyHeader(header) || !strings.HasPrefix(header.Hash, strings.Repeat("0", header.Difficulty)) {
+		return ErrHeaderNotValid
+	}
+	return nil
+}
+
+//다음 header가 가져야하는 난이도. blockchain의 difficulty와 같은 계산을 header로 함.
+func (h *headerChain) nextDifficulty(find func(hash string) *Header) int {
+	if h.Height == 0 {
+		return defaultDifficulty
+	}
+	if h.Height%difficultyInterval != 0 {
+		return h.CurrDifficulty
+	}
+	newest := find(h.NewestHash)
+	lastCalculated := newest
+	for i := 0; i < difficultyInterval-1 && lastCalculated != nil; i++ {
+		lastCalculated = find(lastCalculated.PrevHash)
+	}
+	if newest == nil || lastCalculated == nil {
+		return h.CurrDifficulty
+	}
+	return adjustDifficulty(h.CurrDifficulty, newest.Timestamp, lastCalculated.Timestamp)
+}
+
+//header를 h의 가장 최근 header로 만듬. db에 저장하지는 않음.
+func (h *headerChain) connect(header *Header) {
+	h.NewestHash = header.Hash
+	h.Height = header.Height
+	h.CurrDifficulty = header.Difficulty
+}
+
+//header chain을 []byte로 변환시켜서 db에 저장.
+func persistHeaderChain(h *headerChain) {
+	db.SaveHeaderChain(utils.ToBytes(h))
+}
+
+//hash 다음의 block header들을 오래된 것부터 최대 max개 리턴. hash를 가지는 block이 없으면 genesis부터 리턴.
+//full node가 light node의 header 요청에 답할 때 사용.
+func HeadersAfter(b *blockchain, hash string, max int) []*Header {
+	blocks := Blocks(b)
+	start := len(blocks) - 1 // genesis
+	for i, block := range blocks {
+		if block.Hash == hash {
+			start = i - 1
+			break
+		}
+	}
+	var headers []*Header
+	for i := start; i >= 0 && len(headers) < max; i-- {
+		headers = append(headers, blocks[i].Header())
+	}
+	return headers
+}
@@ -0,0 +1,150 @@
+package blockchain
+
+import "sort"
+
+//wallet에서 본 tx의 종류.
+const (
+	HistoryReceived string = "received" // 다른 address에게 받음
+	HistorySent     string = "sent"     // 다른 address에게 보냄
+	HistorySelf     string = "self"     // wallet의 address끼리 보냄. Amount는 -Fee
+	HistoryMined    string = "mined"    // coinbase tx로 채굴 보상을 받음
+)
+
+//wallet의 address들이 받거나 보낸 tx. Amount는 tx로 바뀐 wallet의 잔액이고 보냈으면 fee를 포함한 음수.
+type HistoryTx struct {
+	TxID           string   `json:"txID"`
+	Direction      string   `json:"direction"`
+	Amount         int      `json:"amount"`
+	Fee            int      `json:"fee"`                      // wallet이 낸 fee. 받은 tx는 0
+	Counterparties []string `json:"counterparties,omitempty"` // 보냈으면 받은 address, 받았으면 보낸 address. 찾지 못하면 비어있음
+	Height         int      `json:"height"`                   // 아직 block에 없으면 0
+	Confirmations  int      `json:"confirmations"`            // tx가 들어간 block부터 최신 block까지 block의 수
+	Timestamp      int      `json:"timestamp"`
+}
+
+//addresses가 받거나 보낸 tx들. mempool의 tx부터 최근 tx 순서. light node는 merkle proof로 확인한 wallet tx에서 찾음.
+//light node는 다른 address의 tx를 가지고 있지 않으므로 받은 tx의 보낸 address를 알 수 없음.
+//pruned node는 지운 block의 tx를 찾지 못하므로 지운 block에서 받은 TxOut을 보낸 금액도 계산하지 못함.
+func History(addresses []string) []*HistoryTx {
+	mine := make(map[string]bool)
+	for _, address := range addresses {
+		mine[address] = true
+	}
+	txOuts := make(map[string]*TxOut) // 지금까지 본 모든 TxOut. 보낸 address와 fee를 계산함. key는 utxoKey
+	var history []*HistoryTx
+	add := func(tx *Tx, height int) {
+		if h := historyOf(tx, height, mine, txOuts); h != nil {
+			history = append(history, h)
+		}
+	}
+
+	tip := 0
+	if Light() {
+		tip = Headers().Height
+		txs := lightTxs()
+		sort.SliceStable(txs, func(i, j int) bool { return txs[i].Height < txs[j].Height })
+		for _, tx := range txs {
+			add(tx.Tx, tx.Height)
+		}
+	} else {
+		blocks := Blocks(Blockchain())
+		if len(blocks) > 0 {
+			tip = blocks[0].Height
+		}
+		for i := len(blocks) - 1; i >= 0; i-- { // 오래된 block부터 봐야 받은 TxOut을 기억함
+			for _, tx := range blocks[i].Transactions {
+				add(tx, blocks[i].Height)
+			}
+		}
+	}
+	for _, tx := range mempoolTxs() {
+		add(tx, 0)
+	}
+	return newestFirst(history, tip)
+}
+
+//오래된 tx부터 있는 history를 최근 tx부터로 바꾸고 tip까지의 confirmation 수를 넣음.
+func newestFirst(history []*HistoryTx, tip int) []*HistoryTx {
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+	for _, h := range history {
+		if h.Height > 0 && tip >= h.Height {
+			h.Confirmations = tip - h.Height + 1
+		}
+	}
+	return history
+}
+
+//mine의 address가 받거나 보낸 tx이면 HistoryTx를 만듬. 아니면 nil.
+//txOuts는 이전 tx들의 TxOut으로 TxIn이 사용한 금액과 address를 찾고, tx의 TxOut을 추가함.
+func historyOf(tx *Tx, height int, mine map[string]bool, txOuts map[string]*TxOut) *HistoryTx {
+	spent, received, inputs, known := 0, 0, 0, true
+	var senders []string
+	for _, txIn := range tx.TxIns {
+		txOut, ok := txOuts[utxoKey(txIn.TxID, txIn.Index)]
+		if !ok {
+			known = false
+			continue
+		}
+		inputs += txOut.Amount
+		if mine[txOut.Address] {
+			spent += txOut.Amount
+		} else {
+			senders = appendUnique(senders, txOut.Address)
+		}
+	}
+	total, receivers := 0, []string(nil)
+	for index, txOut := range tx.TxOuts {
+		txOuts[utxoKey(tx.Id, index)] = txOut
+		total += txOut.Amount
+		if mine[txOut.Address] {
+			received += txOut.Amount
+		} else {
+			receivers = appendUnique(receivers, txOut.Address)
+		}
+	}
+	if spent == 0 && received == 0 {
+		return nil
+	}
+	h := &HistoryTx{TxID: tx.Id, Amount: received - spent, Height: height, Timestamp: tx.Timestamp}
+	switch {
+	case isCoinbase(tx):
+		h.Direction = HistoryMined
+	case spent == 0:
+		h.Direction = HistoryReceived
+		h.Counterparties = senders
+	case len(receivers) == 0:
+		h.Direction = HistorySelf
+	default:
+		h.Direction = HistorySent
+		h.Counterparties = receivers
+	}
+	if spent > 0 && known && inputs > total { // 보냈으면 사용한 TxOut을 모두 알 수 있으므로 fee를 계산할 수 있음
+		h.Fee = inputs - total
+	}
+	return h
+}
+
+//addresses에 address가 없으면 추가.
+func appendUnique(addresses []string, address string) []string {
+	for _, a := range addresses {
+		if a == address {
+			return addresses
+		}
+	}
+	return append(addresses, address)
+}
+
+//mempool의 tx들을 들어온 시간 순서로 리턴.
+func mempoolTxs() []*Tx {
+	m := Mempool()
+	m.m.Lock()
+	defer m.m.Unlock()
+	var txs []*Tx
+	for _, tx := range m.Txs {
+		txs = append(txs, tx)
+	}
+	sort.Slice(txs, func(i, j int) bool { return txs[i].Timestamp < txs[j].Timestamp })
+	return txs
+}
@@ -0,0 +1,46 @@
+package blockchain
+
+import "testing"
+
+func TestHistoryOf(t *testing.T) {
+	mine := map[string]bool{"me": true, "change": true}
+	txOuts := make(map[string]*TxOut)
+	txs := []*Tx{
+		{Id: "coinbase", TxIns: []*TxIn{{Index: 1, Signature: "COINBASE"}}, TxOuts: []*TxOut{{"me", 50}}},
+		{Id: "other", TxIns: []*TxIn{{Index: 2, Signature: "COINBASE"}}, TxOuts: []*TxOut{{"bob", 50}}},
+		{Id: "receive", TxIns: []*TxIn{{TxID: "other", Index: 0}}, TxOuts: []*TxOut{{"me", 30}, {"bob", 19}}},
+		{Id: "send", TxIns: []*TxIn{{TxID: "coinbase", Index: 0}}, TxOuts: []*TxOut{{"carol", 20}, {"change", 28}}},
+		{Id: "self", TxIns: []*TxIn{{TxID: "send", Index: 1}}, TxOuts: []*TxOut{{"me", 27}}},
+	}
+	expected := []struct {
+		direction      string
+		amount, fee    int
+		counterparties []string
+	}{
+		{HistoryMined, 50, 0, nil},
+		{},
+		{HistoryReceived, 30, 0, []string{"bob"}},
+		{HistorySent, -22, 2, []string{"carol"}},
+		{HistorySelf, -1, 1, nil},
+	}
+	for i, tx := range txs {
+		h := historyOf(tx, i+1, mine, txOuts)
+		if expected[i].direction == "" {
+			if h != nil {
+				t.Errorf("Expected %s not to be in the history", tx.Id)
+			}
+			continue
+		}
+		if h == nil || h.Direction != expected[i].direction || h.Amount != expected[i].amount || h.Fee != expected[i].fee ||
+			len(h.Counterparties) != len(expected[i].counterparties) || len(h.Counterparties) > 0 && h.Counterparties[0] != expected[i].counterparties[0] {
+			t.Errorf("Expected %+v for %s, got %+v", expected[i], tx.Id, h)
+		}
+	}
+
+	t.Run("unknown inputs have no fee", func(t *testing.T) {
+		tx := &Tx{Id: "pruned", TxIns: []*TxIn{{TxID: "self", Index: 0}, {TxID: "missing", Index: 0}}, TxOuts: []*TxOut{{"dave", 30}}}
+		if h := historyOf(tx, 6, mine, txOuts); h == nil || h.Amount != -27 || h.Fee != 0 {
+			t.Errorf("Expected -27 without a fee, got %+v", h)
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package blockchain
+
+import (
+	"errors"
+
+	"github.com/yyuurriiaa/ProjectMSSP/db"
+	"github.com/yyuurriiaa/ProjectMSSP/utils"
+)
+
+var lightMode bool
+
+var ErrProofNotValid = errors.New("merkle proof not valid")
+
+//merkle proof와 함께 보내는 tx. Index는 block 안에서의 위치.
+type ProvenTx struct {
+	Tx    *Tx      `json:"tx"`
+	Index int      `json:"index"`
+	Proof []string `json:"proof"`
+}
+
+//light node에게 보내는 block. header와 light node의 filter에 맞는 tx들만 merkle proof와 함께 보냄.
+type MerkleBlock struct {
+	Header *Header     `json:"header"`
+	Txs    []*ProvenTx `json:"txs"`
+}
+
+//light node가 merkle proof로 확인하고 저장한 wallet tx.
+type lightTx struct {
+	Tx        *Tx
+	BlockHash string
+	Height    int
+}
+
+//이 노드를 light node로 만듬. light node는 block 대신 header만 받고, wallet의 tx는 merkle proof로 확인함.
+func SetLight() {
+	lightMode = true
+}
+
+//light node인지 확인.
+func Light() bool {
+	return lightMode
+}
+
+//block에서 match가 true인 tx들만 merkle proof와 함께 담은 MerkleBlock을 만듬.
+func NewMerkleBlock(b *Block, match func(tx *Tx) bool) *MerkleBlock {
+	mb := &MerkleBlock{Header: b.Header()}
+	for i, tx := range b.Transactions {
+		if match(tx) {
+			mb.Txs = append(mb.Txs, &ProvenTx{Tx: tx, Index: i, Proof: merkleProof(b.Transactions, i)})
+		}
+	}
+	return mb
+}
+
+//peer에게 받은 MerkleBlock의 header를 header chain에 연결하고, tx들의 id와 merkle proof를 검증해서 저장.
+//header를 연결할 수 없으면 ErrHeaderNotConnectable을 리턴해서 header를 먼저 요청할 수 있게 함.
+func (h *headerChain) AddMerkleBlock(mb *MerkleBlock) error {
+	if mb.Header == nil {
+		return ErrHeaderNotValid
+	}
+	if err := h.AddHeaders([]*Header{mb.Header}); err != nil {
+		return err
+	}
+	header := FindHeader(mb.Header.Hash) // 검증된 header를 사용
+	if header == nil {
+		return ErrHeaderNotConnectable
+	}
+	for _, proven := range mb.Txs {
+		if proven == nil || proven.Tx == nil {
+			return ErrProofNotValid
+		}
+		if proven.Tx.Id != proven.Tx.calculateId() && (header.Height > db.TextIdHeight() || proven.Tx.Id != proven.Tx.textId()) { // 업그레이드 전의 block은 이전 형식의 id
+			return ErrProofNotValid
+		}
+		if !verifyMerkleProof(proven.Tx.Id, proven.Index, proven.Proof, header.MerkleRoot) {
+			return ErrProofNotValid
+		}
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+	m := Mempool()
+	m.m.Lock()
+	defer m.m.Unlock()
+	var txs []*Tx
+	for _, proven := range mb.Txs {
+		db.SaveLightTx(proven.Tx.Id, utils.ToBytes(&lightTx{Tx: proven.Tx, BlockHash: header.Hash, Height: header.Height}))
+		delete(m.Txs, proven.Tx.Id) // 보냈던 tx가 block에 들어감
+		txs = append(txs, proven.Tx)
+	}
+	if watch().connect(txs, header.Height, lightTxOutFinder()) {
+		go RefreshWatched()
+	}
+	if header.Height > h.Scanned {
+		h.Scanned = header.Height
+		persistHeaderChain(h)
+	}
+	return nil
+}
+
+//db에 저장된 light node의 wallet tx들.
+func lightTxs() []*lightTx {
+	var txs []*lightTx
+	for _, data := range db.LightTxs() {
+		tx := &lightTx{}
+		utils.FromBytes(tx, data)
+		txs = append(txs, tx)
+	}
+	return txs
+}
+
+//light node의 wallet tx와 mempool에서 id를 가지는 tx를 찾음.
+func findLightTx(id string) *Tx {
+	for _, tx := range lightTxs() {
+		if tx.Tx.Id == id {
+			return tx.Tx
+		}
+	}
+	return FindMempoolTx(Mempool(), id)
+}
+
+//light node가 merkle proof로 확인한 tx들에서 address의 uTxOuts를 찾음. mempool에서 이미 사용한 TxOut은 제외.
+func LightUTxOuts(address string) []*UTxOut {
+	txs := lightTxs()
+	m := Mempool()
+	m.m.Lock()
+	defer m.m.Unlock()
+	spent := make(map[UTxOut]bool)
+	for _, tx := range txs {
+		for _, input := range tx.Tx.TxIns {
+			spent[UTxOut{TxID: input.TxID, Index: input.Index}] = true
+		}
+	}
+	var uTxOuts []*UTxOut
+	for _, tx := range txs {
+		for index, output := range tx.Tx.TxOuts {
+			if output.Address != address || spent[UTxOut{TxID: tx.Tx.Id, Index: index}] {
+				continue
+			}
+			uTxOut := &UTxOut{
+				TxID:   tx.Tx.Id,
+				Index:  index,
+				Amount: output.Amount,
+			}
+			if !isOnMempool(uTxOut) {
+				uTxOuts = append(uTxOuts, uTxOut)
+			}
+		}
+	}
+	return uTxOuts
+}
+
+//light node에서 address의 uTxOuts의 amount를 모두 더한 값.
+func LightBalance(address string) int {
+	return sumAmount(LightUTxOuts(address))
+}
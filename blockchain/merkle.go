@@ -0,0 +1,88 @@
+package blockchain
+
+import "github.com/yyuurriiaa/ProjectMSSP/utils"
+
+//txs의 id로 merkle root를 만듬. 두개씩 짝지어서 hash하고, 홀수개이면 마지막 것을 한번 더 사용함. tx가 없으면 빈 문자열.
+func merkleRoot(txs []*Tx) string {
+	if len(txs) == 0 {
+		return ""
+	}
+	var level []string
+	for _, tx := range txs {
+		level = append(level, tx.Id)
+	}
+	for len(level) > 1 {
+		level = nextLevel(level)
+	}
+	return level[0]
+}
+
+//merkle tree의 한 level에서 두개씩 짝지어 hash한 윗 level. 홀수개이면 마지막 것을 한번 더 사용함.
+func nextLevel(level []string) []string {
+	if len(level)%2 == 1 {
+		level = append(level, level[len(level)-1])
+	}
+	var next []string
+	for i := 0; i < len(level); i += 2 {
+		next = append(next, hashPair(level[i], level[i+1]))
+	}
+	return next
+}
+
+//txs 중 index번째 tx가 merkle root에 포함되어 있음을 보여주는 merkle proof. 아래 level부터 형제 node의 hash들.
+func merkleProof(txs []*Tx, index int) []string {
+	var level []string
+	for _, tx := range txs {
+		level = append(level, tx.Id)
+	}
+	var proof []string
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		proof = append(proof, level[index^1]) // 짝수 index는 오른쪽, 홀수 index는 왼쪽 node가 형제
+		level = nextLevel(level)
+		index /= 2
+	}
+	return proof
+}
+
+//id를 가지는 tx가 index번째 위치에서 proof로 root를 만드는지 확인.
+func verifyMerkleProof(id string, index int, proof []string, root string) bool {
+	if index < 0 {
+		return false
+	}
+	hash := id
+	for _, sibling := range proof {
+		if index%2 == 0 {
+			hash = hashPair(hash, sibling)
+		} else {
+			hash = hashPair(sibling, hash)
+		}
+		index /= 2
+	}
+	return index == 0 && hash == root
+}
+
+//merkle tree에서 두 node를 합친 부모 node의 hash.
+func hashPair(left string, right string) string {
+	return utils.GetHash(left + right)
+}
+
+//block에 같은 id의 tx가 두번 있는지 확인. 홀수개인 level의 마지막 node를 한번 더 사용하므로
+//마지막 tx들을 한번 더 넣은 block도 merkle root와 hash가 같음. 그런 block은 원래 block과 구별할 수 없으므로 받지 않음.
+func duplicateTxs(b *Block) bool {
+	seen := make(map[string]bool)
+	for _, tx := range b.Transactions {
+		if seen[tx.Id] {
+			return true
+		}
+		seen[tx.Id] = true
+	}
+	return false
+}
+
+//block의 MerkleRoot가 block의 tx들로 만든 merkle root와 같은지 확인.
+func CheckMerkleRoot(b *Block) bool {
+	return b.MerkleRoot == merkleRoot(b.Transactions)
+}
@@ -0,0 +1,28 @@
+package blockchain
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMerkleProof(t *testing.T) {
+	for n := 1; n <= 7; n++ {
+		var txs []*Tx
+		for i := 0; i < n; i++ {
+			txs = append(txs, &Tx{Id: fmt.Sprint("tx", i)})
+		}
+		root := merkleRoot(txs)
+		for i, tx := range txs {
+			proof := merkleProof(txs, i)
+			if !verifyMerkleProof(tx.Id, i, proof, root) {
+				t.Errorf("Expected proof of tx %d in %d txs to be valid", i, n)
+			}
+			if verifyMerkleProof("other", i, proof, root) {
+				t.Errorf("Expected proof of other tx at %d in %d txs to be invalid", i, n)
+			}
+			if i^1 < n && verifyMerkleProof(tx.Id, i^1, proof, root) {
+				t.Errorf("Expected proof of tx %d at wrong index in %d txs to be invalid", i, n)
+			}
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package blockchain
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yyuurriiaa/ProjectMSSP/utils"
+)
+
+const (
+	maxOrphanBlocks     int           = 100              // orphan pool에 보관하는 최대 block 수
+	maxOrphanTxs        int           = 100              // orphan pool에 보관하는 최대 tx 수
+	maxOrphanBlockBytes int           = 32 << 20         // orphan pool에 보관하는 block 크기의 합
+	maxOrphanTxBytes    int           = 4 << 20          // orphan pool에 보관하는 tx 크기의 합
+	orphanExpiry        time.Duration = 20 * time.Minute // 부모를 찾지 못한 orphan을 보관하는 시간
+)
+
+//부모(이전 block 또는 사용하려는 TxOut을 가진 tx)를 아직 받지 못한 block과 tx를 보관.
+//부모가 연결되면 byParent로 기다리던 orphan들을 찾아서 다시 처리함
+type orphanPool struct {
+	blocks *orphanSet // key : block hash
+	txs    *orphanSet // key : tx id
+	m      sync.Mutex
+}
+
+//같은 종류의 orphan들. 수와 크기(byte)의 합이 최대값을 넘지 않도록 가장 오래된 orphan부터 버림.
+type orphanSet struct {
+	orphans  map[string]*orphan
+	byParent map[string][]string // key : 없는 부모의 hash(또는 tx id), value : 기다리는 orphan의 key들
+	size     int                 // 보관한 orphan들의 크기 합
+	maxCount int
+	maxSize  int
+}
+
+type orphan struct {
+	block   *Block
+	tx      *Tx
+	parents []string // 기다리는 부모 hash(또는 tx id)들
+	size    int      // encoding한 block(또는 tx)의 크기
+	expires time.Time
+}
+
+var orphans = newOrphanPool()
+
+func newOrphanPool() *orphanPool {
+	return &orphanPool{
+		blocks: newOrphanSet(maxOrphanBlocks, maxOrphanBlockBytes),
+		txs:    newOrphanSet(maxOrphanTxs, maxOrphanTxBytes),
+	}
+}
+
+func newOrphanSet(maxCount int, maxSize int) *orphanSet {
+	return &orphanSet{
+		orphans:  make(map[string]*orphan),
+		byParent: make(map[string][]string),
+		maxCount: maxCount,
+		maxSize:  maxSize,
+	}
+}
+
+//부모 block을 기다리는 orphan block 추가. 가득 차있으면 가장 오래된 orphan을 버림.
+//이전 block이 없어서 전부 검증할 수는 없지만 hash가 header와 맞고 난이도를 만족하는 block만 보관해서 아무 data나 쌓이지 않게 함.
+//같은 hash의 block이 이미 있으면 새로 받은 block으로 바꿈. 먼저 받은 것이 tx를 바꾼 복사본이어도 원래 block을 받을 수 있음.
+func (o *orphanPool) addBlock(block *Block) error {
+	if block.Header().calculateHash() != block.Hash {
+		return blockError("hash does not match the header")
+	}
+	if !strings.HasPrefix(block.Hash, strings.Repeat("0", block.Difficulty)) {
+		return blockError("hash does not meet the difficulty")
+	}
+	if duplicateTxs(block) {
+		return blockError("duplicate txs")
+	}
+	o.m.Lock()
+	defer o.m.Unlock()
+	o.blocks.add(block.Hash, &orphan{block: block, parents: []string{block.PrevHash}, size: len(utils.ToBytes(block))})
+	return nil
+}
+
+//부모 tx들을 기다리는 orphan tx 추가. 가득 차있으면 가장 오래된 orphan을 버림. id가 내용과 다른 tx는 보관하지 않음.
+func (o *orphanPool) addTx(tx *Tx, missing []string) bool {
+	if tx.Id != tx.calculateId() {
+		return false
+	}
+	o.m.Lock()
+	defer o.m.Unlock()
+	o.txs.add(tx.Id, &orphan{tx: tx, parents: missing, size: len(utils.ToBytes(tx))})
+	return true
+}
+
+//prevHash를 이전 block으로 가지는 orphan block들을 pool에서 꺼내서 리턴.
+func (o *orphanPool) takeBlocks(prevHash string) []*Block {
+	o.m.Lock()
+	defer o.m.Unlock()
+	var blocks []*Block
+	for _, orphan := range o.blocks.take(prevHash) {
+		blocks = append(blocks, orphan.block)
+	}
+	return blocks
+}
+
+//parentID를 부모로 가지는 orphan tx들을 pool에서 꺼내서 리턴. 다른 부모를 아직 기다리고 있어도 꺼내고, 다시 처리할 때 확인함.
+func (o *orphanPool) takeTxs(parentID string) []*Tx {
+	o.m.Lock()
+	defer o.m.Unlock()
+	var txs []*Tx
+	for _, orphan := range o.txs.take(parentID) {
+		txs = append(txs, orphan.tx)
+	}
+	return txs
+}
+
+//block과 내용까지 같은 block이 orphan pool에 있는지 확인. hash만 같은 block은 다른 block으로 봄.
+func (o *orphanPool) hasBlock(block *Block) bool {
+	o.m.Lock()
+	defer o.m.Unlock()
+	pooled, ok := o.blocks.orphans[block.Hash]
+	return ok && bytes.Equal(utils.ToBytes(pooled.block), utils.ToBytes(block))
+}
+
+//orphan을 key로 추가. 이미 있으면 새 orphan으로 바꿈. 만료된 orphan을 지우고, 수나 크기가 넘치면 오래된 orphan부터 버림.
+//하나만으로 maxSize를 넘는 orphan은 보관하지 않음. o.m을 잡은 상태에서 호출해야함.
+func (s *orphanSet) add(key string, orphan *orphan) {
+	if orphan.size > s.maxSize {
+		return
+	}
+	s.remove(key)
+	s.expire()
+	for len(s.orphans) > 0 && (len(s.orphans) >= s.maxCount || s.size+orphan.size > s.maxSize) {
+		s.evictOldest()
+	}
+	orphan.expires = time.Now().Add(orphanExpiry)
+	s.orphans[key] = orphan
+	s.size += orphan.size
+	for _, parent := range orphan.parents {
+		s.byParent[parent] = append(s.byParent[parent], key)
+	}
+}
+
+//parent를 기다리는 orphan들을 꺼내서 리턴. o.m을 잡은 상태에서 호출해야함.
+func (s *orphanSet) take(parent string) []*orphan {
+	var taken []*orphan
+	for _, key := range s.byParent[parent] {
+		if orphan, ok := s.orphans[key]; ok {
+			taken = append(taken, orphan)
+			s.remove(key)
+		}
+	}
+	return taken
+}
+
+//orphan을 set과 부모 index에서 삭제. o.m을 잡은 상태에서 호출해야함.
+func (s *orphanSet) remove(key string) {
+	orphan, ok := s.orphans[key]
+	if !ok {
+		return
+	}
+	delete(s.orphans, key)
+	s.size -= orphan.size
+	for _, parent := range orphan.parents {
+		var rest []string
+		for _, waiting := range s.byParent[parent] {
+			if waiting != key {
+				rest = append(rest, waiting)
+			}
+		}
+		if len(rest) == 0 {
+			delete(s.byParent, parent)
+		} else {
+			s.byParent[parent] = rest
+		}
+	}
+}
+
+//보관 시간이 지난 orphan 삭제. o.m을 잡은 상태에서 호출해야함.
+func (s *orphanSet) expire() {
+	now := time.Now()
+	for key, orphan := range s.orphans {
+		if now.After(orphan.expires) {
+			s.remove(key)
+		}
+	}
+}
+
+//가장 먼저 만료되는 orphan 삭제. o.m을 잡은 상태에서 호출해야함.
+func (s *orphanSet) evictOldest() {
+	oldest := ""
+	for key, orphan := range s.orphans {
+		if oldest == "" || orphan.expires.Before(s.orphans[oldest].expires) {
+			oldest = key
+		}
+	}
+	s.remove(oldest)
+}
@@ -0,0 +1,176 @@
+package blockchain
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOrphanSet(t *testing.T) {
+	t.Run("count and size caps evict the oldest", func(t *testing.T) {
+		s := newOrphanSet(2, 100)
+		s.add("a", &orphan{parents: []string{"p"}, size: 10})
+		s.orphans["a"].expires = time.Now().Add(time.Minute) // 가장 먼저 만료됨
+		s.add("b", &orphan{parents: []string{"p"}, size: 10})
+		s.add("c", &orphan{parents: []string{"q"}, size: 10})
+		if _, ok := s.orphans["a"]; ok || len(s.orphans) != 2 || s.size != 20 {
+			t.Errorf("Expected the oldest orphan to be evicted by count, got %v size %d", s.orphans, s.size)
+		}
+		s.add("d", &orphan{parents: []string{"r"}, size: 85})
+		if s.orphans["b"] != nil || s.orphans["c"] == nil || s.orphans["d"] == nil || s.size != 95 {
+			t.Errorf("Expected only the oldest to be evicted by size, got %v size %d", s.orphans, s.size)
+		}
+		s.add("e", &orphan{parents: []string{"r"}, size: 101})
+		if s.orphans["e"] != nil {
+			t.Error("Expected an orphan larger than the pool not to be kept")
+		}
+		if len(s.byParent) != 2 || s.byParent["p"] != nil || len(s.byParent["r"]) != 1 {
+			t.Errorf("Expected the parents of c and d to be indexed, got %v", s.byParent)
+		}
+	})
+
+	t.Run("expired orphans are dropped", func(t *testing.T) {
+		s := newOrphanSet(10, 100)
+		s.add("old", &orphan{parents: []string{"p"}, size: 1})
+		s.orphans["old"].expires = time.Now().Add(-time.Second)
+		s.add("new", &orphan{parents: []string{"q"}, size: 1})
+		if s.orphans["old"] != nil || s.byParent["p"] != nil || s.size != 1 {
+			t.Errorf("Expected the expired orphan to be removed, got %v", s.orphans)
+		}
+	})
+
+	t.Run("adding the same key replaces the orphan", func(t *testing.T) {
+		s := newOrphanSet(10, 100)
+		s.add("a", &orphan{parents: []string{"p"}, size: 10})
+		s.add("a", &orphan{parents: []string{"q"}, size: 4})
+		if len(s.orphans) != 1 || s.size != 4 || s.byParent["p"] != nil || len(s.byParent["q"]) != 1 {
+			t.Errorf("Expected the new orphan to replace the old one, got %v size %d", s.byParent, s.size)
+		}
+	})
+
+	t.Run("taking an orphan cleans every parent", func(t *testing.T) {
+		s := newOrphanSet(10, 100)
+		s.add("child", &orphan{parents: []string{"p1", "p2"}, size: 1})
+		s.add("sibling", &orphan{parents: []string{"p2"}, size: 1})
+		if taken := s.take("p1"); len(taken) != 1 {
+			t.Fatalf("Expected one orphan, got %d", len(taken))
+		}
+		if s.byParent["p1"] != nil || len(s.byParent["p2"]) != 1 || s.byParent["p2"][0] != "sibling" {
+			t.Errorf("Expected the taken orphan to leave the parent index, got %v", s.byParent)
+		}
+	})
+}
+
+func TestOrphanBlocks(t *testing.T) {
+	newTestChain(t)
+	genesis, err := FindBlock(Blockchain().NewestHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("blocks without proof of work are not kept", func(t *testing.T) {
+		forged := testBlock(genesis, testRecipient)
+		forged.Hash = "00" + strings.Repeat("f", len(forged.Hash)-2)
+		if err := orphans.addBlock(forged); !errors.Is(err, ErrBlockNotValid) {
+			t.Errorf("Expected ErrBlockNotValid for a wrong hash, got %v", err)
+		}
+		easy := &Block{PrevHash: "unknown", Height: 3, Difficulty: 64}
+		easy.Hash = easy.Header().calculateHash()
+		if err := orphans.addBlock(easy); !errors.Is(err, ErrBlockNotValid) {
+			t.Errorf("Expected ErrBlockNotValid for a hash that does not meet the difficulty, got %v", err)
+		}
+		if len(orphans.blocks.orphans) != 0 {
+			t.Error("Expected no orphan to be kept")
+		}
+	})
+
+	t.Run("orphans connect when their parent arrives", func(t *testing.T) {
+		b2 := testBlock(genesis, testRecipient)
+		b3 := testBlock(b2, testRecipient)
+		b4 := testBlock(b3, testRecipient)
+		for _, block := range []*Block{b4, b3} {
+			if err := Blockchain().AddPeerBlock(block); err != ErrOrphanBlock {
+				t.Fatalf("Expected ErrOrphanBlock, got %v", err)
+			}
+		}
+		if err := Blockchain().AddPeerBlock(b2); err != nil {
+			t.Fatal(err)
+		}
+		if chain := Blockchain(); chain.Height != 4 || chain.NewestHash != b4.Hash {
+			t.Errorf("Expected the orphans to be connected up to height 4, got %d", chain.Height)
+		}
+		if len(orphans.blocks.orphans) != 0 || len(orphans.blocks.byParent) != 0 || orphans.blocks.size != 0 {
+			t.Errorf("Expected the orphan pool to be empty, got %v", orphans.blocks.byParent)
+		}
+	})
+
+}
+
+func TestOrphanChangedCopy(t *testing.T) {
+	newTestChain(t)
+	Blockchain().AddBlock() // 두 tx가 사용할 coin
+	txs := []*Tx{sendTo(t, testRecipient, 7), sendTo(t, testRecipient, 8)}
+	tip, err := FindBlock(Blockchain().NewestHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := testBlock(tip, testRecipient)
+	block := testBlock(parent, testRecipient, txs...) // tx가 3개이므로 마지막 tx를 한번 더 넣어도 merkle root가 같음
+
+	t.Run("duplicate txs are not kept", func(t *testing.T) {
+		duplicated := *block
+		duplicated.Transactions = append(append([]*Tx{}, block.Transactions...), block.Transactions[2])
+		if duplicated.Header().calculateHash() != block.Hash {
+			t.Fatal("Expected the copy to have the same hash")
+		}
+		if err := Blockchain().AddPeerBlock(&duplicated); !errors.Is(err, ErrBlockNotValid) {
+			t.Errorf("Expected ErrBlockNotValid for duplicate txs, got %v", err)
+		}
+	})
+
+	t.Run("a pooled copy is replaced by the block", func(t *testing.T) {
+		tx := *txs[0] // signature는 tx id에 들어가지 않으므로 signature를 바꾼 copy도 hash가 같음
+		txIn := *tx.TxIns[0]
+		txIn.Signature = "00"
+		tx.TxIns = append([]*TxIn{&txIn}, tx.TxIns[1:]...)
+		changed := *block
+		changed.Transactions = append([]*Tx{&tx}, block.Transactions[1:]...)
+		if err := Blockchain().AddPeerBlock(&changed); err != ErrOrphanBlock {
+			t.Fatalf("Expected ErrOrphanBlock, got %v", err)
+		}
+		if err := Blockchain().AddPeerBlock(&changed); err != ErrBlockNotConnectable {
+			t.Errorf("Expected the same copy not to be pooled again, got %v", err)
+		}
+		if err := Blockchain().AddPeerBlock(block); err != ErrOrphanBlock {
+			t.Fatalf("Expected the block to replace the pooled copy, got %v", err)
+		}
+		if err := Blockchain().AddPeerBlock(parent); err != nil {
+			t.Fatal(err)
+		}
+		if Blockchain().NewestHash != block.Hash {
+			t.Errorf("Expected the block to be connected, got height %d", Blockchain().Height)
+		}
+	})
+}
+
+func TestOrphanTxSpentInput(t *testing.T) {
+	newTestChain(t)
+	Blockchain().AddBlock()
+	spent := sendTo(t, testRecipient, 7).TxIns[0]
+	Blockchain().AddBlock()
+	tx := &Tx{Timestamp: 1, TxIns: []*TxIn{{TxID: spent.TxID, Index: spent.Index, Signature: "aa"}}, TxOuts: []*TxOut{{testRecipient, 1}}}
+	tx.getId()
+
+	//UTXO set과 mempool에 없는 TxOut은 blockchain을 찾지 않고 없는 부모로 처리함
+	if err := Mempool().AddRawTx(tx); err != ErrorOrphanTx {
+		t.Errorf("Expected ErrorOrphanTx for a raw tx, got %v", err)
+	}
+	missing, err := Mempool().AddPeerTx(tx)
+	if err != ErrorOrphanTx || len(missing) != 1 || missing[0] != spent.TxID {
+		t.Errorf("Expected the spent tx to be missing, got %v %v", missing, err)
+	}
+	if FindMempoolTx(Mempool(), tx.Id) != nil {
+		t.Error("Expected the tx not to be added to the mempool")
+	}
+}
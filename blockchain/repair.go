@@ -0,0 +1,94 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/yyuurriiaa/ProjectMSSP/db"
+)
+
+//시작할 때 db의 checkpoint, block, UTXO set이 서로 맞는지 확인하고 맞지 않으면 고침.
+//block 연결을 한번에 저장하기 전의 db는 꺼진 시점에 따라 checkpoint가 없는 block을 가리키거나 UTXO set이 다른 block의 것일 수 있음.
+//고칠 수 없으면 db의 chain을 비우고 NewestHash를 ""로 만들어서 genesis부터 다시 시작하게 함.
+func (b *blockchain) repair() {
+	if !b.tipStored() {
+		tip := storedTip()
+		if tip == nil {
+			b.reset("no block of the checkpoint chain was found")
+			return
+		}
+		fmt.Printf("checkpoint block %s is missing, recovered the chain at height %d\n", b.NewestHash, tip.Height)
+		b.NewestHash = tip.Hash
+		b.Height = tip.Height
+		b.CurrDifficulty = tip.Difficulty
+		persistBlockchain(b)
+	}
+
+	tip := db.UTxOTip()
+	if tip != nil && string(tip) == b.NewestHash {
+		return
+	}
+	if b.PrunedHeight == 0 { // 모든 block이 있으면 UTXO set을 다시 만들 수 있음
+		fmt.Printf("utxo set does not match block %s, rebuilding it\n", b.NewestHash)
+		batch := db.NewBatch()
+		rebuildUTxOs(batch, Blocks(b))
+		batch.Commit()
+		return
+	}
+	b.reset("utxo set does not match the newest block and blocks were pruned")
+}
+
+//checkpoint가 가리키는 block이 db에 있고 checkpoint의 height, 난이도와 같은지 확인.
+func (b *blockchain) tipStored() bool {
+	block, err := FindBlock(b.NewestHash)
+	return err == nil && block.Height == b.Height && block.Difficulty == b.CurrDifficulty
+}
+
+//db에 있는 block 중에서 이전 block이나 지운 block의 header를 따라 genesis까지 이어지는 가장 높은 block. 없으면 nil.
+func storedTip() *Block {
+	blocks := make(map[string]*Block)
+	for hash, data := range db.Blocks() {
+		block := &Block{}
+		block.fromBytes(data)
+		blocks[hash] = block
+	}
+	linked := map[string]bool{"": true} // genesis까지 이어지는지 확인한 hash
+	var connects func(hash string) bool
+	connects = func(hash string) bool {
+		if ok, seen := linked[hash]; seen {
+			return ok
+		}
+		linked[hash] = false
+		if block, ok := blocks[hash]; ok {
+			linked[hash] = block.Height > 0 && connects(block.PrevHash)
+		} else if header := FindHeader(hash); header != nil {
+			linked[hash] = connects(header.PrevHash)
+		}
+		return linked[hash]
+	}
+	var tip *Block
+	for hash, block := range blocks {
+		if !connects(hash) {
+			continue
+		}
+		if tip == nil || block.Height > tip.Height || (block.Height == tip.Height && block.Hash < tip.Hash) {
+			tip = block
+		}
+	}
+	return tip
+}
+
+//db의 block, header, UTXO set과 checkpoint를 모두 지우고 빈 blockchain으로 만듬. block은 peer에게 다시 받음.
+func (b *blockchain) reset(reason string) {
+	fmt.Printf("%s, starting the chain over\n", reason)
+	batch := db.NewBatch()
+	batch.EmptyBlocks()
+	batch.EmptyHeaders()
+	batch.EmptyUTxOs()
+	batch.DeleteBlockchain()
+	batch.Commit()
+	b.NewestHash = ""
+	b.Height = 0
+	b.CurrDifficulty = 0
+	b.PrunedHeight = 0
+	b.Snapshot = nil
+}
@@ -0,0 +1,141 @@
+package blockchain
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/yyuurriiaa/ProjectMSSP/db"
+	"github.com/yyuurriiaa/ProjectMSSP/utils"
+)
+
+//genesis 다음에 block 두개를 채굴함. recipient에게 7을 보내는 tx는 block 3에 있음. 높이 순서로 block들을 리턴.
+func mineTestChain(t *testing.T) []*Block {
+	t.Helper()
+	chain := Blockchain()
+	chain.AddBlock()
+	sendTo(t, testRecipient, 7)
+	chain.AddBlock()
+	var blocks []*Block
+	for _, block := range Blocks(chain) {
+		blocks = append([]*Block{block}, blocks...)
+	}
+	return blocks
+}
+
+//node를 다시 시작한 것처럼 db의 checkpoint부터 blockchain을 다시 만들고, 고친 뒤의 checkpoint와 UTXO set이 맞는지 확인.
+func restart(t *testing.T) *blockchain {
+	t.Helper()
+	resetChain()
+	chain := Blockchain()
+	stored := &blockchain{}
+	stored.fromBytes(db.Checkpoint())
+	if stored.NewestHash != chain.NewestHash || stored.Height != chain.Height {
+		t.Errorf("Expected the repaired chain to be saved, got %s at %d", stored.NewestHash, stored.Height)
+	}
+	if tip := db.UTxOTip(); string(tip) != chain.NewestHash {
+		t.Errorf("Expected the utxo set of %s, got %s", chain.NewestHash, tip)
+	}
+	return chain
+}
+
+func TestRepair(t *testing.T) {
+	t.Run("checkpoint of a missing block", func(t *testing.T) {
+		newTestChain(t)
+		blocks := mineTestChain(t)
+		balances := utxoBalances()
+		db.SaveBlockchain(utils.ToBytes(&blockchain{NewestHash: "missing", Height: 4, CurrDifficulty: defaultDifficulty})) // block을 저장하기 전에 꺼진 db
+
+		chain := restart(t)
+		if chain.NewestHash != blocks[2].Hash || chain.Height != 3 {
+			t.Errorf("Expected to roll back to block 3, got %s at %d", chain.NewestHash, chain.Height)
+		}
+		if got := utxoBalances(); fmt.Sprint(got) != fmt.Sprint(balances) {
+			t.Errorf("Expected %v, got %v", balances, got)
+		}
+	})
+
+	t.Run("checkpoint block deleted", func(t *testing.T) {
+		newTestChain(t)
+		blocks := mineTestChain(t)
+		db.DeleteBlock(blocks[2].Hash) // checkpoint와 UTXO set은 block 3의 것
+
+		chain := restart(t)
+		if chain.NewestHash != blocks[1].Hash || chain.Height != 2 {
+			t.Errorf("Expected to roll back to block 2, got %s at %d", chain.NewestHash, chain.Height)
+		}
+		if got := utxoBalances(); len(got) != 1 || got[testRecipient] != 0 { // 7을 보내는 tx는 block 3에 있었음
+			t.Errorf("Expected the utxo set to be rebuilt from block 2, got %v", got)
+		}
+	})
+
+	t.Run("utxo set of another block", func(t *testing.T) {
+		newTestChain(t)
+		blocks := mineTestChain(t)
+		balances := utxoBalances()
+		batch := db.NewBatch() // block 2까지만 적용한 UTXO set
+		batch.EmptyUTxOs()
+		for _, block := range blocks[:2] {
+			applyBlock(batch, block)
+		}
+		batch.Commit()
+
+		restart(t)
+		if got := utxoBalances(); fmt.Sprint(got) != fmt.Sprint(balances) {
+			t.Errorf("Expected the utxo set to be rebuilt, got %v instead of %v", got, balances)
+		}
+	})
+
+	t.Run("pruned chain cannot be rebuilt", func(t *testing.T) {
+		newTestChain(t)
+		pruneDepth = difficultyInterval
+		blocks := mineTestChain(t)
+		for i := 0; i < pruneDepth; i++ {
+			Blockchain().AddBlock()
+		}
+		batch := db.NewBatch()
+		batch.SaveUTxOTip(blocks[2].Hash)
+		batch.Commit()
+
+		chain := restart(t) // 모든 block을 지우고 genesis부터 다시 시작함
+		if chain.Height != 1 || chain.PrunedHeight != 0 || len(db.Blocks()) != 1 {
+			t.Errorf("Expected a new chain, got height %d with %d blocks", chain.Height, len(db.Blocks()))
+		}
+		if FindHeader(blocks[0].Hash) != nil {
+			t.Error("Expected the headers of the old chain to be deleted")
+		}
+	})
+
+	t.Run("replace leaves only the new chain", func(t *testing.T) {
+		newTestChain(t)
+		old := mineTestChain(t)
+		candidate := testChain(testGenesis(testRecipient), testRecipient, 4)
+		if err := Blockchain().Replace(candidate[:3]); err == nil { // genesis가 없는 chain
+			t.Fatal("Expected a chain without the genesis block to be rejected")
+		}
+		if chain := restart(t); chain.NewestHash != old[2].Hash {
+			t.Fatalf("Expected the rejected chain not to be saved, got %s", chain.NewestHash)
+		}
+		if err := Blockchain().Replace(candidate); err != nil {
+			t.Fatal(err)
+		}
+
+		chain := restart(t) // repair가 고칠 것이 없음
+		if chain.NewestHash != candidate[0].Hash || chain.Height != 4 {
+			t.Errorf("Expected the new chain, got %s at %d", chain.NewestHash, chain.Height)
+		}
+		stored := db.Blocks()
+		for _, block := range candidate {
+			if _, ok := stored[block.Hash]; !ok {
+				t.Errorf("Expected block %d of the new chain to be saved", block.Height)
+			}
+		}
+		for _, block := range old {
+			if _, err := FindBlock(block.Hash); err != ErrNotFound {
+				t.Errorf("Expected block %d of the old chain to be deleted, got %v", block.Height, err)
+			}
+		}
+		if got := utxoBalances(); len(got) != 1 || got[testRecipient] != 4*minerReward {
+			t.Errorf("Expected only the utxos of the new chain, got %v", got)
+		}
+	})
+}
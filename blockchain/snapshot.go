@@ -0,0 +1,283 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yyuurriiaa/ProjectMSSP/db"
+	"github.com/yyuurriiaa/ProjectMSSP/utils"
+)
+
+//chain params에 고정된 snapshot hash. height: hash. 여기 있는 snapshot은 operator가 hash를 주지 않아도 믿음
+var snapshotCheckpoints = map[int]string{}
+
+var verifySnapshot bool // snapshot으로 시작한 node가 모든 block을 받아서 snapshot을 다시 검증할지
+
+var ErrNoBlockchain = errors.New("no blockchain to export")
+var ErrSnapshotHeight = errors.New("snapshot height out of range")
+var ErrSnapshotPruned = errors.New("blocks below the snapshot height were pruned")
+var ErrSnapshotNotValid = errors.New("snapshot not valid")
+var ErrSnapshotNotTrusted = errors.New("snapshot hash is not pinned or supplied")
+var ErrSnapshotExists = errors.New("blockchain already exists")
+var ErrSnapshotMismatch = errors.New("blocks do not match the snapshot")
+
+//UTXO set의 TxOut 하나. snapshot 파일에 저장함.
+type SnapshotUTxO struct {
+	TxID    string
+	Index   int
+	Address string
+	Amount  int
+}
+
+//height까지의 block으로 만든 UTXO set. 새 node는 모든 block 대신 snapshot을 받아서 height부터 동기화함.
+type Snapshot struct {
+	Height    int
+	BlockHash string
+	Hash      string         // Height, BlockHash, UTxOs의 hash. 이 값을 믿을 수 있어야 snapshot을 사용함
+	Headers   []*Header      // genesis부터 Height까지의 header. BlockHash까지 이어지고 난이도를 만족하는지 확인함
+	Blocks    []*Block       // 가장 최근 block들. 난이도 계산과 다음 block 연결에 사용
+	UTxOs     []SnapshotUTxO // txID, index 순서
+}
+
+//snapshot으로 시작한 node가 기억하는 snapshot 정보. /status 에서 보여줌.
+type SnapshotInfo struct {
+	Height    int    `json:"height"`
+	BlockHash string `json:"blockHash"`
+	Hash      string `json:"hash"`
+	Verified  bool   `json:"verified"` // 모든 block을 받아서 같은 UTXO set이 나오는지 확인했음
+}
+
+//snapshot으로 시작한 node가 모든 block을 받아서 snapshot을 다시 검증하도록 함.
+func SetVerifySnapshot() {
+	verifySnapshot = true
+}
+
+//모든 block을 받아서 검증해야하는 snapshot이 있는지 확인.
+func SnapshotPending() bool {
+	if !verifySnapshot || b == nil {
+		return false
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.Snapshot != nil && !b.Snapshot.Verified
+}
+
+//snapshot의 commitment. height, block hash와 정렬된 UTXO set을 한 줄씩 이어서 hash함.
+func snapshotHash(height int, blockHash string, uTxOs []SnapshotUTxO) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d:%s\n", height, blockHash)
+	for _, u := range uTxOs {
+		fmt.Fprintf(&sb, "%s:%d:%s:%d\n", u.TxID, u.Index, u.Address, u.Amount)
+	}
+	return utils.GetHash(sb.String())
+}
+
+//UTXO set을 snapshot에 저장하는 순서로 정렬.
+func snapshotUTxOs(set map[string]*TxOut) []SnapshotUTxO {
+	var uTxOs []SnapshotUTxO
+	for key, txOut := range set {
+		txID, index := splitUTxOKey(key)
+		uTxOs = append(uTxOs, SnapshotUTxO{TxID: txID, Index: index, Address: txOut.Address, Amount: txOut.Amount})
+	}
+	sort.Slice(uTxOs, func(i, j int) bool {
+		if uTxOs[i].TxID != uTxOs[j].TxID {
+			return uTxOs[i].TxID < uTxOs[j].TxID
+		}
+		return uTxOs[i].Index < uTxOs[j].Index
+	})
+	return uTxOs
+}
+
+//blocks를 오래된 것부터 height까지 적용한 UTXO set. blocks는 가장 최근 block이 blocks[0].
+func replayUTxOs(blocks []*Block, height int) map[string]*TxOut {
+	set := make(map[string]*TxOut)
+	for i := len(blocks) - 1; i >= 0 && blocks[i].Height <= height; i-- {
+		add, remove := utxoChanges(blocks[i])
+		for _, key := range remove {
+			delete(set, key)
+		}
+		for key, txOut := range add {
+			set[key] = txOut
+		}
+	}
+	return set
+}
+
+//genesis부터 가장 최근 block까지의 header. 지운 block은 저장해둔 header를 사용.
+func chainHeaders(b *blockchain) []*Header {
+	var headers []*Header
+	hashCursor := b.NewestHash
+	for hashCursor != "" {
+		var header *Header
+		if block, err := FindBlock(hashCursor); err == nil {
+			header = block.Header()
+		} else if header = FindHeader(hashCursor); header == nil {
+			break
+		}
+		headers = append([]*Header{header}, headers...)
+		hashCursor = header.PrevHash
+	}
+	return headers
+}
+
+//height의 UTXO set snapshot을 만듬. height가 0이면 가장 최근 block의 snapshot.
+//가장 최근 block이 아니면 genesis부터 block을 다시 적용해야하므로 pruned node는 가장 최근 block의 snapshot만 만들 수 있음.
+func ExportSnapshot(height int) (*Snapshot, error) {
+	if db.Checkpoint() == nil {
+		return nil, ErrNoBlockchain
+	}
+	b := Blockchain()
+	if height == 0 {
+		height = b.Height
+	}
+	if height < 1 || height > b.Height {
+		return nil, ErrSnapshotHeight
+	}
+	var set map[string]*TxOut
+	if height == b.Height {
+		set = make(map[string]*TxOut)
+		for key, data := range db.UTxOs() {
+			txOut := &TxOut{}
+			utils.FromBytes(txOut, data)
+			set[key] = txOut
+		}
+	} else {
+		if b.PrunedHeight > 0 {
+			return nil, ErrSnapshotPruned
+		}
+		set = replayUTxOs(Blocks(b), height)
+	}
+	headers := chainHeaders(b)[:height]
+	s := &Snapshot{
+		Height:    height,
+		BlockHash: headers[height-1].Hash,
+		Headers:   headers,
+		UTxOs:     snapshotUTxOs(set),
+	}
+	first := height - minPruneDepth // snapshot에 넣는 가장 오래된 block의 위치
+	if first < 0 {
+		first = 0
+	}
+	for _, header := range headers[first:] {
+		block, err := FindBlock(header.Hash)
+		if err != nil {
+			return nil, ErrSnapshotPruned
+		}
+		s.Blocks = append(s.Blocks, block)
+	}
+	s.Hash = snapshotHash(s.Height, s.BlockHash, s.UTxOs)
+	return s, nil
+}
+
+//snapshot의 commitment와 header, block들이 서로 맞는지 확인.
+func (s *Snapshot) verify() error {
+	if s.Height < 1 || len(s.Headers) != s.Height || len(s.Blocks) == 0 || len(s.Blocks) > s.Height {
+		return ErrSnapshotNotValid
+	}
+	if snapshotHash(s.Height, s.BlockHash, s.UTxOs) != s.Hash {
+		return ErrSnapshotNotValid
+	}
+	candidate := &headerChain{}
+	batch := make(map[string]*Header)
+	for _, header := range s.Headers {
+		if err := candidate.verifyNext(header, func(hash string) *Header { return batch[hash] }); err != nil {
+			return ErrSnapshotNotValid
+		}
+		batch[header.Hash] = header
+		candidate.connect(header)
+	}
+	if candidate.NewestHash != s.BlockHash {
+		return ErrSnapshotNotValid
+	}
+	first := s.Height - len(s.Blocks) + 1 // s.Blocks의 가장 오래된 block의 height
+	for i, block := range s.Blocks {
+		if block.Height != first+i || *block.Header() != *s.Headers[block.Height-1] || !CheckMerkleRoot(block) {
+			return ErrSnapshotNotValid
+		}
+	}
+	return nil
+}
+
+//snapshot 파일을 검증하고 비어있는 db에 저장. snapshot의 hash가 chain params에 고정된 값이나 trustedHash와 같아야 사용함.
+//이미 같은 snapshot으로 시작한 db면 아무것도 하지 않음. Blockchain()을 처음 호출하기 전에 사용해야함.
+func LoadSnapshot(data []byte, trustedHash string) (*Snapshot, error) {
+	s := &Snapshot{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(s); err != nil {
+		return nil, ErrSnapshotNotValid
+	}
+	if err := s.verify(); err != nil {
+		return nil, err
+	}
+	if s.Hash != snapshotCheckpoints[s.Height] && s.Hash != trustedHash {
+		return nil, ErrSnapshotNotTrusted
+	}
+	if checkpoint := db.Checkpoint(); checkpoint != nil {
+		existing := &blockchain{}
+		existing.fromBytes(checkpoint)
+		if existing.Snapshot != nil && existing.Snapshot.Hash == s.Hash {
+			return s, nil
+		}
+		return nil, ErrSnapshotExists
+	}
+
+	prunedHeight := s.Height - len(s.Blocks)
+	batch := db.NewBatch() // checkpoint가 있으면 snapshot이 모두 저장된 것
+	for _, header := range s.Headers[:prunedHeight] {
+		batch.SaveHeader(header.Hash, utils.ToBytes(header))
+	}
+	for _, block := range s.Blocks {
+		batch.SaveBlock(block.Hash, utils.ToBytes(block))
+	}
+	add := make(map[string][]byte)
+	for _, u := range s.UTxOs {
+		add[utxoKey(u.TxID, u.Index)] = utils.ToBytes(&TxOut{Address: u.Address, Amount: u.Amount})
+	}
+	batch.UpdateUTxOs(add, nil)
+	batch.SaveUTxOTip(s.BlockHash)
+	batch.SaveBlockchain(utils.ToBytes(&blockchain{
+		NewestHash:     s.BlockHash,
+		Height:         s.Height,
+		CurrDifficulty: s.Headers[s.Height-1].Difficulty,
+		PrunedHeight:   prunedHeight,
+		Snapshot:       &SnapshotInfo{Height: s.Height, BlockHash: s.BlockHash, Hash: s.Hash},
+	}))
+	batch.Commit()
+	return s, nil
+}
+
+//peer에게 받은 모든 block으로 snapshot을 다시 검증. blocks는 가장 최근 block이 blocks[0].
+//genesis부터 snapshot의 height까지 header와 merkle root를 검증하고 같은 UTXO set이 나오면 snapshot을 검증된 것으로 저장함.
+//검증할 snapshot이 없으면 nil을 리턴.
+func (b *blockchain) VerifySnapshot(blocks []*Block) error {
+	b.m.Lock()
+	info := b.Snapshot
+	b.m.Unlock()
+	if info == nil || info.Verified {
+		return nil
+	}
+	candidate := &headerChain{}
+	batch := make(map[string]*Header)
+	for i := len(blocks) - 1; i >= 0 && blocks[i].Height <= info.Height; i-- {
+		header := blocks[i].Header()
+		if err := candidate.verifyNext(header, func(hash string) *Header { return batch[hash] }); err != nil || !CheckMerkleRoot(blocks[i]) {
+			return ErrSnapshotMismatch
+		}
+		batch[header.Hash] = header
+		candidate.connect(header)
+	}
+	if candidate.NewestHash != info.BlockHash {
+		return ErrSnapshotMismatch
+	}
+	if snapshotHash(info.Height, info.BlockHash, snapshotUTxOs(replayUTxOs(blocks, info.Height))) != info.Hash {
+		return ErrSnapshotMismatch
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.Snapshot.Verified = true
+	persistBlockchain(b)
+	return nil
+}
@@ -0,0 +1,123 @@
+package blockchain
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/yyuurriiaa/ProjectMSSP/db"
+	"github.com/yyuurriiaa/ProjectMSSP/utils"
+)
+
+func TestSnapshot(t *testing.T) {
+	newTestChain(t)
+	chain := Blockchain()
+	chain.AddBlock()
+	sendTo(t, testRecipient, 7)
+	for i := 0; i < 3; i++ {
+		chain.AddBlock()
+	}
+	blocks := Blocks(chain) // 가장 최근 block이 blocks[0]
+	balances := utxoBalances()
+
+	if _, err := ExportSnapshot(chain.Height + 1); err != ErrSnapshotHeight {
+		t.Errorf("Expected ErrSnapshotHeight, got %v", err)
+	}
+	newest, err := ExportSnapshot(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newest.Height != chain.Height || newest.BlockHash != chain.NewestHash || len(newest.UTxOs) != len(db.UTxOs()) {
+		t.Errorf("Expected the snapshot of the newest block, got height %d with %d utxos", newest.Height, len(newest.UTxOs))
+	}
+	s, err := ExportSnapshot(3) // 이전 height의 snapshot은 block을 다시 적용해서 만듬
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.BlockHash != blocks[len(blocks)-3].Hash || len(s.Headers) != 3 || len(s.Blocks) != 3 {
+		t.Fatalf("Expected the snapshot of block 3, got %+v", s)
+	}
+	data := utils.ToBytes(s)
+
+	db.Close()
+	newTestChain(t) // 새 node
+
+	t.Run("untrusted or changed snapshots are not loaded", func(t *testing.T) {
+		if _, err := LoadSnapshot(data, ""); err != ErrSnapshotNotTrusted {
+			t.Errorf("Expected ErrSnapshotNotTrusted, got %v", err)
+		}
+		if _, err := LoadSnapshot(data[:len(data)/2], s.Hash); err != ErrSnapshotNotValid {
+			t.Errorf("Expected ErrSnapshotNotValid for a cut file, got %v", err)
+		}
+		changed := *s
+		changed.UTxOs = append([]SnapshotUTxO{{TxID: "forged", Address: testRecipient, Amount: 1000}}, s.UTxOs...)
+		if _, err := LoadSnapshot(utils.ToBytes(&changed), s.Hash); err != ErrSnapshotNotValid {
+			t.Errorf("Expected ErrSnapshotNotValid for a changed utxo set, got %v", err)
+		}
+		changed = *s
+		changed.UTxOs = changed.UTxOs[1:]
+		changed.Hash = snapshotHash(changed.Height, changed.BlockHash, changed.UTxOs)
+		changed.Headers = append([]*Header{}, s.Headers...)
+		header := *changed.Headers[1]
+		header.Timestamp++
+		changed.Headers[1] = &header
+		if _, err := LoadSnapshot(utils.ToBytes(&changed), changed.Hash); err != ErrSnapshotNotValid {
+			t.Errorf("Expected ErrSnapshotNotValid for a changed header, got %v", err)
+		}
+		if db.Checkpoint() != nil {
+			t.Error("Expected nothing to be saved")
+		}
+	})
+
+	t.Run("load", func(t *testing.T) {
+		if _, err := LoadSnapshot(data, s.Hash); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadSnapshot(data, s.Hash); err != nil { // 같은 snapshot으로 시작한 db
+			t.Errorf("Expected the same snapshot to load again, got %v", err)
+		}
+		if _, err := LoadSnapshot(utils.ToBytes(newest), newest.Hash); err != ErrSnapshotExists {
+			t.Errorf("Expected ErrSnapshotExists, got %v", err)
+		}
+		loaded := Blockchain()
+		if loaded.Height != 3 || loaded.NewestHash != s.BlockHash || loaded.Snapshot == nil || loaded.Snapshot.Verified {
+			t.Fatalf("Expected an unverified chain at the snapshot, got %+v", loaded)
+		}
+		for _, block := range []*Block{blocks[1], blocks[0]} { // snapshot 다음 block들
+			if err := loaded.AddPeerBlock(block); err != nil {
+				t.Fatalf("block %d: %v", block.Height, err)
+			}
+		}
+		if got := utxoBalances(); fmt.Sprint(got) != fmt.Sprint(balances) {
+			t.Errorf("Expected %v, got %v", balances, got)
+		}
+	})
+
+	t.Run("verify with all blocks", func(t *testing.T) {
+		loaded := Blockchain()
+		changed := append([]*Block{}, blocks...)
+		block := *changed[len(changed)-2]
+		block.Transactions = block.Transactions[1:] // 7을 보내는 tx를 뺀 block
+		changed[len(changed)-2] = &block
+		if err := loaded.VerifySnapshot(changed); err != ErrSnapshotMismatch {
+			t.Errorf("Expected ErrSnapshotMismatch, got %v", err)
+		}
+		if err := loaded.VerifySnapshot(blocks[1:]); err != nil {
+			t.Fatal(err)
+		}
+		resetChain() // node를 다시 시작해도 검증한 것을 기억함
+		if info := Blockchain().Snapshot; info == nil || !info.Verified {
+			t.Errorf("Expected the snapshot to be verified, got %+v", info)
+		}
+	})
+
+	t.Run("different genesis", func(t *testing.T) {
+		genesis := testGenesis(testRecipient)
+		other := testBlock(genesis, testRecipient)
+		if err := Blockchain().AddPeerBlock(other); err != ErrOrphanBlock {
+			t.Fatalf("Expected ErrOrphanBlock, got %v", err)
+		}
+		if err := Blockchain().AddPeerBlock(genesis); err != ErrDifferentGenesis {
+			t.Errorf("Expected ErrDifferentGenesis, got %v", err)
+		}
+	})
+}
@@ -3,7 +3,10 @@ package blockchain
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,6 +16,8 @@ import (
 
 const (
 	minerReward int = 50 //블록 채굴 시 보상
+
+	maxTxOuts int = 1000 // 한 tx로 보낼 수 있는 받는 사람의 최대 수
 )
 
 type Tx struct {
@@ -26,6 +31,7 @@ type TxIn struct {
 	TxID      string `json:"txID"`  // 어떤 TxOut으로부터 만들어졌는지 알려줌. 즉, TxOut이 속해있는 Tx의 Id
 	Index     int    `json:"index"` // 그 TxOut의 위치를 알려줌
 	Signature string `json:"signature"`
+	PublicKey string `json:"publicKey,omitempty"` // 서명한 key의 압축한 public key. 이전 hex address의 TxOut을 사용하면 비어있음
 	// Amount int    `json:"Amount"`
 }
 
@@ -72,42 +78,145 @@ func MempoolMutex(m *mempool, rw http.ResponseWriter) {
 //tx의 id 를 해싱(string)함.
 func (t *Tx) getId() { // tx 해싱해서 id 얻기
 	// utils.GetHash(t)
-	t.Id = utils.GetHash(t)
+	t.Id = t.calculateId()
+}
+
+//Signature를 제외한 tx의 내용으로 id를 계산. 같은 내용의 tx는 어느 노드에서나 같은 id를 가지므로 id로 tx의 내용을 확인할 수 있음.
+//signature는 id에 서명한 값이므로 id에 포함하지 않음. public key는 사용하는 TxOut의 address로 정해지므로 포함하지 않음.
+//string은 길이를 앞에 붙이고 숫자와 개수는 ;로 끝내서, 내용이 다른 tx는 hashing하는 문자열도 항상 다름.
+func (t *Tx) calculateId() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d;%d;", t.Timestamp, len(t.TxIns))
+	for _, txIn := range t.TxIns {
+		fmt.Fprintf(&sb, "%d:%s%d;", len(txIn.TxID), txIn.TxID, txIn.Index)
+	}
+	fmt.Fprintf(&sb, "%d;", len(t.TxOuts))
+	for _, txOut := range t.TxOuts {
+		fmt.Fprintf(&sb, "%d:%s%d;", len(txOut.Address), txOut.Address, txOut.Amount)
+	}
+	return utils.GetHash(sb.String())
 }
 
-//tx의 signature를 생성 후 대입.
-func (t *Tx) sign() {
+//tx id를 calculateId의 형식으로 바꾸기 전의 id. struct를 fmt.Sprint한 문자열을 hashing해서 다른 내용의 tx가 같은 id를 가질 수 있으므로
+//db migration이 기록한 height까지의 tx만 이 형식으로 인정함.
+func (t *Tx) textId() string {
+	type idTxIn struct {
+		TxID      string
+		Index     int
+		Signature string
+	}
+	payload := struct {
+		Timestamp int
+		TxIns     []idTxIn
+		TxOuts    []TxOut
+	}{Timestamp: t.Timestamp}
 	for _, txIn := range t.TxIns {
-		txIn.Signature = wallet.Sign(t.Id, wallet.Wallet())
+		payload.TxIns = append(payload.TxIns, idTxIn{TxID: txIn.TxID, Index: txIn.Index})
+	}
+	for _, txOut := range t.TxOuts {
+		payload.TxOuts = append(payload.TxOuts, *txOut)
+	}
+	return utils.GetHash(payload)
+}
+
+//from wallet으로 tx의 signature를 생성 후 대입. owners[i]는 i번째 TxIn이 사용하는 TxOut의 address. wallet이 잠겨있으면 에러.
+func (t *Tx) sign(from string, owners []string) error {
+	w, err := wallet.Wallets().Get(from)
+	if err != nil {
+		return err
+	}
+	for i, txIn := range t.TxIns {
+		publicKey, err := w.PublicKey(owners[i])
+		if err != nil {
+			return err
+		}
+		signature, err := wallet.Sign(t.Id, owners[i], w)
+		if err != nil {
+			return err
+		}
+		txIn.Signature = signature
+		txIn.PublicKey = publicKey
 	}
+	return nil
 }
 
-//TxID가 같은 Tx가 존재하는지 먼저 검증. 그 후, publicKey를 사용해서 다시 한번 검증.
+//tx의 모든 TxOut이 형식과 checksum이 맞는 address로 가는지 확인. 읽을 수 없는 address로 보낸 coin은 아무도 사용할 수 없음.
+func validAddresses(tx *Tx) bool {
+	for _, txOut := range tx.TxOuts {
+		if wallet.ValidateAddress(txOut.Address) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+//tx의 id가 내용과 맞는지, 사용하려는 TxOut이 UTXO set에 있는지 먼저 검증. 그 후, publicKey를 사용해서 다시 한번 검증.
+//light node는 block을 가지고 있지 않으므로 검증된 wallet tx에서 찾음.
 func validate(tx *Tx) bool {
+	if tx.Id != tx.calculateId() { // id가 내용과 다르면 서명된 tx의 내용을 바꾼 것
+		return false
+	}
+	if Light() {
+		return verifyTxIns(tx, false, func(txIn *TxIn) *TxOut {
+			return txOutOf(findLightTx(txIn.TxID), txIn.Index)
+		})
+	}
+	return verifyTxIns(tx, false, func(txIn *TxIn) *TxOut {
+		return FindUTxO(txIn.TxID, txIn.Index)
+	})
+}
+
+//tx의 index번째 TxOut. tx가 없거나 index의 TxOut이 없으면 nil.
+func txOutOf(tx *Tx, index int) *TxOut {
+	if tx == nil || index < 0 || index >= len(tx.TxOuts) {
+		return nil
+	}
+	return tx.TxOuts[index]
+}
+
+//tx의 모든 TxIn에 대해 findTxOut으로 사용하려는 TxOut을 찾고, TxIn의 public key가 그 TxOut의 address의 key인지 확인한 후 signature를 검증.
+//signature는 64 byte low-S여야함. allowLegacy이면 이전 hex address의 TxOut을 사용하는 TxIn은 이전 형식의 signature도 허용함.
+//새 tx는 모두 새 형식으로 서명하므로 이미 chain에 있는 block을 검증할 때만 허용함.
+//음수인 TxOut이 있거나 TxOut의 합이 사용하는 TxOut의 합보다 크면 코인을 새로 만드는 tx이므로 false. TxOut의 합이 overflow되는 tx도 false.
+//signature는 tx.Id에 서명한 것이므로 id가 내용과 맞는지는 호출하는 쪽에서 먼저 확인해야함.
+func verifyTxIns(tx *Tx, allowLegacy bool, findTxOut func(txIn *TxIn) *TxOut) bool {
+	if len(tx.TxIns) == 0 {
+		return false
+	}
 	valid := true
+	total := 0 // 사용하는 TxOut의 합
 	for _, txIn := range tx.TxIns {
-		prevTx := FindTx(Blockchain(), txIn.TxID)
-		if prevTx == nil { //txid가 txIn.TxID인 모든 tx를 찾아봐서 없으면 txIn.TxID를 가진 tx가 애초에 블록체인에 존재하지 않았다는 의미이므로 false
+		prevTxOut := findTxOut(txIn)
+		if prevTxOut == nil { //사용하려는 TxOut이 없거나 이미 사용되었으므로 false
 			valid = false
 			break
 		}
-		address := prevTx.TxOuts[txIn.Index].Address
-		valid = wallet.Verify(txIn.Signature, tx.Id, address) //publicKey로 검증
+		address := prevTxOut.Address
+		valid = wallet.Verify(txIn.Signature, tx.Id, txIn.PublicKey, address) || //publicKey로 검증
+			allowLegacy && wallet.VerifyLegacy(txIn.Signature, tx.Id, address)
 		if !valid {
 			break
 		}
+		total += prevTxOut.Amount
+	}
+	for _, txOut := range tx.TxOuts { // TxOut을 더하면 overflow로 음수가 될 수 있으므로 남은 금액에서 하나씩 뺌
+		if txOut.Amount < 0 || txOut.Amount > total {
+			return false
+		}
+		total -= txOut.Amount
 	}
 	return valid
 }
 
-// coinbase에서 address에 보상 tx 만들고 tx 리턴
-func makeCoinbaseTx(address string) *Tx {
+// coinbase에서 address에 보상 tx 만들고 tx 리턴. 같은 시간에 채굴한 coinbase tx의 id가 같지 않도록 Index에 block의 height를 넣음
+//보상은 minerReward와 block에 넣은 tx들의 fees를 더한 값.
+func makeCoinbaseTx(address string, height int, fees int) *Tx {
 	txIns := []*TxIn{
-		{"", -1, "COINBASE"},
+		{TxID: "", Index: height, Signature: "COINBASE"},
 	}
 
 	txOuts := []*TxOut{
-		{address, minerReward},
+		{address, minerReward + fees},
 	}
 	tx := Tx{
 		Id:        "",
@@ -120,65 +229,63 @@ func makeCoinbaseTx(address string) *Tx {
 	return &tx
 }
 
+//findTxOut으로 찾은 사용하는 TxOut의 합에서 tx의 TxOut의 합을 뺀 fee. 검증된 tx에만 사용해야함.
+func txFee(tx *Tx, findTxOut func(txIn *TxIn) *TxOut) int {
+	fee := 0
+	for _, txIn := range tx.TxIns {
+		if txOut := findTxOut(txIn); txOut != nil {
+			fee += txOut.Amount
+		}
+	}
+	for _, txOut := range tx.TxOuts {
+		fee -= txOut.Amount
+	}
+	return fee
+}
+
 var ErrorNotFund error = errors.New("not enough funds")
 var ErrorNotValid error = errors.New("not valid tx")
+var ErrorOrphanTx error = errors.New("parent tx not found")
+var ErrNoRecipients = errors.New("tx needs at least one recipient")
+var ErrTooManyRecipients = fmt.Errorf("tx can have at most %d recipients", maxTxOuts)
+var ErrInvalidAmount = errors.New("amount must be more than 0")
+
+//tx를 만드는 방법. 비어있으면 largest-first로 고르고 fee를 내지 않음.
+type SendOptions struct {
+	Strategy string   // 사용할 TxOut을 고르는 방법
+	FeeRate  int      // tx 크기 1000 byte당 fee
+	Coins    []string // coin control. "txID:index"로 지정한 TxOut만 모두 사용함. 있으면 Strategy는 사용하지 않음
+}
 
-//from이 TxOut으로 있는 TxOuts들을 모아서 TxIns을 생성하고 돈 받는사람 to 와 잔돈을 다시 from에게 돌려주는 TxOuts 를 생성. 생성된 TxIns와 TxOuts 로 Tx를 생성하고 그것을 검증하여 검증이 되면 Tx를 리턴.
-func makeTx(from string, to string, amount int) (*Tx, error) { // mempool에 들어갈 tx를 생성
-	if BalanceByAddress(from, Blockchain()) < amount { //잔액이 amount보다 작으면 tx 생성 불가능
-		return nil, ErrorNotFund
-
+//from wallet으로 outputs의 받는 사람들에게 보내는 tx를 options대로 만들어서 서명하고, 그것을 검증하여 검증이 되면 Tx와 고른 TxOut들을 리턴.
+func makeTx(from string, outputs []*TxOut, options SendOptions) (*Tx, *Selection, error) { // mempool에 들어갈 tx를 생성
+	w, err := wallet.Wallets().Get(from)
+	if err != nil {
+		return nil, nil, err
 	}
-	var txOuts []*TxOut
-	var txIns []*TxIn
-	total := 0                                      // 보낼 수 있는 코인의 합
-	uTxOuts := UTxOutsByAddress(from, Blockchain()) //from 의 총 잔액을 계산하기 위한 uTxOuts
-
-	for _, uTxOut := range uTxOuts {
-		if total >= amount { // 보낼 수 있는 코인의 합이 amount보다 크거나 같아야 보낼 수 있음. 이걸 만족하면 더이상 total에 더하지 않아도 됨
-			break
-		}
-		txIn := &TxIn{ //uTxOut을 모아놓은 TxIns 생성
-			TxID:      uTxOut.TxID,
-			Index:     uTxOut.Index,
-			Signature: from,
-		}
-		txIns = append(txIns, txIn)
-		total += uTxOut.Amount
+	if w.WatchOnly() { // 서명하지 않은 tx를 만들어서 offline wallet으로 서명해야함
+		return nil, nil, wallet.ErrWatchOnly
 	}
-	// fmt.Println("total:", total)
-
-	if change := total - amount; change > 0 { //잔돈이 남앗을 때 다시 Txout을 만들고 추가해야함
-		// fmt.Println("change added")
-		changeTxOut := &TxOut{ // 돈을 보내는 from 에게 잔액 change 돌려줌
-			Address: from,
-			Amount:  change,
-		}
-		txOuts = append(txOuts, changeTxOut)
-
+	if w.Status().Locked { // 잠겨있으면 change address를 만들기 전에 멈춤
+		return nil, nil, wallet.ErrWalletLocked
 	}
-
-	txOut := &TxOut{ // 돈 받는 사람
-		Address: to,
-		Amount:  amount,
+	tx, selection, err := buildTx(from, outputs, options)
+	if err != nil {
+		return nil, nil, err
 	}
-
-	txOuts = append(txOuts, txOut) // 돈 받는 사람 to 모아서 TxOuts 생성
-
-	tx := &Tx{ //TxIns 와 TxOuts 로 새로운 Tx 생성
-		Id:        "",
-		Timestamp: int(time.Now().Unix()),
-		TxIns:     txIns,
-		TxOuts:    txOuts,
+	var owners []string // TxIn마다 서명할 address
+	for _, coin := range selection.Coins {
+		owners = append(owners, coin.Address)
+	}
+	if err := tx.sign(from, owners); err != nil { //tx에 signature 생성 후 대입
+		return nil, nil, err
 	}
-	tx.getId() //id 해싱
-	tx.sign()  //tx에 signature 생성 후 대입
 	valid := validate(tx)
 	if !valid {
-		return nil, ErrorNotValid
+		return nil, nil, ErrorNotValid
 	}
 
-	return tx, nil
+	return tx, selection, nil
 
 	// if Blockchain().BalanceByAddress(from) <= amount { // from 이 amount이상의 돈을 가지고 있나 확인
 	// 	return nil, errors.New("not enough money")
@@ -215,39 +322,263 @@ func makeTx(from string, to string, amount int) (*Tx, error) { // mempool에 들
 
 }
 
-//검증이 완료된 Tx를 mempool에 대입하고 Tx를 리턴.
-func (m *mempool) AddTx(to string, amount int) (*Tx, error) {
-	tx, err := makeTx(wallet.Wallet().Address, to, amount)
+//from wallet의 사용할 수 있는 TxOut 중에서 options의 방법으로 골라서 TxIns을 생성하고 돈 받는사람 outputs 와 잔돈을 wallet의 새 change address로 돌려주는 TxOuts 를 생성.
+//받는 사람이 여럿이어도 change TxOut은 하나만 만듬. 생성된 TxIns와 TxOuts 로 서명하지 않은 Tx를 만들어서 고른 TxOut들과 함께 리턴.
+//public key만 있으면 되므로 wallet이 잠겨있어도 만들 수 있음.
+func buildTx(from string, outputs []*TxOut, options SendOptions) (*Tx, *Selection, error) {
+	target := CoinTarget{Outputs: len(outputs), FeeRate: options.FeeRate}
+	amount, err := checkOutputs(outputs, target.dust())
+	if err != nil {
+		return nil, nil, err
+	}
+	target.Amount = amount
+	w, err := wallet.Wallets().Get(from)
+	if err != nil {
+		return nil, nil, err
+	}
+	coins := WalletCoins(w.Addresses())
+	var selection *Selection
+	if len(options.Coins) > 0 {
+		selection, err = selectOutpoints(coins, options.Coins, target)
+	} else {
+		var selector CoinSelector
+		if selector, err = coinSelector(options.Strategy); err == nil {
+			selection, err = selectCoins(selector, coins, target)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var txOuts []*TxOut
+	var txIns []*TxIn
+	for _, coin := range selection.Coins {
+		publicKey, err := w.PublicKey(coin.Address)
+		if err != nil {
+			return nil, nil, err
+		}
+		txIns = append(txIns, &TxIn{TxID: coin.TxID, Index: coin.Index, PublicKey: publicKey})
+	}
+	if selection.Change > 0 { //잔돈이 남앗을 때 다시 Txout을 만들고 추가해야함. dust인 잔돈은 fee로 줌
+		changeAddress, err := w.ChangeAddress()
+		if err != nil {
+			return nil, nil, err
+		}
+		changeTxOut := &TxOut{ // wallet의 change address로 잔액 change 돌려줌
+			Address: changeAddress,
+			Amount:  selection.Change,
+		}
+		txOuts = append(txOuts, changeTxOut)
+
+	}
+
+	for _, output := range outputs { // 돈 받는 사람들. 받은 값을 바꾸지 않도록 복사함
+		txOuts = append(txOuts, &TxOut{Address: output.Address, Amount: output.Amount})
+	}
+
+	tx := &Tx{ //TxIns 와 TxOuts 로 새로운 Tx 생성
+		Id:        "",
+		Timestamp: int(time.Now().Unix()),
+		TxIns:     txIns,
+		TxOuts:    txOuts,
+	}
+	tx.getId() //id 해싱
+	return tx, selection, nil
+}
+
+//받는 사람들의 address와 금액을 확인하고 금액의 합을 리턴. 금액은 0과 dust보다 커야함.
+func checkOutputs(outputs []*TxOut, dust int) (int, error) {
+	if len(outputs) == 0 {
+		return 0, ErrNoRecipients
+	}
+	if len(outputs) > maxTxOuts {
+		return 0, ErrTooManyRecipients
+	}
+	total := 0
+	for _, output := range outputs {
+		if err := wallet.ValidateAddress(output.Address); err != nil { // 잘못 쓴 address로 보내면 아무도 사용할 수 없음
+			return 0, err
+		}
+		if output.Amount <= 0 { // 음수 금액으로 다른 받는 사람의 금액을 채울 수 없도록
+			return 0, fmt.Errorf("%w: %s", ErrInvalidAmount, output.Address)
+		}
+		if output.Amount <= dust {
+			return 0, fmt.Errorf("%w: %s", ErrDustAmount, output.Address)
+		}
+		if total > math.MaxInt-output.Amount { // 어떤 wallet도 보낼 수 없는 금액
+			return 0, ErrorNotFund
+		}
+		total += output.Amount
+	}
+	return total, nil
+}
+
+//addresses가 사용할 수 있는 TxOut들. addresses 순서대로 모음.
+func WalletCoins(addresses []string) []*Coin {
+	var coins []*Coin
+	for _, address := range addresses {
+		for _, uTxOut := range spendableTxOuts(address) {
+			coins = append(coins, &Coin{UTxOut: *uTxOut, Address: address})
+		}
+	}
+	return coins
+}
+
+//address가 사용할 수 있는 uTxOuts. light node는 검증된 wallet tx에서 찾음.
+func spendableTxOuts(address string) []*UTxOut {
+	if Light() {
+		return LightUTxOuts(address)
+	}
+	return UTxOutsByAddress(address, Blockchain())
+}
+
+//uTxOuts의 amount를 모두 더함.
+func sumAmount(uTxOuts []*UTxOut) int {
+	var amount int
+	for _, uTxOut := range uTxOuts {
+		amount += uTxOut.Amount
+	}
+	return amount
+}
+
+//from wallet에서 outputs의 받는 사람들에게 보내는 Tx를 options대로 만들어서 검증이 완료되면 mempool에 대입하고 Tx와 고른 TxOut들을 리턴.
+//tx를 만드는 동안 다른 tx가 같은 TxOut을 사용했을 수 있으므로 mempool lock을 잡고 다시 확인한 후 넣음.
+func (m *mempool) AddTx(from string, outputs []*TxOut, options SendOptions) (*Tx, *Selection, error) {
+	tx, selection, err := makeTx(from, outputs, options) // blockchain lock을 먼저 잡기 위해 mempool lock 전에 만듬
 	//utils.HandleErr(err) 이거로 하면 return값이 error가 아니고 log.panic이기때문에 안댐
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
+	m.m.Lock()
+	defer m.m.Unlock()
+	for _, txIn := range tx.TxIns {
+		if isOnMempool(&UTxOut{TxID: txIn.TxID, Index: txIn.Index}) || !Light() && FindUTxO(txIn.TxID, txIn.Index) == nil { // 그 사이에 다른 tx나 block이 사용한 TxOut
+			return nil, nil, ErrorNotValid
+		}
+	}
 	// m.Txs = append(m.Txs, tx)
 	m.Txs[tx.Id] = tx
-	return tx, nil
+	watch().pending(tx)
+	return tx, selection, nil
 }
 
-//mempool에 tx를 추가
-func (m *mempool) AddPeerTx(tx *Tx) {
+//peer에게 받은 tx를 검증 후 mempool에 추가. 사용하려는 TxOut을 가진 tx를 아직 받지 못했으면 orphan pool에 보관하고
+//없는 tx id들과 ErrorOrphanTx를 리턴해서 peer에게 요청할 수 있게 함. tx가 추가되면 tx를 기다리던 orphan tx들도 처리함.
+func (m *mempool) AddPeerTx(tx *Tx) ([]string, error) {
+	missing, err := m.addPeerTx(tx)
+	if err != nil {
+		return missing, err
+	}
+	m.processOrphanTxs(tx.Id)
+	return nil, nil
+}
+
+//tx가 사용하려는 TxOut을 UTXO set과 mempool에서 찾아서 검증 후 mempool에 추가. 없는 부모가 있으면 orphan pool에 보관.
+//UTXO set과 mempool 어디에도 없는 TxOut은 아직 받지 못한 tx의 것인지 이미 사용된 것인지 구분하지 않고 없는 부모로 처리함.
+//이미 사용된 TxOut을 기다리는 orphan은 부모가 오지 않으므로 만료되어 버려짐.
+func (m *mempool) addPeerTx(tx *Tx) ([]string, error) {
+	if !validAddresses(tx) {
+		return nil, ErrorNotValid
+	}
+	chainTxOuts := make(map[string]*TxOut) // UTXO set에서 찾은 TxOut. key : utxoKey
+	for _, txIn := range tx.TxIns {
+		if txIn.Signature == "COINBASE" { // coinbase tx는 block 안에서만 만들어짐
+			return nil, ErrorNotValid
+		}
+		if txOut := FindUTxO(txIn.TxID, txIn.Index); txOut != nil {
+			chainTxOuts[utxoKey(txIn.TxID, txIn.Index)] = txOut
+		}
+	}
+
 	m.m.Lock()
 	defer m.m.Unlock()
+	if _, ok := m.Txs[tx.Id]; ok { //이미 mempool에 있는 tx
+		return nil, nil
+	}
+	var missing []string
+	requested := make(map[string]bool)
+	for _, txIn := range tx.TxIns {
+		if _, ok := chainTxOuts[utxoKey(txIn.TxID, txIn.Index)]; ok {
+			continue
+		}
+		if _, ok := m.Txs[txIn.TxID]; ok { //mempool에 있는 tx의 TxOut을 사용하는 tx
+			continue
+		}
+		if !requested[txIn.TxID] { // 같은 부모를 두번 넣지 않도록
+			missing = append(missing, txIn.TxID)
+			requested[txIn.TxID] = true
+		}
+	}
+	if len(missing) > 0 {
+		if !orphans.addTx(tx, missing) {
+			return nil, ErrorNotValid
+		}
+		return missing, ErrorOrphanTx
+	}
+	for _, txIn := range tx.TxIns {
+		if isOnMempool(&UTxOut{TxID: txIn.TxID, Index: txIn.Index}) { //mempool의 다른 tx가 이미 사용한 TxOut
+			return nil, ErrorNotValid
+		}
+	}
+	valid := tx.Id == tx.calculateId() && verifyTxIns(tx, false, func(txIn *TxIn) *TxOut {
+		if txOut, ok := chainTxOuts[utxoKey(txIn.TxID, txIn.Index)]; ok {
+			return txOut
+		}
+		return txOutOf(m.Txs[txIn.TxID], txIn.Index)
+	})
+	if !valid {
+		return nil, ErrorNotValid
+	}
 	// m.Txs = append(m.Txs, tx)
 	m.Txs[tx.Id] = tx
+	watch().pending(tx)
+	return nil, nil
+}
+
+//parentID를 부모로 가지는 orphan tx들을 다시 처리. mempool에 추가된 orphan tx를 기다리던 orphan tx들도 이어서 처리함.
+func (m *mempool) processOrphanTxs(parentID string) {
+	queue := []string{parentID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, tx := range orphans.takeTxs(id) {
+			if _, err := m.addPeerTx(tx); err == nil {
+				queue = append(queue, tx.Id)
+			}
+		}
+	}
+}
+
+//mempool에서 ID가 targetID와 같은 Tx를 찾아서 리턴
+func FindMempoolTx(m *mempool, targetID string) *Tx {
+	m.m.Lock()
+	defer m.m.Unlock()
+	return m.Txs[targetID]
 }
 
 //mempool의 tx를 승인하고 mempool을 비우는 역할
 //coinbase tx를 생성하고 mempool에 coinbase tx를 추가함. 그 후 mempool을 초기화하고 []*Tx를 리턴
-func (m *mempool) TxToConfirm() []*Tx {
-	coinbase := makeCoinbaseTx(wallet.Wallet().Address) //coinbase에서 채굴자에게 주는 보상 tx
+//tx들의 fee는 UTXO set이나 mempool의 부모 tx에서 사용하는 TxOut을 찾아서 계산하고 coinbase로 받음.
+func (m *mempool) TxToConfirm(height int) []*Tx {
+	m.m.Lock()
+	defer m.m.Unlock()
 	// txs := m.Txs                // 처음에 coinbase 에서 보낸 tx는 들어가있지 않으므로
 	var txs []*Tx
+	fees := 0
 
 	// txs = append(txs, coinbase) // 여기서 추가해줌. 순서는 바뀌는데 상관없는듯?
 	for _, tx := range m.Txs {
 		txs = append(txs, tx)
+		fees += txFee(tx, func(txIn *TxIn) *TxOut {
+			if txOut := FindUTxO(txIn.TxID, txIn.Index); txOut != nil {
+				return txOut
+			}
+			return txOutOf(m.Txs[txIn.TxID], txIn.Index)
+		})
 	}
 
+	coinbase := makeCoinbaseTx(wallet.Wallet().Address, height, fees) //coinbase에서 채굴자에게 주는 보상 tx
 	txs = append(txs, coinbase)
 
 	// m.Txs = nil // mempool 비우기
@@ -257,6 +588,7 @@ func (m *mempool) TxToConfirm() []*Tx {
 }
 
 //모든 tx 의 모든 TxIn과 uTxOut를 비교하여 uTxOut이 사용되었나 사용되지않았나 판단함. 사용되었을경우 mempool에 존재함(true).
+//mempool lock을 가지고 있어야함.
 func isOnMempool(uTxOut *UTxOut) bool {
 	exists := false
 Outer:
@@ -0,0 +1,197 @@
+package blockchain
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yyuurriiaa/ProjectMSSP/wallet"
+)
+
+func TestTxId(t *testing.T) {
+	two := &Tx{Timestamp: 1, TxOuts: []*TxOut{{"A", 5}, {"B", 3}}}
+	one := &Tx{Timestamp: 1, TxOuts: []*TxOut{{"A 5} {B", 3}}} // fmt.Sprint하면 two와 같은 문자열
+	if two.textId() != one.textId() {
+		t.Fatal("Expected the text ids to collide")
+	}
+	if two.calculateId() == one.calculateId() {
+		t.Error("Expected txs with different outputs to have different ids")
+	}
+	moved := &Tx{Timestamp: 1, TxIns: []*TxIn{{TxID: "ab", Index: 1}}}
+	if (&Tx{Timestamp: 1, TxIns: []*TxIn{{TxID: "a", Index: 1}}}).calculateId() == moved.calculateId() ||
+		(&Tx{Timestamp: 1, TxIns: []*TxIn{{TxID: "ab1", Index: 0}}}).calculateId() == moved.calculateId() {
+		t.Error("Expected the tx id and index of an input not to run together")
+	}
+}
+
+//tx와 같은 TxOut들을 사용해서 outputs로 보내는 tx를 wallet으로 서명해서 만듬. 사용하는 TxOut은 UTXO set에 있어야함.
+func respend(t *testing.T, tx *Tx, outputs []*TxOut) *Tx {
+	t.Helper()
+	spend := &Tx{Timestamp: tx.Timestamp, TxOuts: outputs}
+	var owners []string
+	for _, txIn := range tx.TxIns {
+		spend.TxIns = append(spend.TxIns, &TxIn{TxID: txIn.TxID, Index: txIn.Index})
+		owners = append(owners, FindUTxO(txIn.TxID, txIn.Index).Address)
+	}
+	spend.getId()
+	if err := spend.sign(wallet.DefaultName, owners); err != nil {
+		t.Fatal(err)
+	}
+	return spend
+}
+
+func TestInvalidAddress(t *testing.T) {
+	newTestChain(t)
+	Blockchain().AddBlock()
+	tx := sendTo(t, testRecipient, 7)
+	Mempool().Txs = make(map[string]*Tx)
+
+	bad := respend(t, tx, []*TxOut{{testRecipient[:len(testRecipient)-1], 7}}) // 서명은 맞고 address만 틀린 tx
+	if _, err := Mempool().AddPeerTx(bad); err != ErrorNotValid {
+		t.Errorf("Expected ErrorNotValid for a peer tx, got %v", err)
+	}
+
+	tip, err := FindBlock(Blockchain().NewestHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Blockchain().AddPeerBlock(testBlock(tip, "not an address")); !errors.Is(err, ErrBlockNotValid) {
+		t.Errorf("Expected ErrBlockNotValid for a coinbase to an unreadable address, got %v", err)
+	}
+	if err := Blockchain().AddPeerBlock(testBlock(tip, testRecipient, bad)); !errors.Is(err, ErrBlockNotValid) {
+		t.Errorf("Expected ErrBlockNotValid for a tx to an unreadable address, got %v", err)
+	}
+	if err := Blockchain().AddPeerBlock(testBlock(tip, testRecipient, tx)); err != nil {
+		t.Errorf("Expected the tx to a valid address to be accepted, got %v", err)
+	}
+}
+
+func TestOverflowingOutputs(t *testing.T) {
+	newTestChain(t)
+	Blockchain().AddBlock()
+	tx := sendTo(t, testRecipient, 7)
+	Mempool().Txs = make(map[string]*Tx)
+
+	//두 TxOut의 합은 overflow되어 사용하는 coin보다 작아짐
+	overflowing := respend(t, tx, []*TxOut{{testRecipient, math.MaxInt}, {testRecipient, math.MaxInt}})
+	if _, err := Mempool().AddPeerTx(overflowing); err != ErrorNotValid {
+		t.Errorf("Expected ErrorNotValid for a peer tx, got %v", err)
+	}
+	tip, err := FindBlock(Blockchain().NewestHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Blockchain().AddPeerBlock(testBlock(tip, testRecipient, overflowing)); !errors.Is(err, ErrBlockNotValid) {
+		t.Errorf("Expected ErrBlockNotValid, got %v", err)
+	}
+	negative := respend(t, tx, []*TxOut{{testRecipient, -1}, {testRecipient, 7}})
+	if _, err := Mempool().AddPeerTx(negative); err != ErrorNotValid {
+		t.Errorf("Expected ErrorNotValid for a negative TxOut, got %v", err)
+	}
+}
+
+//-race로 실행하면 mempool을 lock 없이 읽거나 쓰는 곳을 찾음
+func TestConcurrentAddTx(t *testing.T) {
+	newTestChain(t)
+	for i := 0; i < 3; i++ {
+		Blockchain().AddBlock()
+	}
+	if err := wallet.Wallet().Unlock("passphrase", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() { // tx를 넣는 동안 mempool을 계속 읽음
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				mempoolTxs()
+				UTxOutsByAddress(testRecipient, Blockchain())
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	sent := make(chan *Tx, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if tx, _, err := Mempool().AddTx(wallet.DefaultName, []*TxOut{{testRecipient, 30}}, SendOptions{}); err == nil {
+				sent <- tx
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	close(sent)
+
+	spent := make(map[string]bool)
+	count := 0
+	for tx := range sent {
+		count++
+		if FindMempoolTx(Mempool(), tx.Id) == nil {
+			t.Errorf("Expected tx %s to be in the mempool", tx.Id)
+		}
+		for _, txIn := range tx.TxIns {
+			key := utxoKey(txIn.TxID, txIn.Index)
+			if spent[key] {
+				t.Errorf("Expected %s to be spent only once", key)
+			}
+			spent[key] = true
+		}
+	}
+	if count == 0 || count != len(Mempool().Txs) {
+		t.Errorf("Expected every added tx in the mempool, got %d of %d", len(Mempool().Txs), count)
+	}
+}
+
+func TestMinerFees(t *testing.T) {
+	newTestChain(t)
+	Blockchain().AddBlock()
+	if err := wallet.Wallet().Unlock("passphrase", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	tx, selection, err := Mempool().AddTx(wallet.DefaultName, []*TxOut{{testRecipient, 30}}, SendOptions{FeeRate: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if selection.Fee <= 0 {
+		t.Fatalf("Expected the tx to pay a fee, got %d", selection.Fee)
+	}
+	tip, err := FindBlock(Blockchain().NewestHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("coinbase cannot claim more than the fees", func(t *testing.T) {
+		block := &Block{PrevHash: tip.Hash, Height: tip.Height + 1, Difficulty: defaultDifficulty}
+		block.Transactions = []*Tx{tx, makeCoinbaseTx(testRecipient, block.Height, selection.Fee+1)}
+		block.MerkleRoot = merkleRoot(block.Transactions)
+		block.mine()
+		if err := Blockchain().AddPeerBlock(block); !errors.Is(err, ErrBlockNotValid) {
+			t.Errorf("Expected ErrBlockNotValid, got %v", err)
+		}
+	})
+
+	t.Run("mined block pays the fees to the miner", func(t *testing.T) {
+		block := Blockchain().AddBlock()
+		coinbase := block.Transactions[len(block.Transactions)-1]
+		if !isCoinbase(coinbase) || coinbase.TxOuts[0].Amount != minerReward+selection.Fee {
+			t.Errorf("Expected the coinbase to pay %d, got %+v", minerReward+selection.Fee, coinbase.TxOuts[0])
+		}
+		total := 0
+		for _, amount := range utxoBalances() {
+			total += amount
+		}
+		if total != Blockchain().Height*minerReward {
+			t.Errorf("Expected no coins to be burned, got %d in total", total)
+		}
+		if err := validateChain(Blocks(Blockchain())); err != nil { // peer가 검증해도 맞는 block
+			t.Errorf("Expected the mined chain to be valid, got %v", err)
+		}
+	})
+}
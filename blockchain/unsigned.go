@@ -0,0 +1,190 @@
+package blockchain
+
+import (
+	"errors"
+
+	"github.com/yyuurriiaa/ProjectMSSP/wallet"
+)
+
+//서명하지 않은 tx 파일 형식의 버전. 2부터 TxIn이 사용하는 TxOut을 만든 tx 전체를 넣음.
+const unsignedTxVersion int = 2
+
+//서명하지 않은 tx와 서명할 때 필요한 TxIn의 정보. 잠긴 wallet이나 watch-only node에서 만들어서 파일로 옮기고
+//인터넷에 연결되지 않은 컴퓨터의 wallet으로 서명함. 여러 wallet이 차례로 자기 TxIn에 서명할 수 있음.
+type UnsignedTx struct {
+	Version int              `json:"version"`
+	Tx      *Tx              `json:"tx"`
+	Inputs  []*UnsignedInput `json:"inputs"` // Tx.TxIns와 같은 순서
+}
+
+//TxIn이 사용하는 TxOut을 만든 tx. offline wallet은 chain이 없으므로 이 tx로 서명할 key를 찾고 fee를 보여줌.
+//tx를 만든 node가 금액이나 address를 바꿔서 알려줄 수 없도록 tx의 id를 다시 계산해서 TxIn의 TxID와 같은지 확인함.
+type UnsignedInput struct {
+	PrevTx *Tx    `json:"prevTx"`
+	Path   string `json:"path,omitempty"` // HD wallet에서 address의 경로
+}
+
+var ErrUnsignedTx = errors.New("unsigned tx is not valid")
+var ErrNotSigned = errors.New("tx is not fully signed")
+var ErrPrevTxNotFound = errors.New("tx of a coin cannot be checked offline, coins of pruned blocks or of txs made before the length-prefixed tx id cannot be signed offline")
+
+//id를 가지는 tx. full node는 block에서 찾고 light node는 wallet tx에서 찾음. 지운 block의 tx는 찾을 수 없음.
+func findPrevTx(id string) *Tx {
+	if Light() {
+		return findLightTx(id)
+	}
+	return FindTx(Blockchain(), id)
+}
+
+//from wallet으로 outputs의 받는 사람들에게 보내는 서명하지 않은 tx를 options대로 만듬. wallet이 잠겨있어도 만들 수 있음.
+//사용할 TxOut은 서명된 tx를 mempool에 넣을 때까지 다른 tx에 사용될 수 있음.
+func MakeUnsignedTx(from string, outputs []*TxOut, options SendOptions) (*UnsignedTx, error) {
+	tx, selection, err := buildTx(from, outputs, options)
+	if err != nil {
+		return nil, err
+	}
+	w, err := wallet.Wallets().Get(from)
+	if err != nil {
+		return nil, err
+	}
+	u := &UnsignedTx{Version: unsignedTxVersion, Tx: tx}
+	for _, coin := range selection.Coins {
+		prevTx := findPrevTx(coin.TxID)
+		if prevTx == nil || prevTx.calculateId() != coin.TxID { // 이전 형식의 tx는 offline wallet이 id를 확인할 수 없음
+			return nil, ErrPrevTxNotFound
+		}
+		u.Inputs = append(u.Inputs, &UnsignedInput{PrevTx: prevTx, Path: w.Path(coin.Address)})
+	}
+	return u, nil
+}
+
+//파일 형식과 tx의 id를 확인. id가 내용과 다르면 서명할 내용이 보여준 내용과 다를 수 있음.
+//Inputs의 tx도 id를 다시 계산해서 TxIn이 사용하는 tx인지 확인함. 이전 형식의 tx는 id를 다시 계산할 수 없으므로 서명할 수 없음.
+func (u *UnsignedTx) Check() error {
+	if u.Version != unsignedTxVersion || !decodedTx(u.Tx) || len(u.Tx.TxIns) == 0 || len(u.Inputs) != len(u.Tx.TxIns) ||
+		u.Tx.Id != u.Tx.calculateId() || isCoinbase(u.Tx) {
+		return ErrUnsignedTx
+	}
+	for i, txIn := range u.Tx.TxIns {
+		input := u.Inputs[i]
+		if input == nil || !decodedTx(input.PrevTx) || input.PrevTx.calculateId() != txIn.TxID || txIn.Index < 0 || txIn.Index >= len(input.PrevTx.TxOuts) {
+			return ErrUnsignedTx
+		}
+	}
+	return nil
+}
+
+//파일에서 읽은 tx에 null인 TxIn이나 TxOut이 없는지 확인.
+func decodedTx(tx *Tx) bool {
+	if tx == nil {
+		return false
+	}
+	for _, txIn := range tx.TxIns {
+		if txIn == nil {
+			return false
+		}
+	}
+	for _, txOut := range tx.TxOuts {
+		if txOut == nil {
+			return false
+		}
+	}
+	return true
+}
+
+//i번째 TxIn이 사용하는 TxOut. Check로 확인한 후에 사용해야함.
+func (u *UnsignedTx) prevTxOut(i int) *TxOut {
+	return u.Inputs[i].PrevTx.TxOuts[u.Tx.TxIns[i].Index]
+}
+
+//사용하는 TxOut의 금액에서 TxOut의 합을 뺀 fee. Check로 확인한 후에 사용해야함.
+func (u *UnsignedTx) Fee() int {
+	fee := 0
+	for i := range u.Inputs {
+		fee += u.prevTxOut(i).Amount
+	}
+	for _, txOut := range u.Tx.TxOuts {
+		fee -= txOut.Amount
+	}
+	return fee
+}
+
+//from wallet이 가진 address의 TxIn에 서명하고 서명한 TxIn의 수를 리턴. 다른 wallet의 TxIn은 그대로 둠.
+func (u *UnsignedTx) Sign(from string) (int, error) {
+	if err := u.Check(); err != nil {
+		return 0, err
+	}
+	w, err := wallet.Wallets().Get(from)
+	if err != nil {
+		return 0, err
+	}
+	signed := 0
+	for i, txIn := range u.Tx.TxIns {
+		address := u.prevTxOut(i).Address
+		if path := u.Inputs[i].Path; path != "" {
+			if err := w.AddPath(address, path); err != nil && !errors.Is(err, wallet.ErrUnknownAddress) && !errors.Is(err, wallet.ErrInvalidPath) {
+				return signed, err
+			}
+		}
+		publicKey, err := w.PublicKey(address)
+		if errors.Is(err, wallet.ErrUnknownAddress) {
+			continue
+		}
+		if err != nil {
+			return signed, err
+		}
+		signature, err := wallet.Sign(u.Tx.Id, address, w)
+		if err != nil {
+			return signed, err
+		}
+		txIn.Signature = signature
+		txIn.PublicKey = publicKey
+		signed++
+	}
+	return signed, nil
+}
+
+//모든 TxIn에 서명했는지.
+func (u *UnsignedTx) Complete() bool {
+	for _, txIn := range u.Tx.TxIns {
+		if txIn.Signature == "" {
+			return false
+		}
+	}
+	return true
+}
+
+//밖에서 서명한 tx를 peer에게 받은 tx와 같이 검증해서 mempool에 추가. 사용하는 TxOut이 UTXO set과 mempool에 없으면 보관하지 않고 ErrorOrphanTx.
+//light node는 wallet tx와 mempool에서 사용하는 TxOut을 찾음.
+func (m *mempool) AddRawTx(tx *Tx) error {
+	if len(tx.TxIns) == 0 || isCoinbase(tx) {
+		return ErrorNotValid
+	}
+	for _, txIn := range tx.TxIns {
+		if txIn.Signature == "" {
+			return ErrNotSigned
+		}
+	}
+	if Light() {
+		if !validAddresses(tx) || !validate(tx) {
+			return ErrorNotValid
+		}
+		m.m.Lock()
+		defer m.m.Unlock()
+		for _, txIn := range tx.TxIns {
+			if isOnMempool(&UTxOut{TxID: txIn.TxID, Index: txIn.Index}) {
+				return ErrorNotValid
+			}
+		}
+		m.Txs[tx.Id] = tx
+		watch().pending(tx)
+		return nil
+	}
+	for _, txIn := range tx.TxIns {
+		if FindUTxO(txIn.TxID, txIn.Index) == nil && FindMempoolTx(m, txIn.TxID) == nil { // 받지 못했거나 이미 사용된 TxOut
+			return ErrorOrphanTx
+		}
+	}
+	_, err := m.AddPeerTx(tx)
+	return err
+}
@@ -0,0 +1,125 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/yyuurriiaa/ProjectMSSP/wallet"
+)
+
+func TestUnsignedTx(t *testing.T) {
+	prevA := &Tx{Timestamp: 1, TxIns: []*TxIn{{Index: -1, Signature: "COINBASE"}}, TxOuts: []*TxOut{{"me", 20}}}
+	prevB := &Tx{Timestamp: 2, TxIns: []*TxIn{{TxID: "c", Index: 0}}, TxOuts: []*TxOut{{"alice", 5}, {"me", 27}}}
+	prevA.getId()
+	prevB.getId()
+	tx := &Tx{Timestamp: 3, TxIns: []*TxIn{{TxID: prevA.Id, Index: 0}, {TxID: prevB.Id, Index: 1}}, TxOuts: []*TxOut{{"bob", 30}, {"change", 15}}}
+	tx.getId()
+	u := &UnsignedTx{Version: unsignedTxVersion, Tx: tx, Inputs: []*UnsignedInput{{PrevTx: prevA}, {PrevTx: prevB}}}
+	if err := u.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if u.Fee() != 2 {
+		t.Errorf("Expected fee 2, got %d", u.Fee())
+	}
+	if u.prevTxOut(1).Address != "me" {
+		t.Errorf("Expected the address of the spent TxOut, got %s", u.prevTxOut(1).Address)
+	}
+	if u.Complete() {
+		t.Error("Expected an unsigned tx not to be complete")
+	}
+	tx.TxIns[0].Signature, tx.TxIns[1].Signature = "aa", "bb"
+	if !u.Complete() || u.Check() != nil {
+		t.Error("Expected signatures not to change the tx id")
+	}
+
+	tx.TxOuts[0].Amount = 40 // 서명할 내용을 바꾸면 id가 달라짐
+	if err := u.Check(); err != ErrUnsignedTx {
+		t.Errorf("Expected ErrUnsignedTx for a changed tx, got %v", err)
+	}
+	tx.TxOuts[0].Amount = 30
+	u.Inputs = u.Inputs[:1]
+	if err := u.Check(); err != ErrUnsignedTx {
+		t.Errorf("Expected ErrUnsignedTx for missing inputs, got %v", err)
+	}
+	u.Inputs = []*UnsignedInput{{PrevTx: prevA}, {PrevTx: prevB}}
+
+	t.Run("inputs cannot be changed by the online node", func(t *testing.T) {
+		prevB.TxOuts[1].Amount = 1000 // fee를 작게 보이게 함
+		if err := u.Check(); err != ErrUnsignedTx {
+			t.Errorf("Expected ErrUnsignedTx for a changed amount, got %v", err)
+		}
+		prevB.TxOuts[1].Amount = 27
+		prevB.TxOuts[1].Address = "other" // 다른 key로 서명하게 함
+		if err := u.Check(); err != ErrUnsignedTx {
+			t.Errorf("Expected ErrUnsignedTx for a changed address, got %v", err)
+		}
+		prevB.TxOuts[1].Address = "me"
+		u.Inputs[0], u.Inputs[1] = u.Inputs[1], u.Inputs[0]
+		if err := u.Check(); err != ErrUnsignedTx {
+			t.Errorf("Expected ErrUnsignedTx for swapped inputs, got %v", err)
+		}
+		u.Inputs[0], u.Inputs[1] = u.Inputs[1], u.Inputs[0]
+		if err := u.Check(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("malformed files", func(t *testing.T) {
+		data, err := json.Marshal(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m map[string]interface{}
+		json.Unmarshal(data, &m)
+		m["inputs"].([]interface{})[1].(map[string]interface{})["prevTx"].(map[string]interface{})["txOuts"] = []interface{}{nil}
+		if data, err = json.Marshal(m); err != nil {
+			t.Fatal(err)
+		}
+		malformed := &UnsignedTx{}
+		if err := json.Unmarshal(data, malformed); err != nil {
+			t.Fatal(err)
+		}
+		if err := malformed.Check(); err != ErrUnsignedTx {
+			t.Errorf("Expected ErrUnsignedTx for a null TxOut, got %v", err)
+		}
+		malformed.Inputs[1] = nil
+		if err := malformed.Check(); err != ErrUnsignedTx {
+			t.Errorf("Expected ErrUnsignedTx for a null input, got %v", err)
+		}
+	})
+}
+
+func TestSignUnsignedTx(t *testing.T) {
+	newTestChain(t)
+	Blockchain().AddBlock()
+	Blockchain().AddBlock()
+	wallet.Wallet().Lock()
+
+	u, err := MakeUnsignedTx(wallet.DefaultName, []*TxOut{{testRecipient, 70}}, SendOptions{FeeRate: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Check(); err != nil {
+		t.Fatal(err)
+	}
+	for i, txIn := range u.Tx.TxIns {
+		if txOut := FindUTxO(txIn.TxID, txIn.Index); *txOut != *u.prevTxOut(i) {
+			t.Errorf("input %d: Expected %+v, got %+v", i, txOut, u.prevTxOut(i))
+		}
+	}
+	if u.Fee() <= 0 || u.Fee() != (CoinTarget{Outputs: 1, FeeRate: 10}).fee(len(u.Inputs), len(u.Tx.TxOuts) > 1) {
+		t.Errorf("Expected the fee of %d inputs, got %d", len(u.Inputs), u.Fee())
+	}
+
+	if err := wallet.Wallet().Unlock("passphrase", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := u.Sign(wallet.DefaultName)
+	if err != nil || signed != len(u.Inputs) || !u.Complete() {
+		t.Fatalf("Expected every input to be signed, got %d %v", signed, err)
+	}
+	if err := Mempool().AddRawTx(u.Tx); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,159 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yyuurriiaa/ProjectMSSP/db"
+	"github.com/yyuurriiaa/ProjectMSSP/utils"
+)
+
+const minPruneDepth int = 10 // pruning해도 남겨두는 최소 block 수. 난이도 계산과 orphan 처리에 필요함
+
+var pruneDepth int // 0이 아니면 가장 최근 pruneDepth개의 block만 남기고 오래된 block은 header만 남김
+
+var ErrBlockPruned = errors.New("block was pruned")
+var ErrPruneDepth = fmt.Errorf("prune depth must be at least %d", minPruneDepth)
+
+//오래된 block을 지우는 pruned node로 만듬. 가장 최근 depth개의 block만 남김.
+func SetPrune(depth int) error {
+	if depth < minPruneDepth {
+		return ErrPruneDepth
+	}
+	pruneDepth = depth
+	return nil
+}
+
+//오래된 block이 없는 node인지 확인. pruning하거나 UTXO snapshot으로 시작해서 아직 모든 block을 받지 않은 node.
+func Pruned() bool {
+	if pruneDepth > 0 {
+		return true
+	}
+	if b == nil { // blockchain을 사용하지 않는 light node
+		return false
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.PrunedHeight > 0
+}
+
+//UTXO set의 key. tx id와 TxOut의 위치.
+func utxoKey(txID string, index int) string {
+	return fmt.Sprintf("%s:%d", txID, index)
+}
+
+//UTXO set의 key를 tx id와 TxOut의 위치로 나눔.
+func splitUTxOKey(key string) (string, int) {
+	i := strings.LastIndex(key, ":")
+	index, _ := strconv.Atoi(key[i+1:])
+	return key[:i], index
+}
+
+//block의 tx들이 새로 만든 TxOut과 사용한 TxOut의 key. block 안에서 만들고 사용한 TxOut은 add에 넣지 않음.
+func utxoChanges(block *Block) (map[string]*TxOut, []string) {
+	add := make(map[string]*TxOut)
+	var remove []string
+	for _, tx := range block.Transactions {
+		for _, txIn := range tx.TxIns {
+			if txIn.Signature == "COINBASE" {
+				continue
+			}
+			remove = append(remove, utxoKey(txIn.TxID, txIn.Index))
+		}
+		for index, txOut := range tx.TxOuts {
+			add[utxoKey(tx.Id, index)] = txOut
+		}
+	}
+	for _, key := range remove { // block 안의 tx 순서와 상관없이 사용된 TxOut은 추가하지 않음
+		delete(add, key)
+	}
+	return add, remove
+}
+
+//block의 tx들이 사용한 TxOut을 UTXO set에서 지우고 새로 만든 TxOut을 추가하는 변경을 batch에 넣음.
+//UTXO set이 block까지 반영했다는 것도 같이 저장해서 시작할 때 checkpoint와 맞는지 확인함.
+func applyBlock(batch *db.Batch, block *Block) {
+	add, remove := utxoChanges(block)
+	data := make(map[string][]byte)
+	for key, txOut := range add {
+		data[key] = utils.ToBytes(txOut)
+	}
+	batch.UpdateUTxOs(data, remove)
+	batch.SaveUTxOTip(block.Hash)
+}
+
+//UTXO set을 비우고 blocks로 다시 만드는 변경을 batch에 넣음. blocks는 가장 최근 block이 blocks[0].
+func rebuildUTxOs(batch *db.Batch, blocks []*Block) {
+	batch.EmptyUTxOs()
+	for i := len(blocks) - 1; i >= 0; i-- {
+		applyBlock(batch, blocks[i])
+	}
+}
+
+//UTXO set에서 tx id와 위치로 사용되지 않은 TxOut을 찾음. 없거나 이미 사용되었으면 nil.
+func FindUTxO(txID string, index int) *TxOut {
+	data := db.UTxO(utxoKey(txID, index))
+	if data == nil {
+		return nil
+	}
+	txOut := &TxOut{}
+	utils.FromBytes(txOut, data)
+	return txOut
+}
+
+//가장 최근 pruneDepth개보다 오래된 block을 지우고 header만 남기는 변경을 batch에 넣음. pruned node가 아니면 아무것도 하지 않음.
+//start부터 이전 block을 따라가며 지움. 가장 최근 block은 아직 db에 없을 수 있으므로 그 이전 block의 hash를 받음.
+//b.PrunedHeight만 바꾸므로 호출한 쪽에서 blockchain을 batch에 저장해야함.
+func (b *blockchain) prune(batch *db.Batch, start string) {
+	target := b.Height - pruneDepth // 이 height까지의 block을 지움
+	if pruneDepth == 0 || target <= b.PrunedHeight {
+		return
+	}
+	hashCursor := start
+	for hashCursor != "" {
+		block, err := FindBlock(hashCursor)
+		if err != nil { // 이미 지운 block
+			break
+		}
+		if block.Height <= target {
+			batch.SaveHeader(block.Hash, utils.ToBytes(block.Header()))
+			batch.DeleteBlock(block.Hash)
+		}
+		hashCursor = block.PrevHash
+	}
+	b.PrunedHeight = target
+}
+
+//UTXO set에서 address의 uTxOuts를 찾음. mempool에서 이미 사용한 TxOut은 제외.
+func utxosByAddress(address string) []*UTxOut {
+	m := Mempool()
+	m.m.Lock()
+	defer m.m.Unlock()
+	var uTxOuts []*UTxOut
+	for key, data := range db.UTxOs() {
+		txOut := &TxOut{}
+		utils.FromBytes(txOut, data)
+		if txOut.Address != address {
+			continue
+		}
+		txID, index := splitUTxOKey(key)
+		uTxOut := &UTxOut{
+			TxID:   txID,
+			Index:  index,
+			Amount: txOut.Amount,
+		}
+		if !isOnMempool(uTxOut) { //mempool에 없어야 uTxOut
+			uTxOuts = append(uTxOuts, uTxOut)
+		}
+	}
+	sort.Slice(uTxOuts, func(i, j int) bool { // db의 map 순서와 상관없이 같은 TxOut부터 사용하도록
+		if uTxOuts[i].TxID != uTxOuts[j].TxID {
+			return uTxOuts[i].TxID < uTxOuts[j].TxID
+		}
+		return uTxOuts[i].Index < uTxOuts[j].Index
+	})
+	return uTxOuts
+}
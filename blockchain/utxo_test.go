@@ -0,0 +1,70 @@
+package blockchain
+
+import "testing"
+
+const testRecipient = "MEwxhtqfxh6VMxmePZwK8pzkzmZhosKK1C"
+
+func TestPrune(t *testing.T) {
+	if err := SetPrune(minPruneDepth - 1); err != ErrPruneDepth {
+		t.Errorf("Expected ErrPruneDepth, got %v", err)
+	}
+	newTestChain(t)
+	pruneDepth = difficultyInterval // 빨리 끝나도록 minPruneDepth보다 작게 정함. 난이도를 다시 계산하려면 difficultyInterval개의 block이 필요함
+	chain := Blockchain()
+	chain.AddBlock()
+	sendTo(t, testRecipient, 7)
+	chain.AddBlock()
+	var hashes []string // height 순서
+	for _, block := range Blocks(chain) {
+		hashes = append([]string{block.Hash}, hashes...)
+	}
+	before := utxoBalances()
+	if chain.PrunedHeight != 0 || before[testRecipient] != 7 {
+		t.Fatalf("Expected 7 for the recipient before pruning, got %v", before)
+	}
+
+	for i := 0; i < pruneDepth; i++ {
+		chain.AddBlock()
+	}
+	if !Pruned() || chain.PrunedHeight != chain.Height-pruneDepth {
+		t.Fatalf("Expected blocks up to %d to be pruned, got %d", chain.Height-pruneDepth, chain.PrunedHeight)
+	}
+
+	t.Run("old blocks keep only their headers", func(t *testing.T) {
+		for i, hash := range hashes {
+			if _, err := FindBlock(hash); err != ErrBlockPruned {
+				t.Errorf("block %d: Expected ErrBlockPruned, got %v", i+1, err)
+			}
+			if header := FindHeader(hash); header == nil || header.Height != i+1 {
+				t.Errorf("block %d: Expected the header to remain, got %v", i+1, header)
+			}
+		}
+		if blocks := Blocks(chain); len(blocks) != pruneDepth {
+			t.Errorf("Expected %d blocks with bodies, got %d", pruneDepth, len(blocks))
+		}
+	})
+
+	t.Run("balances do not change", func(t *testing.T) {
+		after := utxoBalances()
+		total := 0
+		for _, amount := range after {
+			total += amount
+		}
+		if after[testRecipient] != 7 || total != chain.Height*minerReward {
+			t.Errorf("Expected 7 for the recipient and %d in total, got %v", chain.Height*minerReward, after)
+		}
+		if got := BalanceByAddress(testRecipient, chain); got != 7 {
+			t.Errorf("Expected a balance of 7, got %d", got)
+		}
+	})
+
+	t.Run("verify skips the pruned bodies", func(t *testing.T) {
+		report, err := VerifyChain(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !report.Valid || report.Checked != chain.Height {
+			t.Errorf("Expected all %d headers to be checked, got %+v", chain.Height, report)
+		}
+	})
+}
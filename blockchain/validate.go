@@ -0,0 +1,202 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yyuurriiaa/ProjectMSSP/db"
+	"github.com/yyuurriiaa/ProjectMSSP/utils"
+)
+
+const (
+	medianTimeBlocks   int = 11       // block의 timestamp는 이전 block들의 timestamp 중간값보다 빠를 수 없음
+	maxFutureBlockTime int = 2 * 3600 // block의 timestamp는 현재 시간보다 2시간 이상 늦을 수 없음
+)
+
+var ErrBlockNotValid = errors.New("block not valid")
+
+//ErrBlockNotValid에 검증에 실패한 이유를 붙임. errors.Is로 ErrBlockNotValid인지 확인할 수 있음.
+func blockError(reason string) error {
+	return fmt.Errorf("%w: %s", ErrBlockNotValid, reason)
+}
+
+//hash를 가지는 block의 header. 지운 block은 저장해둔 header를 찾음.
+func findChainHeader(hash string) *Header {
+	if block, err := FindBlock(hash); err == nil {
+		return block.Header()
+	}
+	return FindHeader(hash)
+}
+
+//hash 이전의 최대 medianTimeBlocks개 block의 timestamp 중간값. hash가 없으면(genesis 이전) 0.
+func medianTime(hash string, find func(hash string) *Header) int {
+	var timestamps []int
+	for header := find(hash); header != nil && len(timestamps) < medianTimeBlocks; header = find(header.PrevHash) {
+		timestamps = append(timestamps, header.Timestamp)
+	}
+	if len(timestamps) == 0 {
+		return 0
+	}
+	sort.Ints(timestamps)
+	return timestamps[len(timestamps)/2]
+}
+
+//merkle root가 생기기 전에 만든 block의 header인지 확인. 이전 형식의 hash는 block과 tx의 메모리 주소까지 넣어서 계산했으므로 다시 계산할 수 없음.
+//그래서 db migration이 기록한 height까지, 업그레이드 전부터 db에 있던 것과 같은 header만 이전 형식으로 인정함.
+func legacyHeader(header *Header) bool {
+	if header.MerkleRoot != "" || header.Height > db.LegacyHeight() {
+		return false
+	}
+	stored := findChainHeader(header.Hash)
+	return stored != nil && *stored == *header
+}
+
+//merkle root가 생기기 전에 만든 block인지 확인. header와 함께 tx들도 db에 있는 block과 같아야함.
+//tx들을 비교할 수 없는 지운 block은 이전 형식으로 인정하지 않음.
+func legacyBlock(block *Block) bool {
+	if !legacyHeader(block.Header()) {
+		return false
+	}
+	stored, err := FindBlock(block.Hash)
+	return err == nil && bytes.Equal(utils.ToBytes(stored), utils.ToBytes(block))
+}
+
+//tx id를 문자열 형식으로 계산하던 때에 만든 block인지 확인. 이전 형식의 id는 다른 내용의 tx가 같은 id를 가질 수 있으므로
+//db migration이 기록한 height까지, 업그레이드 전부터 db에 있던 것과 같은 block만 이전 형식으로 인정함.
+func textIdBlock(block *Block) bool {
+	if block.Height > db.TextIdHeight() {
+		return false
+	}
+	stored, err := FindBlock(block.Hash)
+	return err == nil && bytes.Equal(utils.ToBytes(stored), utils.ToBytes(block))
+}
+
+//header가 prev의 가장 최근 header 다음에 올 수 있는지 검증. 이전 header와 이어지는지, hash, 난이도, timestamp를 확인.
+func checkHeader(header *Header, prev *headerChain, find func(hash string) *Header) error {
+	if header.PrevHash != prev.NewestHash || header.Height != prev.Height+1 {
+		return blockError("does not extend the previous block")
+	}
+	if header.calculateHash() != header.Hash && !legacyHeader(header) {
+		return blockError("hash does not match the header")
+	}
+	if header.Difficulty != prev.nextDifficulty(find) {
+		return blockError("wrong difficulty")
+	}
+	if !strings.HasPrefix(header.Hash, strings.Repeat("0", header.Difficulty)) {
+		return blockError("hash does not meet the difficulty")
+	}
+	if header.Timestamp < medianTime(prev.NewestHash, find) {
+		return blockError("timestamp is before the median time of the previous blocks")
+	}
+	if header.Timestamp > int(time.Now().Unix())+maxFutureBlockTime {
+		return blockError("timestamp is too far in the future")
+	}
+	return nil
+}
+
+//peer에게 받은 block이 가장 최근 block 다음에 올 수 있는지 검증.
+//header, merkle root, coinbase와 모든 tx의 signature와 사용하는 TxOut을 확인. b.m을 잡은 상태에서 호출해야함.
+func (b *blockchain) validateBlock(block *Block) error {
+	prev := &headerChain{NewestHash: b.NewestHash, Height: b.Height, CurrDifficulty: b.CurrDifficulty}
+	return checkBlock(block, prev, findChainHeader, FindUTxO)
+}
+
+//block이 prev의 가장 최근 header 다음에 올 수 있는지 header, merkle root와 tx들을 검증.
+//find로 이전 header를 찾고 findUTxO로 tx가 사용하는 TxOut을 찾음.
+func checkBlock(block *Block, prev *headerChain, find func(hash string) *Header, findUTxO func(txID string, index int) *TxOut) error {
+	if err := checkHeader(block.Header(), prev, find); err != nil {
+		return err
+	}
+	if duplicateTxs(block) {
+		return blockError("duplicate txs")
+	}
+	legacy := legacyBlock(block)
+	if !legacy && !CheckMerkleRoot(block) {
+		return blockError("merkle root does not match the transactions")
+	}
+	return checkBlockTxs(block, legacy || textIdBlock(block), findUTxO)
+}
+
+//genesis부터 시작하는 blocks를 peer에게 받은 block처럼 하나씩 검증. blocks는 가장 최근 block이 blocks[0].
+//db의 blockchain과 UTXO set 대신 blocks만으로 만든 header와 UTXO set을 사용하므로 db는 바뀌지 않음.
+func validateChain(blocks []*Block) error {
+	candidate := &headerChain{}
+	headers := make(map[string]*Header)
+	set := make(map[string]*TxOut)
+	find := func(hash string) *Header { return headers[hash] }
+	findUTxO := func(txID string, index int) *TxOut { return set[utxoKey(txID, index)] }
+	for i := len(blocks) - 1; i >= 0; i-- {
+		block := blocks[i]
+		if err := checkBlock(block, candidate, find, findUTxO); err != nil {
+			return fmt.Errorf("block %d: %w", block.Height, err)
+		}
+		header := block.Header()
+		headers[header.Hash] = header
+		candidate.connect(header)
+		add, remove := utxoChanges(block)
+		for _, key := range remove {
+			delete(set, key)
+		}
+		for key, txOut := range add {
+			set[key] = txOut
+		}
+	}
+	return nil
+}
+
+//block의 tx들을 검증. coinbase tx는 하나만 있고 보상이 minerReward와 다른 tx들의 fee를 더한 값보다 크지 않아야함.
+//다른 tx들은 findUTxO로 찾은 TxOut이나 같은 block의 다른 tx가 만든 TxOut을 사용할 수 있고, 같은 TxOut을 두번 사용할 수 없음.
+//모든 TxOut은 읽을 수 있는 address로 가야함. oldIds가 true인 업그레이드 전의 block은 tx id를 지금 형식으로 다시 계산할 수 없으므로
+//tx id와 address는 확인하지 않고, signature와 사용하는 TxOut만 확인함.
+func checkBlockTxs(block *Block, oldIds bool, findUTxO func(txID string, index int) *TxOut) error {
+	created := make(map[string]*TxOut) // block 안의 tx가 만든 TxOut. block 안의 tx 순서는 상관없음
+	for _, tx := range block.Transactions {
+		for index, txOut := range tx.TxOuts {
+			created[utxoKey(tx.Id, index)] = txOut
+		}
+	}
+	findTxOut := func(txIn *TxIn) *TxOut {
+		if txOut, ok := created[utxoKey(txIn.TxID, txIn.Index)]; ok {
+			return txOut
+		}
+		return findUTxO(txIn.TxID, txIn.Index)
+	}
+	var coinbases []*Tx
+	fees := 0
+	spent := make(map[string]bool)
+	for _, tx := range block.Transactions {
+		if !oldIds && !validAddresses(tx) { // 업그레이드 전의 block에는 이전 형식의 address가 있음
+			return blockError(fmt.Sprintf("tx %s sends to an address that is not valid", tx.Id))
+		}
+		if isCoinbase(tx) {
+			coinbases = append(coinbases, tx)
+			if len(tx.TxOuts) != 1 || tx.TxOuts[0].Amount < 0 || !oldIds && tx.Id != tx.calculateId() {
+				return blockError(fmt.Sprintf("coinbase tx %s not valid", tx.Id))
+			}
+			continue
+		}
+		for _, txIn := range tx.TxIns {
+			key := utxoKey(txIn.TxID, txIn.Index)
+			if spent[key] {
+				return blockError(fmt.Sprintf("tx %s spends %s twice in the block", tx.Id, key))
+			}
+			spent[key] = true
+		}
+		valid := (oldIds || tx.Id == tx.calculateId()) && verifyTxIns(tx, true, findTxOut)
+		if !valid {
+			return blockError(fmt.Sprintf("tx %s not valid", tx.Id))
+		}
+		fees += txFee(tx, findTxOut)
+	}
+	if len(coinbases) != 1 {
+		return blockError("block must have one coinbase tx")
+	}
+	if coinbases[0].TxOuts[0].Amount > minerReward+fees {
+		return blockError(fmt.Sprintf("coinbase tx %s claims more than the reward and the fees", coinbases[0].Id))
+	}
+	return nil
+}
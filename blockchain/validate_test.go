@@ -0,0 +1,28 @@
+package blockchain
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMedianTime(t *testing.T) {
+	headers := make(map[string]*Header)
+	prevHash := ""
+	timestamps := []int{10, 50, 20, 40, 30, 90, 80, 70, 60, 100, 110, 5}
+	for i, timestamp := range timestamps {
+		hash := fmt.Sprint("block", i)
+		headers[hash] = &Header{Hash: hash, PrevHash: prevHash, Timestamp: timestamp}
+		prevHash = hash
+	}
+	find := func(hash string) *Header { return headers[hash] }
+
+	if got := medianTime("", find); got != 0 {
+		t.Errorf("Expected median time before genesis to be 0, got %d", got)
+	}
+	if got := medianTime("block2", find); got != 20 {
+		t.Errorf("Expected median of 3 blocks to be 20, got %d", got)
+	}
+	if got := medianTime("block11", find); got != 60 { // 가장 최근 11개만 사용하므로 10은 빠짐
+		t.Errorf("Expected median of the newest %d blocks to be 60, got %d", medianTimeBlocks, got)
+	}
+}
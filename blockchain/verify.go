@@ -0,0 +1,231 @@
+package blockchain
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/yyuurriiaa/ProjectMSSP/db"
+	"github.com/yyuurriiaa/ProjectMSSP/utils"
+)
+
+//chain 검증 결과. 검증에 실패하면 처음 실패한 block의 height와 이유를 보여줌.
+type VerifyReport struct {
+	Height          int    `json:"height"`                    // db의 checkpoint에 저장된 가장 최근 block의 height
+	Start           int    `json:"start"`                     // 검증을 시작한 height
+	Checked         int    `json:"checked"`                   // 검증한 block의 수
+	UncheckedBlocks int    `json:"uncheckedBlocks,omitempty"` // 사용한 TxOut이 지운 block에 있어서 tx를 검증하지 못한 block의 수
+	Valid           bool   `json:"valid"`
+	FailedHeight    int    `json:"failedHeight,omitempty"`
+	Reason          string `json:"reason,omitempty"`
+}
+
+//REST API로 시작한 검증 작업. 검증은 오래 걸리므로 background에서 실행하고 상태를 보여줌.
+type VerifyJob struct {
+	Running   bool          `json:"running"`
+	Depth     int           `json:"depth"`
+	StartedAt int           `json:"startedAt,omitempty"`
+	Report    *VerifyReport `json:"report,omitempty"` // 마지막으로 끝난 검증의 결과
+	Error     string        `json:"error,omitempty"`
+}
+
+var verifyJob VerifyJob
+var verifyJobM sync.Mutex
+
+//검증 중인 작업이 없으면 가장 최근 depth개의 block을 검증하는 작업을 background에서 시작. depth가 0이면 genesis부터 검증.
+func StartVerify(depth int) {
+	verifyJobM.Lock()
+	defer verifyJobM.Unlock()
+	if verifyJob.Running {
+		return
+	}
+	verifyJob.Running = true
+	verifyJob.Depth = depth
+	verifyJob.StartedAt = int(time.Now().Unix())
+	go func() {
+		report, err := VerifyChain(depth)
+		verifyJobM.Lock()
+		defer verifyJobM.Unlock()
+		verifyJob.Running = false
+		verifyJob.Report = report
+		verifyJob.Error = ""
+		if err != nil {
+			verifyJob.Error = err.Error()
+		}
+	}()
+}
+
+//검증 작업의 상태.
+func VerifyStatus() VerifyJob {
+	verifyJobM.Lock()
+	defer verifyJobM.Unlock()
+	return verifyJob
+}
+
+//db의 blockchain을 genesis부터 다시 검증. depth가 0보다 크면 가장 최근 depth개의 block만 검증함.
+//모든 header의 hash, 난이도, timestamp와 block의 merkle root, coinbase, tx의 signature와 사용한 TxOut을 확인하고
+//data bucket의 checkpoint가 block들과 맞는지, UTXO set이 block들로 만든 것과 같은지 확인함.
+//genesis부터 검증하지 않으면 현재 UTXO set에서 block들을 되돌려서 검증을 시작하는 height의 UTXO set을 만듬.
+func VerifyChain(depth int) (*VerifyReport, error) {
+	if db.Checkpoint() == nil {
+		return nil, ErrNoBlockchain
+	}
+	b := Blockchain()
+	b.m.Lock() // checkpoint와 UTXO set이 같은 block의 것이어야함
+	checkpoint := &blockchain{}
+	checkpoint.fromBytes(db.Checkpoint())
+	utxos := make(map[string]*TxOut)
+	for key, data := range db.UTxOs() {
+		txOut := &TxOut{}
+		utils.FromBytes(txOut, data)
+		utxos[key] = txOut
+	}
+	b.m.Unlock()
+
+	r := &VerifyReport{Height: checkpoint.Height, Start: 1}
+	fail := func(height int, reason string) (*VerifyReport, error) {
+		r.FailedHeight = height
+		r.Reason = reason
+		return r, nil
+	}
+
+	//가장 최근 block부터 genesis까지 header와 block을 찾음
+	headers := make(map[string]*Header)
+	chain := make([]*Header, checkpoint.Height) // chain[i]는 height i+1의 header
+	bodies := make(map[int]*Block)              // 지우지 않은 block. key : height
+	hashCursor := checkpoint.NewestHash
+	for height := checkpoint.Height; height > 0; height-- {
+		block, err := FindBlock(hashCursor)
+		var header *Header
+		switch {
+		case err == nil:
+			header = block.Header()
+			bodies[height] = block
+		case err == ErrBlockPruned && height <= checkpoint.PrunedHeight:
+			header = FindHeader(hashCursor)
+		default:
+			return fail(height, fmt.Sprintf("block %s is missing", hashCursor))
+		}
+		if header.Height != height {
+			return fail(height, fmt.Sprintf("block %s has height %d", hashCursor, header.Height))
+		}
+		headers[header.Hash] = header
+		chain[height-1] = header
+		hashCursor = header.PrevHash
+	}
+	if hashCursor != "" {
+		return fail(1, "genesis block has a previous block")
+	}
+	if newest := chain[len(chain)-1]; checkpoint.CurrDifficulty != newest.Difficulty {
+		return fail(newest.Height, "checkpoint difficulty does not match the newest block")
+	}
+	if depth > 0 && depth < checkpoint.Height {
+		r.Start = checkpoint.Height - depth + 1
+	}
+
+	//tx를 검증하기 시작하는 height의 UTXO set. genesis부터 검증하면 빈 UTXO set에서 시작함
+	view := make(map[string]*TxOut)
+	unknown := make(map[string]bool) // 지운 block에 있어서 값을 알 수 없는 TxOut
+	bodyStart := r.Start
+	if bodyStart <= checkpoint.PrunedHeight {
+		bodyStart = checkpoint.PrunedHeight + 1
+	}
+	if bodyStart > 1 {
+		for key, txOut := range utxos {
+			view[key] = txOut
+		}
+		index := make(map[string]*Tx) // 지우지 않은 block의 tx. key : tx id
+		for _, block := range bodies {
+			for _, tx := range block.Transactions {
+				index[tx.Id] = tx
+			}
+		}
+		for height := checkpoint.Height; height >= bodyStart; height-- {
+			block := bodies[height]
+			add, remove := utxoChanges(block)
+			for key := range add {
+				delete(view, key)
+			}
+			for _, key := range remove {
+				txID, i := splitUTxOKey(key)
+				if blockHasTx(block, txID) { // block 안에서 만들고 사용한 TxOut은 이전 UTXO set에 없음
+					continue
+				}
+				if creator := index[txID]; creator != nil {
+					if txOut := txOutOf(creator, i); txOut != nil { // 없는 TxOut을 사용한 tx는 아래에서 검증에 실패함
+						view[key] = txOut
+					}
+				} else {
+					unknown[key] = true
+				}
+			}
+		}
+	}
+
+	prev := &headerChain{}
+	if r.Start > 1 {
+		prev.connect(chain[r.Start-2])
+	}
+	find := func(hash string) *Header { return headers[hash] }
+	for height := r.Start; height <= checkpoint.Height; height++ {
+		header := chain[height-1]
+		if err := checkHeader(header, prev, find); err != nil {
+			return fail(height, err.Error())
+		}
+		prev.connect(header)
+		r.Checked++
+		block := bodies[height]
+		if height < bodyStart { // header만 남은 block
+			continue
+		}
+		legacy := legacyBlock(block)
+		if !legacy && !CheckMerkleRoot(block) {
+			return fail(height, blockError("merkle root does not match the transactions").Error())
+		}
+		if spendsUnknown(block, unknown) {
+			r.UncheckedBlocks++
+		} else if err := checkBlockTxs(block, legacy || textIdBlock(block), func(txID string, index int) *TxOut { return view[utxoKey(txID, index)] }); err != nil {
+			return fail(height, err.Error())
+		}
+		add, remove := utxoChanges(block)
+		for _, key := range remove {
+			delete(view, key)
+		}
+		for key, txOut := range add {
+			view[key] = txOut
+		}
+	}
+
+	if len(view) != len(utxos) {
+		return fail(checkpoint.Height, "utxo set does not match the blocks")
+	}
+	for key, txOut := range view {
+		if u, ok := utxos[key]; !ok || *u != *txOut {
+			return fail(checkpoint.Height, fmt.Sprintf("utxo %s does not match the blocks", key))
+		}
+	}
+	r.Valid = true
+	return r, nil
+}
+
+//block에 id가 txID인 tx가 있는지 확인.
+func blockHasTx(block *Block, txID string) bool {
+	for _, tx := range block.Transactions {
+		if tx.Id == txID {
+			return true
+		}
+	}
+	return false
+}
+
+//block의 tx가 값을 알 수 없는 TxOut을 사용하는지 확인.
+func spendsUnknown(block *Block, unknown map[string]bool) bool {
+	for _, tx := range block.Transactions {
+		for _, txIn := range tx.TxIns {
+			if unknown[utxoKey(txIn.TxID, txIn.Index)] {
+				return true
+			}
+		}
+	}
+	return false
+}
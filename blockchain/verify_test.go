@@ -0,0 +1,120 @@
+package blockchain
+
+import (
+	"os"
+	"testing"
+
+	"github.com/yyuurriiaa/ProjectMSSP/db"
+)
+
+//db/testdata의 db 파일을 새 node의 db로 복사해서 migration함.
+func openDbFixture(t *testing.T, fixture string) {
+	t.Helper()
+	data, err := os.ReadFile("../db/testdata/" + fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTestChain(t)
+	if err := os.WriteFile("blockchain_test.db", data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//처음 release node가 만든 db 파일(height 5, bob에게 7)을 migration한 후 blockchain을 시작함.
+func openLegacyFixture(t *testing.T) {
+	t.Helper()
+	openDbFixture(t, "v0.db")
+	if db.LegacyHeight() != 5 || Blockchain().Height != 5 {
+		t.Fatalf("Expected a legacy chain of height 5, got %d", Blockchain().Height)
+	}
+}
+
+func TestLegacyChain(t *testing.T) {
+	openLegacyFixture(t)
+	blocks := Blocks(Blockchain())
+
+	t.Run("legacy headers and blocks are accepted", func(t *testing.T) {
+		prev := &headerChain{}
+		for i := len(blocks) - 1; i >= 0; i-- {
+			if err := checkHeader(blocks[i].Header(), prev, findChainHeader); err != nil {
+				t.Fatalf("block %d: %s", blocks[i].Height, err)
+			}
+			if !legacyBlock(blocks[i]) {
+				t.Errorf("Expected block %d to be a legacy block", blocks[i].Height)
+			}
+			prev.connect(blocks[i].Header())
+		}
+	})
+
+	t.Run("tx ids are only skipped in legacy blocks", func(t *testing.T) {
+		find := func(txID string, index int) *TxOut {
+			for _, block := range blocks {
+				for _, tx := range block.Transactions {
+					if tx.Id == txID {
+						return txOutOf(tx, index)
+					}
+				}
+			}
+			return nil
+		}
+		if err := checkBlockTxs(blocks[0], true, find); err != nil {
+			t.Errorf("Expected the txs of the legacy block to be valid, got %s", err)
+		}
+		if err := checkBlockTxs(blocks[0], false, find); err == nil {
+			t.Error("Expected legacy tx ids not to match the new format")
+		}
+	})
+
+	t.Run("verify checks the whole legacy chain", func(t *testing.T) {
+		report, err := VerifyChain(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !report.Valid || report.Checked != 5 {
+			t.Errorf("Expected 5 valid blocks, got %+v", report)
+		}
+	})
+
+	t.Run("changed legacy blocks are not", func(t *testing.T) {
+		changed := *blocks[0].Header()
+		changed.Nonce++
+		if legacyHeader(&changed) {
+			t.Error("Expected a changed header not to be a legacy header")
+		}
+		block := *blocks[0]
+		block.Transactions = []*Tx{{Id: block.Transactions[0].Id, TxIns: block.Transactions[0].TxIns, TxOuts: []*TxOut{{"bob", 50}}}}
+		if legacyBlock(&block) {
+			t.Error("Expected a block with changed txs not to be a legacy block")
+		}
+	})
+}
+
+//merkle root가 있지만 tx id를 문자열 형식으로 계산하던 pruned node의 db 파일(height 13)
+func TestTextIdChain(t *testing.T) {
+	openDbFixture(t, "v1.db")
+	if db.TextIdHeight() != 13 || Blockchain().Height != 13 {
+		t.Fatalf("Expected the txs of 13 blocks to have text ids, got %d", db.TextIdHeight())
+	}
+	newest, err := FindBlock(Blockchain().NewestHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report, err := VerifyChain(0); err != nil || !report.Valid {
+		t.Errorf("Expected the blocks from before the upgrade to be valid, got %+v %v", report, err)
+	}
+	if !textIdBlock(newest) {
+		t.Error("Expected the stored block to keep its text ids")
+	}
+	if err := checkBlockTxs(newest, false, FindUTxO); err == nil {
+		t.Error("Expected text ids not to match the length-prefixed format")
+	}
+	changed := *newest
+	changed.Nonce++
+	if textIdBlock(&changed) {
+		t.Error("Expected a changed block not to keep text ids")
+	}
+}
@@ -0,0 +1,440 @@
+package blockchain
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yyuurriiaa/ProjectMSSP/db"
+	"github.com/yyuurriiaa/ProjectMSSP/utils"
+	"github.com/yyuurriiaa/ProjectMSSP/wallet"
+)
+
+//wallet들이 지켜보는 address의 TxOut과 tx를 block이 연결될 때마다 이어서 기록하는 index. private key 없이 잔액과 history를 보고
+//받은 TxOut마다 알림을 만듬. 메모리에만 두므로 시작할 때와 지켜보는 address가 바뀔 때, chain이 바뀔 때 다시 만듬.
+const (
+	NotificationPending   string = "pending"   // mempool에 들어온 tx로 받음
+	NotificationConfirmed string = "confirmed" // block에 들어간 tx로 받음
+	NotificationReverted  string = "reverted"  // chain이 바뀌어서 받은 tx가 block에서 빠짐
+
+	maxNotifications int = 1000 // 가장 최근 알림만 이만큼 보관함
+)
+
+//지켜보는 address가 TxOut을 받았다는 알림. ID는 node가 시작한 후 1부터 늘어남.
+type Notification struct {
+	ID      int    `json:"id"`
+	Type    string `json:"type"`
+	Address string `json:"address"`
+	TxID    string `json:"txID"`
+	Index   int    `json:"index"`
+	Amount  int    `json:"amount"`
+	Height  int    `json:"height,omitempty"` // mempool의 tx면 0
+	Time    int    `json:"time"`
+}
+
+//지켜보는 address가 받거나 보낸 tx와 그 TxIn이 사용한 TxOut.
+type watchedTx struct {
+	tx       *Tx
+	height   int
+	prevOuts map[string]*TxOut // key는 utxoKey. 찾지 못한 TxOut은 없음
+}
+
+type watchIndex struct {
+	addresses     map[string]bool
+	coins         map[string]*Coin // 사용되지 않은 TxOut. key는 utxoKey
+	txs           []*watchedTx     // 오래된 tx부터
+	ids           map[string]bool  // txs의 tx id
+	used          map[string]bool  // TxOut을 받은 적이 있는 address
+	notifications []*Notification
+	lastID        int
+	changed       chan struct{} // 알림이 추가되면 닫고 새로 만들어서 기다리는 request를 깨움
+	m             sync.Mutex
+}
+
+var wi *watchIndex
+var watchOnce sync.Once
+var refreshM sync.Mutex // RefreshWatched를 한번에 하나만 실행
+
+//singleton으로 watch index 초기화. 지켜보는 address가 없으면 아무것도 기록하지 않음.
+func watch() *watchIndex {
+	watchOnce.Do(func() {
+		wi = &watchIndex{changed: make(chan struct{})}
+		wi.reset(map[string]bool{})
+	})
+	return wi
+}
+
+//addresses를 지켜보도록 기록을 비움. i.m을 가지고 있어야함.
+func (i *watchIndex) reset(addresses map[string]bool) {
+	i.addresses = addresses
+	i.coins = make(map[string]*Coin)
+	i.txs = nil
+	i.ids = make(map[string]bool)
+	i.used = make(map[string]bool)
+}
+
+//tx가 지켜보는 address의 TxOut을 사용하거나 받으면 기록함. TxIn이 사용한 TxOut은 outs, coins, find 순서로 찾고 tx의 TxOut은 outs에 추가함.
+//notify면 받은 TxOut마다 confirmed 알림을 만듬. i.m을 가지고 있어야함.
+func (i *watchIndex) apply(tx *Tx, height int, outs map[string]*TxOut, find func(txID string, index int) *TxOut, notify bool) bool {
+	relevant := false
+	prevOuts := make(map[string]*TxOut)
+	for _, txIn := range tx.TxIns {
+		if txIn.Signature == "COINBASE" {
+			continue
+		}
+		key := utxoKey(txIn.TxID, txIn.Index)
+		txOut := outs[key]
+		if coin, ok := i.coins[key]; ok && txOut == nil {
+			txOut = &TxOut{Address: coin.Address, Amount: coin.Amount}
+		}
+		if txOut == nil && find != nil {
+			txOut = find(txIn.TxID, txIn.Index)
+		}
+		if txOut == nil {
+			continue
+		}
+		prevOuts[key] = txOut
+		relevant = relevant || i.addresses[txOut.Address]
+	}
+	for index, txOut := range tx.TxOuts {
+		outs[utxoKey(tx.Id, index)] = txOut
+		relevant = relevant || i.addresses[txOut.Address]
+	}
+	if !relevant || i.ids[tx.Id] {
+		return false
+	}
+
+	i.txs = append(i.txs, &watchedTx{tx: tx, height: height, prevOuts: prevOuts})
+	i.ids[tx.Id] = true
+	for key := range prevOuts {
+		delete(i.coins, key)
+	}
+	for index, txOut := range tx.TxOuts {
+		if !i.addresses[txOut.Address] {
+			continue
+		}
+		i.used[txOut.Address] = true
+		i.coins[utxoKey(tx.Id, index)] = &Coin{UTxOut: UTxOut{TxID: tx.Id, Index: index, Amount: txOut.Amount}, Address: txOut.Address}
+		if notify {
+			i.notify(NotificationConfirmed, tx, index, height)
+		}
+	}
+	return true
+}
+
+//height의 block에 들어간 txs를 기록. 아직 UTXO set에 반영하기 전이므로 find로 사용한 TxOut을 찾을 수 있음.
+//지켜보는 address의 tx가 있으면 true.
+func (i *watchIndex) connect(txs []*Tx, height int, find func(txID string, index int) *TxOut) bool {
+	i.m.Lock()
+	defer i.m.Unlock()
+	if len(i.addresses) == 0 {
+		return false
+	}
+	outs := make(map[string]*TxOut) // 같은 block에서 만들고 사용한 TxOut
+	touched := false
+	for _, tx := range txs {
+		if i.apply(tx, height, outs, find, true) {
+			touched = true
+		}
+	}
+	return touched
+}
+
+//chain의 txs(오래된 tx부터)로 기록을 다시 만듬. utxos가 있으면 지운 block에서 받은 TxOut도 찾을 수 있도록 UTXO set으로 coins를 만듬.
+//i.m을 가지고 있어야함.
+func (i *watchIndex) rebuild(addresses map[string]bool, txs []*watchedTx, utxos map[string]*TxOut) {
+	i.reset(addresses)
+	outs := make(map[string]*TxOut)
+	for _, wtx := range txs {
+		i.apply(wtx.tx, wtx.height, outs, nil, false)
+	}
+	if utxos == nil {
+		return
+	}
+	i.coins = make(map[string]*Coin)
+	for key, txOut := range utxos {
+		if addresses[txOut.Address] {
+			txID, index := splitUTxOKey(key)
+			i.coins[key] = &Coin{UTxOut: UTxOut{TxID: txID, Index: index, Amount: txOut.Amount}, Address: txOut.Address}
+			i.used[txOut.Address] = true
+		}
+	}
+}
+
+//chain이 바뀌었을 때 새 chain의 txs로 기록을 다시 만들고, 빠진 tx에는 reverted, 새로 들어간 tx에는 confirmed 알림을 만듬.
+func (i *watchIndex) reorg(txs []*watchedTx, utxos map[string]*TxOut) {
+	i.m.Lock()
+	defer i.m.Unlock()
+	if len(i.addresses) == 0 {
+		return
+	}
+	before := i.txs
+	i.rebuild(i.addresses, txs, utxos)
+	for _, wtx := range before {
+		if !i.ids[wtx.tx.Id] {
+			i.notifyReceived(NotificationReverted, wtx.tx, wtx.height)
+		}
+	}
+	old := make(map[string]bool)
+	for _, wtx := range before {
+		old[wtx.tx.Id] = true
+	}
+	for _, wtx := range i.txs {
+		if !old[wtx.tx.Id] {
+			i.notifyReceived(NotificationConfirmed, wtx.tx, wtx.height)
+		}
+	}
+}
+
+//mempool에 들어온 tx가 지켜보는 address에게 보내면 pending 알림을 만듬.
+func (i *watchIndex) pending(tx *Tx) {
+	i.m.Lock()
+	defer i.m.Unlock()
+	i.notifyReceived(NotificationPending, tx, 0)
+}
+
+//tx가 지켜보는 address에게 보낸 TxOut마다 알림을 만듬. i.m을 가지고 있어야함.
+func (i *watchIndex) notifyReceived(kind string, tx *Tx, height int) {
+	for index, txOut := range tx.TxOuts {
+		if i.addresses[txOut.Address] {
+			i.notify(kind, tx, index, height)
+		}
+	}
+}
+
+//알림을 추가하고 기다리는 request를 깨움. i.m을 가지고 있어야함.
+func (i *watchIndex) notify(kind string, tx *Tx, index int, height int) {
+	i.lastID++
+	i.notifications = append(i.notifications, &Notification{
+		ID:      i.lastID,
+		Type:    kind,
+		Address: tx.TxOuts[index].Address,
+		TxID:    tx.Id,
+		Index:   index,
+		Amount:  tx.TxOuts[index].Amount,
+		Height:  height,
+		Time:    int(time.Now().Unix()),
+	})
+	if len(i.notifications) > maxNotifications {
+		i.notifications = append([]*Notification(nil), i.notifications[len(i.notifications)-maxNotifications:]...)
+	}
+	close(i.changed)
+	i.changed = make(chan struct{})
+}
+
+//지금 지켜보는 address가 addresses와 같은지.
+func (i *watchIndex) watching(addresses map[string]bool) bool {
+	i.m.Lock()
+	defer i.m.Unlock()
+	if len(addresses) != len(i.addresses) {
+		return false
+	}
+	for address := range addresses {
+		if !i.addresses[address] {
+			return false
+		}
+	}
+	return true
+}
+
+//지켜보는 address 중 TxOut을 받은 적이 있는 address.
+func (i *watchIndex) usedAddresses() map[string]bool {
+	i.m.Lock()
+	defer i.m.Unlock()
+	used := make(map[string]bool)
+	for address := range i.used {
+		used[address] = true
+	}
+	return used
+}
+
+//불러온 wallet들이 지켜보는 address가 바뀌었으면 index를 다시 만듬. xpub로 만든 watch-only wallet은 index에서 사용한 address를 찾아서
+//wallet에 추가하고, 그 다음 address들도 지켜보도록 바뀌지 않을 때까지 반복함. 시작할 때와 wallet이나 address가 바뀐 후 호출함.
+func RefreshWatched() {
+	refreshM.Lock()
+	defer refreshM.Unlock()
+	for {
+		addresses := make(map[string]bool)
+		for _, w := range wallet.Wallets().Loaded() {
+			for _, address := range w.Watched() {
+				addresses[address] = true
+			}
+		}
+		if !watch().watching(addresses) {
+			rebuildWatched(addresses)
+		}
+		used := watch().usedAddresses()
+		found := 0
+		for _, w := range wallet.Wallets().Loaded() {
+			if !w.WatchOnly() {
+				continue
+			}
+			if n, err := w.Discover(func(address string) bool { return used[address] }); err == nil {
+				found += n
+			}
+		}
+		if found == 0 {
+			return
+		}
+	}
+}
+
+//addresses를 지켜보도록 chain에서 index를 다시 만듬. light node는 merkle proof로 확인한 wallet tx로 만듬.
+func rebuildWatched(addresses map[string]bool) {
+	var txs []*watchedTx
+	if Light() {
+		for _, tx := range lightTxs() {
+			txs = append(txs, &watchedTx{tx: tx.Tx, height: tx.Height})
+		}
+		sort.SliceStable(txs, func(i, j int) bool { return txs[i].height < txs[j].height })
+		i := watch()
+		i.m.Lock()
+		defer i.m.Unlock()
+		i.rebuild(addresses, txs, nil)
+		return
+	}
+	b := Blockchain()
+	b.m.Lock() // 다시 만드는 동안 block이 연결되지 않도록
+	defer b.m.Unlock()
+	txs = chainTxs(b.blocks())
+	i := watch()
+	i.m.Lock()
+	defer i.m.Unlock()
+	i.rebuild(addresses, txs, unspentTxOuts())
+}
+
+//blocks(가장 최근 block이 blocks[0])의 tx들을 오래된 tx부터.
+func chainTxs(blocks []*Block) []*watchedTx {
+	var txs []*watchedTx
+	for i := len(blocks) - 1; i >= 0; i-- {
+		for _, tx := range blocks[i].Transactions {
+			txs = append(txs, &watchedTx{tx: tx, height: blocks[i].Height})
+		}
+	}
+	return txs
+}
+
+//UTXO set의 모든 TxOut. key는 utxoKey.
+func unspentTxOuts() map[string]*TxOut {
+	utxos := make(map[string]*TxOut)
+	for key, data := range db.UTxOs() {
+		txOut := &TxOut{}
+		utils.FromBytes(txOut, data)
+		utxos[key] = txOut
+	}
+	return utxos
+}
+
+//light node가 저장한 wallet tx에서 TxOut을 찾는 함수. 처음 찾을 때 wallet tx를 한번만 읽음.
+func lightTxOutFinder() func(txID string, index int) *TxOut {
+	var txs map[string]*Tx
+	return func(txID string, index int) *TxOut {
+		if txs == nil {
+			txs = make(map[string]*Tx)
+			for _, tx := range lightTxs() {
+				txs[tx.Tx.Id] = tx.Tx
+			}
+		}
+		return txOutOf(txs[txID], index)
+	}
+}
+
+//지켜보는 addresses의 사용되지 않은 TxOut들. mempool에서 이미 사용한 TxOut은 제외. addresses 순서대로 모음.
+func WatchedCoins(addresses []string) []*Coin {
+	spent := make(map[string]bool)
+	for _, tx := range mempoolTxs() {
+		for _, txIn := range tx.TxIns {
+			spent[utxoKey(txIn.TxID, txIn.Index)] = true
+		}
+	}
+	i := watch()
+	i.m.Lock()
+	defer i.m.Unlock()
+	var coins []*Coin
+	for _, address := range addresses {
+		var found []*Coin
+		for key, coin := range i.coins {
+			if coin.Address == address && !spent[key] {
+				found = append(found, coin)
+			}
+		}
+		sort.Slice(found, func(a, b int) bool {
+			return utxoKey(found[a].TxID, found[a].Index) < utxoKey(found[b].TxID, found[b].Index)
+		})
+		coins = append(coins, found...)
+	}
+	return coins
+}
+
+//지켜보는 addresses가 받거나 보낸 tx들. History와 같은 형식이지만 chain 전체 대신 index에서 찾음.
+func WatchedHistory(addresses []string) []*HistoryTx {
+	mine := make(map[string]bool)
+	for _, address := range addresses {
+		mine[address] = true
+	}
+	tip := chainTip()
+	pending := mempoolTxs()
+	i := watch()
+	i.m.Lock()
+	defer i.m.Unlock()
+	txOuts := make(map[string]*TxOut)
+	for _, wtx := range i.txs {
+		for key, txOut := range wtx.prevOuts {
+			txOuts[key] = txOut
+		}
+	}
+	var history []*HistoryTx
+	for _, wtx := range i.txs {
+		if h := historyOf(wtx.tx, wtx.height, mine, txOuts); h != nil {
+			history = append(history, h)
+		}
+	}
+	for _, tx := range pending {
+		if h := historyOf(tx, 0, mine, txOuts); h != nil {
+			history = append(history, h)
+		}
+	}
+	return newestFirst(history, tip)
+}
+
+//addresses에게 온 알림 중 ID가 after보다 큰 알림과 마지막 알림의 ID. 없으면 wait 동안 새 알림을 기다림.
+func Notifications(addresses []string, after int, wait time.Duration) ([]*Notification, int) {
+	mine := make(map[string]bool)
+	for _, address := range addresses {
+		mine[address] = true
+	}
+	deadline := time.Now().Add(wait)
+	i := watch()
+	for {
+		i.m.Lock()
+		found := []*Notification{}
+		for _, n := range i.notifications {
+			if n.ID > after && mine[n.Address] {
+				found = append(found, n)
+			}
+		}
+		last, changed := i.lastID, i.changed
+		i.m.Unlock()
+		remaining := time.Until(deadline)
+		if len(found) > 0 || remaining <= 0 {
+			return found, last
+		}
+		timer := time.NewTimer(remaining)
+		select {
+		case <-changed:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+//가장 최근 block의 height. light node는 header chain의 height.
+func chainTip() int {
+	if Light() {
+		return Headers().Height
+	}
+	b := Blockchain()
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.Height
+}
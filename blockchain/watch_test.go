@@ -0,0 +1,83 @@
+package blockchain
+
+import "testing"
+
+func TestWatchIndex(t *testing.T) {
+	i := &watchIndex{changed: make(chan struct{})}
+	i.reset(map[string]bool{"watched": true})
+	chain := map[string]*TxOut{"funding:0": {"bob", 40}} // UTXO set에 있는 다른 address의 TxOut
+	find := func(txID string, index int) *TxOut { return chain[utxoKey(txID, index)] }
+
+	block1 := []*Tx{
+		{Id: "coinbase", TxIns: []*TxIn{{Index: 1, Signature: "COINBASE"}}, TxOuts: []*TxOut{{"miner", 50}}},
+		{Id: "pay", TxIns: []*TxIn{{TxID: "funding", Index: 0}}, TxOuts: []*TxOut{{"watched", 25}, {"bob", 14}}},
+	}
+	if !i.connect(block1, 1, find) {
+		t.Fatal("Expected the payment to be recorded")
+	}
+	if len(i.txs) != 1 || len(i.coins) != 1 || i.coins["pay:0"] == nil || !i.used["watched"] {
+		t.Fatalf("Expected one tx and one coin, got %d txs and %v", len(i.txs), i.coins)
+	}
+	if len(i.notifications) != 1 || i.notifications[0].Type != NotificationConfirmed || i.notifications[0].Amount != 25 {
+		t.Errorf("Expected a confirmed notification of 25, got %+v", i.notifications)
+	}
+
+	changed := i.changed
+	block2 := []*Tx{
+		{Id: "spend", TxIns: []*TxIn{{TxID: "pay", Index: 0}}, TxOuts: []*TxOut{{"carol", 24}}},
+		{Id: "unrelated", TxIns: []*TxIn{{TxID: "pay", Index: 1}}, TxOuts: []*TxOut{{"carol", 14}}},
+	}
+	if !i.connect(block2, 2, find) {
+		t.Fatal("Expected the spend to be recorded")
+	}
+	if len(i.txs) != 2 || len(i.coins) != 0 || len(i.notifications) != 1 {
+		t.Errorf("Expected the coin to be spent without a notification, got %d txs, %v", len(i.txs), i.coins)
+	}
+	if len(i.txs[1].prevOuts) != 1 || i.txs[1].prevOuts["pay:0"].Amount != 25 {
+		t.Errorf("Expected the spent TxOut to be kept for the history, got %v", i.txs[1].prevOuts)
+	}
+	select {
+	case <-changed:
+		t.Error("Expected no wake up without a notification")
+	default:
+	}
+
+	t.Run("pending payments", func(t *testing.T) {
+		i.pending(&Tx{Id: "mempool", TxOuts: []*TxOut{{"bob", 1}, {"watched", 3}}})
+		last := i.notifications[len(i.notifications)-1]
+		if last.Type != NotificationPending || last.Index != 1 || last.Height != 0 {
+			t.Errorf("Expected a pending notification for the second output, got %+v", last)
+		}
+		select {
+		case <-changed:
+		default:
+			t.Error("Expected waiting requests to wake up")
+		}
+	})
+
+	t.Run("reorg reverts missing payments", func(t *testing.T) {
+		before := len(i.notifications)
+		other := []*watchedTx{
+			{tx: &Tx{Id: "coinbase2", TxIns: []*TxIn{{Index: 1, Signature: "COINBASE"}}, TxOuts: []*TxOut{{"watched", 50}}}, height: 1},
+		}
+		i.reorg(other, map[string]*TxOut{"coinbase2:0": {"watched", 50}})
+		added := i.notifications[before:]
+		if len(added) != 2 || added[0].Type != NotificationReverted || added[0].TxID != "pay" ||
+			added[1].Type != NotificationConfirmed || added[1].TxID != "coinbase2" {
+			t.Errorf("Expected pay to be reverted and coinbase2 confirmed, got %+v %+v", added[0], added[len(added)-1])
+		}
+		if len(i.txs) != 1 || i.coins["coinbase2:0"] == nil || i.coins["pay:0"] != nil {
+			t.Errorf("Expected the index of the new chain, got %v", i.coins)
+		}
+	})
+
+	t.Run("notifications are capped", func(t *testing.T) {
+		tx := &Tx{Id: "many", TxOuts: []*TxOut{{"watched", 1}}}
+		for n := 0; n < maxNotifications+5; n++ {
+			i.pending(tx)
+		}
+		if len(i.notifications) != maxNotifications || i.notifications[len(i.notifications)-1].ID != i.lastID {
+			t.Errorf("Expected the last %d notifications, got %d", maxNotifications, len(i.notifications))
+		}
+	})
+}
@@ -1,12 +1,26 @@
 package cli
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
 	"runtime"
+	"strings"
+	"time"
 
+	"github.com/yyuurriiaa/ProjectMSSP/blockchain"
+	"github.com/yyuurriiaa/ProjectMSSP/db"
 	"github.com/yyuurriiaa/ProjectMSSP/explorer"
+	"github.com/yyuurriiaa/ProjectMSSP/p2p"
 	"github.com/yyuurriiaa/ProjectMSSP/rest"
+	"github.com/yyuurriiaa/ProjectMSSP/utils"
+	"github.com/yyuurriiaa/ProjectMSSP/wallet"
 )
 
 func usage() {
@@ -14,11 +28,513 @@ func usage() {
 	fmt.Printf("please use the following flags:\n\n")
 	fmt.Printf("-port=4000 : set the port of the server\n")
 	fmt.Printf("-mode=rest : start the REST API(recommended)\n")
+	fmt.Printf("-mode=light : start the REST API as a light node that only keeps block headers\n")
+	fmt.Printf("-seeds=127.0.0.1:3000,127.0.0.1:5000 : set the seed peers to bootstrap from\n")
+	fmt.Printf("-wire=binary : set the peer message format. 'json' is easier to debug\n")
+	fmt.Printf("-tls : encrypt peer connections and authenticate nodes by their node key\n")
+	fmt.Printf("-allowlist=nodes.txt : with -tls, only allow the node IDs listed in the file\n")
+	fmt.Printf("-prune=100 : keep only the newest 100 blocks and delete older block bodies\n")
+	fmt.Printf("-snapshot=utxo.snap -snapshot-hash=<hash> : start a new node from a UTXO snapshot instead of all blocks\n")
+	fmt.Printf("-snapshot-verify : download all blocks in the background and check the snapshot against them\n")
+	fmt.Printf("-backup-dir=backups : let POST /admin/backup?path=<file> write backups into this directory\n\n")
+	fmt.Printf("commands (stop the node of the port first):\n\n")
+	fmt.Printf("snapshot -port=4000 -height=100 -out=utxo.snap : export the UTXO set at height 100\n")
+	fmt.Printf("export -port=4000 -out=chain.dat : write all blocks to a file\n")
+	fmt.Printf("import -port=4000 -in=chain.dat : validate and add the blocks of a file\n")
+	fmt.Printf("verify -port=4000 -depth=100 : check the newest 100 blocks of the db (0 checks from genesis)\n")
+	fmt.Printf("migrate -port=4000 -dry-run : upgrade an old db to the current format (-dry-run only lists the steps)\n")
+	fmt.Printf("backup -port=4000 -out=backup.tar -wallet -tls : back up the db and wallet file, also while the node is running (-tls if the node uses it)\n")
+	fmt.Printf("restore -port=4000 -in=backup.tar -wallet : check a backup and replace the db and wallet file with it\n")
+	fmt.Printf("wallet unlock -port=4000 -name=default -timeout=300 -tls : unlock a wallet of the running node to sign transactions (-tls if the node uses it)\n")
+	fmt.Printf("wallet lock -port=4000 -name=default : lock a wallet of the running node\n")
+	fmt.Printf("wallet address -port=4000 -name=default : make a new receive address in a wallet of the running node\n")
+	fmt.Printf("wallet rescan -port=4000 -name=default : find the used addresses of a wallet of the running node in its chain\n")
+	fmt.Printf("wallet restore -port=4000 -name=default : restore a wallet from its mnemonic (read from stdin) and find its used addresses\n")
+	fmt.Printf("wallet migrate : encrypt a plaintext wallet file\n")
+	fmt.Printf("sign -in=unsigned.json -out=signed.json -name=default : sign a transaction from /transactions/unsigned without a node, then POST it to /transactions/raw\n\n")
+	fmt.Printf("the passphrase is read from %s or stdin. a new node needs %s to create its wallet\n", passphraseEnv, passphraseEnv)
 	//os.Exit(1) //강제종료. error code 1
 	runtime.Goexit() //모든 함수 제거(defer 먼저 실행 후)
 }
 
+//db를 연 후에 실패하면 err를 출력하고 db를 닫은 후 종료. usage()의 Goexit은 db를 연 후에는 끝나지 않음
+func exit(err error) {
+	fmt.Println(err)
+	db.Close()
+	os.Exit(1)
+}
+
+//"127.0.0.1:3000,127.0.0.1:5000" 형식의 seeds를 ','로 나눔. 비어있으면 nil 리턴.
+func splitSeeds(seeds string) []string {
+	var r []string
+	for _, seed := range strings.Split(seeds, ",") {
+		if seed = strings.TrimSpace(seed); seed != "" {
+			r = append(r, seed)
+		}
+	}
+	return r
+}
+
+//port의 db를 열고 오래된 형식의 db 파일이면 migration을 실행. db를 사용하기 전에 호출해야함.
+func openDB(port int) {
+	db.SetPort(fmt.Sprint(port))
+	applied, backup, err := db.Migrate()
+	if backup != "" {
+		fmt.Printf("db backed up to %s before migrating\n", backup)
+	}
+	for _, m := range applied {
+		fmt.Printf("migrated db to version %d: %s\n", m.Version, m.Description)
+	}
+	if err != nil {
+		exit(err)
+	}
+}
+
+//migrate command. port의 db를 가장 최근 schema version으로 바꿈. dry-run이면 실행할 migration만 출력.
+func migrateCommand(args []string) {
+	migrateCmd := flag.NewFlagSet("migrate", flag.ExitOnError)
+	port := migrateCmd.Int("port", 4000, "Port of the node whose db to migrate")
+	dryRun := migrateCmd.Bool("dry-run", false, "Only print the migrations that would run")
+	migrateCmd.Parse(args)
+
+	if !*dryRun {
+		openDB(*port)
+		fmt.Printf("db is at version %d\n", db.Version())
+		return
+	}
+	db.SetPort(fmt.Sprint(*port))
+	pending, err := db.PendingMigrations()
+	if err != nil {
+		exit(err)
+	}
+	fmt.Printf("db is at version %d\n", db.Version())
+	for _, m := range pending {
+		fmt.Printf("would migrate to version %d: %s\n", m.Version, m.Description)
+	}
+}
+
+//snapshot command. port의 db에서 height의 UTXO set snapshot을 만들어서 out 파일에 저장.
+func snapshotCommand(args []string) {
+	snapshotCmd := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	port := snapshotCmd.Int("port", 4000, "Port of the node whose blockchain to export")
+	height := snapshotCmd.Int("height", 0, "Height of the snapshot (0 is the newest block)")
+	out := snapshotCmd.String("out", "utxo.snap", "File to write the snapshot to")
+	snapshotCmd.Parse(args)
+
+	openDB(*port)
+	s, err := blockchain.ExportSnapshot(*height)
+	if err != nil {
+		exit(err)
+	}
+	utils.HandleErr(os.WriteFile(*out, utils.ToBytes(s), 0644))
+	fmt.Printf("snapshot of %d utxos at height %d written to %s\nhash: %s\n", len(s.UTxOs), s.Height, *out, s.Hash)
+}
+
+//export command. port의 db의 모든 block을 out 파일에 저장.
+func exportCommand(args []string) {
+	exportCmd := flag.NewFlagSet("export", flag.ExitOnError)
+	port := exportCmd.Int("port", 4000, "Port of the node whose blockchain to export")
+	out := exportCmd.String("out", "chain.dat", "File to write the blocks to")
+	exportCmd.Parse(args)
+
+	openDB(*port)
+	file, err := os.Create(*out)
+	utils.HandleErr(err)
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	n, err := blockchain.ExportChain(w)
+	if err != nil {
+		os.Remove(*out) // 중간까지 쓴 파일을 남기지 않음
+		exit(err)
+	}
+	utils.HandleErr(w.Flush())
+	fmt.Printf("%d blocks written to %s\n", n, *out)
+}
+
+//import command. in 파일의 block들을 검증해서 port의 db에 추가.
+func importCommand(args []string) {
+	importCmd := flag.NewFlagSet("import", flag.ExitOnError)
+	port := importCmd.Int("port", 4000, "Port of the node to import the blocks into")
+	in := importCmd.String("in", "chain.dat", "File to read the blocks from")
+	importCmd.Parse(args)
+
+	openDB(*port)
+	file, err := os.Open(*in)
+	utils.HandleErr(err)
+	defer file.Close()
+	n, err := blockchain.ImportChain(bufio.NewReader(file))
+	fmt.Printf("%d blocks imported\n", n)
+	if err != nil {
+		exit(err)
+	}
+}
+
+//verify command. port의 db를 검증하고 처음 실패한 block의 height와 이유를 출력.
+func verifyCommand(args []string) {
+	verifyCmd := flag.NewFlagSet("verify", flag.ExitOnError)
+	port := verifyCmd.Int("port", 4000, "Port of the node whose blockchain to verify")
+	depth := verifyCmd.Int("depth", 0, "Verify only this many newest blocks (0 verifies from genesis)")
+	verifyCmd.Parse(args)
+
+	openDB(*port)
+	r, err := blockchain.VerifyChain(*depth)
+	if err != nil {
+		exit(err)
+	}
+	fmt.Printf("checked %d blocks from height %d to %d\n", r.Checked, r.Start, r.Height)
+	if r.UncheckedBlocks > 0 {
+		fmt.Printf("%d blocks spend outputs of pruned blocks, their txs were not checked\n", r.UncheckedBlocks)
+	}
+	if !r.Valid {
+		exit(fmt.Errorf("block %d failed: %s", r.FailedHeight, r.Reason))
+	}
+	fmt.Println("ok")
+}
+
+//backup command. port의 db와 wallet 파일을 out 파일에 backup. node가 실행 중이면 node의 REST API로 backup을 받음.
+func backupCommand(args []string) {
+	backupCmd := flag.NewFlagSet("backup", flag.ExitOnError)
+	port := backupCmd.Int("port", 4000, "Port of the node whose db to back up")
+	out := backupCmd.String("out", "backup.tar", "File to write the backup to")
+	withWallet := backupCmd.Bool("wallet", false, "Also back up the wallet file")
+	secure := backupCmd.Bool("tls", false, "The running node was started with -tls")
+	backupCmd.Parse(args)
+
+	db.SetPort(fmt.Sprint(*port))
+	var size int64
+	var err error
+	if db.InUse() {
+		size, err = requestBackup(*port, *secure, *out, *withWallet)
+	} else {
+		walletFile := ""
+		if *withWallet {
+			walletFile = wallet.File()
+		}
+		size, err = db.BackupFile(*out, walletFile)
+	}
+	if err != nil {
+		exit(err)
+	}
+	fmt.Printf("backup of %d bytes written to %s\n", size, *out)
+}
+
+//실행 중인 node의 /admin/backup에서 backup을 받아서 out 파일에 씀. secure이면 node의 인증서를 확인하고 https로 받음.
+func requestBackup(port int, secure bool, out string, withWallet bool) (int64, error) {
+	client, scheme, err := p2p.NodeClient(fmt.Sprint(port), secure)
+	if err != nil {
+		return 0, err
+	}
+	res, err := client.Post(fmt.Sprintf("%s://localhost:%d/admin/backup?wallet=%t", scheme, port, withWallet), "", nil)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		var e struct{ ErrorMessage string }
+		json.NewDecoder(res.Body).Decode(&e)
+		return 0, fmt.Errorf("backup failed: %s %s", res.Status, e.ErrorMessage)
+	}
+	tmp := out + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(file, res.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return size, err
+	}
+	return size, os.Rename(tmp, out)
+}
+
+//restore command. 멈춘 node의 db를 in 파일의 backup으로 바꿈.
+func restoreCommand(args []string) {
+	restoreCmd := flag.NewFlagSet("restore", flag.ExitOnError)
+	port := restoreCmd.Int("port", 4000, "Port of the node whose db to restore")
+	in := restoreCmd.String("in", "backup.tar", "Backup file to restore")
+	withWallet := restoreCmd.Bool("wallet", false, "Also restore the wallet file if the backup has one")
+	restoreCmd.Parse(args)
+
+	db.SetPort(fmt.Sprint(*port))
+	file, err := os.Open(*in)
+	utils.HandleErr(err)
+	defer file.Close()
+	walletFile := ""
+	if *withWallet {
+		walletFile = wallet.File()
+	}
+	info, err := db.Restore(bufio.NewReader(file), walletFile)
+	if err != nil {
+		exit(err)
+	}
+	fmt.Printf("restored db at version %d with the newest block %s at height %d\n", info.Version, info.NewestHash, info.Height)
+	if info.Wallet {
+		fmt.Printf("restored the wallet file %s\n", walletFile)
+	}
+}
+
+//wallet 파일을 암호화할 passphrase를 담는 환경 변수. wallet을 새로 만들거나 이전 wallet 파일을 암호화할 때만 사용함
+const passphraseEnv = "MSSP_WALLET_PASSPHRASE"
+
+var stdin = bufio.NewReader(os.Stdin)
+
+//passphraseEnv가 있으면 그 값을, 없으면 stdin에서 한 줄을 passphrase로 읽음.
+func readPassphrase() string {
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		return passphrase
+	}
+	return readLine("passphrase: ")
+}
+
+//prompt를 출력하고 stdin에서 한 줄을 읽음.
+func readLine(prompt string) string {
+	fmt.Print(prompt)
+	line, _ := stdin.ReadString('\n')
+	return strings.TrimRight(line, "\r\n")
+}
+
+//wallet 파일을 준비. 없으면 새 HD wallet을 만들고 암호화하지 않은 이전 wallet 파일이면 passphraseEnv의 passphrase로 암호화함.
+//새 wallet의 mnemonic은 이때 한 번만 보여줌.
+func openWallet() {
+	mnemonic, migrated, err := wallet.Prepare(os.Getenv(passphraseEnv))
+	if errors.Is(err, wallet.ErrNoPassphrase) {
+		err = fmt.Errorf("set %s to create or encrypt the wallet file", passphraseEnv)
+	}
+	if err != nil {
+		exit(err)
+	}
+	if mnemonic != "" {
+		fmt.Println("created a new encrypted wallet. write down its mnemonic, it is the only way to restore the wallet:")
+		fmt.Printf("\n  %s\n\n", mnemonic)
+	}
+	if migrated {
+		fmt.Println("encrypted the plaintext wallet file")
+	}
+	if _, err := wallet.Wallets().Load(wallet.DefaultName); err != nil {
+		exit(err)
+	}
+}
+
+//wallet command. 실행 중인 node의 wallet을 unlock, lock하거나 새 address를 만들거나 사용한 address를 찾음(rescan).
+//암호화하지 않은 wallet 파일을 암호화(migrate)하거나 mnemonic으로 wallet을 복원(restore)하는 것은 node를 멈추고 실행함.
+func walletCommand(args []string) {
+	if len(args) == 0 {
+		usage()
+	}
+	walletCmd := flag.NewFlagSet("wallet "+args[0], flag.ExitOnError)
+	port := walletCmd.Int("port", 4000, "Port of the running node")
+	name := walletCmd.String("name", wallet.DefaultName, "Name of the wallet")
+	timeout := walletCmd.Int("timeout", int(wallet.DefaultUnlockTimeout/time.Second), "Seconds until the wallet is locked again")
+	secure := walletCmd.Bool("tls", false, "The running node was started with -tls")
+	walletCmd.Parse(args[1:])
+
+	var status wallet.Status
+	var err error
+	switch args[0] {
+	case "unlock":
+		payload := map[string]interface{}{"passphrase": readPassphrase(), "timeout": *timeout}
+		err = postNode(*port, *secure, "/wallets/"+*name+"/unlock", payload, &status)
+	case "lock":
+		err = postNode(*port, *secure, "/wallets/"+*name+"/lock", nil, &status)
+	case "address":
+		var r struct{ Address string }
+		if err = postNode(*port, *secure, "/wallets/"+*name+"/address", nil, &r); err == nil {
+			fmt.Println(r.Address)
+			return
+		}
+	case "rescan":
+		var r struct {
+			Found  int
+			Wallet wallet.Status
+		}
+		if err = postNode(*port, *secure, "/wallets/"+*name+"/rescan", nil, &r); err == nil {
+			fmt.Printf("found %d used addresses\n", r.Found)
+			status = r.Wallet
+		}
+	case "restore":
+		status, err = restoreWallet(*port, *name)
+	case "migrate":
+		var migrated bool
+		migrated, err = wallet.Migrate(readPassphrase())
+		if err == nil && !migrated {
+			fmt.Println("wallet file is already encrypted")
+			return
+		}
+		status = wallet.Wallet().Status()
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if status.Locked {
+		fmt.Printf("wallet %s is locked\n", status.Address)
+	} else {
+		fmt.Printf("wallet %s is unlocked until %s\n", status.Address, time.Unix(int64(status.UnlockedUntil), 0).Format(time.RFC3339))
+	}
+}
+
+//sign command. node 없이 in 파일의 서명하지 않은 tx를 name wallet으로 서명해서 out 파일에 씀.
+//인터넷에 연결되지 않은 컴퓨터에 wallet 파일을 두고 서명한 후 out 파일을 /transactions/raw로 보냄.
+func signCommand(args []string) {
+	signCmd := flag.NewFlagSet("sign", flag.ExitOnError)
+	in := signCmd.String("in", "unsigned.json", "File with the unsigned transaction")
+	out := signCmd.String("out", "signed.json", "File to write the signed transaction to")
+	name := signCmd.String("name", wallet.DefaultName, "Name of the wallet to sign with")
+	signCmd.Parse(args)
+
+	if err := signTx(*in, *out, *name); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func signTx(in string, out string, name string) error {
+	data, err := os.ReadFile(in)
+	if err != nil {
+		return err
+	}
+	u := &blockchain.UnsignedTx{}
+	if err := json.Unmarshal(data, u); err != nil {
+		return err
+	}
+	if err := u.Check(); err != nil {
+		return err
+	}
+	fmt.Printf("tx %s\n", u.Tx.Id) // 서명하기 전에 보내는 금액을 확인할 수 있도록
+	for _, txOut := range u.Tx.TxOuts {
+		fmt.Printf("  pay %d to %s\n", txOut.Amount, txOut.Address)
+	}
+	fmt.Printf("  fee %d\n", u.Fee())
+
+	w, err := wallet.Wallets().Load(name)
+	if err != nil {
+		return err
+	}
+	if err := w.Unlock(readPassphrase(), 0); err != nil {
+		return err
+	}
+	defer w.Lock()
+	signed, err := u.Sign(name)
+	if err != nil {
+		return err
+	}
+	if data, err = json.MarshalIndent(u, "", "  "); err != nil {
+		return err
+	}
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("signed %d of %d inputs and wrote %s\n", signed, len(u.Inputs), out)
+	if !u.Complete() {
+		fmt.Println("sign it with the wallets of the other inputs before sending it")
+	}
+	return nil
+}
+
+//stdin의 mnemonic으로 name HD wallet을 복원하고 port의 db에 block이 있으면 사용한 address를 찾음.
+//light node는 block이 없으므로 node를 시작해서 wallet tx를 받은 후 rescan해야함.
+func restoreWallet(port int, name string) (wallet.Status, error) {
+	db.SetPort(fmt.Sprint(port))
+	if db.InUse() {
+		return wallet.Status{}, fmt.Errorf("stop the node of port %d before restoring its wallet", port)
+	}
+	mnemonic := readLine("mnemonic: ")
+	if err := wallet.Restore(name, mnemonic, readPassphrase()); err != nil {
+		return wallet.Status{}, err
+	}
+	w, err := wallet.Wallets().Load(name)
+	if err != nil {
+		return wallet.Status{}, err
+	}
+	if db.Exists() {
+		openDB(port)
+		defer db.Close()
+		if db.Checkpoint() != nil {
+			used := blockchain.UsedAddresses()
+			found, err := w.Discover(func(address string) bool { return used[address] })
+			if err != nil {
+				return wallet.Status{}, err
+			}
+			fmt.Printf("found %d used addresses\n", found)
+			return w.Status(), nil
+		}
+	}
+	fmt.Println("no blocks to scan. start the node and run 'wallet rescan' after it has synced")
+	return w.Status(), nil
+}
+
+//실행 중인 node의 REST API에 payload를 POST하고 response를 r에 decode. secure이면 node의 인증서를 확인하고 https로 보냄.
+func postNode(port int, secure bool, path string, payload interface{}, r interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	client, scheme, err := p2p.NodeClient(fmt.Sprint(port), secure)
+	if err != nil {
+		return err
+	}
+	res, err := client.Post(fmt.Sprintf("%s://localhost:%d%s", scheme, port, path), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		var e struct{ ErrorMessage string }
+		json.NewDecoder(res.Body).Decode(&e)
+		return fmt.Errorf("%s %s", res.Status, e.ErrorMessage)
+	}
+	return json.NewDecoder(res.Body).Decode(r)
+}
+
+//snapshot 파일을 불러와서 비어있는 db에 저장.
+func loadSnapshot(path string, trustedHash string) {
+	data, err := os.ReadFile(path)
+	utils.HandleErr(err)
+	s, err := blockchain.LoadSnapshot(data, trustedHash)
+	if err != nil {
+		exit(err)
+	}
+	fmt.Printf("started from the snapshot at height %d (%s)\n", s.Height, s.Hash)
+}
+
 func Start() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "snapshot":
+			snapshotCommand(os.Args[2:])
+			return
+		case "export":
+			exportCommand(os.Args[2:])
+			return
+		case "import":
+			importCommand(os.Args[2:])
+			return
+		case "verify":
+			verifyCommand(os.Args[2:])
+			return
+		case "migrate":
+			migrateCommand(os.Args[2:])
+			return
+		case "backup":
+			backupCommand(os.Args[2:])
+			return
+		case "restore":
+			restoreCommand(os.Args[2:])
+			return
+		case "wallet":
+			walletCommand(os.Args[2:])
+			return
+		case "sign":
+			signCommand(os.Args[2:])
+			return
+		}
+	}
+
 	/////////////////////////////////////////////////////
 	/////////////////////더 많은 기능 사용하려면 cobra CLI/////
 	/////////////////////////////////////////////////////
@@ -29,12 +545,72 @@ func Start() {
 
 	port := flag.Int("port", 4000, "Set port of the server") //4000이 default
 
-	mode := flag.String("mode", "rest", "Choose between 'html' and 'rest'") //rest가 default
+	mode := flag.String("mode", "rest", "Choose between 'html', 'rest' and 'light'") //rest가 default
+
+	seeds := flag.String("seeds", "", "Comma separated address:port (or nodeID@address:port) list of seed peers") //처음 연결할 peer들
+
+	wire := flag.String("wire", "binary", "Choose the peer message format between 'binary' and 'json'")
+
+	secure := flag.Bool("tls", false, "Encrypt and authenticate peer connections with the node key")
+
+	allowlist := flag.String("allowlist", "", "File of node IDs allowed to connect (requires -tls)")
+
+	prune := flag.Int("prune", 0, "Keep only this many newest blocks (0 keeps all blocks)")
+
+	snapshot := flag.String("snapshot", "", "UTXO snapshot file to start a new node from")
+
+	snapshotHash := flag.String("snapshot-hash", "", "Trusted hash of the snapshot if it is not pinned in the chain params")
+
+	snapshotVerify := flag.Bool("snapshot-verify", false, "Download all blocks in the background and verify the snapshot")
+
+	backupDir := flag.String("backup-dir", "", "Directory that POST /admin/backup?path= writes into (empty only streams backups)")
 
 	flag.Parse()
 
+	if *mode != "rest" && *mode != "light" && *mode != "html" {
+		usage()
+	}
+	if *allowlist != "" && !*secure {
+		fmt.Println("-allowlist requires -tls")
+		usage()
+	}
+	if err := p2p.SetWire(*wire); err != nil {
+		usage()
+	}
+	if *prune != 0 {
+		if err := blockchain.SetPrune(*prune); err != nil {
+			fmt.Println(err)
+			usage()
+		}
+	}
+	if *secure {
+		utils.HandleErr(p2p.EnableTLS(fmt.Sprint(*port), *allowlist))
+	}
+	openDB(*port)
+	openWallet()
+
+	if *snapshot != "" {
+		if *mode != "rest" {
+			fmt.Println("-snapshot requires -mode=rest")
+			usage()
+		}
+		loadSnapshot(*snapshot, *snapshotHash)
+	}
+	if *snapshotVerify {
+		blockchain.SetVerifySnapshot()
+	}
+	rest.SetBackupDir(*backupDir)
+
 	switch *mode {
 	case "rest":
+		blockchain.Blockchain() // peer와 연결하기 전에 pruned인지 알 수 있도록 불러옴
+		blockchain.RefreshWatched()
+		p2p.Start(fmt.Sprint(*port), splitSeeds(*seeds))
+		rest.Start(*port)
+	case "light": // header만 받고 wallet tx는 merkle proof로 확인하는 light node
+		blockchain.SetLight()
+		blockchain.RefreshWatched()
+		p2p.Start(fmt.Sprint(*port), splitSeeds(*seeds))
 		rest.Start(*port)
 	case "html":
 		explorer.Start(*port)
@@ -0,0 +1,107 @@
+package codec
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+//p2p message를 주고받는 binary frame 형식.
+//
+//	magic(4) | command(2) | length(4) | checksum(4) | payload(length)
+//
+//숫자는 모두 big endian. checksum은 payload를 sha256으로 두번 hashing한 값의 앞 4 byte.
+const (
+	HeaderSize     int    = 14
+	MaxPayloadSize uint32 = 32 << 20 // 32MB. 이보다 긴 frame은 읽지 않음
+)
+
+var Magic = [4]byte{'M', 'S', 'S', 'P'}
+
+var ErrBadMagic = errors.New("codec: bad magic")
+var ErrBadChecksum = errors.New("codec: bad checksum")
+var ErrPayloadTooLarge = errors.New("codec: payload too large")
+var ErrTrailingData = errors.New("codec: trailing data after frame")
+
+type Frame struct {
+	Command uint16
+	Payload []byte
+}
+
+//payload의 checksum. sha256(sha256(payload))의 앞 4 byte.
+func Checksum(payload []byte) [4]byte {
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	var sum [4]byte
+	copy(sum[:], second[:4])
+	return sum
+}
+
+//frame을 binary 형식으로 w에 씀.
+func Encode(w io.Writer, f Frame) error {
+	if uint64(len(f.Payload)) > uint64(MaxPayloadSize) {
+		return ErrPayloadTooLarge
+	}
+	header := make([]byte, HeaderSize)
+	copy(header[0:4], Magic[:])
+	binary.BigEndian.PutUint16(header[4:6], f.Command)
+	binary.BigEndian.PutUint32(header[6:10], uint32(len(f.Payload)))
+	sum := Checksum(f.Payload)
+	copy(header[10:14], sum[:])
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(f.Payload)
+	return err
+}
+
+//r에서 frame 하나를 읽음. magic, 길이, checksum이 맞지 않으면 에러.
+func Decode(r io.Reader) (*Frame, error) {
+	header := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[0:4], Magic[:]) {
+		return nil, ErrBadMagic
+	}
+	length := binary.BigEndian.Uint32(header[6:10])
+	if length > MaxPayloadSize {
+		return nil, ErrPayloadTooLarge
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if sum := Checksum(payload); !bytes.Equal(sum[:], header[10:14]) {
+		return nil, ErrBadChecksum
+	}
+	return &Frame{
+		Command: binary.BigEndian.Uint16(header[4:6]),
+		Payload: payload,
+	}, nil
+}
+
+//frame을 binary 형식의 []byte로 변환.
+func Marshal(f Frame) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := Encode(&buffer, f)
+	return buffer.Bytes(), err
+}
+
+//data 전체가 frame 하나여야함. websocket message 하나에 frame 하나를 담을 때 사용.
+func Unmarshal(data []byte) (*Frame, error) {
+	r := bytes.NewReader(data)
+	f, err := Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Len() != 0 {
+		return nil, ErrTrailingData
+	}
+	return f, nil
+}
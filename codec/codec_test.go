@@ -0,0 +1,94 @@
+package codec
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	frames := []Frame{
+		{Command: 0, Payload: nil},
+		{Command: 3, Payload: []byte("block")},
+		{Command: 65535, Payload: bytes.Repeat([]byte{0xff}, 1000)},
+	}
+	for _, f := range frames {
+		data, err := Marshal(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != HeaderSize+len(f.Payload) {
+			t.Errorf("Expected frame length : %d. now got : %d", HeaderSize+len(f.Payload), len(data))
+		}
+		got, err := Unmarshal(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Command != f.Command || !bytes.Equal(got.Payload, f.Payload) {
+			t.Errorf("Expected frame : %v. now got : %v", f, got)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	valid, err := Marshal(Frame{Command: 1, Payload: []byte("payload")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := func(i int, b byte) []byte {
+		data := append([]byte{}, valid...)
+		data[i] = b
+		return data
+	}
+
+	type test struct {
+		name  string
+		input []byte
+		err   error
+	}
+	tests := []test{
+		{name: "bad magic", input: corrupt(0, 'X'), err: ErrBadMagic},
+		{name: "bad checksum", input: corrupt(len(valid)-1, '!'), err: ErrBadChecksum},
+		{name: "too large", input: append(append([]byte{}, valid[:6]...), 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0), err: ErrPayloadTooLarge},
+		{name: "short header", input: valid[:5], err: io.ErrUnexpectedEOF},
+		{name: "short payload", input: valid[:len(valid)-1], err: io.ErrUnexpectedEOF},
+		{name: "trailing data", input: append(append([]byte{}, valid...), 0), err: ErrTrailingData},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Unmarshal(tc.input)
+			if err != tc.err {
+				t.Errorf("Expected error : %v. now got : %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, frame := range []Frame{{Command: 0}, {Command: 4, Payload: []byte("tx")}, {Command: 9, Payload: make([]byte, 64)}} {
+		data, err := Marshal(frame)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte("MSSP"))
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := bytes.NewReader(data)
+		frame, err := Decode(r)
+		if err != nil {
+			return
+		}
+		//decode에 성공한 frame은 다시 encode하면 읽은 byte와 같아야함
+		encoded, err := Marshal(*frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		consumed := data[:len(data)-r.Len()]
+		if !bytes.Equal(encoded, consumed) {
+			t.Errorf("Expected re-encoded frame %x. now got : %x", consumed, encoded)
+		}
+	})
+}
@@ -0,0 +1,264 @@
+package db
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+//backup 파일은 tar archive. db 파일과 선택한 경우 wallet 파일이 들어있음.
+const (
+	backupDB     = "blockchain.db"
+	backupWallet = "wallet"
+)
+
+var ErrDBInUse = errors.New("db is used by a running node, stop the node first")
+var ErrBackupNotValid = errors.New("not a backup file")
+var ErrBackupNoChain = errors.New("backup has no blockchain")
+var ErrBackupTip = errors.New("newest block of the backup is missing")
+
+//restore한 backup의 정보.
+type BackupInfo struct {
+	Version    int
+	NewestHash string
+	Height     int
+	Light      bool // light node의 header chain
+	Wallet     bool // wallet 파일도 restore했음
+}
+
+//backup의 가장 최근 block. checkpoint와 light node의 header chain 모두 이 field들이 있음.
+type backupTip struct {
+	NewestHash string
+	Height     int
+}
+
+//port의 db 파일이 있는지 확인.
+func Exists() bool {
+	_, err := os.Stat(getDbName())
+	return err == nil
+}
+
+//다른 process가 port의 db 파일을 열고 있는지 확인. 실행 중인 node는 db 파일을 잠금.
+func InUse() bool {
+	if db != nil {
+		return false
+	}
+	if _, err := os.Stat(getDbName()); os.IsNotExist(err) {
+		return false
+	}
+	d, err := bolt.Open(getDbName(), 0600, &bolt.Options{Timeout: 100 * time.Millisecond, ReadOnly: true})
+	if err != nil {
+		return true
+	}
+	d.Close()
+	return false
+}
+
+//하나의 read transaction으로 db 파일을 복사해서 w에 tar archive로 씀. node가 실행 중이어도 block 연결 중간이 아닌 상태가 복사됨.
+//wallet이 ""이 아니면 그 wallet 파일도 넣음. archive의 크기를 리턴.
+func Backup(w io.Writer, wallet string) (int64, error) {
+	var walletData []byte
+	if wallet != "" {
+		data, err := os.ReadFile(wallet)
+		if err != nil {
+			return 0, err
+		}
+		walletData = data
+	}
+	counter := &countWriter{w: w}
+	tw := tar.NewWriter(counter)
+	err := DB().View(func(t *bolt.Tx) error {
+		header := &tar.Header{Name: backupDB, Mode: 0600, Size: t.Size(), ModTime: time.Now()}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := t.WriteTo(tw)
+		return err
+	})
+	if err != nil {
+		return counter.n, err
+	}
+	if walletData != nil {
+		header := &tar.Header{Name: backupWallet, Mode: 0600, Size: int64(len(walletData)), ModTime: time.Now()}
+		if err := tw.WriteHeader(header); err != nil {
+			return counter.n, err
+		}
+		if _, err := tw.Write(walletData); err != nil {
+			return counter.n, err
+		}
+	}
+	err = tw.Close()
+	return counter.n, err
+}
+
+//Backup을 path 파일에 씀. 다 쓴 후에 파일 이름을 바꾸므로 실패해도 path에 중간까지 쓴 파일이 남지 않음.
+func BackupFile(path string, wallet string) (int64, error) {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, err
+	}
+	n, err := Backup(file, wallet)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return n, err
+	}
+	return n, os.Rename(tmp, path)
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+//backup 파일을 검증하고 port의 db 파일과 바꿈. wallet이 ""이 아니고 backup에 wallet이 있으면 wallet 파일도 바꿈.
+//backup의 schema version이 이 node가 읽을 수 있는 것인지, 가장 최근 block이 backup 안에 있는지 확인한 후에 바꾸고
+//원래 파일들은 .before-restore를 붙여서 남겨둠. node가 실행 중이면 ErrDBInUse. db를 열기 전에 호출해야함.
+func Restore(r io.Reader, wallet string) (*BackupInfo, error) {
+	if InUse() {
+		return nil, ErrDBInUse
+	}
+	tmp := getDbName() + ".restore"
+	defer os.Remove(tmp)
+	var walletData []byte
+	hasDB := false
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, ErrBackupNotValid
+		}
+		switch header.Name {
+		case backupDB:
+			if err := writeFile(tmp, tr); err != nil {
+				return nil, err
+			}
+			hasDB = true
+		case backupWallet:
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, ErrBackupNotValid
+			}
+			walletData = data
+		}
+	}
+	if !hasDB {
+		return nil, ErrBackupNotValid
+	}
+	info, err := checkBackup(tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := replaceFile(getDbName(), tmp); err != nil {
+		return nil, err
+	}
+	if wallet != "" && walletData != nil {
+		if err := writeFile(tmp, bytes.NewReader(walletData)); err != nil {
+			return info, err
+		}
+		if err := replaceFile(wallet, tmp); err != nil {
+			return info, err
+		}
+		info.Wallet = true
+	}
+	return info, nil
+}
+
+func writeFile(path string, r io.Reader) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, r)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+//path가 있으면 path.before-restore로 옮기고 tmp를 path로 옮김.
+func replaceFile(path string, tmp string) error {
+	if _, err := os.Stat(path); err == nil {
+		if err := os.Rename(path, path+".before-restore"); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp, path)
+}
+
+//backup한 db 파일을 읽기 전용으로 열어서 schema version과 가장 최근 block을 확인.
+func checkBackup(path string) (*BackupInfo, error) {
+	d, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		return nil, ErrBackupNotValid
+	}
+	defer d.Close()
+	info := &BackupInfo{}
+	err = d.View(func(t *bolt.Tx) error {
+		data := t.Bucket([]byte(dataBucket))
+		blocks := t.Bucket([]byte(blocksBucket))
+		if data == nil || blocks == nil {
+			return ErrBackupNotValid
+		}
+		info.Version, _ = readVersion(t)
+		if info.Version > len(migrations) {
+			return ErrSchemaTooNew
+		}
+		var tip backupTip
+		chain := data.Get([]byte(checkpoint))
+		if chain == nil {
+			chain = data.Get([]byte(headerChain))
+			info.Light = true
+		}
+		if chain == nil {
+			return ErrBackupNoChain
+		}
+		if err := decode(&tip, chain); err != nil {
+			return ErrBackupNotValid
+		}
+		info.NewestHash = tip.NewestHash
+		info.Height = tip.Height
+		if info.Light {
+			if headers := t.Bucket([]byte(headersBucket)); tip.Height > 0 && (headers == nil || headers.Get([]byte(tip.NewestHash)) == nil) {
+				return ErrBackupTip
+			}
+			return nil
+		}
+		if blocks.Get([]byte(tip.NewestHash)) == nil {
+			return ErrBackupTip
+		}
+		if info.Version >= 2 && string(data.Get([]byte(utxoTip))) != tip.NewestHash { // version 2부터 UTXO tip이 있음
+			return fmt.Errorf("%w: utxo set is not at the newest block", ErrBackupTip)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBackupRestore(t *testing.T) {
+	openFixture(t, "v1.db")
+	if _, _, err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("wallet.file", []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	size, err := Backup(&buf, "wallet.file")
+	if err != nil || size != int64(buf.Len()) {
+		t.Fatalf("Expected a backup of %d bytes, got %d %v", buf.Len(), size, err)
+	}
+	checkpointData := Checkpoint()
+	Close()
+	db = nil
+
+	t.Run("restores the db and the wallet", func(t *testing.T) {
+		os.WriteFile("wallet.file", []byte("other key"), 0600)
+		SetPort("restored")
+		info, err := Restore(bytes.NewReader(buf.Bytes()), "wallet.file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Version != len(migrations) || info.Height != 13 || info.Light || !info.Wallet {
+			t.Errorf("Unexpected backup info %+v", info)
+		}
+		if !bytes.Equal(Checkpoint(), checkpointData) {
+			t.Error("restored checkpoint is different")
+		}
+		if data, _ := os.ReadFile("wallet.file"); string(data) != "key" {
+			t.Errorf("Expected the wallet of the backup, got %s", data)
+		}
+		if data, _ := os.ReadFile("wallet.file.before-restore"); string(data) != "other key" {
+			t.Errorf("Expected the old wallet to be kept, got %s", data)
+		}
+	})
+
+	t.Run("rejects a backup from a newer node", func(t *testing.T) {
+		DB().Update(func(tx *bolt.Tx) error { return putVersion(tx, len(migrations)+1) })
+		var newer bytes.Buffer
+		if _, err := Backup(&newer, ""); err != nil {
+			t.Fatal(err)
+		}
+		Close()
+		db = nil
+		SetPort("newer")
+		if _, err := Restore(&newer, ""); !errors.Is(err, ErrSchemaTooNew) {
+			t.Errorf("Expected ErrSchemaTooNew, got %v", err)
+		}
+		if _, err := os.Stat(getDbName()); !os.IsNotExist(err) {
+			t.Error("rejected backup was restored")
+		}
+	})
+
+	t.Run("rejects a file that is not a backup", func(t *testing.T) {
+		if _, err := Restore(bytes.NewReader([]byte("not a tar archive")), ""); err != ErrBackupNotValid {
+			t.Errorf("Expected ErrBackupNotValid, got %v", err)
+		}
+	})
+}
@@ -2,7 +2,6 @@ package db
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/yyuurriiaa/ProjectMSSP/utils"
 	bolt "go.etcd.io/bbolt"
@@ -10,21 +9,35 @@ import (
 
 var db *bolt.DB // singleton pattern
 
+var port string // db 파일 이름에 사용하는 node의 port
+
 const (
-	dbName       = "blockchain" //db 이름
-	dataBucket   = "data"
-	blocksBucket = "blocks"
+	dbName         = "blockchain" //db 이름
+	dataBucket     = "data"
+	blocksBucket   = "blocks"
+	peersBucket    = "peers"    // 주소록. key : address:port, value : 해당 peer의 정보
+	headersBucket  = "headers"  // light node의 block header. key : hash, value : header
+	lightTxsBucket = "lightTxs" // light node가 merkle proof로 확인한 wallet tx. key : tx id, value : tx와 tx가 들어있는 block
+	utxosBucket    = "utxos"    // 사용되지 않은 TxOut. key : tx id:index, value : TxOut
 	//bucket : table같은 것. 분류를 위해
 
-	checkpoint = "checkpoint"
+	checkpoint   = "checkpoint"
+	headerChain  = "headerChain"  // light node의 header chain
+	utxoTip      = "utxoTip"      // UTXO set이 반영한 가장 최근 block의 hash
+	legacyHeight = "legacyHeight" // merkle root가 생기기 전에 만든 가장 높은 block의 height
+	textIdHeight = "textIdHeight" // tx id를 문자열 형식으로 계산하던 때에 만든 가장 높은 block의 height
 )
 
+//db 파일 이름에 사용할 port를 정함. DB()를 처음 사용하기 전에 호출해야함.
+func SetPort(p string) {
+	port = p
+}
+
 //포트 이름을 가져와서 dbName + port로 db파일 만들기
 func getDbName() string {
 	// for i, a := range os.Args {
 	// 	fmt.Println(i, a)
 	// }
-	port := os.Args[2][6:]
 	return fmt.Sprintf("%s_%s.db", dbName, port)
 
 }
@@ -40,7 +53,19 @@ func DB() *bolt.DB { // singleton pattern으로 data bucket과 blocks bucket을
 			utils.HandleErr(err)
 
 			_, err = t.CreateBucketIfNotExists([]byte(blocksBucket)) // blocks bucket todtjd
-			return err                                               // error를 반환해야하기때문에 error handling을 다 하지 않고 return
+			utils.HandleErr(err)
+
+			_, err = t.CreateBucketIfNotExists([]byte(peersBucket)) // peers bucket 생성
+			utils.HandleErr(err)
+
+			_, err = t.CreateBucketIfNotExists([]byte(headersBucket)) // headers bucket 생성
+			utils.HandleErr(err)
+
+			_, err = t.CreateBucketIfNotExists([]byte(lightTxsBucket)) // lightTxs bucket 생성
+			utils.HandleErr(err)
+
+			_, err = t.CreateBucketIfNotExists([]byte(utxosBucket)) // utxos bucket 생성
+			return err                                              // error를 반환해야하기때문에 error handling을 다 하지 않고 return
 		})
 
 		utils.HandleErr(err) // 위에서 받은 err handling
@@ -97,9 +122,12 @@ func Block(hash string) []byte { //Checkpoint와 동일. 해당 블록의 hash
 	return data
 }
 
-// DB 열었던거 닫기
+// DB 열었던거 닫기. 열지 않았으면 아무것도 하지 않음. 닫은 후에 DB()를 호출하면 다시 엶
 func Close() {
-	DB().Close()
+	if db != nil {
+		db.Close()
+		db = nil
+	}
 }
 
 // blocksBucket 이름의 bucket을 삭제하고 다시 생성하는 방식으로 bucket 비우기
@@ -112,3 +140,328 @@ func EmptyBlocks() {
 	})
 
 }
+
+//blocksBucket에서 해당 hash를 가지는 block 삭제. pruning할 때 사용
+func DeleteBlock(hash string) {
+	err := DB().Update(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(blocksBucket))
+		return bucket.Delete([]byte(hash))
+	})
+
+	utils.HandleErr(err)
+}
+
+//peersBucket에 key : address:port, value : data 형으로 peer 정보 저장
+func SavePeer(key string, data []byte) {
+	err := DB().Update(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(peersBucket))
+		return bucket.Put([]byte(key), data)
+	})
+
+	utils.HandleErr(err)
+}
+
+//peersBucket에서 해당 key를 가지는 peer 정보 삭제
+func DeletePeer(key string) {
+	err := DB().Update(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(peersBucket))
+		return bucket.Delete([]byte(key))
+	})
+
+	utils.HandleErr(err)
+}
+
+//peersBucket에 저장된 모든 peer 정보를 key : address:port, value : data 형태의 map으로 리턴
+func Peers() map[string][]byte {
+	peers := make(map[string][]byte)
+	DB().View(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(peersBucket))
+		return bucket.ForEach(func(k, v []byte) error {
+			data := make([]byte, len(v)) // v는 transaction이 끝나면 사용할 수 없으므로 복사
+			copy(data, v)
+			peers[string(k)] = data
+			return nil
+		})
+	})
+
+	return peers
+}
+
+//headersBucket에 key : hash, value : data 형으로 header 저장
+func SaveHeader(hash string, data []byte) {
+	err := DB().Update(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(headersBucket))
+		return bucket.Put([]byte(hash), data)
+	})
+
+	utils.HandleErr(err)
+}
+
+//headersBucket에서 해당 hash를 가지는 header 데이터를 리턴
+func Header(hash string) []byte {
+	var data []byte
+	DB().View(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(headersBucket))
+		data = bucket.Get([]byte(hash))
+		return nil
+	})
+
+	return data
+}
+
+//dataBucket에 light node의 header chain 저장
+func SaveHeaderChain(data []byte) {
+	err := DB().Update(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(dataBucket))
+		return bucket.Put([]byte(headerChain), data)
+	})
+
+	utils.HandleErr(err)
+}
+
+//dataBucket에 저장된 light node의 header chain을 리턴
+func HeaderChain() []byte {
+	var data []byte
+	DB().View(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(dataBucket))
+		data = bucket.Get([]byte(headerChain))
+		return nil
+	})
+
+	return data
+}
+
+//lightTxsBucket에 key : tx id, value : data 형으로 검증된 wallet tx 저장
+func SaveLightTx(id string, data []byte) {
+	err := DB().Update(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(lightTxsBucket))
+		return bucket.Put([]byte(id), data)
+	})
+
+	utils.HandleErr(err)
+}
+
+//lightTxsBucket에 저장된 모든 tx 데이터를 리턴
+func LightTxs() [][]byte {
+	var txs [][]byte
+	DB().View(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(lightTxsBucket))
+		return bucket.ForEach(func(k, v []byte) error {
+			data := make([]byte, len(v)) // v는 transaction이 끝나면 사용할 수 없으므로 복사
+			copy(data, v)
+			txs = append(txs, data)
+			return nil
+		})
+	})
+
+	return txs
+}
+
+//headersBucket과 lightTxsBucket을 비움. light node가 더 긴 다른 chain으로 바꿀 때 사용
+func EmptyHeaders() {
+	DB().Update(func(t *bolt.Tx) error {
+		for _, name := range []string{headersBucket, lightTxsBucket} {
+			utils.HandleErr(t.DeleteBucket([]byte(name)))
+			_, err := t.CreateBucket([]byte(name))
+			utils.HandleErr(err)
+		}
+		return nil
+	})
+
+}
+
+//utxosBucket에서 remove의 key들을 지우고 add의 key : value를 저장. block 하나의 변경을 한번에 저장함
+func UpdateUTxOs(add map[string][]byte, remove []string) {
+	err := DB().Update(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(utxosBucket))
+		for _, key := range remove {
+			if err := bucket.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		for key, data := range add {
+			if err := bucket.Put([]byte(key), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	utils.HandleErr(err)
+}
+
+//utxosBucket에서 해당 key를 가지는 TxOut 데이터를 리턴
+func UTxO(key string) []byte {
+	var data []byte
+	DB().View(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(utxosBucket))
+		data = bucket.Get([]byte(key))
+		return nil
+	})
+
+	return data
+}
+
+//utxosBucket에 저장된 모든 TxOut을 key : tx id:index, value : data 형태의 map으로 리턴
+func UTxOs() map[string][]byte {
+	utxos := make(map[string][]byte)
+	DB().View(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(utxosBucket))
+		return bucket.ForEach(func(k, v []byte) error {
+			data := make([]byte, len(v)) // v는 transaction이 끝나면 사용할 수 없으므로 복사
+			copy(data, v)
+			utxos[string(k)] = data
+			return nil
+		})
+	})
+
+	return utxos
+}
+
+//utxosBucket을 비움. block들로 UTXO set을 다시 만들 때 사용
+func EmptyUTxOs() {
+	DB().Update(func(t *bolt.Tx) error {
+		utils.HandleErr(t.DeleteBucket([]byte(utxosBucket)))
+		_, err := t.CreateBucket([]byte(utxosBucket))
+		utils.HandleErr(err)
+		return nil
+	})
+
+}
+
+//한 bolt transaction으로 저장할 변경들. Commit하면 모두 저장되거나 하나도 저장되지 않으므로
+//block을 연결하는 도중에 node가 꺼져도 checkpoint, block, UTXO set이 서로 맞지 않는 상태로 남지 않음.
+type Batch struct {
+	ops []func(t *bolt.Tx) error
+}
+
+//빈 batch 생성.
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+func (b *Batch) put(bucket string, key string, data []byte) {
+	b.ops = append(b.ops, func(t *bolt.Tx) error {
+		return t.Bucket([]byte(bucket)).Put([]byte(key), data)
+	})
+}
+
+func (b *Batch) delete(bucket string, key string) {
+	b.ops = append(b.ops, func(t *bolt.Tx) error {
+		return t.Bucket([]byte(bucket)).Delete([]byte(key))
+	})
+}
+
+func (b *Batch) empty(bucket string) {
+	b.ops = append(b.ops, func(t *bolt.Tx) error {
+		if err := t.DeleteBucket([]byte(bucket)); err != nil {
+			return err
+		}
+		_, err := t.CreateBucket([]byte(bucket))
+		return err
+	})
+}
+
+//batch에 block 저장을 추가.
+func (b *Batch) SaveBlock(hash string, data []byte) {
+	b.put(blocksBucket, hash, data)
+}
+
+//batch에 block 삭제를 추가.
+func (b *Batch) DeleteBlock(hash string) {
+	b.delete(blocksBucket, hash)
+}
+
+//batch에 blockchain checkpoint 저장을 추가.
+func (b *Batch) SaveBlockchain(data []byte) {
+	b.put(dataBucket, checkpoint, data)
+}
+
+//batch에 header 저장을 추가.
+func (b *Batch) SaveHeader(hash string, data []byte) {
+	b.put(headersBucket, hash, data)
+}
+
+//batch에 light node의 header chain 저장을 추가.
+func (b *Batch) SaveHeaderChain(data []byte) {
+	b.put(dataBucket, headerChain, data)
+}
+
+//batch에 UTXO set 변경을 추가. remove의 key들을 지우고 add의 key : value를 저장.
+func (b *Batch) UpdateUTxOs(add map[string][]byte, remove []string) {
+	for _, key := range remove {
+		b.delete(utxosBucket, key)
+	}
+	for key, data := range add {
+		b.put(utxosBucket, key, data)
+	}
+}
+
+//batch에 UTXO set이 어떤 block까지 반영했는지 저장을 추가.
+func (b *Batch) SaveUTxOTip(hash string) {
+	b.put(dataBucket, utxoTip, []byte(hash))
+}
+
+//batch에 blocksBucket 비우기를 추가.
+func (b *Batch) EmptyBlocks() {
+	b.empty(blocksBucket)
+}
+
+//batch에 headersBucket과 lightTxsBucket 비우기를 추가.
+func (b *Batch) EmptyHeaders() {
+	b.empty(headersBucket)
+	b.empty(lightTxsBucket)
+}
+
+//batch에 utxosBucket 비우기를 추가.
+func (b *Batch) EmptyUTxOs() {
+	b.empty(utxosBucket)
+}
+
+//batch에 checkpoint와 UTXO tip 삭제를 추가. blockchain을 처음부터 다시 만들 때 사용.
+func (b *Batch) DeleteBlockchain() {
+	b.delete(dataBucket, checkpoint)
+	b.delete(dataBucket, utxoTip)
+}
+
+//batch의 변경들을 하나의 bolt transaction으로 저장. 하나라도 실패하면 아무것도 저장하지 않음.
+func (b *Batch) Commit() {
+	err := DB().Update(func(t *bolt.Tx) error {
+		for _, op := range b.ops {
+			if err := op(t); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	utils.HandleErr(err)
+}
+
+//UTXO set이 반영한 가장 최근 block의 hash. 저장된 적이 없으면 nil.
+func UTxOTip() []byte {
+	var data []byte
+	DB().View(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(dataBucket))
+		data = bucket.Get([]byte(utxoTip))
+		return nil
+	})
+
+	return data
+}
+
+//blocksBucket에 저장된 모든 block을 key : hash, value : data 형태의 map으로 리턴. 시작할 때 db를 복구하는데 사용
+func Blocks() map[string][]byte {
+	blocks := make(map[string][]byte)
+	DB().View(func(t *bolt.Tx) error {
+		bucket := t.Bucket([]byte(blocksBucket))
+		return bucket.ForEach(func(k, v []byte) error {
+			data := make([]byte, len(v)) // v는 transaction이 끝나면 사용할 수 없으므로 복사
+			copy(data, v)
+			blocks[string(k)] = data
+			return nil
+		})
+	})
+
+	return blocks
+}
@@ -0,0 +1,317 @@
+package db
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/yyuurriiaa/ProjectMSSP/utils"
+	bolt "go.etcd.io/bbolt"
+)
+
+//db 파일의 schema version. 저장하는 값의 형식이 바뀌면 migrations에 migration을 추가하고 시작할 때 오래된 파일을 한 단계씩 바꿈.
+//version이 저장되지 않은 파일은 version 0이고, 새로 만든 파일은 바로 가장 최근 version이 됨.
+const schemaVersion = "schemaVersion"
+
+//db 파일의 version을 하나 올리는 변경. version을 저장하는 것과 같은 transaction에서 실행하므로 실패하면 이전 version으로 남음.
+type Migration struct {
+	Version     int // migration을 실행한 후의 version
+	Description string
+	migrate     func(t *bolt.Tx) error
+}
+
+//오래된 것부터 순서대로. migrations[i]는 version i를 i+1로 바꿈.
+//migration은 그 version의 형식으로 값을 읽어야하므로 blockchain의 struct 대신 v0 struct들을 사용함.
+var migrations = []Migration{
+	{Version: 1, Description: "build the utxo set from the blocks", migrate: buildUTxOs},
+	{Version: 2, Description: "record the block the utxo set belongs to", migrate: recordUTxOTip},
+	{Version: 3, Description: "record the height of the blocks made before the merkle root", migrate: recordLegacyHeight},
+	{Version: 4, Description: "record the height of the blocks made before the length-prefixed tx id", migrate: recordTextIdHeight},
+}
+
+var ErrSchemaTooNew = errors.New("db was written by a newer version of the node")
+
+//version 0의 checkpoint, block, tx. migration에 필요한 field만 있음.
+type v0Checkpoint struct {
+	NewestHash string
+}
+
+type v0Block struct {
+	PrevHash     string
+	Transactions []*v0Tx
+}
+
+type v0Tx struct {
+	Id     string
+	TxIns  []*v0TxIn
+	TxOuts []*v0TxOut
+}
+
+type v0TxIn struct {
+	TxID      string
+	Index     int
+	Signature string
+}
+
+type v0TxOut struct {
+	Address string
+	Amount  int
+}
+
+//block이나 지운 block의 header에서 version 3, 4 migration에 필요한 field.
+type v2Header struct {
+	PrevHash   string
+	Height     int
+	MerkleRoot string
+}
+
+//db 파일의 schema version. 새로 만든 파일이면 fresh가 true.
+func readVersion(t *bolt.Tx) (version int, fresh bool) {
+	data := t.Bucket([]byte(dataBucket))
+	if v := data.Get([]byte(schemaVersion)); v != nil {
+		version, err := strconv.Atoi(string(v))
+		utils.HandleErr(err)
+		return version, false
+	}
+	if data.Get([]byte(checkpoint)) == nil && data.Get([]byte(headerChain)) == nil {
+		if k, _ := t.Bucket([]byte(blocksBucket)).Cursor().First(); k == nil {
+			return len(migrations), true
+		}
+	}
+	return 0, false
+}
+
+//db 파일의 schema version.
+func Version() int {
+	var version int
+	DB().View(func(t *bolt.Tx) error {
+		version, _ = readVersion(t)
+		return nil
+	})
+	return version
+}
+
+//db 파일에 아직 실행하지 않은 migration들. db 파일은 바꾸지 않음.
+func PendingMigrations() ([]Migration, error) {
+	version := Version()
+	if version > len(migrations) {
+		return nil, ErrSchemaTooNew
+	}
+	return migrations[version:], nil
+}
+
+//실행하지 않은 migration이 있으면 db 파일을 backup한 후 한 단계씩 실행. 실행한 migration들과 backup 파일의 이름을 리턴.
+//실패하면 그 전까지 실행한 migration은 저장된 상태로 남고, backup 파일로 migration 전의 db를 되살릴 수 있음.
+func Migrate() ([]Migration, string, error) {
+	var version int
+	var fresh bool
+	DB().View(func(t *bolt.Tx) error {
+		version, fresh = readVersion(t)
+		return nil
+	})
+	if version > len(migrations) {
+		return nil, "", ErrSchemaTooNew
+	}
+	if fresh {
+		return nil, "", DB().Update(func(t *bolt.Tx) error {
+			return putVersion(t, version)
+		})
+	}
+	if version == len(migrations) {
+		return nil, "", nil
+	}
+
+	backup := fmt.Sprintf("%s.v%d.bak", getDbName(), version)
+	if err := DB().View(func(t *bolt.Tx) error { return t.CopyFile(backup, 0600) }); err != nil {
+		return nil, "", err
+	}
+	var applied []Migration
+	for _, m := range migrations[version:] {
+		err := DB().Update(func(t *bolt.Tx) error {
+			if err := m.migrate(t); err != nil {
+				return err
+			}
+			return putVersion(t, m.Version)
+		})
+		if err != nil {
+			return applied, backup, fmt.Errorf("migration to version %d: %w", m.Version, err)
+		}
+		applied = append(applied, m)
+	}
+	return applied, backup, nil
+}
+
+func putVersion(t *bolt.Tx, version int) error {
+	return t.Bucket([]byte(dataBucket)).Put([]byte(schemaVersion), []byte(strconv.Itoa(version)))
+}
+
+func decode(i interface{}, data []byte) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(i)
+}
+
+//version 1. UTXO set이 생기기 전의 파일은 checkpoint의 block부터 genesis까지 따라가서 UTXO set을 만듬.
+//이미 UTXO set이 있거나 없는 block이 있으면 아무것도 하지 않음. 없는 block은 시작할 때 blockchain이 고침.
+func buildUTxOs(t *bolt.Tx) error {
+	data := t.Bucket([]byte(dataBucket)).Get([]byte(checkpoint))
+	utxos := t.Bucket([]byte(utxosBucket))
+	if k, _ := utxos.Cursor().First(); data == nil || k != nil {
+		return nil
+	}
+	var chain v0Checkpoint
+	if err := decode(&chain, data); err != nil {
+		return err
+	}
+	var blocks []*v0Block // 가장 최근 block이 blocks[0]
+	for hashCursor := chain.NewestHash; hashCursor != ""; {
+		data := t.Bucket([]byte(blocksBucket)).Get([]byte(hashCursor))
+		if data == nil {
+			return nil
+		}
+		block := &v0Block{}
+		if err := decode(block, data); err != nil {
+			return err
+		}
+		blocks = append(blocks, block)
+		hashCursor = block.PrevHash
+	}
+	for i := len(blocks) - 1; i >= 0; i-- {
+		add := make(map[string]*v0TxOut) // key는 blockchain의 UTXO set과 같은 tx id:index
+		var remove []string
+		for _, tx := range blocks[i].Transactions {
+			for _, txIn := range tx.TxIns {
+				if txIn.Signature != "COINBASE" {
+					remove = append(remove, fmt.Sprintf("%s:%d", txIn.TxID, txIn.Index))
+				}
+			}
+			for index, txOut := range tx.TxOuts {
+				add[fmt.Sprintf("%s:%d", tx.Id, index)] = txOut
+			}
+		}
+		for _, key := range remove {
+			delete(add, key)
+			if err := utxos.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		for key, txOut := range add {
+			if err := utxos.Put([]byte(key), utils.ToBytes(txOut)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//version 2. UTXO set이 있는 파일은 UTXO set이 checkpoint의 block까지 반영한 것으로 저장함.
+func recordUTxOTip(t *bolt.Tx) error {
+	bucket := t.Bucket([]byte(dataBucket))
+	data := bucket.Get([]byte(checkpoint))
+	if k, _ := t.Bucket([]byte(utxosBucket)).Cursor().First(); data == nil || k == nil || bucket.Get([]byte(utxoTip)) != nil {
+		return nil
+	}
+	var chain v0Checkpoint
+	if err := decode(&chain, data); err != nil {
+		return err
+	}
+	return bucket.Put([]byte(utxoTip), []byte(chain.NewestHash))
+}
+
+//version 3. merkle root가 생기기 전의 block은 hash와 tx id를 block과 tx의 메모리 주소까지 넣어서 계산했으므로 다시 계산할 수 없음.
+//checkpoint(light node는 header chain)의 block부터 genesis까지 따라가서 merkle root가 없는 가장 높은 block의 height를 저장함.
+//blockchain은 이 height까지 db에 이미 있는 block만 이전 형식으로 검증함.
+func recordLegacyHeight(t *bolt.Tx) error {
+	data := t.Bucket([]byte(dataBucket))
+	tip := data.Get([]byte(checkpoint))
+	if tip == nil {
+		tip = data.Get([]byte(headerChain))
+	}
+	if tip == nil {
+		return nil
+	}
+	var chain v0Checkpoint
+	if err := decode(&chain, tip); err != nil {
+		return err
+	}
+	height := 0
+	for hashCursor := chain.NewestHash; hashCursor != ""; {
+		value := t.Bucket([]byte(blocksBucket)).Get([]byte(hashCursor))
+		if value == nil {
+			value = t.Bucket([]byte(headersBucket)).Get([]byte(hashCursor))
+		}
+		if value == nil { // 없는 block은 시작할 때 blockchain이 고침
+			break
+		}
+		var header v2Header
+		if err := decode(&header, value); err != nil {
+			return err
+		}
+		if header.MerkleRoot == "" && height == 0 {
+			height = header.Height
+		}
+		hashCursor = header.PrevHash
+	}
+	if height == 0 {
+		return nil
+	}
+	return data.Put([]byte(legacyHeight), []byte(strconv.Itoa(height)))
+}
+
+//version 4. 이전 tx id는 tx를 fmt.Sprint한 문자열로 계산해서 다른 내용의 tx가 같은 id를 가질 수 있었음.
+//checkpoint(light node는 header chain)의 block부터 genesis까지 따라가서 db에 있는 가장 높은 block의 height를 저장함.
+//blockchain은 이 height까지 db에 이미 있는 block의 tx만 이전 형식의 id로 인정함.
+func recordTextIdHeight(t *bolt.Tx) error {
+	data := t.Bucket([]byte(dataBucket))
+	tip := data.Get([]byte(checkpoint))
+	if tip == nil {
+		tip = data.Get([]byte(headerChain))
+	}
+	if tip == nil {
+		return nil
+	}
+	var chain v0Checkpoint
+	if err := decode(&chain, tip); err != nil {
+		return err
+	}
+	for hashCursor := chain.NewestHash; hashCursor != ""; {
+		value := t.Bucket([]byte(blocksBucket)).Get([]byte(hashCursor))
+		if value == nil {
+			value = t.Bucket([]byte(headersBucket)).Get([]byte(hashCursor))
+		}
+		if value == nil {
+			break
+		}
+		var header v2Header
+		if err := decode(&header, value); err != nil {
+			return err
+		}
+		if header.Height > 0 {
+			return data.Put([]byte(textIdHeight), []byte(strconv.Itoa(header.Height)))
+		}
+		hashCursor = header.PrevHash
+	}
+	return nil
+}
+
+//data bucket에 key로 저장한 height. 없으면 0.
+func storedHeight(key string) int {
+	var height int
+	DB().View(func(t *bolt.Tx) error {
+		if v := t.Bucket([]byte(dataBucket)).Get([]byte(key)); v != nil {
+			height, _ = strconv.Atoi(string(v))
+		}
+		return nil
+	})
+	return height
+}
+
+//merkle root가 생기기 전에 만든 block 중 가장 높은 block의 height. 그런 block이 없으면 0.
+func LegacyHeight() int {
+	return storedHeight(legacyHeight)
+}
+
+//tx id를 문자열 형식으로 계산하던 때에 만든 block 중 가장 높은 block의 height. 그런 block이 없으면 0.
+func TextIdHeight() int {
+	return storedHeight(textIdHeight)
+}
@@ -0,0 +1,177 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+//testdata의 db 파일을 임시 폴더에 복사해서 엶. fixture가 ""이면 새 db 파일.
+//v0.db는 처음 release의 node가 만든 파일(height 5, bob에게 7), v1.db는 UTXO set이 있는 pruned node의 파일(height 13, bob에게 9).
+func openFixture(t *testing.T, fixture string) string {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if fixture != "" {
+		data, err := os.ReadFile(filepath.Join("testdata", fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "blockchain_fixture.db"), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	SetPort("fixture")
+	t.Cleanup(func() {
+		Close()
+		db = nil
+		os.Chdir(wd)
+	})
+	return dir
+}
+
+//UTXO set의 address별 amount 합.
+func balances(t *testing.T) map[string]int {
+	t.Helper()
+	r := make(map[string]int)
+	for _, data := range UTxOs() {
+		var txOut v0TxOut
+		if err := decode(&txOut, data); err != nil {
+			t.Fatal(err)
+		}
+		r[txOut.Address] += txOut.Amount
+	}
+	return r
+}
+
+func checkUTxOTip(t *testing.T) {
+	t.Helper()
+	var chain v0Checkpoint
+	if err := decode(&chain, Checkpoint()); err != nil {
+		t.Fatal(err)
+	}
+	if tip := string(UTxOTip()); tip != chain.NewestHash {
+		t.Errorf("Expected utxo tip %s, got %s", chain.NewestHash, tip)
+	}
+}
+
+func TestMigrateV0(t *testing.T) {
+	dir := openFixture(t, "v0.db")
+
+	t.Run("dry run does not change the file", func(t *testing.T) {
+		pending, err := PendingMigrations()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pending) != len(migrations) || pending[0].Version != 1 {
+			t.Fatalf("Expected all %d migrations, got %v", len(migrations), pending)
+		}
+		if Version() != 0 || len(UTxOs()) != 0 {
+			t.Error("dry run changed the db")
+		}
+	})
+
+	t.Run("migrates step by step after a backup", func(t *testing.T) {
+		applied, backup, err := Migrate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(applied) != len(migrations) || Version() != len(migrations) {
+			t.Fatalf("Expected version %d, got %d after %d migrations", len(migrations), Version(), len(applied))
+		}
+		if backup != "blockchain_fixture.db.v0.bak" {
+			t.Errorf("Unexpected backup %s", backup)
+		}
+		b, err := bolt.Open(filepath.Join(dir, backup), 0600, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer b.Close()
+		b.View(func(tx *bolt.Tx) error {
+			if v, _ := readVersion(tx); v != 0 {
+				t.Errorf("Expected the backup at version 0, got %d", v)
+			}
+			return nil
+		})
+	})
+
+	t.Run("builds the utxo set", func(t *testing.T) {
+		total := 0
+		for _, amount := range balances(t) {
+			total += amount
+		}
+		if total != 5*50 || balances(t)["bob"] != 7 {
+			t.Errorf("Expected 250 coins with 7 for bob, got %v", balances(t))
+		}
+		checkUTxOTip(t)
+	})
+
+	t.Run("records the height of the blocks without a merkle root", func(t *testing.T) {
+		if height := LegacyHeight(); height != 5 {
+			t.Errorf("Expected legacy height 5, got %d", height)
+		}
+	})
+
+	t.Run("records the height of the blocks with text tx ids", func(t *testing.T) {
+		if height := TextIdHeight(); height != 5 {
+			t.Errorf("Expected text id height 5, got %d", height)
+		}
+	})
+
+	t.Run("migrated file does nothing", func(t *testing.T) {
+		applied, backup, err := Migrate()
+		if err != nil || applied != nil || backup != "" {
+			t.Errorf("Expected no migration, got %v %s %v", applied, backup, err)
+		}
+	})
+}
+
+func TestMigrateV1(t *testing.T) {
+	openFixture(t, "v1.db")
+	before := balances(t)
+	if before["bob"] != 9 {
+		t.Fatalf("Expected 9 for bob in the fixture, got %v", before)
+	}
+	if _, _, err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	after := balances(t)
+	if len(after) != len(before) || after["bob"] != 9 {
+		t.Errorf("utxo set changed from %v to %v", before, after)
+	}
+	checkUTxOTip(t)
+	if height := LegacyHeight(); height != 0 {
+		t.Errorf("Expected no legacy blocks, got height %d", height)
+	}
+	if height := TextIdHeight(); height != 13 {
+		t.Errorf("Expected text id height 13, got %d", height)
+	}
+}
+
+func TestMigrateNewFile(t *testing.T) {
+	openFixture(t, "")
+	applied, backup, err := Migrate()
+	if err != nil || applied != nil || backup != "" {
+		t.Fatalf("Expected no migration, got %v %s %v", applied, backup, err)
+	}
+	if Version() != len(migrations) {
+		t.Errorf("Expected version %d, got %d", len(migrations), Version())
+	}
+	SaveBlockchain([]byte("checkpoint"))
+	if Version() != len(migrations) {
+		t.Error("new file lost its version")
+	}
+
+	DB().Update(func(tx *bolt.Tx) error { return putVersion(tx, len(migrations)+1) })
+	if _, _, err := Migrate(); err != ErrSchemaTooNew {
+		t.Errorf("Expected ErrSchemaTooNew, got %v", err)
+	}
+}
@@ -5,11 +5,13 @@ go 1.17
 require (
 	github.com/gorilla/mux v1.8.0
 	github.com/gorilla/websocket v1.5.0
+	github.com/tyler-smith/go-bip39 v1.1.0
 	go.etcd.io/bbolt v1.3.6
+	golang.org/x/crypto v0.8.0
 )
 
 require (
 	github.com/axw/gocov v1.0.0 // indirect
-	golang.org/x/sys v0.0.0-20220209214540-3681064d5158 // indirect
+	golang.org/x/sys v0.7.0 // indirect
 	golang.org/x/tools v0.1.10 // indirect
 )
@@ -0,0 +1,224 @@
+package p2p
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yyuurriiaa/ProjectMSSP/db"
+	"github.com/yyuurriiaa/ProjectMSSP/utils"
+)
+
+const (
+	maxAddrs     int = 100  // addr 메세지 하나에 담아 보내는 최대 주소 개수
+	maxAttempts  int = 10   // 연속으로 연결에 실패하면 주소록에서 삭제하는 횟수
+	retryBackoff int = 60   // 연결에 실패한 주소를 다시 시도하기까지 기다리는 시간(초). 실패 횟수만큼 곱해짐
+	maxBookAddrs int = 1000 // 주소록에 저장하는 최대 주소 개수
+)
+
+//주소록에 저장되는 peer의 정보. LastSeen : 마지막으로 연결에 성공한 시간, LastAttempt : 마지막으로 연결을 시도한 시간, Attempts : 연속으로 실패한 횟수
+type knownAddr struct {
+	Address     string `json:"address"`
+	Port        string `json:"port"`
+	NodeID      string `json:"nodeId,omitempty"` // TLS를 사용할 때 이 주소에 있어야 하는 node의 ID
+	LastSeen    int    `json:"lastSeen"`
+	LastAttempt int    `json:"lastAttempt"`
+	Attempts    int    `json:"attempts"`
+}
+
+//addr 메세지로 주고받는 주소. ipv6 주소도 그대로 담을 수 있도록 address와 port를 따로 보냄
+type addrPayload struct {
+	Address string `json:"address"`
+	Port    string `json:"port"`
+	NodeID  string `json:"nodeId,omitempty"`
+}
+
+type addrBook struct {
+	v map[string]*knownAddr
+	m sync.Mutex
+}
+
+var book *addrBook
+var bookOnce sync.Once
+
+//singleton으로 주소록 생성. db에 저장된 주소들을 불러옴
+func AddressBook() *addrBook {
+	bookOnce.Do(func() {
+		book = &addrBook{
+			v: make(map[string]*knownAddr),
+		}
+		for key, data := range db.Peers() {
+			a := &knownAddr{}
+			utils.FromBytes(a, data)
+			book.v[key] = a
+		}
+	})
+	return book
+}
+
+//address 와 port로 peer의 key를 만듬. ipv6 주소는 [::1]:4000 처럼 괄호로 감싸짐
+func peerKey(address string, port string) string {
+	return net.JoinHostPort(address, port)
+}
+
+//knownAddr를 []byte로 변환시켜서 db에 저장
+func persistAddr(key string, a *knownAddr) {
+	db.SavePeer(key, utils.ToBytes(a))
+}
+
+//주소록에 새로운 주소 추가. 이미 있는 주소이거나 자기 자신이라면 아무것도 하지 않음. 이미 있는 주소의 node ID를 모르고 있었다면 nodeID를 기록.
+func (b *addrBook) add(address string, port string, nodeID string) {
+	if address == "" || port == "" || isSelf(address, port) {
+		return
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	key := peerKey(address, port)
+	if a, ok := b.v[key]; ok {
+		if a.NodeID == "" && nodeID != "" {
+			a.NodeID = nodeID
+			persistAddr(key, a)
+		}
+		return
+	}
+	if len(b.v) >= maxBookAddrs {
+		return
+	}
+	a := &knownAddr{
+		Address: address,
+		Port:    port,
+		NodeID:  nodeID,
+	}
+	b.v[key] = a
+	persistAddr(key, a)
+}
+
+//연결을 시도한 시간과 횟수를 기록
+func (b *addrBook) markAttempt(address string, port string) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	key := peerKey(address, port)
+	a, ok := b.v[key]
+	if !ok {
+		return
+	}
+	a.LastAttempt = int(time.Now().Unix())
+	a.Attempts += 1
+	if a.Attempts >= maxAttempts { //계속 연결이 안되는 주소는 삭제
+		delete(b.v, key)
+		db.DeletePeer(key)
+		return
+	}
+	persistAddr(key, a)
+}
+
+//연결에 성공한 주소를 기록. 주소록에 없으면 새로 추가. TLS로 확인한 nodeID가 있으면 함께 기록
+func (b *addrBook) markGood(address string, port string, nodeID string) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	key := peerKey(address, port)
+	a, ok := b.v[key]
+	if !ok {
+		a = &knownAddr{
+			Address: address,
+			Port:    port,
+		}
+		b.v[key] = a
+	}
+	a.LastSeen = int(time.Now().Unix())
+	a.Attempts = 0
+	if nodeID != "" {
+		a.NodeID = nodeID
+	}
+	persistAddr(key, a)
+}
+
+//주소록의 모든 주소를 최근에 연결된 순서로 리턴
+func (b *addrBook) list() []*knownAddr {
+	b.m.Lock()
+	defer b.m.Unlock()
+	var addrs []*knownAddr
+	for _, a := range b.v {
+		copied := *a
+		addrs = append(addrs, &copied)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		if addrs[i].LastSeen != addrs[j].LastSeen {
+			return addrs[i].LastSeen > addrs[j].LastSeen
+		}
+		return addrs[i].Attempts < addrs[j].Attempts
+	})
+	return addrs
+}
+
+//주소록에 기록된 address:port의 node ID를 리턴. 모르면 빈 문자열.
+func (b *addrBook) nodeID(address string, port string) string {
+	b.m.Lock()
+	defer b.m.Unlock()
+	if a, ok := b.v[peerKey(address, port)]; ok {
+		return a.NodeID
+	}
+	return ""
+}
+
+//연결을 시도해볼 주소들을 리턴. 이미 연결된 주소, 자기 자신, 최근에 실패해서 기다려야하는 주소는 제외.
+func (b *addrBook) candidates(n int) []*knownAddr {
+	now := int(time.Now().Unix())
+	connected := make(map[string]bool)
+	for _, key := range AllPeers(&Peers) {
+		connected[key] = true
+	}
+	var addrs []*knownAddr
+	for _, a := range b.list() {
+		if len(addrs) >= n {
+			break
+		}
+		if connected[peerKey(a.Address, a.Port)] || isSelf(a.Address, a.Port) {
+			continue
+		}
+		if a.Attempts > 0 && now-a.LastAttempt < retryBackoff*a.Attempts {
+			continue
+		}
+		addrs = append(addrs, a)
+	}
+	return addrs
+}
+
+//주소록의 모든 주소와 연결 기록을 리턴.
+func KnownAddrs(b *addrBook) []*knownAddr {
+	return b.list()
+}
+
+//주소록에서 최근에 연결된 주소를 최대 maxAddrs개 골라서 addr 메세지의 payload로 만듬
+func (b *addrBook) addrs() []addrPayload {
+	var payload []addrPayload
+	for _, a := range b.list() {
+		if len(payload) >= maxAddrs {
+			break
+		}
+		payload = append(payload, addrPayload{a.Address, a.Port, a.NodeID})
+	}
+	return payload
+}
+
+//해당 address:port가 이 노드 자신인지 확인. 같은 포트를 쓰는 loopback 또는 이 컴퓨터의 주소이면 자기 자신.
+func isSelf(address string, port string) bool {
+	if port != listenPort {
+		return false
+	}
+	ip := net.ParseIP(address)
+	if address == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return true
+	}
+	ifaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, ifaceAddr := range ifaceAddrs {
+		if ipNet, ok := ifaceAddr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
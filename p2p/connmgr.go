@@ -0,0 +1,57 @@
+package p2p
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	targetOutbound  int           = 8                // 유지하려는 outbound 연결의 수
+	connectInterval time.Duration = 30 * time.Second // 연결 수를 확인하는 주기
+)
+
+var listenPort string // 이 노드가 열고있는 포트. 다른 peer에 연결할 때 openPort로 알려줌
+
+//seed peer들을 주소록에 추가하고 connection manager를 시작함. seeds는 "address:port" 또는 TLS를 사용할 때 "nodeID@address:port" 형식.
+func Start(port string, seeds []string) {
+	listenPort = port
+	for _, seed := range seeds {
+		nodeID := ""
+		if at := strings.Index(seed, "@"); at >= 0 {
+			nodeID, seed = strings.ToLower(seed[:at]), seed[at+1:]
+		}
+		address, seedPort, err := net.SplitHostPort(seed)
+		if err != nil {
+			fmt.Printf("invalid seed %s: %s\n", seed, err)
+			continue
+		}
+		AddressBook().add(address, seedPort, nodeID)
+	}
+	go connectionManager()
+}
+
+//connectInterval마다 outbound 연결의 수를 확인하고 부족하면 주소록의 주소로 연결함.
+func connectionManager() {
+	for {
+		maintainOutbound()
+		time.Sleep(connectInterval)
+	}
+}
+
+//outbound 연결이 targetOutbound개가 되도록 주소록의 주소로 연결을 시도함. 재시작 후에도 db에 저장된 주소록으로 다시 연결됨.
+func maintainOutbound() {
+	need := targetOutbound - outboundCount(&Peers)
+	if need <= 0 {
+		return
+	}
+	for _, a := range AddressBook().candidates(need) {
+		p, err := dialPeer(a.Address, a.Port, listenPort)
+		if err != nil {
+			fmt.Printf("\ncould not connect to %s: %s\n", peerKey(a.Address, a.Port), err)
+			continue
+		}
+		startSync(p)
+	}
+}
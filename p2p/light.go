@@ -0,0 +1,205 @@
+package p2p
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/yyuurriiaa/ProjectMSSP/blockchain"
+	"github.com/yyuurriiaa/ProjectMSSP/wallet"
+)
+
+const (
+	maxFilterAddrs     int = 1000  // filter에 넣을 수 있는 address의 최대 수. HD wallet은 address가 많음
+	maxFilterOutpoints int = 10000 // filter가 기억하는 TxOut의 최대 수
+)
+
+var ErrNotFullNode = errors.New("peer is not a full node")
+var ErrLightNode = errors.New("light node does not accept peers")
+
+//tx 안의 TxOut 위치. filter에서 map의 key로 사용.
+type outpoint struct {
+	TxID  string `json:"txID"`
+	Index int    `json:"index"`
+}
+
+//MessageFilterLoad의 payload. light node의 wallet address들과 아직 사용하지 않은 TxOut들.
+type filterPayload struct {
+	Addresses []string   `json:"addresses"`
+	Outpoints []outpoint `json:"outpoints"`
+}
+
+//light node가 등록한 filter. filter에 맞는 tx만 light node에게 보냄.
+//address로 받은 TxOut을 기억해서 그 TxOut을 사용하는 tx도 맞는 것으로 봄.
+type txFilter struct {
+	addresses map[string]bool
+	outpoints map[outpoint]bool
+	m         sync.Mutex
+}
+
+//light node가 보낸 filter로 바꿈. 너무 많은 address나 TxOut은 앞의 것만 사용.
+func (f *txFilter) load(payload filterPayload) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.addresses = make(map[string]bool)
+	f.outpoints = make(map[outpoint]bool)
+	for i, address := range payload.Addresses {
+		if i >= maxFilterAddrs {
+			break
+		}
+		f.addresses[address] = true
+	}
+	for i, o := range payload.Outpoints {
+		if i >= maxFilterOutpoints {
+			break
+		}
+		f.outpoints[o] = true
+	}
+}
+
+//filter가 등록되었는지 확인. filter를 등록한 peer는 light node.
+func (f *txFilter) loaded() bool {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return f.addresses != nil
+}
+
+//tx가 filter의 address로 보내졌거나 filter의 TxOut을 사용하는지 확인. address로 보내진 TxOut은 filter에 추가함.
+func (f *txFilter) match(tx *blockchain.Tx) bool {
+	f.m.Lock()
+	defer f.m.Unlock()
+	matched := false
+	for _, txIn := range tx.TxIns {
+		if f.outpoints[outpoint{TxID: txIn.TxID, Index: txIn.Index}] {
+			matched = true
+		}
+	}
+	for index, txOut := range tx.TxOuts {
+		if !f.addresses[txOut.Address] {
+			continue
+		}
+		matched = true
+		if len(f.outpoints) < maxFilterOutpoints {
+			f.outpoints[outpoint{TxID: tx.Id, Index: index}] = true
+		}
+	}
+	return matched
+}
+
+//연결된 peer와 처음 주고받는 message. light node는 header와 wallet tx를 요청하고, full node는 가장 최근 block을 보냄.
+//검증하지 않은 snapshot으로 시작한 node는 모든 block을 요청해서 snapshot을 검증함.
+func startSync(p *peer) {
+	if blockchain.Light() {
+		syncLight(p)
+		return
+	}
+	sendNewestBlock(p)
+	if blockchain.SnapshotPending() && p.services.has(serviceFullNode) {
+		requestAllBlocks(p)
+	}
+}
+
+//light node가 p에게 wallet의 filter를 등록하고 가장 최근 header 다음의 header들을 요청.
+func syncLight(p *peer) {
+	loadFilter(p)
+	requestHeaders(p)
+}
+
+//불러온 wallet들의 address와 지켜보는 address로 filter를 만들어서 p에게 등록. HD wallet은 아직 만들지 않은 address들도 등록해서 새 address로 받는 tx도 받음.
+func loadFilter(p *peer) {
+	var payload filterPayload
+	for _, w := range wallet.Wallets().Loaded() {
+		addresses := append(w.Addresses(), w.Watched()...)
+		payload.Addresses = append(payload.Addresses, append(addresses, w.Lookahead()...)...)
+		for _, address := range addresses {
+			for _, uTxOut := range blockchain.LightUTxOuts(address) { // 이미 받은 TxOut을 사용하는 tx도 받기 위해
+				payload.Outpoints = append(payload.Outpoints, outpoint{TxID: uTxOut.TxID, Index: uTxOut.Index})
+			}
+		}
+	}
+	p.send(MessageFilterLoad, payload)
+}
+
+//wallet에 address가 추가되었을 때 연결된 peer들의 filter를 다시 등록. light node가 아니면 아무것도 하지 않음.
+func ReloadFilters() {
+	if !blockchain.Light() {
+		return
+	}
+	for _, p := range Peers.snapshot() {
+		loadFilter(p)
+	}
+}
+
+//p의 queue에 MessageGetHeaders와 light node의 가장 최근 header의 hash를 넣음
+func requestHeaders(p *peer) {
+	p.send(MessageGetHeaders, blockchain.Headers().NewestHash)
+}
+
+//p의 queue에 MessageGetMerkleBlocks와 wallet tx를 받은 마지막 height를 넣음
+func requestMerkleBlocks(p *peer) {
+	p.send(MessageGetMerkleBlocks, blockchain.Headers().Scanned)
+}
+
+//height 다음의 block들 중 p의 filter에 맞는 tx가 있는 block들을 MerkleBlock으로 보냄. filter가 없으면 보내지 않음.
+func sendMerkleBlocks(height int, p *peer) {
+	if !p.filter.loaded() {
+		return
+	}
+	blocks := blockchain.Blocks(blockchain.Blockchain())
+	var merkleBlocks []*blockchain.MerkleBlock
+	for i := len(blocks) - 1; i >= 0; i-- { // 오래된 block부터 보내야 filter가 TxOut을 기억함
+		if blocks[i].Height <= height {
+			continue
+		}
+		if mb := blockchain.NewMerkleBlock(blocks[i], p.filter.match); len(mb.Txs) > 0 {
+			merkleBlocks = append(merkleBlocks, mb)
+		}
+	}
+	p.send(MessageMerkleBlocks, merkleBlocks)
+}
+
+//light node가 p에게 받은 header들을 header chain에 연결. 잘못된 header를 보낸 peer와는 연결을 끊음.
+//더 받을 header가 있으면 다시 요청하고, 다 받았으면 wallet tx를 요청.
+func handleHeaders(headers []*blockchain.Header, p *peer) {
+	if !blockchain.Light() {
+		return
+	}
+	err := blockchain.Headers().AddHeaders(headers)
+	switch err {
+	case nil:
+		if len(headers) >= blockchain.MaxHeaders && headers[len(headers)-1].Hash == blockchain.Headers().NewestHash {
+			requestHeaders(p)
+			return
+		}
+		requestMerkleBlocks(p)
+	case blockchain.ErrHeaderNotConnectable:
+		requestHeaders(p)
+	default:
+		fmt.Printf("\n%s sent invalid headers, disconnecting\n", p.key)
+		p.close()
+	}
+}
+
+//light node가 p에게 받은 MerkleBlock들의 header와 merkle proof를 검증하고 wallet tx를 저장.
+//header를 아직 받지 못했으면 header를 요청하고, 잘못된 proof를 보낸 peer와는 연결을 끊음.
+func handleMerkleBlocks(merkleBlocks []*blockchain.MerkleBlock, p *peer) {
+	if !blockchain.Light() {
+		return
+	}
+	for _, mb := range merkleBlocks {
+		if mb == nil {
+			continue
+		}
+		err := blockchain.Headers().AddMerkleBlock(mb)
+		switch err {
+		case nil:
+		case blockchain.ErrHeaderNotConnectable:
+			requestHeaders(p) // header를 받은 후 wallet tx를 다시 요청함
+			return
+		default:
+			fmt.Printf("\n%s sent an invalid merkle block, disconnecting\n", p.key)
+			p.close()
+			return
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package p2p
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/yyuurriiaa/ProjectMSSP/codec"
+)
+
+const (
+	maxInboundPeers int   = 32                                      // 다른 노드가 연결해올 수 있는 최대 peer 수
+	maxPeersPerIP   int   = 4                                       // ip 하나에서 연결해올 수 있는 최대 peer 수. loopback은 제한하지 않음
+	maxMessageSize  int64 = int64(codec.MaxPayloadSize) + 1024*1024 // 받을 수 있는 message 하나의 최대 크기. 넘으면 연결을 끊음
+)
+
+var ErrTooManyPeers = errors.New("too many inbound peers")
+var ErrTooManyFromIP = errors.New("too many peers from this ip")
+
+//message 종류마다 peer가 보낼 수 있는 속도. 초당 rate개씩 채워지고 최대 burst개까지 모아둘 수 있음.
+type rateLimit struct {
+	rate  float64
+	burst float64
+}
+
+var rateLimits = map[MessageKind]rateLimit{
+	MessageNewestBlock:       {rate: 1, burst: 5},
+	MessageAllBlocksRequest:  {rate: 0.1, burst: 2},
+	MessageAllBlocksResponse: {rate: 0.1, burst: 2},
+	MessageNewBlockNotify:    {rate: 1, burst: 10},
+	MessageNewTxNotify:       {rate: 10, burst: 100},
+	MessageNewPeerNotify:     {rate: 1, burst: 10},
+	MessageGetAddr:           {rate: 1.0 / 60, burst: 2},
+	MessageAddr:              {rate: 0.1, burst: 5},
+	MessageBlockRequest:      {rate: 10, burst: 50},
+	MessageBlockResponse:     {rate: 10, burst: 50},
+	MessageTxRequest:         {rate: 20, burst: 100},
+	MessageTxResponse:        {rate: 20, burst: 100},
+	MessageCompactBlock:      {rate: 1, burst: 10},
+	MessageGetBlockTxn:       {rate: 1, burst: 10},
+	MessageBlockTxn:          {rate: 1, burst: 10},
+	MessageGetHeaders:        {rate: 1, burst: 10},
+	MessageHeaders:           {rate: 1, burst: 10},
+	MessageFilterLoad:        {rate: 0.1, burst: 2},
+	MessageGetMerkleBlocks:   {rate: 0.2, burst: 5},
+	MessageMerkleBlocks:      {rate: 1, burst: 10},
+}
+
+//token bucket. message 하나를 받을 때마다 token 하나를 사용하고, token이 없으면 message를 버림.
+type tokenBucket struct {
+	limit  rateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit rateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		limit:  limit,
+		tokens: limit.burst,
+		last:   now,
+	}
+}
+
+//now까지 채워진 token을 더하고 token 하나를 사용. token이 없으면 false.
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.rate
+	if b.tokens > b.limit.burst {
+		b.tokens = b.limit.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens -= 1
+	return true
+}
+
+//peer가 kind message를 보낼 수 있는지 확인. read goroutine에서만 호출되므로 lock을 사용하지 않음.
+//모르는 종류의 message는 handleMsg에서 무시되므로 제한하지 않음.
+func (p *peer) allow(kind MessageKind) bool {
+	limit, ok := rateLimits[kind]
+	if !ok {
+		return true
+	}
+	now := time.Now()
+	bucket, ok := p.buckets[kind]
+	if !ok {
+		bucket = newTokenBucket(limit, now)
+		p.buckets[kind] = bucket
+	}
+	return bucket.allow(now)
+}
+
+//ip에서 새로 연결해온 peer를 받을 수 있는지 확인. inbound peer 수와 ip 하나의 peer 수를 제한함.
+func checkInbound(p *peers, ip string) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	inbound, fromIP := 0, 0
+	for _, aPeer := range p.v {
+		if aPeer.outbound {
+			continue
+		}
+		inbound += 1
+		if aPeer.address == ip {
+			fromIP += 1
+		}
+	}
+	if inbound >= maxInboundPeers {
+		return ErrTooManyPeers
+	}
+	if parsed := net.ParseIP(ip); (parsed == nil || !parsed.IsLoopback()) && fromIP >= maxPeersPerIP {
+		return ErrTooManyFromIP
+	}
+	return nil
+}
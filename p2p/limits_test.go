@@ -0,0 +1,51 @@
+package p2p
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(rateLimit{rate: 10, burst: 5}, now)
+	for i := 0; i < 5; i++ {
+		if !b.allow(now) {
+			t.Fatalf("Expected message %d within burst to be allowed", i)
+		}
+	}
+	if b.allow(now) {
+		t.Error("Expected message over burst to be dropped")
+	}
+	if !b.allow(now.Add(100 * time.Millisecond)) { // 0.1초에 token 하나가 채워짐
+		t.Error("Expected message after refill to be allowed")
+	}
+	if b.allow(now.Add(100 * time.Millisecond)) {
+		t.Error("Expected refilled token to be used only once")
+	}
+	b.allow(now.Add(time.Hour))
+	if b.tokens > b.limit.burst {
+		t.Errorf("Expected tokens to be capped at %v. now got : %v", b.limit.burst, b.tokens)
+	}
+}
+
+func TestCheckInbound(t *testing.T) {
+	ps := &peers{v: make(map[string]*peer)}
+	for i := 0; i < maxPeersPerIP; i++ {
+		p := newPeer(nil, "10.0.0.1", strconv.Itoa(4000+i), "", wireJSON, 0, false)
+		ps.v[p.key] = p
+	}
+	if err := checkInbound(ps, "10.0.0.1"); err != ErrTooManyFromIP {
+		t.Errorf("Expected error : %v. now got : %v", ErrTooManyFromIP, err)
+	}
+	if err := checkInbound(ps, "10.0.0.2"); err != nil {
+		t.Errorf("Expected other ip to be accepted. now got : %v", err)
+	}
+	for i := 0; i < maxInboundPeers; i++ {
+		p := newPeer(nil, "127.0.0.1", strconv.Itoa(4000+i), "", wireJSON, 0, false)
+		ps.v[p.key] = p
+	}
+	if err := checkInbound(ps, "10.0.0.2"); err != ErrTooManyPeers {
+		t.Errorf("Expected error : %v. now got : %v", ErrTooManyPeers, err)
+	}
+}
@@ -1,9 +1,9 @@
 package p2p
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
+	"sync/atomic"
 
 	"github.com/yyuurriiaa/ProjectMSSP/blockchain"
 	"github.com/yyuurriiaa/ProjectMSSP/utils"
@@ -18,8 +18,50 @@ const (
 	MessageNewBlockNotify
 	MessageNewTxNotify
 	MessageNewPeerNotify
+	MessageGetAddr         // 알고있는 peer 주소들을 요청
+	MessageAddr            // 알고있는 peer 주소들을 보냄
+	MessageBlockRequest    // hash로 block 하나를 요청. orphan block의 이전 block을 받기 위해 사용
+	MessageBlockResponse   // 요청받은 block을 보냄
+	MessageTxRequest       // id로 tx 하나를 요청. orphan tx의 부모 tx를 받기 위해 사용
+	MessageTxResponse      // 요청받은 tx를 보냄
+	MessageCompactBlock    // 새 block을 header와 short tx id로 알림
+	MessageGetBlockTxn     // compact block에서 mempool에 없는 tx들을 요청
+	MessageBlockTxn        // 요청받은 tx들을 보냄
+	MessageGetHeaders      // hash 다음의 header들을 요청. light node가 사용
+	MessageHeaders         // 요청받은 header들을 보냄
+	MessageFilterLoad      // light node의 wallet address를 보내서 그 address의 tx만 받음
+	MessageGetMerkleBlocks // height 다음의 block에서 filter에 맞는 tx들을 merkle proof와 함께 요청
+	MessageMerkleBlocks    // header와 filter에 맞는 tx들을 merkle proof와 함께 보냄
 )
 
+//새로운 peer의 주소와 그 peer에 연결할 때 사용할 openPort. ipv6 주소의 ':' 때문에 문자열을 나누지 않고 필드로 보냄
+type newPeerPayload struct {
+	Address  string `json:"address"`
+	Port     string `json:"port"`
+	NodeID   string `json:"nodeId,omitempty"`
+	OpenPort string `json:"openPort"`
+}
+
+//block과 관련된 message인지 확인. block message는 다른 message보다 먼저 보내짐
+func (k MessageKind) isBlockMessage() bool {
+	switch k {
+	case MessageNewestBlock, MessageAllBlocksRequest, MessageAllBlocksResponse, MessageNewBlockNotify, MessageBlockRequest, MessageBlockResponse,
+		MessageCompactBlock, MessageGetBlockTxn, MessageBlockTxn,
+		MessageGetHeaders, MessageHeaders, MessageGetMerkleBlocks, MessageMerkleBlocks:
+		return true
+	}
+	return false
+}
+
+//light node가 처리하는 message인지 확인. light node는 block과 tx를 검증할 수 없으므로 header와 merkle proof, 주소만 받음
+func (k MessageKind) isLightMessage() bool {
+	switch k {
+	case MessageHeaders, MessageMerkleBlocks, MessageGetAddr, MessageAddr, MessageNewPeerNotify:
+		return true
+	}
+	return false
+}
+
 type Message struct {
 	Kind    MessageKind
 	Payload []byte
@@ -35,60 +77,130 @@ func makeMessage(kind MessageKind, payload interface{}) []byte {
 	return utils.ToJSON(m)
 }
 
-//peer에게 가장 최근의 block을 보냄. p.inbox 채널에 MessageNewestBlock 과 NewestHash를 가지는 NewestBlock을 json으로 변환한 값을 넣음
+//peer에게 가장 최근의 block을 보냄. p의 queue에 MessageNewestBlock 과 NewestHash를 가지는 NewestBlock을 peer의 형식으로 변환한 값을 넣음
 func sendNewestBlock(p *peer) { //연결한 측에서 사용됨
 	fmt.Printf("\nsending newest block to %s\n", p.key)
 	b, err := blockchain.FindBlock(blockchain.Blockchain().NewestHash)
 	utils.HandleErr(err)
 	fmt.Println("b :", b)
-	m := makeMessage(MessageNewestBlock, b)
-	p.inbox <- m
+	p.send(MessageNewestBlock, b)
 
 }
 
-//p.inbox 채널에 MessageAllBlocksRequest 를 보냄. nil인 이유는 모든 블록을 보내달라는 요청만을 보내는 것이기 때문에.
+//p의 queue에 MessageAllBlocksRequest 를 보냄. nil인 이유는 모든 블록을 보내달라는 요청만을 보내는 것이기 때문에.
+//pruned node는 오래된 block이 없으므로 요청하지 않음. 다른 peer와 연결되면 그 peer에게 받음.
 func requestAllBlocks(p *peer) {
-	m := makeMessage(MessageAllBlocksRequest, nil)
-	p.inbox <- m
+	if p.services.has(servicePruned) {
+		fmt.Printf("\n%s is pruned, not requesting all blocks\n", p.key)
+		return
+	}
+	atomic.StoreInt32(&p.allBlocks, 1)
+	p.send(MessageAllBlocksRequest, nil)
 }
 
-//p.inbox 채널에 MessageAllBlocksResponse와 block을 json으로 변환한 값을 넣음
+//p의 queue에 MessageAllBlocksResponse와 block을 peer의 형식으로 변환한 값을 넣음
 func sendAllBlocks(p *peer) {
-	m := makeMessage(MessageAllBlocksResponse, blockchain.Blocks(blockchain.Blockchain()))
-	p.inbox <- m
+	p.send(MessageAllBlocksResponse, blockchain.Blocks(blockchain.Blockchain()))
 }
 
-//p.inbox 채널에 MessageNewBlockNotify와 block을 json으로 변환한 값을 넣음
+//p의 queue에 MessageNewBlockNotify와 block을 peer의 형식으로 변환한 값을 넣음
 func notifyNewBlock(b *blockchain.Block, p *peer) {
-	m := makeMessage(MessageNewBlockNotify, b)
-	p.inbox <- m
+	p.send(MessageNewBlockNotify, b)
 }
 
-//p.inbox 채널에 MessageNewTxNotify와 tx을 json으로 변환한 값을 넣음
+//p의 queue에 MessageNewTxNotify와 tx을 peer의 형식으로 변환한 값을 넣음
 func notifyNewTx(tx *blockchain.Tx, p *peer) {
-	m := makeMessage(MessageNewTxNotify, tx)
-	p.inbox <- m
+	p.send(MessageNewTxNotify, tx)
+}
+
+//p의 queue에 MessageNewPeerNotify와 newPeer의 주소를 peer의 형식으로 변환한 값을 넣음
+func notifyNewPeer(newPeer newPeerPayload, p *peer) {
+	p.send(MessageNewPeerNotify, newPeer)
+}
+
+//p의 queue에 MessageGetAddr를 보냄. 요청만 하므로 payload는 nil.
+func requestAddrs(p *peer) {
+	p.send(MessageGetAddr, nil)
+}
+
+//p의 queue에 MessageAddr와 주소록의 주소들을 peer의 형식으로 변환한 값을 넣음
+func sendAddrs(p *peer) {
+	p.send(MessageAddr, AddressBook().addrs())
+}
+
+//p의 queue에 MessageBlockRequest와 요청하는 block의 hash를 넣음
+func requestBlock(hash string, p *peer) {
+	p.send(MessageBlockRequest, hash)
+}
+
+//p의 queue에 MessageBlockResponse와 요청받은 block을 넣음
+func sendBlock(b *blockchain.Block, p *peer) {
+	p.send(MessageBlockResponse, b)
+}
+
+//p의 queue에 MessageTxRequest와 요청하는 tx의 id를 넣음
+func requestTx(id string, p *peer) {
+	p.send(MessageTxRequest, id)
+}
+
+//p의 queue에 MessageTxResponse와 요청받은 tx를 넣음
+func sendTx(tx *blockchain.Tx, p *peer) {
+	p.send(MessageTxResponse, tx)
+}
+
+//peer에게 받은 block을 blockchain에 연결. 이전 block이 없으면 p에게 이전 block을 요청하고, 너무 멀리 떨어져 있으면 모든 블록을 요청.
+func handlePeerBlock(newBlock *blockchain.Block, p *peer) {
+	err := blockchain.Blockchain().AddPeerBlock(newBlock)
+	switch err {
+	case blockchain.ErrOrphanBlock:
+		fmt.Printf("\nrequest previous block %s from %s\n", newBlock.PrevHash, p.key)
+		requestBlock(newBlock.PrevHash, p)
+	case blockchain.ErrBlockTooFar, blockchain.ErrDifferentGenesis:
+		fmt.Printf("\nrequest all blocks from %s\n", p.key)
+		requestAllBlocks(p)
+	case nil, blockchain.ErrBlockNotConnectable:
+	default:
+		fmt.Printf("\n%s sent an invalid block: %s\n", p.key, err)
+	}
 }
 
-//p.inbox 채널에 MessageNewPeerNotify와 address을 json으로 변환한 값을 넣음
-func notifyNewPeer(address string, p *peer) {
-	m := makeMessage(MessageNewPeerNotify, address)
-	p.inbox <- m
+//peer에게 받은 tx를 mempool에 추가. 부모 tx가 없으면 p에게 부모 tx들을 요청.
+func handlePeerTx(tx *blockchain.Tx, p *peer) {
+	missing, err := blockchain.Mempool().AddPeerTx(tx)
+	if err == blockchain.ErrorOrphanTx {
+		for _, id := range missing {
+			requestTx(id, p)
+		}
+	}
 }
 
-//받은 Message의 종류마다 다른 기능을 하는 함수 실행.
-func handleMsg(m *Message, p *peer) { //연결된 측에서 사용됨
+//받은 Message의 종류마다 다른 기능을 하는 함수 실행. payload를 읽을 수 없거나 필요한 값이 nil이면 에러를 리턴하고 read가 연결을 끊음.
+func handleMsg(m *Message, p *peer) error { //연결된 측에서 사용됨
+	if blockchain.Light() && !m.Kind.isLightMessage() {
+		return nil
+	}
 	switch m.Kind {
 	case MessageNewestBlock: //새 블록을 보냄
 		fmt.Printf("\nreceived the newest block from %s\n", p.key)
 		// fmt.Println(m.Kind, m.Payload)
-		var msgBlock blockchain.Block               //var payload blockchain.Block으로 빈 블록을 만든 후,
-		err := json.Unmarshal(m.Payload, &msgBlock) // json.Unmarshal로 m.payload(다른 포트에서 받아온)의 내용물을 unmarshal 하여 payload 블록에 저장
-		utils.HandleErr(err)
+		var msgBlock blockchain.Block                                  //var payload blockchain.Block으로 빈 블록을 만든 후,
+		if err := p.wire.unmarshal(m.Payload, &msgBlock); err != nil { // json.Unmarshal로 m.payload(다른 포트에서 받아온)의 내용물을 unmarshal 하여 payload 블록에 저장
+			return err
+		}
+		if err := checkBlockPayload(&msgBlock); err != nil {
+			return err
+		}
 		fmt.Println("\nmsgBlock : ", msgBlock)
 		b, err := blockchain.FindBlock(blockchain.Blockchain().NewestHash)
 		utils.HandleErr(err)
-		if msgBlock.Height >= b.Height { //다른 포트의 height가 이 포트의 height보다 크면
+		if msgBlock.Height >= b.Height && p.services.has(servicePruned) && !blockchain.Pruned() {
+			//pruned node에게는 모든 블록을 받을 수 없으므로 이 포트의 newest block을 보내서 pruned node가 모든 블록을 요청하게 함
+			fmt.Printf("\nsend newest block to pruned %s\n", p.key)
+			sendNewestBlock(p)
+		} else if msgBlock.Height > b.Height && blockchain.Pruned() {
+			//오래된 block이 없는 node는 모든 블록을 받지 않고 다른 포트의 newest block부터 이전 block을 하나씩 요청해서 연결
+			handlePeerBlock(&msgBlock, p)
+		} else if msgBlock.Height >= b.Height { //다른 포트의 height가 이 포트의 height보다 크면
 			//다른 포트에게 모든 블록을 요청
 			fmt.Printf("\nrequest all blocks from %s\n", p.key)
 			requestAllBlocks(p)
@@ -99,27 +211,203 @@ func handleMsg(m *Message, p *peer) { //연결된 측에서 사용됨
 		}
 	case MessageAllBlocksRequest: //모든 블록을 다른 포트에게 요청
 		fmt.Printf("\n%s wants all blocks\n", p.key)
+		if blockchain.Pruned() { // 일부 block만 보내면 상대의 blockchain이 잘못 바뀜
+			break
+		}
 		sendAllBlocks(p)
 	case MessageAllBlocksResponse: //모든 블록을 다른 포트에게 받음
 		fmt.Printf("\nreceived all blocks from %s\n", p.key)
+		if !atomic.CompareAndSwapInt32(&p.allBlocks, 1, 0) {
+			fmt.Printf("\n%s sent blocks that were not requested\n", p.key)
+			break
+		}
 		var msgAllBlocks []*blockchain.Block //양이 많아서 포인터를 사용하나?
-		err := json.Unmarshal(m.Payload, &msgAllBlocks)
-		utils.HandleErr(err)
+		if err := p.wire.unmarshal(m.Payload, &msgAllBlocks); err != nil {
+			return err
+		}
+		for _, block := range msgAllBlocks {
+			if err := checkBlockPayload(block); err != nil {
+				return err
+			}
+		}
 		fmt.Println("\nmsgAllBlocks : ", msgAllBlocks)
-		blockchain.Blockchain().Replace(msgAllBlocks) // replace blockchain and blocks
-	case MessageNewBlockNotify:
+		if err := blockchain.Blockchain().VerifySnapshot(msgAllBlocks); err != nil { // snapshot과 다른 chain으로 바꾸지 않음
+			fmt.Printf("\n%s: %s\n", p.key, err)
+			break
+		}
+		if err := blockchain.Blockchain().Replace(msgAllBlocks); err != nil { // replace blockchain and blocks
+			fmt.Printf("\nnot replacing the chain with the blocks from %s: %s\n", p.key, err)
+		}
+	case MessageNewBlockNotify, MessageBlockResponse:
 		var msgNewBlock *blockchain.Block
-		utils.HandleErr(json.Unmarshal(m.Payload, &msgNewBlock))
-		blockchain.Blockchain().AddPeerBlock(msgNewBlock)
-	case MessageNewTxNotify:
+		if err := p.wire.unmarshal(m.Payload, &msgNewBlock); err != nil {
+			return err
+		}
+		if err := checkBlockPayload(msgNewBlock); err != nil {
+			return err
+		}
+		handlePeerBlock(msgNewBlock, p)
+	case MessageNewTxNotify, MessageTxResponse:
 		var msgNewTx *blockchain.Tx
-		utils.HandleErr(json.Unmarshal(m.Payload, &msgNewTx))
-		blockchain.Mempool().AddPeerTx(msgNewTx)
+		if err := p.wire.unmarshal(m.Payload, &msgNewTx); err != nil {
+			return err
+		}
+		if err := checkTxPayload(msgNewTx); err != nil {
+			return err
+		}
+		handlePeerTx(msgNewTx, p)
+	case MessageBlockRequest:
+		var msgHash string
+		if err := p.wire.unmarshal(m.Payload, &msgHash); err != nil {
+			return err
+		}
+		if block, err := blockchain.FindBlock(msgHash); err == nil {
+			sendBlock(block, p)
+		}
+	case MessageTxRequest:
+		var msgTxID string
+		if err := p.wire.unmarshal(m.Payload, &msgTxID); err != nil {
+			return err
+		}
+		//orphan tx의 부모는 아직 승인되지 않은 tx이므로 mempool에서만 찾음. 승인된 부모의 TxOut은 요청한 peer의 UTXO set에 있음
+		if tx := blockchain.FindMempoolTx(blockchain.Mempool(), msgTxID); tx != nil {
+			sendTx(tx, p)
+		}
+	case MessageCompactBlock:
+		var msgCompactBlock *blockchain.CompactBlock
+		if err := p.wire.unmarshal(m.Payload, &msgCompactBlock); err != nil {
+			return err
+		}
+		if msgCompactBlock == nil || msgCompactBlock.Header == nil {
+			return ErrInvalidPayload
+		}
+		for _, prefilled := range msgCompactBlock.Prefilled {
+			if err := checkTxPayload(prefilled.Tx); err != nil {
+				return err
+			}
+		}
+		handleCompactBlock(msgCompactBlock, p)
+	case MessageGetBlockTxn:
+		var msgGetBlockTxn getBlockTxnPayload
+		if err := p.wire.unmarshal(m.Payload, &msgGetBlockTxn); err != nil {
+			return err
+		}
+		handleGetBlockTxn(msgGetBlockTxn, p)
+	case MessageBlockTxn:
+		var msgBlockTxn blockTxnPayload
+		if err := p.wire.unmarshal(m.Payload, &msgBlockTxn); err != nil {
+			return err
+		}
+		for _, tx := range msgBlockTxn.Txs {
+			if err := checkTxPayload(tx); err != nil {
+				return err
+			}
+		}
+		handleBlockTxn(msgBlockTxn, p)
+	case MessageGetHeaders:
+		var msgHash string
+		if err := p.wire.unmarshal(m.Payload, &msgHash); err != nil {
+			return err
+		}
+		p.send(MessageHeaders, blockchain.HeadersAfter(blockchain.Blockchain(), msgHash, blockchain.MaxHeaders))
+	case MessageHeaders:
+		var msgHeaders []*blockchain.Header
+		if err := p.wire.unmarshal(m.Payload, &msgHeaders); err != nil {
+			return err
+		}
+		for _, header := range msgHeaders {
+			if header == nil {
+				return ErrInvalidPayload
+			}
+		}
+		handleHeaders(msgHeaders, p)
+	case MessageFilterLoad:
+		var msgFilter filterPayload
+		if err := p.wire.unmarshal(m.Payload, &msgFilter); err != nil {
+			return err
+		}
+		p.filter.load(msgFilter)
+	case MessageGetMerkleBlocks:
+		var msgHeight int
+		if err := p.wire.unmarshal(m.Payload, &msgHeight); err != nil {
+			return err
+		}
+		sendMerkleBlocks(msgHeight, p)
+	case MessageMerkleBlocks:
+		var msgMerkleBlocks []*blockchain.MerkleBlock
+		if err := p.wire.unmarshal(m.Payload, &msgMerkleBlocks); err != nil {
+			return err
+		}
+		for _, mb := range msgMerkleBlocks {
+			if mb == nil || mb.Header == nil {
+				return ErrInvalidPayload
+			}
+			for _, proven := range mb.Txs {
+				if proven == nil {
+					return ErrInvalidPayload
+				}
+				if err := checkTxPayload(proven.Tx); err != nil {
+					return err
+				}
+			}
+		}
+		handleMerkleBlocks(msgMerkleBlocks, p)
 	case MessageNewPeerNotify:
-		var msgNewPeer string // newPeer의 address이므로 string
-		utils.HandleErr(json.Unmarshal(m.Payload, &msgNewPeer))
-		fmt.Printf("now /ws upgrade %s", msgNewPeer)
-		parts := strings.Split(msgNewPeer, ":")      // address, port, openPort로 조각냄
-		AddPeer(parts[0], parts[1], parts[2], false) // broadcastNewPeer에서 이미 새로운 peer 확인을 햇으므로 false
+		var msgNewPeer newPeerPayload
+		if err := p.wire.unmarshal(m.Payload, &msgNewPeer); err != nil {
+			return err
+		}
+		fmt.Printf("now /ws upgrade %s", peerKey(msgNewPeer.Address, msgNewPeer.Port))
+		err := AddPeer(msgNewPeer.Address, msgNewPeer.Port, msgNewPeer.NodeID, msgNewPeer.OpenPort, false) // broadcastNewPeer에서 이미 새로운 peer 확인을 햇으므로 false
+		if err != nil {
+			fmt.Printf("\ncould not connect to %s: %s\n", peerKey(msgNewPeer.Address, msgNewPeer.Port), err)
+		}
+	case MessageGetAddr:
+		sendAddrs(p)
+	case MessageAddr:
+		var msgAddrs []addrPayload
+		if err := p.wire.unmarshal(m.Payload, &msgAddrs); err != nil {
+			return err
+		}
+		if len(msgAddrs) > maxAddrs { // 너무 많은 주소를 보내면 앞의 maxAddrs개만 사용
+			msgAddrs = msgAddrs[:maxAddrs]
+		}
+		for _, addr := range msgAddrs {
+			AddressBook().add(addr.Address, addr.Port, addr.NodeID)
+		}
+	}
+	return nil
+}
+
+var ErrInvalidPayload = errors.New("message payload is not valid")
+
+//peer가 보낸 block에 nil인 tx, TxIn, TxOut이 없는지 확인. 나머지는 blockchain이 검증하지만 nil은 검증하기 전에 panic을 일으킴.
+func checkBlockPayload(block *blockchain.Block) error {
+	if block == nil {
+		return ErrInvalidPayload
+	}
+	for _, tx := range block.Transactions {
+		if err := checkTxPayload(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//peer가 보낸 tx와 tx의 TxIn, TxOut이 nil이 아닌지 확인.
+func checkTxPayload(tx *blockchain.Tx) error {
+	if tx == nil {
+		return ErrInvalidPayload
+	}
+	for _, txIn := range tx.TxIns {
+		if txIn == nil {
+			return ErrInvalidPayload
+		}
+	}
+	for _, txOut := range tx.TxOuts {
+		if txOut == nil {
+			return ErrInvalidPayload
+		}
 	}
+	return nil
 }
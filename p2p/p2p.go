@@ -1,30 +1,54 @@
 package p2p
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 
 	"github.com/gorilla/websocket"
 	"github.com/yyuurriiaa/ProjectMSSP/blockchain"
-	"github.com/yyuurriiaa/ProjectMSSP/utils"
 )
 
 // var conns []*websocket.Conn
 var upgrader = websocket.Upgrader{} //initialize
 
-//openPort값을 가지는 port를 ws로 upgrade 하고 해당 port의 값을 가지는 peer를 새로 만들고 Peers에 추가. 그리고 peer의 inbox에 들어오는 값을 go routine으로 write, read.
+var ErrAlreadyConnected = errors.New("peer already connected")
+
+//openPort값을 가지는 port를 ws로 upgrade 하고 해당 port의 값을 가지는 peer를 새로 만들고 Peers에 추가. 그리고 peer의 queue에 들어오는 값을 go routine으로 write, read.
 func Upgrade(rw http.ResponseWriter, r *http.Request) {
 	//3000포트가 4000포트에서 온 request를 upgrade함
-	openPort := r.URL.Query().Get("openPort")           //query로 url에서 openPort 가져옴
-	ip := utils.Splitter(r.RemoteAddr, ":", 0)          //컴퓨터 주소의 ip 가져옴
+	openPort := r.URL.Query().Get("openPort")     //query로 url에서 openPort 가져옴
+	ip, _, err := net.SplitHostPort(r.RemoteAddr) //컴퓨터 주소의 ip 가져옴. ipv6 주소도 나눌 수 있도록 net.SplitHostPort 사용
+	if err != nil {
+		ip = ""
+	}
+	if blockchain.Light() { // light node는 다른 노드에게 block을 보낼 수 없으므로 연결을 받지 않음
+		http.Error(rw, ErrLightNode.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	nodeID, err := remoteNodeID(r.TLS) // TLS를 사용하면 상대의 인증서로 node ID 확인
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err := checkInbound(&Peers, ip); err != nil { // 연결해온 peer가 너무 많으면 받지 않음
+		http.Error(rw, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
 	upgrader.CheckOrigin = func(r *http.Request) bool { //openPort와 ip 값이 존재하면 CheckOrigin을 true로 함
 		return openPort != "" && ip != ""
 	}
-	conn, err := upgrader.Upgrade(rw, r, nil) //ws으로 업그레이드
+	wire, header := acceptWire(r)                // 요청한 측과 message 형식을 정함
+	services := acceptServices(r, header)        // 서로 제공하는 기능을 알려줌
+	conn, err := upgrader.Upgrade(rw, r, header) //ws으로 업그레이드
+	if err != nil {
+		return // Upgrade가 실패하면 upgrader가 이미 에러 response를 보냄
+	}
 	fmt.Printf("port %s upgrade!\n", openPort)
 
 	// conns = append(conns, conn)
-	utils.HandleErr(err)
 	// for {
 	// 	_, p, err := conn.ReadMessage()
 	// 	if err != nil {
@@ -38,53 +62,103 @@ func Upgrade(rw http.ResponseWriter, r *http.Request) {
 	// 	}
 
 	// }
-	initPeer(conn, ip, openPort)
+	initPeer(conn, ip, openPort, nodeID, wire, services, false)
+	if services.has(serviceFullNode) { // 연결해온 peer도 주소록에 기록. light node는 연결을 받지 않으므로 기록하지 않음
+		AddressBook().markGood(ip, openPort, nodeID)
+	}
 	fmt.Println("\nupgrade complete")
 
 }
 
-//port : 새로 연결하려는 포트, openPort : 기존에 연결된 포트. gorilla websocket으로 websocket.Conn 을 생성하고 해당 Conn을 가지는 peer를 만듬.
+//port : 새로 연결하려는 포트, nodeID : TLS를 사용할 때 상대에게 기대하는 node ID(모르면 빈 문자열), openPort : 기존에 연결된 포트. gorilla websocket으로 websocket.Conn 을 생성하고 해당 Conn을 가지는 peer를 만듬.
 //그 후 Peers에 만들어진 peer를 추가하고 만약 이 peer가 새로 연결된 peer(기존에 연결하고 끊었다가 다시 연결한게 아닌)일 경우 다른 Peers에게 새로운 peer를 전파함.
 //기존에 연결되었던 peer 라면 peer에 가장 최근의 block을 보내어 통신.
-func AddPeer(address string, port string, openPort string, broadcast bool) { // broadcast bool : 새로운 연결인지 확인하기 위함
+func AddPeer(address string, port string, nodeID string, openPort string, broadcast bool) error { // broadcast bool : 새로운 연결인지 확인하기 위함
 	//4000포트에서 3000포트로 upgrade를 request함
 	fmt.Printf("\nport %s -> port %s\n", openPort, port)
-	conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s:%s/ws?openPort=%s", address, port, openPort), nil) // dial의 URL을 call하면 새로운 connection을 만듬
-	utils.HandleErr(err)
+	AddressBook().add(address, port, nodeID)
+	p, err := dialPeer(address, port, openPort)
+	if err != nil {
+		return err
+	}
 	fmt.Println("\naddpeer start")
-	p := initPeer(conn, address, port)
+	if blockchain.Light() { // light node는 block을 주고받지 않고 header와 wallet tx만 받음
+		syncLight(p)
+		return nil
+	}
 	if broadcast {
 		broadcastNewPeer(p)
-		return //새 연결일 경우 sendNewestBlock 하지 않음
+		return nil //새 연결일 경우 sendNewestBlock 하지 않음
 	}
 	sendNewestBlock(p)
+	return nil
+}
 
+//TLS를 사용하면 주소록에 기록된 node ID와 상대의 인증서가 같아야 연결됨.
+//
+//address:port로 websocket 연결을 만들고 outbound peer를 생성. 연결 결과를 주소록에 기록하고 연결되면 peer에게 알고있는 주소들을 요청함.
+func dialPeer(address string, port string, openPort string) (*peer, error) {
+	if isConnected(&Peers, peerKey(address, port)) {
+		return nil, ErrAlreadyConnected
+	}
+	AddressBook().add(address, port, "")
+	AddressBook().markAttempt(address, port)
+	d, scheme := dialer(AddressBook().nodeID(address, port))
+	wsURL := url.URL{
+		Scheme:   scheme,
+		Host:     peerKey(address, port),
+		Path:     "/ws",
+		RawQuery: url.Values{"openPort": {openPort}, wireQuery: {preferredWire.String()}, servicesQuery: {localServices().String()}}.Encode(),
+	}
+	conn, resp, err := d.Dial(wsURL.String(), nil) // dial의 URL을 call하면 새로운 connection을 만듬
+	if err != nil {
+		return nil, err
+	}
+	nodeID, err := remoteNodeID(connectionState(conn))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	services := dialedServices(resp)
+	if blockchain.Light() && !services.has(serviceFullNode) { // light node는 full node에게서만 header와 merkle proof를 받을 수 있음
+		conn.Close()
+		return nil, ErrNotFullNode
+	}
+	AddressBook().markGood(address, port, nodeID)
+	p := initPeer(conn, address, port, nodeID, dialedWire(resp), services, true)
+	requestAddrs(p)
+	return p, nil
 }
 
-//peers에 있는 모든 peer의 inbox 채널에 newBlock을 대입.
+//peers에 있는 모든 peer의 queue에 newBlock을 대입. 느린 peer가 있어도 기다리지 않음.
 func BroadcastNewBlock(b *blockchain.Block) {
-	Peers.m.Lock()
-	defer Peers.m.Unlock()
-	for _, p := range Peers.v {
-		notifyNewBlock(b, p)
+	for _, p := range Peers.snapshot() {
+		relayNewBlock(b, p)
 	}
 }
 
-//연결된 모든 peer의 inbox 채널에 새로 검증한 tx를 대입.
+//연결된 모든 peer의 queue에 새로 검증한 tx를 대입. 느린 peer가 있어도 기다리지 않음.
+//light node는 tx를 검증할 수 없으므로 보내지 않음.
 func BroadcastNewTx(tx *blockchain.Tx) {
-	Peers.m.Lock()
-	defer Peers.m.Unlock()
-	for _, p := range Peers.v {
+	for _, p := range Peers.snapshot() {
+		if p.filter.loaded() {
+			continue
+		}
 		notifyNewTx(tx, p)
 	}
 }
 
-//newPeer를 제외한 다른 peer 들에게 newPeer의 key와 기존 peer의 port를 알려줌. openPort 를 알아야 하기 때문.
+//newPeer를 제외한 다른 peer 들에게 newPeer의 주소와 기존 peer의 port를 알려줌. openPort 를 알아야 하기 때문.
 func broadcastNewPeer(newPeer *peer) {
-	for key, p := range Peers.v {
-		if key != newPeer.key {
-			portInfo := fmt.Sprintf("%s:%s", newPeer.key, p.port) // newPeer의 주소와 기존의 openPort
-			notifyNewPeer(portInfo, p)                            // 다른 peer 들에게 새로운 peer의 주소를 알려줌
+	for _, p := range Peers.snapshot() {
+		if p.key != newPeer.key {
+			portInfo := newPeerPayload{ // newPeer의 주소와 기존의 openPort
+				Address:  newPeer.address,
+				Port:     newPeer.port,
+				NodeID:   newPeer.nodeID,
+				OpenPort: p.port,
+			}
+			notifyNewPeer(portInfo, p) // 다른 peer 들에게 새로운 peer의 주소를 알려줌
 		}
 	}
 }
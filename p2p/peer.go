@@ -3,10 +3,18 @@ package p2p
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+const (
+	blockInboxSize int           = 16               // block 관련 message를 담아두는 queue의 크기
+	inboxSize      int           = 256              // tx, 주소 등 나머지 message를 담아두는 queue의 크기
+	writeWait      time.Duration = 10 * time.Second // message 하나를 쓰는데 기다리는 최대 시간
+)
+
 type peers struct {
 	v map[string]*peer
 	m sync.Mutex
@@ -17,11 +25,37 @@ var Peers = peers{
 }
 
 type peer struct {
-	conn    *websocket.Conn
-	inbox   chan []byte
-	key     string // 연결 주소. address + port
-	address string
-	port    string
+	dropped     uint64 // inbox가 가득 차서 버려진 message의 수. 32bit에서도 atomic을 쓸 수 있도록 첫번째 필드에 둠
+	rateLimited uint64 // peer가 너무 빨리 보내서 처리하지 않고 버린 message의 수
+	allBlocks   int32  // 모든 block을 요청하고 아직 받지 않았으면 1. 요청하지 않은 block들로 chain을 바꾸지 않음
+	conn        *websocket.Conn
+	blockInbox  chan []byte // block message queue. inbox보다 먼저 보내짐
+	inbox       chan []byte // tx, 주소 등 나머지 message queue
+	quit        chan struct{}
+	closeOnce   sync.Once
+	key         string // 연결 주소. address + port
+	address     string
+	port        string
+	nodeID      string                       // TLS로 확인한 상대의 node ID. TLS를 사용하지 않으면 빈 문자열
+	wire        wireFormat                   // 연결할 때 정한 message 형식
+	services    serviceFlags                 // 상대 노드가 제공하는 기능
+	outbound    bool                         // 이 노드가 먼저 연결한 peer이면 true
+	pending     map[string]*pendingBlock     // tx를 기다리는 compact block. read goroutine에서만 사용
+	buckets     map[MessageKind]*tokenBucket // message 종류마다 받는 속도 제한. read goroutine에서만 사용
+	filter      txFilter                     // light node가 등록한 filter. 등록되어 있으면 block 대신 MerkleBlock을 보냄
+}
+
+//peer의 연결 상태. /peers/info 에서 보여줌
+type PeerInfo struct {
+	Key             string   `json:"key"`
+	NodeID          string   `json:"nodeId,omitempty"`
+	Outbound        bool     `json:"outbound"`
+	Wire            string   `json:"wire"`
+	Services        []string `json:"services"`
+	BlockQueue      int      `json:"blockQueue"`
+	Queue           int      `json:"queue"`
+	DroppedMessages uint64   `json:"droppedMessages"`
+	RateLimited     uint64   `json:"rateLimited"`
 }
 
 //peers의 key(localhost:4000같은) 값을 keys []string에 저장하고 keys 리턴. 즉 모든 peer의 address 를 []string 형태로 반환.
@@ -36,55 +70,176 @@ func AllPeers(p *peers) []string {
 	return keys
 }
 
-//peer의 연결을 끊을 때 websocket을 Close하고 Peers 에서 peer 삭제.
+//연결된 모든 peer의 연결 상태를 리턴.
+func AllPeerInfo(p *peers) []PeerInfo {
+	var infos []PeerInfo
+	for _, aPeer := range p.snapshot() {
+		infos = append(infos, PeerInfo{
+			Key:             aPeer.key,
+			NodeID:          aPeer.nodeID,
+			Outbound:        aPeer.outbound,
+			Wire:            aPeer.wire.String(),
+			Services:        aPeer.services.names(),
+			BlockQueue:      len(aPeer.blockInbox),
+			Queue:           len(aPeer.inbox),
+			DroppedMessages: atomic.LoadUint64(&aPeer.dropped),
+			RateLimited:     atomic.LoadUint64(&aPeer.rateLimited),
+		})
+	}
+	return infos
+}
+
+//현재 연결된 peer들을 복사해서 리턴. lock을 잡은 채로 peer에게 message를 보내지 않기 위해 사용.
+func (p *peers) snapshot() []*peer {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	var all []*peer
+	for _, aPeer := range p.v {
+		all = append(all, aPeer)
+	}
+	return all
+}
+
+//peer의 연결을 끊을 때 websocket을 Close하고 Peers 에서 peer 삭제. read, write, send 어디서 호출해도 한번만 실행됨.
 func (p *peer) close() {
-	Peers.m.Lock()
-	defer Peers.m.Unlock()
+	p.closeOnce.Do(func() {
+		close(p.quit) // write goroutine 종료
+		p.conn.Close()
 
-	p.conn.Close()
-	delete(Peers.v, p.key)
+		Peers.m.Lock()
+		defer Peers.m.Unlock()
+		if Peers.v[p.key] == p { // 같은 key로 다시 연결된 peer는 지우지 않음
+			delete(Peers.v, p.key)
+		}
+	})
+}
+
+//kind와 payload로 p의 형식에 맞는 message를 만들어서 kind에 맞는 queue에 넣음. 절대 기다리지 않음.
+//block queue가 가득 차면 block도 따라오지 못하는 peer이므로 연결을 끊고, 나머지 queue가 가득 차면 message를 버림.
+//peer가 읽을 수 없을 만큼 큰 message는 만들지 않고 log만 남김.
+func (p *peer) send(kind MessageKind, payload interface{}) {
+	m, err := p.wire.encode(kind, payload)
+	if err != nil {
+		fmt.Printf("\nnot sending message %d to %s: %s\n", kind, p.key, err)
+		return
+	}
+	if kind.isBlockMessage() {
+		select {
+		case p.blockInbox <- m:
+		case <-p.quit:
+		default:
+			fmt.Printf("\nblock queue of %s is full, disconnecting\n", p.key)
+			p.close()
+		}
+		return
+	}
+	select {
+	case p.inbox <- m:
+	case <-p.quit:
+	default:
+		atomic.AddUint64(&p.dropped, 1)
+	}
 }
 
-//p.conn에서 (json으로 된)message를 받으면 handleMsg 실행.
+//p.conn에서 (p의 형식으로 된)message를 받으면 handleMsg 실행. 너무 빨리 보낸 message는 처리하지 않고 버림.
+//형식이 맞지 않는 message나 payload를 보내면 연결을 끊음.
 func (p *peer) read() {
 	defer p.close()
+	p.conn.SetReadLimit(maxMessageSize) // 너무 큰 message를 보내는 peer와는 연결을 끊음
 	for {
-		m := Message{}
-		err := p.conn.ReadJSON(&m)
+		_, data, err := p.conn.ReadMessage()
 		if err != nil { // err가 nil 이면 m에 값이 들어왔다는 뜻. 즉, m에 값이 안들어왔으면(메세지를 못받았으면) break
 			break
 		}
-		handleMsg(&m, p) //값을 받으면 실행됨
+		m, err := p.wire.decode(data)
+		if err != nil { // 형식이 맞지 않는 message를 보내는 peer와는 연결을 끊음
+			break
+		}
+		if !p.allow(m.Kind) {
+			atomic.AddUint64(&p.rateLimited, 1)
+			continue
+		}
+		if err := handleMsg(m, p); err != nil { //값을 받으면 실행됨. 읽을 수 없는 payload를 보내는 peer와는 연결을 끊음
+			fmt.Printf("\n%s sent an invalid message %d: %s, disconnecting\n", p.key, m.Kind, err)
+			break
+		}
 	}
 }
 
-//p.inbox에 message를 받으면 p.conn에 message를 씀.
+//p.blockInbox, p.inbox에 message를 받으면 p.conn에 message를 씀. blockInbox에 message가 있으면 항상 먼저 보냄.
 func (p *peer) write() {
 	defer p.close()
 	for {
-		m, ok := <-p.inbox
-		if !ok {
-			break //값을 못받으면 break
+		var m []byte
+		select {
+		case m = <-p.blockInbox:
+		default:
+			select {
+			case m = <-p.blockInbox:
+			case m = <-p.inbox:
+			case <-p.quit:
+				return
+			}
+		}
+		p.conn.SetWriteDeadline(time.Now().Add(writeWait))  // 멈춰버린 peer 때문에 write goroutine이 계속 기다리지 않도록
+		err := p.conn.WriteMessage(p.wire.messageType(), m) //값을 받으면 실행됨
+		if err != nil {
+			return
 		}
-		p.conn.WriteMessage(websocket.TextMessage, m) //값을 받으면 실행됨
+	}
+}
+
+//새로운 peer 생성. Peers에 추가하거나 read, write를 시작하지는 않음.
+func newPeer(conn *websocket.Conn, address string, port string, nodeID string, wire wireFormat, services serviceFlags, outbound bool) *peer {
+	return &peer{
+		conn:       conn,
+		blockInbox: make(chan []byte, blockInboxSize),
+		inbox:      make(chan []byte, inboxSize),
+		quit:       make(chan struct{}),
+		key:        peerKey(address, port),
+		address:    address,
+		port:       port,
+		nodeID:     nodeID,
+		wire:       wire,
+		services:   services,
+		outbound:   outbound,
+		pending:    make(map[string]*pendingBlock),
+		buckets:    make(map[MessageKind]*tokenBucket),
 	}
 }
 
 //address 와 port를 받아서 key(localhost:4000같은)를 만들고 새로운 peer에 대입 후, Peers에 새로 만든 peer을 추가.
 // 그 후 go routine으로 새로 만들어진 peer에 들어오는 inbox값을 읽고 쓰기.
-func initPeer(conn *websocket.Conn, address string, port string) *peer { // 새로 peer 만들고 message read, write
+func initPeer(conn *websocket.Conn, address string, port string, nodeID string, wire wireFormat, services serviceFlags, outbound bool) *peer { // 새로 peer 만들고 message read, write
 	Peers.m.Lock()
 	defer Peers.m.Unlock()
-	key := fmt.Sprintf("%s:%s", address, port)
-	p := &peer{
-		conn:    conn,
-		inbox:   make(chan []byte),
-		key:     key,
-		address: address,
-		port:    port,
-	}
-	Peers.v[key] = p
+	p := newPeer(conn, address, port, nodeID, wire, services, outbound)
+	Peers.v[p.key] = p
 	go p.read() //go routine. 계속 실행되고있다고 봐야하나?
 	go p.write()
 	return p
 }
+
+//이 노드가 먼저 연결한(outbound) peer의 수를 리턴.
+func outboundCount(p *peers) int {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	count := 0
+	for _, aPeer := range p.v {
+		if aPeer.outbound {
+			count += 1
+		}
+	}
+	return count
+}
+
+//해당 key를 가지는 peer가 이미 연결되어 있는지 확인.
+func isConnected(p *peers, key string) bool {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	_, ok := p.v[key]
+	return ok
+}
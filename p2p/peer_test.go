@@ -0,0 +1,225 @@
+package p2p
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/yyuurriiaa/ProjectMSSP/blockchain"
+	"github.com/yyuurriiaa/ProjectMSSP/codec"
+)
+
+//테스트용 websocket 연결을 만듬. 리턴하는 conn은 이 노드 쪽, remote는 상대 peer 쪽 연결.
+func wsPair(t *testing.T) (conn *websocket.Conn, remote *websocket.Conn) {
+	remotes := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		c, err := (&websocket.Upgrader{}).Upgrade(rw, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		remotes <- c
+	}))
+	t.Cleanup(server.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote = <-remotes
+	t.Cleanup(func() {
+		conn.Close()
+		remote.Close()
+	})
+	return conn, remote
+}
+
+//write goroutine이 돌지 않는, 멈춰버린 peer를 Peers에 추가.
+func addStalledPeer(t *testing.T, port string) *peer {
+	conn, _ := wsPair(t)
+	p := newPeer(conn, "127.0.0.1", port, "", wireJSON, 0, true)
+	Peers.m.Lock()
+	Peers.v[p.key] = p
+	Peers.m.Unlock()
+	return p
+}
+
+//정상적으로 동작하는 peer를 Peers에 추가하고 상대 peer가 받은 message의 수를 세는 goroutine 실행.
+func addHealthyPeer(t *testing.T, port string) (*peer, *uint64) {
+	conn, remote := wsPair(t)
+	p := newPeer(conn, "127.0.0.1", port, "", wireJSON, 0, true)
+	Peers.m.Lock()
+	Peers.v[p.key] = p
+	Peers.m.Unlock()
+	go p.write()
+	var received uint64
+	go func() {
+		for {
+			if _, _, err := remote.ReadMessage(); err != nil {
+				return
+			}
+			atomic.AddUint64(&received, 1)
+		}
+	}()
+	return p, &received
+}
+
+//f가 timeout 안에 끝나지 않으면 실패.
+func finishesWithin(t *testing.T, timeout time.Duration, f func()) {
+	done := make(chan struct{})
+	go func() {
+		f()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatalf("Expected to finish within %s", timeout)
+	}
+}
+
+func TestBroadcastWithStalledPeer(t *testing.T) {
+	t.Cleanup(func() {
+		for _, p := range Peers.snapshot() {
+			p.close()
+		}
+	})
+
+	//1. 멈춘 peer가 있어도 block broadcast는 기다리지 않고, 멈춘 peer는 연결이 끊겨야함
+	t.Run("stalled peer is disconnected on block overflow", func(t *testing.T) {
+		stalled := addStalledPeer(t, "1001")
+		healthy, received := addHealthyPeer(t, "1002")
+		block := &blockchain.Block{Hash: "00ab", Height: 1}
+		blocks := blockInboxSize * 2
+		finishesWithin(t, 2*time.Second, func() {
+			for i := 0; i < blocks; i++ {
+				BroadcastNewBlock(block)
+				time.Sleep(5 * time.Millisecond) // 정상적인 peer가 queue를 비울 시간
+			}
+		})
+		if isConnected(&Peers, stalled.key) {
+			t.Error("Expected stalled peer to be disconnected")
+		}
+		if !isConnected(&Peers, healthy.key) {
+			t.Error("Expected healthy peer to stay connected")
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		for atomic.LoadUint64(received) < uint64(blocks) && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if got := atomic.LoadUint64(received); got != uint64(blocks) {
+			t.Errorf("Expected healthy peer to receive %d blocks. now got : %d", blocks, got)
+		}
+	})
+
+	//2. tx queue가 가득 차면 tx는 버려지고 연결은 유지되어야함
+	t.Run("stalled peer drops txs on overflow", func(t *testing.T) {
+		stalled := addStalledPeer(t, "1003")
+		tx := &blockchain.Tx{Id: "ab"}
+		txs := inboxSize + 10
+		finishesWithin(t, time.Second, func() {
+			for i := 0; i < txs; i++ {
+				BroadcastNewTx(tx)
+			}
+		})
+		if !isConnected(&Peers, stalled.key) {
+			t.Error("Expected stalled peer to stay connected")
+		}
+		if got := atomic.LoadUint64(&stalled.dropped); got != 10 {
+			t.Errorf("Expected 10 dropped txs. now got : %d", got)
+		}
+	})
+
+	//3. block message는 tx message보다 먼저 보내져야함
+	t.Run("blocks are sent before txs", func(t *testing.T) {
+		conn, remote := wsPair(t)
+		p := newPeer(conn, "127.0.0.1", "1004", "", wireJSON, 0, true)
+		notifyNewTx(&blockchain.Tx{Id: "ab"}, p)
+		notifyNewBlock(&blockchain.Block{Hash: "00ab"}, p)
+		go p.write()
+		defer p.close()
+		m := Message{}
+		if err := remote.ReadJSON(&m); err != nil {
+			t.Fatal(err)
+		}
+		if m.Kind != MessageNewBlockNotify {
+			t.Errorf("Expected first message kind : %d. now got : %d", MessageNewBlockNotify, m.Kind)
+		}
+	})
+}
+
+//읽을 수 없거나 nil인 payload를 보내는 peer는 panic 없이 연결이 끊겨야함
+func TestInvalidPayloadDisconnects(t *testing.T) {
+	binary, err := codec.Marshal(codec.Frame{Command: uint16(MessageNewBlockNotify), Payload: []byte{0xff, 0x01, 0x02}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonMessage := func(kind MessageKind, payload string) []byte {
+		data, err := json.Marshal(Message{Kind: kind, Payload: []byte(payload)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	tests := []struct {
+		name    string
+		wire    wireFormat
+		message []byte
+	}{
+		{"corrupt gob block", wireBinary, binary},
+		{"corrupt json block", wireJSON, jsonMessage(MessageBlockResponse, `{"height":`)},
+		{"null block", wireJSON, jsonMessage(MessageNewBlockNotify, "null")},
+		{"null tx in a block", wireJSON, jsonMessage(MessageBlockResponse, `{"transactions":[null]}`)},
+		{"null TxIn", wireJSON, jsonMessage(MessageNewTxNotify, `{"txIns":[null]}`)},
+		{"null compact block header", wireJSON, jsonMessage(MessageCompactBlock, `{"shortIds":[]}`)},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn, remote := wsPair(t)
+			p := newPeer(conn, "127.0.0.1", fmt.Sprint(2000+i), "", test.wire, 0, true)
+			Peers.m.Lock()
+			Peers.v[p.key] = p
+			Peers.m.Unlock()
+			go p.read()
+			if err := remote.WriteMessage(test.wire.messageType(), test.message); err != nil {
+				t.Fatal(err)
+			}
+			deadline := time.Now().Add(2 * time.Second)
+			for isConnected(&Peers, p.key) && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if isConnected(&Peers, p.key) {
+				t.Error("Expected the peer to be disconnected")
+			}
+		})
+	}
+}
+
+func TestOversizedMessageIsDropped(t *testing.T) {
+	payload := strings.Repeat("a", int(codec.MaxPayloadSize)) // 긴 chain의 모든 block처럼 frame 하나에 들어가지 않는 payload
+	for _, w := range []wireFormat{wireJSON, wireBinary} {
+		if _, err := w.encode(MessageAllBlocksResponse, payload); err != ErrMessageTooLarge {
+			t.Errorf("%s: Expected ErrMessageTooLarge, got %v", w, err)
+		}
+		if data, err := w.encode(MessageAllBlocksResponse, "small"); err != nil || len(data) == 0 {
+			t.Errorf("%s: Expected a small message to be encoded, got %v", w, err)
+		}
+	}
+
+	p := addStalledPeer(t, "4300")
+	t.Cleanup(p.close)
+	finishesWithin(t, 5*time.Second, func() { p.send(MessageAllBlocksResponse, payload) })
+	if len(p.blockInbox) != 0 {
+		t.Error("Expected the oversized message not to be queued")
+	}
+	select {
+	case <-p.quit:
+		t.Error("Expected the peer to stay connected")
+	default:
+	}
+}
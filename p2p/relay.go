@@ -0,0 +1,143 @@
+package p2p
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/yyuurriiaa/ProjectMSSP/blockchain"
+)
+
+const maxPendingBlocks int = 8 // peer 하나당 tx를 기다리는 compact block의 최대 수
+
+//compact block을 받았지만 mempool에 없는 tx가 있어서 peer에게 tx들을 요청하고 기다리는 block.
+type pendingBlock struct {
+	block   *blockchain.Block
+	missing []int // block.Transactions에서 비어있는 위치
+}
+
+//MessageGetBlockTxn의 payload. block 안에서 필요한 tx들의 위치를 보냄.
+type getBlockTxnPayload struct {
+	BlockHash string `json:"blockHash"`
+	Indexes   []int  `json:"indexes"`
+}
+
+//MessageBlockTxn의 payload. 요청받은 위치의 tx들을 같은 순서로 보냄.
+type blockTxnPayload struct {
+	BlockHash string           `json:"blockHash"`
+	Txs       []*blockchain.Tx `json:"txs"`
+}
+
+//compact block relay 통계. /peers/relay 에서 보여줌.
+type RelayStats struct {
+	CompactBlocks   uint64  `json:"compactBlocks"`   // 받은 compact block의 수
+	Reconstructed   uint64  `json:"reconstructed"`   // 추가 요청 없이 mempool만으로 다시 만든 block의 수
+	RoundTrips      uint64  `json:"roundTrips"`      // 없는 tx를 peer에게 요청한 block의 수
+	Fallbacks       uint64  `json:"fallbacks"`       // 다시 만들지 못해서 block 전체를 요청한 수
+	Txs             uint64  `json:"txs"`             // compact block으로 받은 tx의 수 (prefilled 제외)
+	MempoolHits     uint64  `json:"mempoolHits"`     // 그 중 mempool에서 찾은 tx의 수
+	MempoolHitRate  float64 `json:"mempoolHitRate"`  // MempoolHits / Txs
+	ReconstructRate float64 `json:"reconstructRate"` // Reconstructed / CompactBlocks
+}
+
+var relayStats RelayStats
+
+//현재까지의 compact block relay 통계를 리턴.
+func Relay() RelayStats {
+	s := RelayStats{
+		CompactBlocks: atomic.LoadUint64(&relayStats.CompactBlocks),
+		Reconstructed: atomic.LoadUint64(&relayStats.Reconstructed),
+		RoundTrips:    atomic.LoadUint64(&relayStats.RoundTrips),
+		Fallbacks:     atomic.LoadUint64(&relayStats.Fallbacks),
+		Txs:           atomic.LoadUint64(&relayStats.Txs),
+		MempoolHits:   atomic.LoadUint64(&relayStats.MempoolHits),
+	}
+	if s.Txs > 0 {
+		s.MempoolHitRate = float64(s.MempoolHits) / float64(s.Txs)
+	}
+	if s.CompactBlocks > 0 {
+		s.ReconstructRate = float64(s.Reconstructed) / float64(s.CompactBlocks)
+	}
+	return s
+}
+
+//p에게 새 block을 알림. light node에게는 MerkleBlock을, compact block을 받을 수 있는 peer에게는 compact block을, 아니면 block 전체를 보냄.
+func relayNewBlock(b *blockchain.Block, p *peer) {
+	if p.filter.loaded() {
+		p.send(MessageMerkleBlocks, []*blockchain.MerkleBlock{blockchain.NewMerkleBlock(b, p.filter.match)})
+		return
+	}
+	if p.services.has(serviceCompactBlocks) {
+		p.send(MessageCompactBlock, blockchain.NewCompactBlock(b))
+		return
+	}
+	notifyNewBlock(b, p)
+}
+
+//peer에게 받은 compact block을 mempool의 tx로 다시 만듬. 없는 tx가 있으면 p에게 요청하고 기다림.
+func handleCompactBlock(cb *blockchain.CompactBlock, p *peer) {
+	atomic.AddUint64(&relayStats.CompactBlocks, 1)
+	block, missing, err := blockchain.ReconstructBlock(cb)
+	if err != nil {
+		return
+	}
+	atomic.AddUint64(&relayStats.Txs, uint64(len(cb.ShortIDs)))
+	atomic.AddUint64(&relayStats.MempoolHits, uint64(len(cb.ShortIDs)-len(missing)))
+	if len(missing) == 0 {
+		atomic.AddUint64(&relayStats.Reconstructed, 1)
+		connectCompactBlock(block, p)
+		return
+	}
+	if _, ok := p.pending[block.Hash]; !ok && len(p.pending) >= maxPendingBlocks {
+		fallbackToBlock(block.Hash, p)
+		return
+	}
+	atomic.AddUint64(&relayStats.RoundTrips, 1)
+	p.pending[block.Hash] = &pendingBlock{block: block, missing: missing}
+	p.send(MessageGetBlockTxn, getBlockTxnPayload{BlockHash: block.Hash, Indexes: missing})
+}
+
+//p가 요청한 위치의 tx들을 보냄. 해당 block이 없거나 위치가 잘못되었으면 보내지 않음.
+func handleGetBlockTxn(req getBlockTxnPayload, p *peer) {
+	block, err := blockchain.FindBlock(req.BlockHash)
+	if err != nil {
+		return
+	}
+	var txs []*blockchain.Tx
+	for _, index := range req.Indexes {
+		if index < 0 || index >= len(block.Transactions) {
+			return
+		}
+		txs = append(txs, block.Transactions[index])
+	}
+	p.send(MessageBlockTxn, blockTxnPayload{BlockHash: req.BlockHash, Txs: txs})
+}
+
+//요청했던 tx들을 받으면 기다리던 block을 완성해서 연결.
+func handleBlockTxn(resp blockTxnPayload, p *peer) {
+	pending, ok := p.pending[resp.BlockHash]
+	if !ok {
+		return
+	}
+	delete(p.pending, resp.BlockHash)
+	if err := blockchain.FillBlock(pending.block, pending.missing, resp.Txs); err != nil {
+		fallbackToBlock(resp.BlockHash, p)
+		return
+	}
+	connectCompactBlock(pending.block, p)
+}
+
+//다시 만든 block의 tx들이 header의 merkle root와 맞으면 blockchain에 연결. 맞지 않으면 short id가 충돌한 것이므로 block 전체를 요청.
+func connectCompactBlock(block *blockchain.Block, p *peer) {
+	if !blockchain.CheckMerkleRoot(block) {
+		fallbackToBlock(block.Hash, p)
+		return
+	}
+	handlePeerBlock(block, p)
+}
+
+//compact block으로 다시 만들지 못한 block을 p에게 전체 요청.
+func fallbackToBlock(hash string, p *peer) {
+	atomic.AddUint64(&relayStats.Fallbacks, 1)
+	fmt.Printf("\ncould not reconstruct block %s, request full block from %s\n", hash, p.key)
+	requestBlock(hash, p)
+}
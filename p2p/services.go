@@ -0,0 +1,80 @@
+package p2p
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yyuurriiaa/ProjectMSSP/blockchain"
+)
+
+//노드가 제공하는 기능. 연결할 때 서로 알려주고, 상대가 제공하는 기능만 사용함.
+type serviceFlags uint64
+
+const (
+	serviceCompactBlocks serviceFlags = 1 << iota // compact block으로 새 block을 받을 수 있음
+	serviceFullNode                               // 모든 block을 가지고 있어서 light node에게 header와 merkle proof를 보낼 수 있음
+	servicePruned                                 // 오래된 block을 지웠으므로 모든 block을 보낼 수 없음
+)
+
+const (
+	servicesQuery  string = "services"        // 연결을 요청하는 측의 기능을 보내는 query
+	servicesHeader string = "X-Mssp-Services" // 연결을 받은 측의 기능을 알려주는 response header
+)
+
+//이 노드가 제공하는 기능.
+func localServices() serviceFlags {
+	if blockchain.Light() {
+		return 0
+	}
+	if blockchain.Pruned() {
+		return serviceCompactBlocks | servicePruned
+	}
+	return serviceCompactBlocks | serviceFullNode
+}
+
+func (s serviceFlags) has(flag serviceFlags) bool {
+	return s&flag == flag
+}
+
+func (s serviceFlags) String() string {
+	return strconv.FormatUint(uint64(s), 10)
+}
+
+//기능을 사람이 읽을 수 있는 이름들로 변환. /peers/info 에서 보여줌.
+func (s serviceFlags) names() []string {
+	var names []string
+	if s.has(serviceCompactBlocks) {
+		names = append(names, "compact")
+	}
+	if s.has(serviceFullNode) {
+		names = append(names, "full")
+	}
+	if s.has(servicePruned) {
+		names = append(names, "pruned")
+	}
+	return names
+}
+
+//query 또는 header로 받은 기능. 값이 없거나 잘못되었으면 아무 기능도 없는 것으로 봄.
+func parseServices(v string) serviceFlags {
+	s, err := strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return serviceFlags(s)
+}
+
+//연결을 받은 측에서 요청한 측의 기능을 읽고, response header에 이 노드의 기능을 담음.
+func acceptServices(r *http.Request, header http.Header) serviceFlags {
+	header.Set(servicesHeader, localServices().String())
+	return parseServices(r.URL.Query().Get(servicesQuery))
+}
+
+//연결을 요청한 측에서 상대가 response header로 알려준 기능을 읽음.
+func dialedServices(resp *http.Response) serviceFlags {
+	if resp == nil {
+		return 0
+	}
+	return parseServices(resp.Header.Get(servicesHeader))
+}
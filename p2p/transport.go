@@ -0,0 +1,248 @@
+package p2p
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/yyuurriiaa/ProjectMSSP/utils"
+)
+
+//peer끼리의 연결을 암호화하고 상대 node를 인증하기 위한 설정.
+//각 node는 고정된 node key를 가지고, 그 key로 만든 self-signed 인증서로 TLS 연결을 함. node ID는 public key의 hash.
+type transport struct {
+	secure    bool
+	nodeID    string
+	cert      tls.Certificate
+	allowlist map[string]bool // 비어있지 않으면 여기에 있는 node ID만 연결 가능
+}
+
+var tr = &transport{}
+
+var ErrNotAllowed = errors.New("node is not in the allowlist")
+var ErrNodeIDMismatch = errors.New("node id does not match")
+var ErrNoCertificate = errors.New("peer did not present a node certificate")
+
+const nodeKeyName string = "node_%s.key"
+
+//node key를 불러오거나 새로 만들고 TLS 연결을 사용하도록 설정. allowlistFile이 비어있지 않으면 그 파일의 node ID들만 연결할 수 있음.
+func EnableTLS(port string, allowlistFile string) error {
+	key, err := loadNodeKey(fmt.Sprintf(nodeKeyName, port))
+	if err != nil {
+		return err
+	}
+	cert, err := selfSignedCert(key)
+	if err != nil {
+		return err
+	}
+	tr.secure = true
+	tr.nodeID = nodeIDFromKey(&key.PublicKey)
+	tr.cert = cert
+	if allowlistFile != "" {
+		allowlist, err := readAllowlist(allowlistFile)
+		if err != nil {
+			return err
+		}
+		tr.allowlist = allowlist
+	}
+	fmt.Printf("node id: %s\n", tr.nodeID)
+	return nil
+}
+
+//이 node의 ID와 TLS 사용 여부를 리턴. TLS를 사용하지 않으면 node ID는 빈 문자열.
+func NodeID() (string, bool) {
+	return tr.nodeID, tr.secure
+}
+
+//REST 서버에서 사용할 TLS 설정. TLS를 사용하지 않으면 nil.
+//peer의 인증서는 요청만 하고 /ws에서 node ID로 확인하므로 일반 REST 클라이언트는 인증서 없이 접속할 수 있음.
+func ServerTLSConfig() *tls.Config {
+	if !tr.secure {
+		return nil
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{tr.cert},
+		ClientAuth:   tls.RequestClientCert,
+		MinVersion:   tls.VersionTLS13,
+	}
+}
+
+//peer에 연결할 때 사용할 websocket dialer와 scheme. expectedID가 있으면 상대의 node ID가 같아야 연결됨.
+func dialer(expectedID string) (*websocket.Dialer, string) {
+	if !tr.secure {
+		return websocket.DefaultDialer, "ws"
+	}
+	d := *websocket.DefaultDialer
+	d.TLSClientConfig = &tls.Config{
+		Certificates: []tls.Certificate{tr.cert},
+		MinVersion:   tls.VersionTLS13,
+		// node 인증서는 self-signed이므로 CA 검증 대신 node ID로 확인
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: verifyNodeCert(expectedID),
+	}
+	return &d, "wss"
+}
+
+//상대가 보낸 node 인증서의 node ID를 checkNodeID로 확인하는 tls.Config.VerifyPeerCertificate.
+func verifyNodeCert(expectedID string) func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return ErrNoCertificate
+		}
+		cert, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return err
+		}
+		return checkNodeID(cert, expectedID)
+	}
+}
+
+//같은 폴더에서 실행 중인 port의 node에 REST API로 요청할 http client와 scheme.
+//secure이면 node가 -tls로 실행 중이므로 https를 사용하고, node key 파일의 node ID를 가진 인증서만 믿음.
+func NodeClient(port string, secure bool) (*http.Client, string, error) {
+	if !secure {
+		return http.DefaultClient, "http", nil
+	}
+	keyBytes, err := os.ReadFile(fmt.Sprintf(nodeKeyName, port))
+	if err != nil {
+		return nil, "", err
+	}
+	key, err := x509.ParseECPrivateKey(keyBytes)
+	if err != nil {
+		return nil, "", err
+	}
+	config := &tls.Config{
+		MinVersion:            tls.VersionTLS13,
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: verifyNodeCert(nodeIDFromKey(&key.PublicKey)),
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config}}, "https", nil
+}
+
+//TLS 연결에서 상대가 보낸 인증서의 node ID를 확인하고 리턴. TLS를 사용하지 않으면 빈 문자열.
+func remoteNodeID(state *tls.ConnectionState) (string, error) {
+	if !tr.secure {
+		return "", nil
+	}
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return "", ErrNoCertificate
+	}
+	cert := state.PeerCertificates[0]
+	if err := checkNodeID(cert, ""); err != nil {
+		return "", err
+	}
+	return nodeIDFromCert(cert)
+}
+
+//websocket 연결의 TLS 상태. TLS 연결이 아니면 nil.
+func connectionState(conn *websocket.Conn) *tls.ConnectionState {
+	tlsConn, ok := conn.UnderlyingConn().(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	state := tlsConn.ConnectionState()
+	return &state
+}
+
+//인증서의 node ID가 expectedID(비어있으면 확인하지 않음)와 같고 allowlist에 있는지 확인.
+func checkNodeID(cert *x509.Certificate, expectedID string) error {
+	id, err := nodeIDFromCert(cert)
+	if err != nil {
+		return err
+	}
+	if expectedID != "" && id != expectedID {
+		return ErrNodeIDMismatch
+	}
+	if len(tr.allowlist) > 0 && !tr.allowlist[id] {
+		return ErrNotAllowed
+	}
+	return nil
+}
+
+//인증서의 public key로 node ID를 구함.
+func nodeIDFromCert(cert *x509.Certificate) (string, error) {
+	key, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return "", ErrNoCertificate
+	}
+	return nodeIDFromKey(key), nil
+}
+
+//public key를 PKIX 형식으로 바꾼 값의 sha256 hash가 node ID.
+func nodeIDFromKey(key *ecdsa.PublicKey) string {
+	keyBytes, err := x509.MarshalPKIXPublicKey(key)
+	utils.HandleErr(err)
+	return fmt.Sprintf("%x", sha256.Sum256(keyBytes))
+}
+
+//fileName의 node key를 불러옴. 없으면 새로 만들어서 0600 권한으로 저장.
+func loadNodeKey(fileName string) (*ecdsa.PrivateKey, error) {
+	keyBytes, err := os.ReadFile(fileName)
+	if err == nil {
+		return x509.ParseECPrivateKey(keyBytes)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	keyBytes, err = x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return key, os.WriteFile(fileName, keyBytes, 0600)
+}
+
+//node key로 서명한 self-signed 인증서 생성. 인증서의 CN은 node ID.
+func selfSignedCert(key *ecdsa.PrivateKey) (tls.Certificate, error) {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: nodeIDFromKey(&key.PublicKey)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}, nil
+}
+
+//한 줄에 node ID 하나씩 적힌 allowlist 파일을 읽음. 빈 줄과 #으로 시작하는 줄은 무시.
+func readAllowlist(fileName string) (map[string]bool, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	allowlist := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		allowlist[strings.ToLower(line)] = true
+	}
+	return allowlist, scanner.Err()
+}
@@ -0,0 +1,60 @@
+package p2p
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+//port의 node key로 만든 인증서를 사용하는 https 서버.
+func nodeServer(t *testing.T, port string) *httptest.Server {
+	t.Helper()
+	key, err := loadNodeKey(fmt.Sprintf(nodeKeyName, port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := selfSignedCert(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestNodeClient(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	if _, scheme, err := NodeClient("4600", false); err != nil || scheme != "http" {
+		t.Errorf("Expected http without TLS, got %s %v", scheme, err)
+	}
+	if _, _, err := NodeClient("4600", true); err == nil {
+		t.Error("Expected an error without the node key")
+	}
+
+	node := nodeServer(t, "4600")
+	client, scheme, err := NodeClient("4600", true)
+	if err != nil || scheme != "https" {
+		t.Fatalf("Expected https, got %s %v", scheme, err)
+	}
+	res, err := client.Get(node.URL)
+	if err != nil {
+		t.Fatalf("Expected the certificate of the node to be trusted, got %v", err)
+	}
+	res.Body.Close()
+	if _, err := client.Get(nodeServer(t, "4601").URL); err == nil {
+		t.Error("Expected the certificate of another node not to be trusted")
+	}
+}
@@ -0,0 +1,137 @@
+package p2p
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/yyuurriiaa/ProjectMSSP/codec"
+	"github.com/yyuurriiaa/ProjectMSSP/utils"
+)
+
+//peer와 message를 주고받는 형식. 연결할 때 정하고, 상대가 binary를 모르면 json을 사용함.
+//json : Message를 json으로 변환해서 text message로 보냄. 사람이 읽을 수 있어서 debugging할 때 사용.
+//binary : codec frame에 gob으로 변환한 payload를 담아서 binary message로 보냄.
+type wireFormat int
+
+const (
+	wireJSON wireFormat = iota
+	wireBinary
+)
+
+const (
+	wireQuery  string = "wire"        // 연결을 요청하는 측이 원하는 형식을 보내는 query
+	wireHeader string = "X-Mssp-Wire" // 연결을 받은 측이 정한 형식을 알려주는 response header
+)
+
+var preferredWire = wireBinary
+
+var ErrUnknownWire = errors.New("unknown wire format")
+var ErrMessageTooLarge = errors.New("message is larger than a peer can read")
+
+//"json" 또는 "binary"로 이 노드가 사용할 형식을 정함.
+func SetWire(name string) error {
+	w, err := parseWire(name)
+	if err != nil {
+		return err
+	}
+	preferredWire = w
+	return nil
+}
+
+func parseWire(name string) (wireFormat, error) {
+	switch name {
+	case "json":
+		return wireJSON, nil
+	case "binary":
+		return wireBinary, nil
+	}
+	return wireJSON, ErrUnknownWire
+}
+
+func (w wireFormat) String() string {
+	if w == wireBinary {
+		return "binary"
+	}
+	return "json"
+}
+
+//websocket message type. json은 text, binary는 binary message.
+func (w wireFormat) messageType() int {
+	if w == wireBinary {
+		return websocket.BinaryMessage
+	}
+	return websocket.TextMessage
+}
+
+//연결을 받은 측에서 요청한 형식과 이 노드의 형식을 비교해서 사용할 형식을 정하고 response header에 담음.
+func acceptWire(r *http.Request) (wireFormat, http.Header) {
+	w := wireJSON
+	if requested, err := parseWire(r.URL.Query().Get(wireQuery)); err == nil && requested == wireBinary && preferredWire == wireBinary {
+		w = wireBinary
+	}
+	return w, http.Header{wireHeader: {w.String()}}
+}
+
+//연결을 요청한 측에서 상대가 response header로 알려준 형식을 읽음. header가 없는 노드는 json만 사용.
+func dialedWire(resp *http.Response) wireFormat {
+	if resp == nil {
+		return wireJSON
+	}
+	w, err := parseWire(resp.Header.Get(wireHeader))
+	if err != nil {
+		return wireJSON
+	}
+	return w
+}
+
+//kind와 payload로 w 형식의 message를 만듬. payload가 codec.MaxPayloadSize보다 크면 상대가 읽지 못하므로 ErrMessageTooLarge.
+func (w wireFormat) encode(kind MessageKind, payload interface{}) ([]byte, error) {
+	if w == wireJSON {
+		data := makeMessage(kind, payload)
+		if len(data) > int(codec.MaxPayloadSize) {
+			return nil, ErrMessageTooLarge
+		}
+		return data, nil
+	}
+	var payloadBytes []byte
+	if payload != nil {
+		payloadBytes = utils.ToBytes(payload)
+	}
+	data, err := codec.Marshal(codec.Frame{Command: uint16(kind), Payload: payloadBytes})
+	if errors.Is(err, codec.ErrPayloadTooLarge) {
+		return nil, ErrMessageTooLarge
+	}
+	return data, err
+}
+
+//w 형식의 message를 Message로 변환.
+func (w wireFormat) decode(data []byte) (*Message, error) {
+	if w == wireJSON {
+		m := &Message{}
+		err := json.Unmarshal(data, m)
+		return m, err
+	}
+	frame, err := codec.Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{
+		Kind:    MessageKind(frame.Command),
+		Payload: frame.Payload,
+	}, nil
+}
+
+//w 형식의 payload를 v에 저장. 비어있는 payload는 무시.
+func (w wireFormat) unmarshal(payload []byte, v interface{}) error {
+	if w == wireJSON {
+		return json.Unmarshal(payload, v)
+	}
+	if len(payload) == 0 {
+		return nil
+	}
+	return gob.NewDecoder(bytes.NewReader(payload)).Decode(v) // 잘못된 payload로 panic이 나지 않도록 utils.FromBytes 대신 사용
+}
@@ -2,12 +2,20 @@ package rest
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/yyuurriiaa/ProjectMSSP/blockchain"
+	"github.com/yyuurriiaa/ProjectMSSP/db"
 	"github.com/yyuurriiaa/ProjectMSSP/p2p"
 	"github.com/yyuurriiaa/ProjectMSSP/utils"
 	"github.com/yyuurriiaa/ProjectMSSP/wallet"
@@ -16,9 +24,15 @@ import (
 type url string
 
 var port string
+var scheme = "http"  // TLS를 사용하면 https
+var backupDir string // /admin/backup의 path가 들어가는 폴더. 비어있으면 node에 backup 파일을 쓰지 않음
+
+var ErrNoBackupDir = errors.New("no backup directory is set, start the node with -backup-dir")
+var ErrBackupPath = errors.New("backup path must be a relative path inside the backup directory")
+var ErrNotLocal = errors.New("admin and wallet secret endpoints are only served to local clients")
 
 func (u url) MarshalText() ([]byte, error) { //TextMarshaler interface, https://cafemocamoca.tistory.com/288 참고 url을 []byte로 변환
-	url := fmt.Sprintf("http://localhost%s%s", port, u)
+	url := fmt.Sprintf("%s://localhost%s%s", scheme, port, u)
 	return []byte(url), nil
 }
 
@@ -39,17 +53,117 @@ type balanceResponse struct {
 }
 
 type addTxPayload struct {
-	To     string
-	Amount int
+	To       string
+	Amount   int
+	Outputs  []*blockchain.TxOut // 여러 사람에게 한 tx로 보냄. 있으면 To와 Amount는 비워둠
+	Strategy string              // 비어있으면 largest-first
+	FeeRate  int                 // tx 크기 1000 byte당 fee
+	Coins    []string            // "txID:index". 있으면 이 TxOut들만 사용함
+}
+
+//보낸 tx와 TxIns가 사용한 TxOut, fee.
+type txResponse struct {
+	*blockchain.Tx
+	Inputs []*blockchain.Coin `json:"inputs"` // TxIns와 같은 순서
+	Fee    int                `json:"fee"`
+}
+
+type unlockPayload struct {
+	Passphrase string
+	Timeout    int // 초. 0이면 wallet.DefaultUnlockTimeout
 }
 
-type myWalletResponse struct {
+type newAddressResponse struct {
 	Address string `json:"address"`
 }
 
+type createWalletPayload struct {
+	Name       string
+	Passphrase string
+	XPub       string // 있으면 이 account의 address를 지켜보는 watch-only wallet을 만듬
+	WatchOnly  bool   // xpub 없이 가져온 address만 지켜보는 watch-only wallet을 만듬
+}
+
+type createWalletResponse struct {
+	Mnemonic string        `json:"mnemonic,omitempty"` // 이때 한 번만 보여줌. watch-only wallet은 없음
+	Wallet   wallet.Status `json:"wallet"`
+}
+
+type walletBalanceResponse struct {
+	Name      string `json:"name"`
+	Balance   int    `json:"balance"`
+	WatchOnly int    `json:"watchOnly"` // 가져온 address의 잔액. Balance에 포함하지 않음
+}
+
+type xpubResponse struct {
+	XPub string `json:"xpub"`
+}
+
+type watchPayload struct {
+	Address string
+}
+
+type watchResponse struct {
+	Addresses []string           `json:"addresses"` // 가져온 address
+	Balance   int                `json:"balance"`
+	Coins     []*blockchain.Coin `json:"coins"`
+}
+
+const maxNotificationWait int = 60 // 초
+
+type notificationsResponse struct {
+	Last          int                        `json:"last"` // 다음 request의 after로 사용
+	Notifications []*blockchain.Notification `json:"notifications"`
+}
+
+const (
+	defaultHistoryLimit int = 50
+	maxHistoryLimit     int = 500
+)
+
+type historyResponse struct {
+	Total  int             `json:"total"` // 전체 tx의 수
+	Offset int             `json:"offset"`
+	Limit  int             `json:"limit"`
+	Txs    []*historyEntry `json:"txs"`
+}
+
+//history의 tx에 wallet에 저장된 label을 붙임.
+type historyEntry struct {
+	*blockchain.HistoryTx
+	Label              string            `json:"label,omitempty"`
+	CounterpartyLabels map[string]string `json:"counterpartyLabels,omitempty"`
+}
+
+type labelPayload struct {
+	Address string // address나 txID 중 하나
+	TxID    string
+	Label   string // 비어있으면 지움
+}
+
+type rawTxResponse struct {
+	TxID string `json:"txID"`
+}
+
+type rescanResponse struct {
+	Found  int           `json:"found"` // 새로 찾은 address의 수
+	Wallet wallet.Status `json:"wallet"`
+}
+
 type addPeerPayload struct {
 	Address string
 	Port    string
+	NodeID  string // TLS를 사용할 때 연결하려는 peer의 node ID. 비워두면 확인하지 않음
+}
+
+type nodeResponse struct {
+	NodeID string `json:"nodeId,omitempty"`
+	TLS    bool   `json:"tls"`
+}
+
+type backupResponse struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
 }
 
 // type URLDescriptionSlice struct {
@@ -61,7 +175,7 @@ type addPeerPayload struct {
 // 	return udl.URLSlice
 // }
 
-//////http구조//////////////
+// ////http구조//////////////
 //클라이언트  ------->>  서버 : HTTP Request
 //서버 ------->> 클라이언트 : HTTP Response
 func documentation(rw http.ResponseWriter, r *http.Request) { //documentation.
@@ -97,6 +211,186 @@ func documentation(rw http.ResponseWriter, r *http.Request) { //documentation.
 			Method:      "GET",
 			Description: "Get TxOuts for an Address",
 		},
+		{
+			URL:         url("/peers"),
+			Method:      "POST",
+			Description: "Connect to a peer",
+			Payload:     "address:string, port:string, nodeId:string(optional)",
+		},
+		{
+			URL:         url("/peers/book"),
+			Method:      "GET",
+			Description: "See the address book of known peers",
+		},
+		{
+			URL:         url("/peers/info"),
+			Method:      "GET",
+			Description: "See the send queues and dropped messages of connected peers",
+		},
+		{
+			URL:         url("/peers/relay"),
+			Method:      "GET",
+			Description: "See how many relayed blocks were rebuilt from the mempool",
+		},
+		{
+			URL:         url("/node"),
+			Method:      "GET",
+			Description: "See the node ID used to authenticate peers",
+		},
+		{
+			URL:         url("/admin/verify?depth={depth}&rerun={true}"),
+			Method:      "GET",
+			Description: "Verify the newest depth blocks (all blocks if omitted) in the background and see the result",
+		},
+		{
+			URL:         url("/wallet/unlock"),
+			Method:      "POST",
+			Description: "Unlock the wallet to sign transactions for timeout seconds (300 if omitted). Local clients only",
+			Payload:     "passphrase:string, timeout:int(optional)",
+		},
+		{
+			URL:         url("/wallet/lock"),
+			Method:      "POST",
+			Description: "Lock the wallet now",
+		},
+		{
+			URL:         url("/wallet/address"),
+			Method:      "POST",
+			Description: "Make a new receive address (HD wallet) and use it for mining rewards",
+		},
+		{
+			URL:         url("/wallet/rescan"),
+			Method:      "POST",
+			Description: "Scan the chain for used addresses of the HD wallet, e.g. after restoring it from its mnemonic",
+		},
+		{
+			URL:         url("/wallets"),
+			Method:      "GET",
+			Description: "See all wallets of the node and whether they are loaded",
+		},
+		{
+			URL:         url("/wallets"),
+			Method:      "POST",
+			Description: "Create and load a new named HD wallet. The response shows its mnemonic only this once. Local clients only",
+			Payload:     "name:string, passphrase:string",
+		},
+		{
+			URL:         url("/wallets"),
+			Method:      "POST",
+			Description: "Create and load a watch-only wallet without private keys, from the xpub of an HD wallet or empty to import addresses into. Local clients only",
+			Payload:     "name:string, xpub:string or watchOnly:true",
+		},
+		{
+			URL:         url("/wallets/{name}"),
+			Method:      "GET",
+			Description: "See a loaded wallet. The /wallet routes use the wallet named default",
+		},
+		{
+			URL:         url("/wallets/{name}/xpub"),
+			Method:      "GET",
+			Description: "See the extended public key of an HD wallet to watch it from another node. Local clients only",
+		},
+		{
+			URL:         url("/wallets/{name}/watch"),
+			Method:      "GET",
+			Description: "See the addresses imported into a wallet with their balance and unspent outputs",
+		},
+		{
+			URL:         url("/wallets/{name}/watch"),
+			Method:      "POST",
+			Description: "Import an address to watch. Its outputs are never spent by the wallet",
+			Payload:     "address:string",
+		},
+		{
+			URL:         url("/wallets/{name}/notifications?after={id}&wait={seconds}"),
+			Method:      "GET",
+			Description: "See payments to the watched addresses of a wallet after a notification id. Waits up to 60 seconds for a new one",
+		},
+		{
+			URL:         url("/wallets/{name}/load"),
+			Method:      "POST",
+			Description: "Load a wallet from its file in the wallets directory",
+		},
+		{
+			URL:         url("/wallets/{name}/unload"),
+			Method:      "POST",
+			Description: "Lock a wallet and unload it",
+		},
+		{
+			URL:         url("/wallets/{name}/unlock"),
+			Method:      "POST",
+			Description: "Unlock a wallet to sign transactions for timeout seconds (300 if omitted). Local clients only",
+			Payload:     "passphrase:string, timeout:int(optional)",
+		},
+		{
+			URL:         url("/wallets/{name}/lock"),
+			Method:      "POST",
+			Description: "Lock a wallet now",
+		},
+		{
+			URL:         url("/wallets/{name}/address"),
+			Method:      "GET",
+			Description: "See the receive address of a wallet. POST makes a new one",
+		},
+		{
+			URL:         url("/wallets/{name}/balance"),
+			Method:      "GET",
+			Description: "See the balance of all addresses of a wallet",
+		},
+		{
+			URL:         url("/wallets/{name}/transactions"),
+			Method:      "POST",
+			Description: "Send coins from a wallet and see the transaction with the outputs it spent and its fee. outputs pays many recipients with one change output. strategy is largest-first, smallest-first, branch-and-bound or random-improve. coins spends exactly the listed txID:index outputs",
+			Payload:     "to:string, amount:int or outputs:[]{address:string, amount:int}, strategy:string(optional), feeRate:int per 1000 bytes(optional), coins:[]string(optional)",
+		},
+		{
+			URL:         url("/wallets/{name}/transactions/unsigned"),
+			Method:      "POST",
+			Description: "Make an unsigned transaction without unlocking the wallet, to sign it offline with the sign command. /transactions/unsigned uses the default wallet",
+			Payload:     "to:string, amount:int or outputs:[]{address:string, amount:int}, strategy:string(optional), feeRate:int(optional), coins:[]string(optional)",
+		},
+		{
+			URL:         url("/transactions/raw"),
+			Method:      "POST",
+			Description: "Validate a transaction signed offline, add it to the mempool and send it to peers",
+			Payload:     "the file written by the sign command, or a signed transaction",
+		},
+		{
+			URL:         url("/wallets/{name}/coins"),
+			Method:      "GET",
+			Description: "See the unspent outputs a wallet can spend",
+		},
+		{
+			URL:         url("/wallets/{name}/history"),
+			Method:      "GET",
+			Description: "See the transactions a wallet sent or received with their fee, counterparties, confirmations and labels, newest first",
+		},
+		{
+			URL:         url("/wallets/{name}/history?offset={offset}&limit={limit}"),
+			Method:      "GET",
+			Description: "See a page of the wallet history. limit is 50 if omitted and at most 500",
+		},
+		{
+			URL:         url("/wallets/{name}/history?watchOnly=true"),
+			Method:      "GET",
+			Description: "See the history of the addresses imported into a wallet",
+		},
+		{
+			URL:         url("/wallets/{name}/labels"),
+			Method:      "GET",
+			Description: "See the labels of addresses and notes of transactions saved with a wallet",
+		},
+		{
+			URL:         url("/wallets/{name}/labels"),
+			Method:      "POST",
+			Description: "Label an address or add a note to a transaction. An empty label removes it",
+			Payload:     "address:string or txID:string, label:string",
+		},
+		{
+			URL:         url("/admin/backup?path={path}&wallet={true}"),
+			Method:      "POST",
+			Description: "Back up the db (and the wallet file) without stopping the node. Streams a tar archive unless path is given. path is a file name inside the -backup-dir of the node. Local clients only",
+		},
 		{
 			URL:         url("/ws"),
 			Method:      "GET",
@@ -135,6 +429,20 @@ func jsonContentTypeMiddleware(next http.Handler) http.Handler { //handler : HTT
 	})
 }
 
+//loopback 주소에서 온 request만 handler로 보냄. backup과 검증은 wallet 파일을 보내거나 node에 파일을 쓰므로 다른 host에는 보여주지 않음.
+//passphrase를 받거나 mnemonic, xpub을 보여주는 wallet route도 암호화되지 않은 연결이나 다른 host로 secret이 나가지 않도록 같이 막음.
+func localOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+			rw.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(rw).Encode(errorResponse{ErrNotLocal.Error()})
+			return
+		}
+		handler(rw, r)
+	}
+}
+
 //url print 하는 middleware
 func loggerMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
@@ -177,24 +485,41 @@ func block(rw http.ResponseWriter, r *http.Request) { //gorilla mux 사용.
 	hash := vars["hash"]
 
 	block, err := blockchain.FindBlock(hash)
-	if err == blockchain.ErrNotFound {
+	if err == blockchain.ErrBlockPruned { // pruned node는 header만 남긴 block을 보여줄 수 없음
+		rw.WriteHeader(http.StatusGone)
+		utils.HandleErr(json.NewEncoder(rw).Encode(errorResponse{err.Error()}))
+	} else if err == blockchain.ErrNotFound {
 		utils.HandleErr(json.NewEncoder(rw).Encode(errorResponse{err.Error()})) // type error -> type string으로 바꿔서 Encode에 넣고 json으로 변환
 	} else {
 		utils.HandleErr(json.NewEncoder(rw).Encode(block))
 	}
 }
 
-//blockchain을 보여줌.
+//blockchain을 보여줌. light node는 header chain을 보여줌.
 func status(rw http.ResponseWriter, r *http.Request) {
 	// utils.HandleErr(json.NewEncoder(rw).Encode(blockchain.Blockchain())) // blockchain을 encoding
+	if blockchain.Light() {
+		blockchain.HeaderStatus(blockchain.Headers(), rw)
+		return
+	}
 	blockchain.Status(blockchain.Blockchain(), rw) // mutex
 }
 
 //해당 address의 amount를 모두 더한 값을 출력. true가 있으면 총 amount를 보여주고 아니면 해당 address의 uTxOuts를 모두 보여줌.
+//light node는 merkle proof로 확인한 wallet tx로 계산함.
 func balance(rw http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	address := vars["address"]
 	total := r.URL.Query().Get("total")
+	if err := wallet.ValidateAddress(address); err != nil && !errors.Is(err, wallet.ErrLegacyAddress) { // 이전 address의 잔액은 볼 수 있음
+		rw.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(rw).Encode(errorResponse{err.Error()})
+		return
+	}
+	if blockchain.Light() {
+		lightBalance(rw, address, total == "true")
+		return
+	}
 	switch total {
 	case "true":
 		amount := blockchain.BalanceByAddress(address, blockchain.Blockchain())
@@ -206,30 +531,483 @@ func balance(rw http.ResponseWriter, r *http.Request) {
 
 }
 
+//light node에서 address의 amount 또는 uTxOuts를 보여줌.
+func lightBalance(rw http.ResponseWriter, address string, total bool) {
+	if total {
+		utils.HandleErr(json.NewEncoder(rw).Encode(balanceResponse{address, blockchain.LightBalance(address)}))
+		return
+	}
+	utils.HandleErr(json.NewEncoder(rw).Encode(blockchain.LightUTxOuts(address)))
+}
+
 //mempool의 Txs들을 보여줌.
 func mempool(rw http.ResponseWriter, r *http.Request) {
 	// utils.HandleErr(json.NewEncoder(rw).Encode(blockchain.Mempool().Txs)) //mempool의 txs를 json으로 인코딩해서 rw에 저장
 	blockchain.MempoolMutex(blockchain.Mempool(), rw) // Mutex
 }
 
-//payload에 api의 body 내용을 저장. mempool에 저장된 tx를 가져오고 가져온 tx를 다른 peer들에게 전파함.
+//payload에 api의 body 내용을 저장. wallet으로 tx를 만들어서 mempool에 저장하고 다른 peer들에게 전파한 후 tx를 보여줌.
 func transactions(rw http.ResponseWriter, r *http.Request) {
 	var payload addTxPayload
-	utils.HandleErr(json.NewDecoder(r.Body).Decode(&payload)) //body내용을 payload에 저장
-	tx, err := blockchain.Mempool().AddTx(payload.To, payload.Amount)
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil { //body내용을 payload에 저장
+		writeBadRequest(rw, err)
+		return
+	}
+	outputs, err := txOutputs(payload)
 	if err != nil {
-		rw.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(rw).Encode(errorResponse{err.Error()})
+		writeBadRequest(rw, err)
+		return
+	}
+	options := blockchain.SendOptions{Strategy: payload.Strategy, FeeRate: payload.FeeRate, Coins: payload.Coins}
+	tx, selection, err := blockchain.Mempool().AddTx(walletName(r), outputs, options)
+	if err != nil {
+		writeWalletError(rw, err)
 		return //에러가 났을경우 바로 함수 종료
 	}
 	p2p.BroadcastNewTx(tx)
 	rw.WriteHeader(http.StatusCreated)
+	utils.HandleErr(json.NewEncoder(rw).Encode(txResponse{Tx: tx, Inputs: selection.Coins, Fee: selection.Fee}))
 }
 
-//wallet의 address를 보여줌.
+//payload의 받는 사람들. To와 Amount로 한 사람에게 보내거나 Outputs로 여러 사람에게 보냄.
+func txOutputs(payload addTxPayload) ([]*blockchain.TxOut, error) {
+	if len(payload.Outputs) > 0 {
+		if payload.To != "" || payload.Amount != 0 {
+			return nil, errors.New("give either to and amount or outputs")
+		}
+		return payload.Outputs, nil
+	}
+	return []*blockchain.TxOut{{Address: payload.To, Amount: payload.Amount}}, nil
+}
+
+//wallet을 풀지 않고 서명하지 않은 tx를 만들어서 보여줌. offline wallet으로 서명한 후 /transactions/raw로 보냄.
+func unsignedTransactions(rw http.ResponseWriter, r *http.Request) {
+	var payload addTxPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeBadRequest(rw, err)
+		return
+	}
+	outputs, err := txOutputs(payload)
+	if err != nil {
+		writeBadRequest(rw, err)
+		return
+	}
+	options := blockchain.SendOptions{Strategy: payload.Strategy, FeeRate: payload.FeeRate, Coins: payload.Coins}
+	u, err := blockchain.MakeUnsignedTx(walletName(r), outputs, options)
+	if err != nil {
+		writeWalletError(rw, err)
+		return
+	}
+	utils.HandleErr(json.NewEncoder(rw).Encode(u))
+}
+
+//밖에서 서명한 tx를 검증해서 mempool에 넣고 peer에게 보냄. sign command가 만든 파일이나 tx를 그대로 받음.
+func rawTransaction(rw http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		blockchain.Tx
+		Version int            `json:"version"` // sign command가 만든 파일이면 Tx에 tx가 있음
+		Signed  *blockchain.Tx `json:"tx"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeBadRequest(rw, err)
+		return
+	}
+	tx := &payload.Tx
+	if payload.Signed != nil {
+		tx = payload.Signed
+	}
+	if err := blockchain.Mempool().AddRawTx(tx); err != nil {
+		writeBadRequest(rw, err)
+		return
+	}
+	p2p.BroadcastNewTx(tx)
+	rw.WriteHeader(http.StatusCreated)
+	utils.HandleErr(json.NewEncoder(rw).Encode(rawTxResponse{tx.Id}))
+}
+
+// /wallets/{name} route의 wallet 이름. /wallet route와 /transactions는 기본 wallet을 사용함.
+func walletName(r *http.Request) string {
+	if name, ok := mux.Vars(r)["name"]; ok {
+		return name
+	}
+	return wallet.DefaultName
+}
+
+//wallet 에러를 알맞은 status code와 함께 보냄. 없거나 불러오지 않은 wallet은 404.
+func writeWalletError(rw http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, wallet.ErrWalletNotFound), errors.Is(err, wallet.ErrWalletNotLoaded):
+		rw.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, wallet.ErrWalletExists):
+		rw.WriteHeader(http.StatusConflict)
+	default:
+		rw.WriteHeader(http.StatusBadRequest)
+	}
+	json.NewEncoder(rw).Encode(errorResponse{err.Error()})
+}
+
+//GET : node의 모든 wallet과 불러왔는지 여부를 보여줌.
+//POST : 새 HD wallet을 만들어서 불러오고 mnemonic을 한 번만 보여줌.
+func wallets(rw http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		infos, err := wallet.Wallets().List()
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(rw).Encode(errorResponse{err.Error()})
+			return
+		}
+		utils.HandleErr(json.NewEncoder(rw).Encode(infos))
+	case "POST":
+		var payload createWalletPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		if payload.XPub != "" || payload.WatchOnly {
+			w, err := wallet.Wallets().CreateWatchOnly(payload.Name, payload.XPub)
+			if err != nil {
+				writeWalletError(rw, err)
+				return
+			}
+			blockchain.RefreshWatched()
+			p2p.ReloadFilters()
+			rw.WriteHeader(http.StatusCreated)
+			utils.HandleErr(json.NewEncoder(rw).Encode(createWalletResponse{Wallet: w.Status()}))
+			return
+		}
+		mnemonic, w, err := wallet.Wallets().Create(payload.Name, payload.Passphrase)
+		if err != nil {
+			writeWalletError(rw, err)
+			return
+		}
+		p2p.ReloadFilters()
+		rw.WriteHeader(http.StatusCreated)
+		utils.HandleErr(json.NewEncoder(rw).Encode(createWalletResponse{Mnemonic: mnemonic, Wallet: w.Status()}))
+	}
+}
+
+//wallets 폴더의 wallet 파일을 불러옴.
+func loadWallet(rw http.ResponseWriter, r *http.Request) {
+	w, err := wallet.Wallets().Load(walletName(r))
+	if err != nil {
+		writeWalletError(rw, err)
+		return
+	}
+	blockchain.RefreshWatched()
+	p2p.ReloadFilters()
+	utils.HandleErr(json.NewEncoder(rw).Encode(w.Status()))
+}
+
+//wallet을 잠그고 목록에서 뺌.
+func unloadWallet(rw http.ResponseWriter, r *http.Request) {
+	if err := wallet.Wallets().Unload(walletName(r)); err != nil {
+		writeWalletError(rw, err)
+		return
+	}
+	blockchain.RefreshWatched()
+	p2p.ReloadFilters()
+	rw.WriteHeader(http.StatusOK)
+}
+
+//wallet의 address와 잠금 상태를 보여줌.
 func myWallet(rw http.ResponseWriter, r *http.Request) {
-	address := wallet.Wallet().Address
-	utils.HandleErr(json.NewEncoder(rw).Encode(myWalletResponse{Address: address}))
+	w, err := wallet.Wallets().Get(walletName(r))
+	if err != nil {
+		writeWalletError(rw, err)
+		return
+	}
+	utils.HandleErr(json.NewEncoder(rw).Encode(w.Status()))
+}
+
+//wallet의 모든 address의 잔액과 가져온 address의 잔액. light node는 merkle proof로 확인한 wallet tx로 계산함.
+func walletBalance(rw http.ResponseWriter, r *http.Request) {
+	w, err := wallet.Wallets().Get(walletName(r))
+	if err != nil {
+		writeWalletError(rw, err)
+		return
+	}
+	total := 0
+	for _, address := range w.Addresses() {
+		if blockchain.Light() {
+			total += blockchain.LightBalance(address)
+		} else {
+			total += blockchain.BalanceByAddress(address, blockchain.Blockchain())
+		}
+	}
+	watchOnly := 0
+	for _, coin := range blockchain.WatchedCoins(w.Status().Watched) {
+		watchOnly += coin.Amount
+	}
+	utils.HandleErr(json.NewEncoder(rw).Encode(walletBalanceResponse{Name: w.Name, Balance: total, WatchOnly: watchOnly}))
+}
+
+//HD wallet의 account public key. 다른 node에서 watch-only wallet을 만들 때 사용함.
+func walletXPub(rw http.ResponseWriter, r *http.Request) {
+	w, err := wallet.Wallets().Get(walletName(r))
+	if err != nil {
+		writeWalletError(rw, err)
+		return
+	}
+	xpub, err := w.XPub()
+	if err != nil {
+		writeWalletError(rw, err)
+		return
+	}
+	utils.HandleErr(json.NewEncoder(rw).Encode(xpubResponse{xpub}))
+}
+
+//GET : wallet에 가져온 address와 그 잔액, 사용되지 않은 TxOut을 보여줌.
+//POST : address를 가져와서 지켜봄. private key가 없으므로 잔액과 history만 볼 수 있음.
+func walletWatch(rw http.ResponseWriter, r *http.Request) {
+	w, err := wallet.Wallets().Get(walletName(r))
+	if err != nil {
+		writeWalletError(rw, err)
+		return
+	}
+	if r.Method == "POST" {
+		var payload watchPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeBadRequest(rw, err)
+			return
+		}
+		if err := w.ImportAddress(payload.Address); err != nil {
+			writeWalletError(rw, err)
+			return
+		}
+		blockchain.RefreshWatched()
+		p2p.ReloadFilters()
+	}
+	response := watchResponse{Addresses: w.Status().Watched, Coins: blockchain.WatchedCoins(w.Status().Watched)}
+	if response.Addresses == nil {
+		response.Addresses = []string{}
+	}
+	if response.Coins == nil {
+		response.Coins = []*blockchain.Coin{}
+	}
+	for _, coin := range response.Coins {
+		response.Balance += coin.Amount
+	}
+	utils.HandleErr(json.NewEncoder(rw).Encode(response))
+}
+
+//wallet이 지켜보는 address로 after 다음에 온 알림들. 없으면 wait초 동안 기다림.
+func walletNotifications(rw http.ResponseWriter, r *http.Request) {
+	w, err := wallet.Wallets().Get(walletName(r))
+	if err != nil {
+		writeWalletError(rw, err)
+		return
+	}
+	after, err := queryInt(r, "after", 0)
+	if err != nil {
+		writeBadRequest(rw, err)
+		return
+	}
+	wait, err := queryInt(r, "wait", 0)
+	if err != nil {
+		writeBadRequest(rw, err)
+		return
+	}
+	if wait > maxNotificationWait {
+		wait = maxNotificationWait
+	}
+	notifications, last := blockchain.Notifications(w.Watched(), after, time.Duration(wait)*time.Second)
+	utils.HandleErr(json.NewEncoder(rw).Encode(notificationsResponse{Last: last, Notifications: notifications}))
+}
+
+//wallet이 사용할 수 있는 TxOut들. coin control로 보낼 때 사용할 TxOut을 고를 수 있음.
+func walletCoins(rw http.ResponseWriter, r *http.Request) {
+	w, err := wallet.Wallets().Get(walletName(r))
+	if err != nil {
+		writeWalletError(rw, err)
+		return
+	}
+	coins := blockchain.WalletCoins(w.Addresses())
+	if coins == nil {
+		coins = []*blockchain.Coin{}
+	}
+	utils.HandleErr(json.NewEncoder(rw).Encode(coins))
+}
+
+//wallet이 보내거나 받은 tx들을 최근 tx부터 offset부터 limit개 보여줌. tx와 상대 address의 label을 붙임.
+func walletHistory(rw http.ResponseWriter, r *http.Request) {
+	w, err := wallet.Wallets().Get(walletName(r))
+	if err != nil {
+		writeWalletError(rw, err)
+		return
+	}
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil {
+		writeBadRequest(rw, err)
+		return
+	}
+	limit, err := queryInt(r, "limit", defaultHistoryLimit)
+	if err != nil {
+		writeBadRequest(rw, err)
+		return
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+	labels, err := w.Labels()
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(rw).Encode(errorResponse{err.Error()})
+		return
+	}
+
+	var history []*blockchain.HistoryTx
+	if r.URL.Query().Get("watchOnly") == "true" {
+		history = blockchain.WatchedHistory(w.Status().Watched)
+	} else {
+		history = blockchain.History(w.Addresses())
+	}
+	response := historyResponse{Total: len(history), Offset: offset, Limit: limit, Txs: []*historyEntry{}}
+	if offset < len(history) {
+		history = history[offset:]
+		if len(history) > limit {
+			history = history[:limit]
+		}
+		for _, tx := range history {
+			entry := &historyEntry{HistoryTx: tx, Label: labels.Txs[tx.TxID]}
+			for _, address := range tx.Counterparties {
+				if label, ok := labels.Addresses[address]; ok {
+					if entry.CounterpartyLabels == nil {
+						entry.CounterpartyLabels = map[string]string{}
+					}
+					entry.CounterpartyLabels[address] = label
+				}
+			}
+			response.Txs = append(response.Txs, entry)
+		}
+	}
+	utils.HandleErr(json.NewEncoder(rw).Encode(response))
+}
+
+//GET : wallet에 저장된 address의 label과 tx의 메모를 보여줌.
+//POST : address나 tx 하나에 label을 붙이거나 label이 비어있으면 지움.
+func walletLabels(rw http.ResponseWriter, r *http.Request) {
+	w, err := wallet.Wallets().Get(walletName(r))
+	if err != nil {
+		writeWalletError(rw, err)
+		return
+	}
+	if r.Method == "POST" {
+		var payload labelPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeBadRequest(rw, err)
+			return
+		}
+		switch {
+		case payload.Address != "" && payload.TxID == "":
+			err = w.SetAddressLabel(payload.Address, payload.Label)
+		case payload.TxID != "" && payload.Address == "":
+			err = w.SetTxLabel(payload.TxID, payload.Label)
+		default:
+			err = errors.New("give either an address or a txID")
+		}
+		if err != nil {
+			writeWalletError(rw, err)
+			return
+		}
+	}
+	labels, err := w.Labels()
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(rw).Encode(errorResponse{err.Error()})
+		return
+	}
+	utils.HandleErr(json.NewEncoder(rw).Encode(labels))
+}
+
+//query의 key를 0 이상의 정수로 읽음. 없으면 def.
+func queryInt(r *http.Request, key string, def int) (int, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a number of at least 0", key)
+	}
+	return n, nil
+}
+
+//잘못된 request의 에러를 400과 함께 보냄.
+func writeBadRequest(rw http.ResponseWriter, err error) {
+	rw.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(rw).Encode(errorResponse{err.Error()})
+}
+
+//passphrase로 wallet을 풀어서 timeout 동안 tx에 서명할 수 있게 함.
+func unlockWallet(rw http.ResponseWriter, r *http.Request) {
+	var payload unlockPayload
+	json.NewDecoder(r.Body).Decode(&payload)
+	w, err := wallet.Wallets().Get(walletName(r))
+	if err != nil {
+		writeWalletError(rw, err)
+		return
+	}
+	if err := w.Unlock(payload.Passphrase, time.Duration(payload.Timeout)*time.Second); errors.Is(err, wallet.ErrWatchOnly) {
+		writeWalletError(rw, err)
+		return
+	} else if err != nil {
+		rw.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(rw).Encode(errorResponse{err.Error()})
+		return
+	}
+	utils.HandleErr(json.NewEncoder(rw).Encode(w.Status()))
+}
+
+//wallet을 바로 잠금.
+func lockWallet(rw http.ResponseWriter, r *http.Request) {
+	w, err := wallet.Wallets().Get(walletName(r))
+	if err != nil {
+		writeWalletError(rw, err)
+		return
+	}
+	w.Lock()
+	utils.HandleErr(json.NewEncoder(rw).Encode(w.Status()))
+}
+
+//GET : wallet의 receive address를 보여줌.
+//POST : HD wallet의 새 receive address를 만듬. key 하나인 wallet은 항상 같은 address.
+func walletAddress(rw http.ResponseWriter, r *http.Request) {
+	w, err := wallet.Wallets().Get(walletName(r))
+	if err != nil {
+		writeWalletError(rw, err)
+		return
+	}
+	if r.Method == "GET" {
+		utils.HandleErr(json.NewEncoder(rw).Encode(newAddressResponse{w.Status().Address}))
+		return
+	}
+	address, err := w.NewAddress()
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(rw).Encode(errorResponse{err.Error()})
+		return
+	}
+	p2p.ReloadFilters()
+	rw.WriteHeader(http.StatusCreated)
+	utils.HandleErr(json.NewEncoder(rw).Encode(newAddressResponse{address}))
+}
+
+//chain에서 HD wallet이 사용한 address를 찾아서 wallet에 추가함.
+func rescanWallet(rw http.ResponseWriter, r *http.Request) {
+	w, err := wallet.Wallets().Get(walletName(r))
+	if err != nil {
+		writeWalletError(rw, err)
+		return
+	}
+	used := blockchain.UsedAddresses()
+	found, err := w.Discover(func(address string) bool { return used[address] })
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(rw).Encode(errorResponse{err.Error()})
+		return
+	}
+	if found > 0 {
+		p2p.ReloadFilters()
+	}
+	utils.HandleErr(json.NewEncoder(rw).Encode(rescanResponse{Found: found, Wallet: w.Status()}))
 }
 
 //POST : api의 body에서 내용을 가져와서 payload(Address, port)에 저장 후 새로운 peer(port를 기반으로 한) 생성 후 다른 Peers 에게 전파.
@@ -239,13 +1017,119 @@ func peers(rw http.ResponseWriter, r *http.Request) {
 	case "POST":
 		var payload addPeerPayload               // api에서 불러올 payload 초기화
 		json.NewDecoder(r.Body).Decode(&payload) //r.Body 내용을 payload에 저장
-		p2p.AddPeer(payload.Address, payload.Port, port[1:], true)
+		err := p2p.AddPeer(payload.Address, payload.Port, payload.NodeID, port[1:], true)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(rw).Encode(errorResponse{err.Error()})
+			return
+		}
 		rw.WriteHeader(http.StatusOK)
 	case "GET":
 		json.NewEncoder(rw).Encode(p2p.AllPeers(&p2p.Peers))
 	}
 }
 
+//주소록에 저장된 peer들의 주소와 연결 기록을 보여줌.
+func addressBook(rw http.ResponseWriter, r *http.Request) {
+	utils.HandleErr(json.NewEncoder(rw).Encode(p2p.KnownAddrs(p2p.AddressBook())))
+}
+
+//연결된 peer들의 queue 상태와 버려진 message 수를 보여줌.
+func peerInfo(rw http.ResponseWriter, r *http.Request) {
+	utils.HandleErr(json.NewEncoder(rw).Encode(p2p.AllPeerInfo(&p2p.Peers)))
+}
+
+//compact block relay 통계를 보여줌.
+func relay(rw http.ResponseWriter, r *http.Request) {
+	utils.HandleErr(json.NewEncoder(rw).Encode(p2p.Relay()))
+}
+
+//이 node의 ID와 TLS 사용 여부를 보여줌. allowlist를 만들 때 사용.
+func node(rw http.ResponseWriter, r *http.Request) {
+	nodeID, secure := p2p.NodeID()
+	utils.HandleErr(json.NewEncoder(rw).Encode(nodeResponse{nodeID, secure}))
+}
+
+//chain 검증 작업의 상태와 마지막 결과를 보여줌. 검증 중이면 202.
+//아직 검증하지 않았거나 depth가 마지막 검증과 다르거나 rerun=true이면 검증을 새로 시작함.
+func verify(rw http.ResponseWriter, r *http.Request) {
+	depth, err := strconv.Atoi(r.URL.Query().Get("depth"))
+	if err != nil {
+		depth = 0
+	}
+	job := blockchain.VerifyStatus()
+	if !job.Running && (job.StartedAt == 0 || job.Depth != depth || r.URL.Query().Get("rerun") == "true") {
+		blockchain.StartVerify(depth)
+		job = blockchain.VerifyStatus()
+	}
+	if job.Running {
+		rw.WriteHeader(http.StatusAccepted)
+	}
+	utils.HandleErr(json.NewEncoder(rw).Encode(job))
+}
+
+//node를 시작할 때 -backup-dir로 받은 폴더. /admin/backup의 path는 이 폴더 안의 파일이어야함.
+func SetBackupDir(dir string) {
+	backupDir = dir
+}
+
+// /admin/backup의 path를 backup 폴더 안의 경로로 바꿈. 절대 경로나 ..으로 폴더 밖을 가리키는 path는 받지 않음.
+func backupPath(path string) (string, error) {
+	if backupDir == "" {
+		return "", ErrNoBackupDir
+	}
+	if filepath.IsAbs(path) || filepath.VolumeName(path) != "" {
+		return "", ErrBackupPath
+	}
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		if part == ".." {
+			return "", ErrBackupPath
+		}
+	}
+	return filepath.Join(backupDir, path), nil
+}
+
+//node를 멈추지 않고 db를 backup. path가 있으면 node의 backup 폴더 안의 path 파일에 쓰고 없으면 response로 tar archive를 보냄.
+//wallet=true이면 wallet 파일도 넣음.
+func backup(rw http.ResponseWriter, r *http.Request) {
+	walletFile := ""
+	if r.URL.Query().Get("wallet") == "true" {
+		walletFile = wallet.File()
+	}
+	if path := r.URL.Query().Get("path"); path != "" {
+		path, err := backupPath(path)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(rw).Encode(errorResponse{err.Error()})
+			return
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(rw).Encode(errorResponse{err.Error()})
+			return
+		}
+		size, err := db.BackupFile(path, walletFile)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(rw).Encode(errorResponse{err.Error()})
+			return
+		}
+		utils.HandleErr(json.NewEncoder(rw).Encode(backupResponse{Path: path, Size: size}))
+		return
+	}
+	rw.Header().Set("Content-Type", "application/x-tar")
+	rw.Header().Set("Content-Disposition", `attachment; filename="backup.tar"`)
+	size, err := db.Backup(rw, walletFile)
+	if err != nil && size == 0 { // 아직 아무것도 보내지 않았으면 에러를 보냄
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Header().Del("Content-Disposition")
+		rw.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(rw).Encode(errorResponse{err.Error()})
+	} else if err != nil {
+		fmt.Printf("backup failed after %d bytes: %s\n", size, err)
+	}
+}
+
 //cli.Start()에서 rest 로 시작할 시 실행.
 func Start(portnum int) {
 	//handler := http.NewServeMux() //rest.go와 동일 설정. multiplexer
@@ -259,16 +1143,54 @@ func Start(portnum int) {
 	//													   	 	  ServeHTTP(ResponseWriter, *Request)}
 
 	//Handle
-	router.HandleFunc("/blocks", blocks).Methods("POST", "GET") // /blocks 경로에 handler blocks를 출력.
-	router.HandleFunc("/blocks/{hash:[a-f0-9]+}", block).Methods("GET")
+	if !blockchain.Light() { // light node는 block을 가지고 있지 않음
+		router.HandleFunc("/blocks", blocks).Methods("POST", "GET") // /blocks 경로에 handler blocks를 출력.
+		router.HandleFunc("/blocks/{hash:[a-f0-9]+}", block).Methods("GET")
+		router.HandleFunc("/admin/verify", localOnly(verify)).Methods("GET")
+	}
 	router.HandleFunc("/status", status)
 	router.HandleFunc("/balance/{address}", balance).Methods("GET")
 	router.HandleFunc("/mempool", mempool).Methods("GET")
 	router.HandleFunc("/wallet", myWallet).Methods("GET")
+	router.HandleFunc("/wallet/unlock", localOnly(unlockWallet)).Methods("POST")
+	router.HandleFunc("/wallet/lock", lockWallet).Methods("POST")
+	router.HandleFunc("/wallet/address", walletAddress).Methods("GET", "POST")
+	router.HandleFunc("/wallet/rescan", rescanWallet).Methods("POST")
 	router.HandleFunc("/transactions", transactions).Methods("POST")
+	router.HandleFunc("/transactions/unsigned", unsignedTransactions).Methods("POST")
+	router.HandleFunc("/transactions/raw", rawTransaction).Methods("POST")
+	router.HandleFunc("/wallets", wallets).Methods("GET")
+	router.HandleFunc("/wallets", localOnly(wallets)).Methods("POST") // 새 wallet의 mnemonic을 보여줌
+	router.HandleFunc("/wallets/{name}", myWallet).Methods("GET")
+	router.HandleFunc("/wallets/{name}/load", loadWallet).Methods("POST")
+	router.HandleFunc("/wallets/{name}/unload", unloadWallet).Methods("POST")
+	router.HandleFunc("/wallets/{name}/unlock", localOnly(unlockWallet)).Methods("POST")
+	router.HandleFunc("/wallets/{name}/lock", lockWallet).Methods("POST")
+	router.HandleFunc("/wallets/{name}/address", walletAddress).Methods("GET", "POST")
+	router.HandleFunc("/wallets/{name}/rescan", rescanWallet).Methods("POST")
+	router.HandleFunc("/wallets/{name}/balance", walletBalance).Methods("GET")
+	router.HandleFunc("/wallets/{name}/transactions", transactions).Methods("POST")
+	router.HandleFunc("/wallets/{name}/transactions/unsigned", unsignedTransactions).Methods("POST")
+	router.HandleFunc("/wallets/{name}/history", walletHistory).Methods("GET")
+	router.HandleFunc("/wallets/{name}/coins", walletCoins).Methods("GET")
+	router.HandleFunc("/wallets/{name}/labels", walletLabels).Methods("GET", "POST")
+	router.HandleFunc("/wallets/{name}/xpub", localOnly(walletXPub)).Methods("GET")
+	router.HandleFunc("/wallets/{name}/watch", walletWatch).Methods("GET", "POST")
+	router.HandleFunc("/wallets/{name}/notifications", walletNotifications).Methods("GET")
 	router.HandleFunc("/ws", p2p.Upgrade).Methods("GET") //ws로 업그레이드
 	router.HandleFunc("/peers", peers).Methods("GET", "POST")
+	router.HandleFunc("/peers/book", addressBook).Methods("GET")
+	router.HandleFunc("/peers/info", peerInfo).Methods("GET")
+	router.HandleFunc("/peers/relay", relay).Methods("GET")
+	router.HandleFunc("/node", node).Methods("GET")
+	router.HandleFunc("/admin/backup", localOnly(backup)).Methods("POST")
 
+	if tlsConfig := p2p.ServerTLSConfig(); tlsConfig != nil { // TLS를 사용하면 node 인증서로 https 서버를 염
+		scheme = "https"
+		server := &http.Server{Addr: port, Handler: router, TLSConfig: tlsConfig}
+		fmt.Printf("Listening on %s://localhost%s\n", scheme, port)
+		log.Fatal(server.ListenAndServeTLS("", ""))
+	}
 	fmt.Printf("Listening on http://localhost%s\n", port)
 	log.Fatal(http.ListenAndServe(port, router)) //ListenAndServe() 메서드는 지정된 포트에 웹 서버를 열고 클라이언트 Request를 받아들여 새 Go 루틴에 작업을 할당하는 일을 한다
 
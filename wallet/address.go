@@ -0,0 +1,186 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/ripemd160"
+)
+
+//address는 Base58Check 형식. version(1) | hash160(압축한 public key)(20) | checksum(4)
+//checksum은 앞 21 byte를 sha256으로 두번 hashing한 값의 앞 4 byte라서 글자 하나가 틀려도 알 수 있음.
+//address에는 public key가 없으므로 TxIn에 public key를 넣어서 검증함.
+//
+//이전 address는 public key의 X||Y를 hex로 쓴 것. 이미 chain에 있는 TxOut을 사용할 수 있도록 검증만 지원함.
+const (
+	addressVersion byte = 0x32 // 'M'으로 시작하는 address
+
+	addressHashSize = 20
+	checksumSize    = 4
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var ErrAddressEmpty = errors.New("address is empty")
+var ErrAddressCharacter = errors.New("address has a character that is not base58 (0, O, I and l are not used)")
+var ErrAddressLength = errors.New("address has a wrong length")
+var ErrAddressVersion = errors.New("address has an unknown version")
+var ErrAddressChecksum = errors.New("address checksum does not match, check the address for typos")
+var ErrLegacyAddress = errors.New("address is in the old hex format without a checksum, ask for a new address")
+
+//address 형식이 틀렸을 때의 에러. 어떤 address가 왜 틀렸는지 보여줌.
+type AddressError struct {
+	Address string
+	Err     error
+}
+
+func (e *AddressError) Error() string {
+	return "invalid address \"" + e.Address + "\": " + e.Err.Error()
+}
+
+func (e *AddressError) Unwrap() error {
+	return e.Err
+}
+
+//address의 형식과 checksum을 확인. 이전 hex address는 ErrLegacyAddress.
+func ValidateAddress(address string) error {
+	_, err := decodeAddress(address)
+	if err != nil {
+		return &AddressError{Address: address, Err: err}
+	}
+	return nil
+}
+
+//public key의 address.
+func addressFromPublicKey(key *ecdsa.PublicKey) string {
+	payload := append([]byte{addressVersion}, hash160(elliptic.MarshalCompressed(elliptic.P256(), key.X, key.Y))...)
+	return base58Encode(append(payload, addressChecksum(payload)...))
+}
+
+//이전 형식의 address. public key의 X||Y를 hex로 씀.
+func legacyAddress(key *ecdsa.PublicKey) string {
+	return bytesToHex(key.X.Bytes(), key.Y.Bytes())
+}
+
+//address를 확인하고 public key hash를 리턴.
+func decodeAddress(address string) ([]byte, error) {
+	if address == "" {
+		return nil, ErrAddressEmpty
+	}
+	if isLegacyAddress(address) {
+		return nil, ErrLegacyAddress
+	}
+	decoded, err := base58Decode(address)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) != 1+addressHashSize+checksumSize {
+		return nil, ErrAddressLength
+	}
+	payload, checksum := decoded[:1+addressHashSize], decoded[1+addressHashSize:]
+	if !bytes.Equal(addressChecksum(payload), checksum) {
+		return nil, ErrAddressChecksum
+	}
+	if payload[0] != addressVersion {
+		return nil, ErrAddressVersion
+	}
+	return payload[1:], nil
+}
+
+//이전 hex address인지 확인. 64 byte 이하의 hex이고 반으로 나눈 X, Y가 P-256 위의 점이어야함.
+func isLegacyAddress(address string) bool {
+	if len(address) > 128 {
+		return false
+	}
+	key, err := legacyPublicKey(address)
+	return err == nil && key != nil
+}
+
+//이전 hex address에서 public key를 만듬.
+func legacyPublicKey(address string) (*ecdsa.PublicKey, error) {
+	x, y, err := restoreBigInt(address)
+	if err != nil {
+		return nil, err
+	}
+	if !elliptic.P256().IsOnCurve(x, y) {
+		return nil, ErrAddressLength
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+}
+
+//압축한 public key의 hex를 public key로 바꿈.
+func parsePublicKey(publicKey string) *ecdsa.PublicKey {
+	data, err := hex.DecodeString(publicKey)
+	if err != nil {
+		return nil
+	}
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), data)
+	if x == nil {
+		return nil
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+}
+
+//압축한 public key의 hex. TxIn에 넣음.
+func encodePublicKey(key *ecdsa.PublicKey) string {
+	return hex.EncodeToString(elliptic.MarshalCompressed(elliptic.P256(), key.X, key.Y))
+}
+
+func hash160(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	h := ripemd160.New()
+	h.Write(sum[:])
+	return h.Sum(nil)
+}
+
+func addressChecksum(payload []byte) []byte {
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	return second[:checksumSize]
+}
+
+func base58Encode(data []byte) string {
+	n := new(big.Int).SetBytes(data)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range data { // 앞의 0 byte는 '1'로 씀
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+func base58Decode(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, c := range s {
+		index := strings.IndexRune(base58Alphabet, c)
+		if index < 0 {
+			return nil, ErrAddressCharacter
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(index)))
+	}
+	decoded := n.Bytes()
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), decoded...), nil
+}
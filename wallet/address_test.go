@@ -0,0 +1,95 @@
+package wallet
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAddress(t *testing.T) {
+	key := createPublicKey()
+	address := addressFromKey(key)
+
+	t.Run("valid address", func(t *testing.T) {
+		if err := ValidateAddress(address); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(address, "M") {
+			t.Errorf("Expected the address to start with M, got %s", address)
+		}
+	})
+
+	t.Run("rejects typos", func(t *testing.T) {
+		last := address[len(address)-1]
+		typo := "2"
+		if last == '2' {
+			typo = "3"
+		}
+		if err := ValidateAddress(address[:len(address)-1] + typo); !errors.Is(err, ErrAddressChecksum) {
+			t.Errorf("Expected ErrAddressChecksum, got %v", err)
+		}
+	})
+
+	t.Run("rejects malformed addresses", func(t *testing.T) {
+		cases := map[string]error{
+			"":                       ErrAddressEmpty,
+			"PJY":                    ErrAddressLength,
+			address + "0":            ErrAddressCharacter,
+			address[:len(address)-2]: ErrAddressLength,
+		}
+		for address, expected := range cases {
+			err := ValidateAddress(address)
+			var addressErr *AddressError
+			if !errors.Is(err, expected) || !errors.As(err, &addressErr) {
+				t.Errorf("%q: expected %v, got %v", address, expected, err)
+			}
+		}
+	})
+
+	t.Run("rejects another version", func(t *testing.T) {
+		payload := append([]byte{addressVersion + 1}, hash160([]byte("key"))...)
+		if err := ValidateAddress(base58Encode(append(payload, addressChecksum(payload)...))); !errors.Is(err, ErrAddressVersion) {
+			t.Errorf("Expected ErrAddressVersion, got %v", err)
+		}
+	})
+
+	t.Run("detects legacy addresses", func(t *testing.T) {
+		if err := ValidateAddress(legacyAddress(&key.PublicKey)); !errors.Is(err, ErrLegacyAddress) {
+			t.Errorf("Expected ErrLegacyAddress, got %v", err)
+		}
+	})
+
+	t.Run("keeps leading zero bytes", func(t *testing.T) {
+		data := []byte{0, 0, 1, 2, 3}
+		decoded, err := base58Decode(base58Encode(data))
+		if err != nil || string(decoded) != string(data) {
+			t.Errorf("Expected %v, got %v %v", data, decoded, err)
+		}
+	})
+}
+
+func TestVerify(t *testing.T) {
+	key := createPublicKey()
+	for len(legacyAddress(&key.PublicKey)) != 128 { // 이전 address는 좌표 앞의 0 byte를 지워서 반으로 나누면 틀림
+		key = createPublicKey()
+	}
+	other := createPublicKey()
+	payload := "abcd"
+	w := &wallet{Address: addressFromKey(key), privateKey: key, keystore: &keystore{Address: legacyAddress(&key.PublicKey)}}
+	signature, err := Sign(payload, w.Address, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Verify(signature, payload, encodePublicKey(&key.PublicKey), w.Address) {
+		t.Error("Expected the signature to be valid")
+	}
+	if Verify(signature, payload, encodePublicKey(&other.PublicKey), w.Address) {
+		t.Error("Expected a public key of another address to be rejected")
+	}
+	if !Verify(signature, payload, "", legacyAddress(&key.PublicKey)) {
+		t.Error("Expected the signature of a legacy address to be valid")
+	}
+	if Verify(signature, payload, "", "PJY") {
+		t.Error("Expected a malformed address to be rejected")
+	}
+}
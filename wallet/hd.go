@@ -0,0 +1,231 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+//BIP32의 key 유도를 wallet이 사용하는 P-256 곡선으로 바꾼 것. secp256k1 대신 P-256의 order를 사용하고
+//master key의 HMAC key도 다르게 해서 같은 seed로 bitcoin wallet과 같은 key가 나오지 않게 함.
+//address는 m/44'/0'/account'/change/index 경로로 만듬. change는 받는 address가 0, 잔돈 address가 1.
+const (
+	hardened uint32 = 0x80000000
+
+	hdPurpose  uint32 = 44
+	hdCoinType uint32 = 0
+
+	receiveChain uint32 = 0
+	changeChain  uint32 = 1
+
+	gapLimit int = 20 // 복원할 때 연속으로 사용되지 않은 address가 이만큼 나오면 찾기를 멈춤
+)
+
+var masterHMACKey = []byte("MSSP seed")
+
+var ErrHardenedPublic = errors.New("cannot derive a hardened key from a public key")
+var ErrInvalidChild = errors.New("derived key is not valid, use the next index")
+var ErrInvalidPath = errors.New("HD path is not valid for the wallet")
+
+//private key나 public key와 chain code. key가 nil이면 public key로만 자식 public key를 만들 수 있음.
+type extendedKey struct {
+	key       *big.Int // private key. public key만 있으면 nil
+	x, y      *big.Int // public key
+	chainCode []byte
+}
+
+//seed로 master key를 만듬.
+func masterKey(seed []byte) (*extendedKey, error) {
+	mac := hmac.New(sha512.New, masterHMACKey)
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	key := new(big.Int).SetBytes(sum[:32])
+	if key.Sign() == 0 || key.Cmp(elliptic.P256().Params().N) >= 0 {
+		return nil, ErrInvalidChild
+	}
+	return newPrivateExtendedKey(key, sum[32:]), nil
+}
+
+func newPrivateExtendedKey(key *big.Int, chainCode []byte) *extendedKey {
+	x, y := elliptic.P256().ScalarBaseMult(paddedBytes(key))
+	return &extendedKey{key: key, x: x, y: y, chainCode: chainCode}
+}
+
+//i번째 자식 key. i가 hardened 이상이면 hardened 자식이고 private key가 있어야함.
+func (k *extendedKey) child(i uint32) (*extendedKey, error) {
+	curve := elliptic.P256()
+	var data []byte
+	if i >= hardened {
+		if k.key == nil {
+			return nil, ErrHardenedPublic
+		}
+		data = append([]byte{0}, paddedBytes(k.key)...)
+	} else {
+		data = elliptic.MarshalCompressed(curve, k.x, k.y)
+	}
+	index := make([]byte, 4)
+	binary.BigEndian.PutUint32(index, i)
+	data = append(data, index...)
+	mac := hmac.New(sha512.New, k.chainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+	il := new(big.Int).SetBytes(sum[:32])
+	if il.Cmp(curve.Params().N) >= 0 {
+		return nil, ErrInvalidChild
+	}
+	if k.key != nil {
+		key := new(big.Int).Add(il, k.key)
+		key.Mod(key, curve.Params().N)
+		if key.Sign() == 0 {
+			return nil, ErrInvalidChild
+		}
+		return newPrivateExtendedKey(key, sum[32:]), nil
+	}
+	ix, iy := curve.ScalarBaseMult(paddedBytes(il))
+	x, y := curve.Add(ix, iy, k.x, k.y)
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return nil, ErrInvalidChild
+	}
+	return &extendedKey{x: x, y: y, chainCode: sum[32:]}, nil
+}
+
+//path의 key들을 차례로 유도함.
+func (k *extendedKey) derive(path ...uint32) (*extendedKey, error) {
+	var err error
+	for _, i := range path {
+		if k, err = k.child(i); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+//private key를 지운 extended key.
+func (k *extendedKey) public() *extendedKey {
+	return &extendedKey{x: k.x, y: k.y, chainCode: k.chainCode}
+}
+
+//ecdsa private key. public key만 있으면 nil.
+func (k *extendedKey) privateKey() *ecdsa.PrivateKey {
+	if k.key == nil {
+		return nil
+	}
+	return &ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: elliptic.P256(), X: k.x, Y: k.y}, D: k.key}
+}
+
+func (k *extendedKey) address() string {
+	return addressFromPublicKey(&ecdsa.PublicKey{Curve: elliptic.P256(), X: k.x, Y: k.y})
+}
+
+//account key의 경로. m/44'/0'/account'
+func accountPath(account uint32) []uint32 {
+	return []uint32{hdPurpose + hardened, hdCoinType + hardened, account + hardened}
+}
+
+//account 아래 address의 전체 경로. m/44'/0'/account'/change/index
+func (p hdPath) format(account uint32) string {
+	return fmt.Sprintf("m/%d'/%d'/%d'/%d/%d", hdPurpose, hdCoinType, account, p.change, p.index)
+}
+
+//account 아래 address의 전체 경로를 읽음. 다른 account의 경로이면 ErrInvalidPath.
+func parsePath(path string, account uint32) (hdPath, error) {
+	var p hdPath
+	var a uint32
+	if _, err := fmt.Sscanf(path, "m/44'/0'/%d'/%d/%d", &a, &p.change, &p.index); err != nil ||
+		a != account || p.change > changeChain || p.index < 0 || p.format(account) != path {
+		return hdPath{}, ErrInvalidPath
+	}
+	return p, nil
+}
+
+//새 12단어 BIP39 mnemonic.
+func newMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(128)
+	if err != nil {
+		return "", err
+	}
+	return bip39.NewMnemonic(entropy)
+}
+
+//mnemonic을 확인하고 seed를 만듬. 단어 사이의 공백과 대소문자는 상관없음.
+func mnemonicSeed(mnemonic string) ([]byte, error) {
+	mnemonic = strings.Join(strings.Fields(strings.ToLower(mnemonic)), " ")
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, "")
+	if err != nil {
+		return nil, ErrInvalidMnemonic
+	}
+	return seed, nil
+}
+
+//receive와 change chain에서 used가 true인 address를 찾아서 마지막으로 사용한 address까지 wallet에 추가함.
+//gapLimit개의 address가 연속으로 사용되지 않았으면 그 chain을 그만 찾음. 새로 추가한 address의 수를 리턴.
+func (w *wallet) Discover(used func(address string) bool) (int, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if w.account == nil {
+		return 0, nil
+	}
+	found := 0
+	for _, change := range []uint32{receiveChain, changeChain} {
+		count := w.keystore.Account.Receive
+		if change == changeChain {
+			count = w.keystore.Account.Change
+		}
+		last := -1
+		for index, gap := 0, 0; gap < gapLimit; index++ {
+			address, err := w.deriveAddress(change, index)
+			if err != nil {
+				return found, err
+			}
+			if used(address) {
+				last, gap = index, 0
+			} else {
+				gap++
+			}
+		}
+		if last+1 > count {
+			if err := w.setCount(change, last+1); err != nil {
+				return found, err
+			}
+			found += last + 1 - count
+		}
+	}
+	return found, nil
+}
+
+//아직 만들지 않은 다음 gapLimit개의 receive, change address. light node가 filter에 같이 등록해서
+//새로 만든 address나 복원한 wallet의 address로 온 tx도 받을 수 있게 함.
+func (w *wallet) Lookahead() []string {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if w.account == nil {
+		return nil
+	}
+	var addresses []string
+	for _, change := range []uint32{receiveChain, changeChain} {
+		count := w.keystore.Account.Receive
+		if change == changeChain {
+			count = w.keystore.Account.Change
+		}
+		for index := count; index < count+gapLimit; index++ {
+			if address, err := w.deriveAddress(change, index); err == nil {
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	return addresses
+}
+
+//32 byte로 맞춘 big-endian 값.
+func paddedBytes(n *big.Int) []byte {
+	b := make([]byte, 32)
+	return n.FillBytes(b)
+}
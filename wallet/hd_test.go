@@ -0,0 +1,178 @@
+package wallet
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func TestDerivation(t *testing.T) {
+	seed, err := mnemonicSeed(testMnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, err := masterKey(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, err := master.derive(accountPath(0)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("public derivation matches private derivation", func(t *testing.T) {
+		private, err := account.derive(receiveChain, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		public, err := account.public().derive(receiveChain, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if private.address() != public.address() || public.key != nil {
+			t.Error("public derivation gives a different address")
+		}
+		if addressFromKey(private.privateKey()) != private.address() {
+			t.Error("private key does not match the address")
+		}
+	})
+
+	t.Run("hardened keys need the private key", func(t *testing.T) {
+		if _, err := account.public().child(hardened); err != ErrHardenedPublic {
+			t.Errorf("Expected ErrHardenedPublic, got %v", err)
+		}
+	})
+
+	t.Run("same seed gives the same keys", func(t *testing.T) {
+		again, _ := mnemonicSeed("  Abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about\n")
+		other, _ := masterKey(again)
+		otherAccount, _ := other.derive(accountPath(0)...)
+		if otherAccount.key.Cmp(account.key) != 0 {
+			t.Error("derived a different account key")
+		}
+		second, _ := master.derive(accountPath(1)...)
+		if second.key.Cmp(account.key) == 0 {
+			t.Error("accounts have the same key")
+		}
+	})
+
+	t.Run("rejects a wrong mnemonic", func(t *testing.T) {
+		if _, err := mnemonicSeed("abandon abandon abandon"); err != ErrInvalidMnemonic {
+			t.Errorf("Expected ErrInvalidMnemonic, got %v", err)
+		}
+	})
+}
+
+func TestRestoreAndDiscover(t *testing.T) {
+	scryptN = 1 << 10
+	wd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	defer os.Chdir(wd)
+	defer Wallets().forget(DefaultName)
+
+	if err := Restore(DefaultName, testMnemonic, "passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	wallet := Wallet()
+	if !wallet.HD() || len(wallet.Addresses()) != 1 {
+		t.Fatalf("Expected an HD wallet with one address, got %v", wallet.Addresses())
+	}
+	first := wallet.Address
+
+	used := map[string]bool{}
+	for _, path := range []hdPath{{receiveChain, 0}, {receiveChain, 3}, {changeChain, 1}, {receiveChain, 3 + gapLimit + 1}} {
+		address, err := wallet.deriveAddress(path.change, path.index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		used[address] = true
+	}
+	found, err := wallet.Discover(func(address string) bool { return used[address] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != 5 { // receive 1~3, change 0~1. gap 밖의 address는 찾지 않음
+		t.Errorf("Expected 5 new addresses, got %d", found)
+	}
+
+	Wallets().forget(DefaultName)
+	wallet = Wallet()
+	if len(wallet.Addresses()) != 6 || wallet.Addresses()[0] != first {
+		t.Fatalf("Expected the discovered addresses to be saved, got %v", wallet.Addresses())
+	}
+	change, _ := wallet.deriveAddress(changeChain, 1)
+	if _, err := Sign("aa", change, wallet); err != ErrWalletLocked {
+		t.Errorf("Expected ErrWalletLocked, got %v", err)
+	}
+	if err := wallet.Unlock("passphrase", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	defer wallet.Lock()
+	signature, err := Sign("aa", change, wallet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := wallet.PublicKey(change)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Verify(signature, "aa", publicKey, change) {
+		t.Error("signature of the change address is not valid")
+	}
+	if _, err := Sign("aa", addressFromKey(createPublicKey()), wallet); !errors.Is(err, ErrUnknownAddress) {
+		t.Errorf("Expected ErrUnknownAddress, got %v", err)
+	}
+	next, err := wallet.ChangeAddress()
+	if err != nil || next != wallet.Addresses()[6] || wallet.Address != wallet.Addresses()[3] {
+		t.Errorf("Expected a new change address without changing the receive address, got %s %v", next, err)
+	}
+}
+
+func TestAddPath(t *testing.T) {
+	scryptN = 1 << 10
+	wd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	defer os.Chdir(wd)
+	defer Wallets().forget(DefaultName)
+
+	if err := Restore(DefaultName, testMnemonic, "passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	offline := Wallet()
+	online, err := openWallet("online", walletName) // 같은 wallet 파일의 다른 복사본
+	if err != nil {
+		t.Fatal(err)
+	}
+	change, err := online.ChangeAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := online.Path(change)
+	if path != "m/44'/0'/0'/1/0" {
+		t.Fatalf("Expected the path of the first change address, got %s", path)
+	}
+	if _, err := offline.PublicKey(change); !errors.Is(err, ErrUnknownAddress) {
+		t.Fatalf("Expected the offline wallet not to know the change address, got %v", err)
+	}
+	if err := offline.AddPath(change, "m/44'/0'/0'/1/1"); err != ErrUnknownAddress {
+		t.Errorf("Expected ErrUnknownAddress for the path of another address, got %v", err)
+	}
+	for _, invalid := range []string{"m/44'/0'/1'/1/0", "m/44'/0'/0'/2/0", "m/44'/0'/0'/1/00", "1/0"} {
+		if err := offline.AddPath(change, invalid); err != ErrInvalidPath {
+			t.Errorf("Expected ErrInvalidPath for %s, got %v", invalid, err)
+		}
+	}
+	if err := offline.AddPath(change, path); err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := online.PublicKey(change)
+	if publicKey, err := offline.PublicKey(change); err != nil || publicKey != expected {
+		t.Errorf("Expected the public key of the change address, got %s %v", publicKey, err)
+	}
+	if len(offline.Addresses()) != 1 {
+		t.Errorf("Expected the added address only to be used for signing, got %v", offline.Addresses())
+	}
+}
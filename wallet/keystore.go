@@ -0,0 +1,282 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+//wallet 파일은 passphrase로 암호화한 keystore. address는 암호화하지 않으므로 잠긴 wallet으로도 채굴과 잔액 확인을 할 수 있음.
+//private key는 scrypt로 passphrase에서 만든 key로 AES-256-GCM 암호화하고, address를 additional data로 넣어서 address를 바꾸면 풀리지 않게 함.
+//HD wallet은 seed를 암호화하고 account의 public key와 chain code를 그대로 저장해서 잠겨있어도 address를 만들 수 있음.
+const (
+	keystoreVersion int = 1
+
+	keystoreHD    string = "hd"    // seed를 암호화한 HD wallet. type이 없으면 key 하나를 암호화한 wallet
+	keystoreWatch string = "watch" // key가 없는 watch-only wallet. account가 있으면 그 xpub의 address를 만듬
+)
+
+//scrypt 비용. 파일에 저장하므로 나중에 바꿔도 이전 파일을 열 수 있음
+var (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+var ErrNoPassphrase = errors.New("passphrase is empty")
+var ErrNotKeystore = errors.New("not a wallet file")
+
+type keystore struct {
+	Version int          `json:"version"`
+	Type    string       `json:"type,omitempty"`
+	Address string       `json:"address,omitempty"` // key 하나인 wallet의 이전 형식 address. public key의 X||Y
+	Account *hdAccount   `json:"account,omitempty"` // HD wallet의 account
+	Watch   []string     `json:"watch,omitempty"`   // key 없이 잔액과 tx를 지켜보는 address
+	Crypto  cryptoParams `json:"crypto"`
+}
+
+//HD wallet의 account key와 지금까지 만든 address의 수.
+type hdAccount struct {
+	Index     uint32 `json:"index"`
+	PublicKey string `json:"publicKey"` // 압축한 account public key
+	ChainCode string `json:"chainCode"`
+	Receive   int    `json:"receive"` // 만든 receive address의 수
+	Change    int    `json:"change"`  // 만든 change address의 수
+}
+
+type cryptoParams struct {
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       string `json:"salt"`
+	Cipher     string `json:"cipher"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+//passphrase로 key를 암호화한 keystore를 만듬.
+func encryptKey(key *ecdsa.PrivateKey, passphrase string) (*keystore, error) {
+	plain, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	k := &keystore{Version: keystoreVersion, Address: legacyAddress(&key.PublicKey)}
+	return k, k.seal(plain, passphrase)
+}
+
+//passphrase로 seed를 암호화한 HD wallet keystore를 만듬. 첫 receive address를 하나 만들어둠.
+func encryptSeed(seed []byte, account uint32, passphrase string) (*keystore, error) {
+	master, err := masterKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	accountKey, err := master.derive(accountPath(account)...)
+	if err != nil {
+		return nil, err
+	}
+	k := &keystore{Version: keystoreVersion, Type: keystoreHD, Account: &hdAccount{
+		Index:     account,
+		PublicKey: hex.EncodeToString(elliptic.MarshalCompressed(elliptic.P256(), accountKey.x, accountKey.y)),
+		ChainCode: hex.EncodeToString(accountKey.chainCode),
+		Receive:   1,
+	}}
+	return k, k.seal(seed, passphrase)
+}
+
+//passphrase로 keystore의 key를 복호화. passphrase가 틀리거나 파일이 바뀌었으면 ErrWrongPassphrase.
+func (k *keystore) decryptKey(passphrase string) (*ecdsa.PrivateKey, error) {
+	if k.Type != "" {
+		return nil, ErrNotKeystore
+	}
+	plain, err := k.open(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParseECPrivateKey(plain)
+	if err != nil || legacyAddress(&key.PublicKey) != k.Address {
+		return nil, ErrNotKeystore
+	}
+	return key, nil
+}
+
+//passphrase로 HD wallet의 seed를 복호화해서 account의 private key를 만듬.
+func (k *keystore) decryptAccount(passphrase string) (*extendedKey, error) {
+	if k.Type != keystoreHD {
+		return nil, ErrNotKeystore
+	}
+	seed, err := k.open(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	master, err := masterKey(seed)
+	if err != nil {
+		return nil, ErrNotKeystore
+	}
+	accountKey, err := master.derive(accountPath(k.Account.Index)...)
+	if err != nil {
+		return nil, ErrNotKeystore
+	}
+	public, err := k.accountKey()
+	if err != nil || public.x.Cmp(accountKey.x) != 0 || public.y.Cmp(accountKey.y) != 0 {
+		return nil, ErrNotKeystore
+	}
+	return accountKey, nil
+}
+
+//keystore에 저장한 account public key.
+func (k *keystore) accountKey() (*extendedKey, error) {
+	if k.Account == nil {
+		return nil, ErrNotKeystore
+	}
+	publicKey, err := hex.DecodeString(k.Account.PublicKey)
+	if err != nil {
+		return nil, ErrNotKeystore
+	}
+	chainCode, err := hex.DecodeString(k.Account.ChainCode)
+	if err != nil || len(chainCode) != 32 {
+		return nil, ErrNotKeystore
+	}
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), publicKey)
+	if x == nil {
+		return nil, ErrNotKeystore
+	}
+	return &extendedKey{x: x, y: y, chainCode: chainCode}, nil
+}
+
+//암호화하지 않고 저장하는 값. 이 값을 additional data로 넣어서 바꾸면 풀리지 않게 함.
+func (k *keystore) additionalData() []byte {
+	if k.Type == keystoreHD {
+		return []byte(k.Account.PublicKey + k.Account.ChainCode)
+	}
+	return []byte(k.Address)
+}
+
+//plain을 passphrase로 암호화해서 k.Crypto에 넣음.
+func (k *keystore) seal(plain []byte, passphrase string) error {
+	if passphrase == "" {
+		return ErrNoPassphrase
+	}
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	params := cryptoParams{KDF: "scrypt", N: scryptN, R: scryptR, P: scryptP, Salt: hex.EncodeToString(salt), Cipher: "aes-256-gcm"}
+	gcm, err := keystoreCipher(passphrase, &params)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	params.Nonce = hex.EncodeToString(nonce)
+	params.Ciphertext = hex.EncodeToString(gcm.Seal(nil, nonce, plain, k.additionalData()))
+	k.Crypto = params
+	return nil
+}
+
+//passphrase로 k.Crypto를 복호화. passphrase가 틀리거나 파일이 바뀌었으면 ErrWrongPassphrase.
+func (k *keystore) open(passphrase string) ([]byte, error) {
+	gcm, err := keystoreCipher(passphrase, &k.Crypto)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hex.DecodeString(k.Crypto.Nonce)
+	if err != nil || len(nonce) != gcm.NonceSize() {
+		return nil, ErrNotKeystore
+	}
+	ciphertext, err := hex.DecodeString(k.Crypto.Ciphertext)
+	if err != nil {
+		return nil, ErrNotKeystore
+	}
+	plain, err := gcm.Open(nil, nonce, ciphertext, k.additionalData())
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plain, nil
+}
+
+//keystore의 scrypt parameter로 passphrase에서 AES-GCM cipher를 만듬.
+func keystoreCipher(passphrase string, params *cryptoParams) (cipher.AEAD, error) {
+	if params.KDF != "scrypt" || params.Cipher != "aes-256-gcm" {
+		return nil, ErrNotKeystore
+	}
+	salt, err := hex.DecodeString(params.Salt)
+	if err != nil {
+		return nil, ErrNotKeystore
+	}
+	derived, err := scrypt.Key([]byte(passphrase), salt, params.N, params.R, params.P, 32)
+	if err != nil {
+		return nil, ErrNotKeystore
+	}
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+//path의 keystore를 읽음. 암호화하지 않은 이전 wallet 파일이면 plaintext에 그 key를 리턴.
+func readKeystore(path string) (k *keystore, plaintext *ecdsa.PrivateKey, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		key, err := x509.ParseECPrivateKey(data)
+		if err != nil {
+			return nil, nil, ErrNotKeystore
+		}
+		return nil, key, nil
+	}
+	k = &keystore{}
+	if err := json.Unmarshal(data, k); err != nil || k.Version != keystoreVersion {
+		return nil, nil, ErrNotKeystore
+	}
+	if k.Type == keystoreHD && k.Account == nil || k.Type != keystoreHD && k.Type != keystoreWatch && k.Type != "" {
+		return nil, nil, ErrNotKeystore
+	}
+	return k, nil, nil
+}
+
+//keystore를 path에 0600으로 씀.
+func writeKeystore(path string, k *keystore) error {
+	data, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(path, data)
+}
+
+//data를 path에 0600으로 씀. 다른 파일에 다 쓴 후 이름을 바꾸므로 중간에 꺼져도 이전 파일이 남음.
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,88 @@
+package wallet
+
+import (
+	"crypto/x509"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeystore(t *testing.T) {
+	scryptN = 1 << 10 // 테스트가 빨리 끝나도록
+	key := createPublicKey()
+	k, err := encryptKey(key, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("decrypts with the passphrase", func(t *testing.T) {
+		decrypted, err := k.decryptKey("passphrase")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decrypted.D.Cmp(key.D) != 0 || k.Address != legacyAddress(&key.PublicKey) {
+			t.Error("decrypted key is different")
+		}
+	})
+
+	t.Run("rejects a wrong passphrase", func(t *testing.T) {
+		if _, err := k.decryptKey("wrong"); err != ErrWrongPassphrase {
+			t.Errorf("Expected ErrWrongPassphrase, got %v", err)
+		}
+	})
+
+	t.Run("rejects a changed address", func(t *testing.T) {
+		changed := *k
+		changed.Address = legacyAddress(&createPublicKey().PublicKey)
+		if _, err := changed.decryptKey("passphrase"); err != ErrWrongPassphrase {
+			t.Errorf("Expected ErrWrongPassphrase, got %v", err)
+		}
+	})
+
+	t.Run("needs a passphrase", func(t *testing.T) {
+		if _, err := encryptKey(key, ""); err != ErrNoPassphrase {
+			t.Errorf("Expected ErrNoPassphrase, got %v", err)
+		}
+	})
+}
+
+func TestMigratePlaintext(t *testing.T) {
+	scryptN = 1 << 10
+	wd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	defer os.Chdir(wd)
+
+	key := createPublicKey()
+	plain, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(walletName, plain, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Migrate(""); !errors.Is(err, ErrNoPassphrase) {
+		t.Fatalf("Expected ErrNoPassphrase, got %v", err)
+	}
+	migrated, err := Migrate("passphrase")
+	if err != nil || !migrated {
+		t.Fatalf("Expected the wallet file to be migrated, got %v %v", migrated, err)
+	}
+	info, err := os.Stat(filepath.Join(".", walletName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected 0600, got %o", info.Mode().Perm())
+	}
+	k, plaintext, err := readKeystore(walletName)
+	if err != nil || plaintext != nil {
+		t.Fatalf("Expected a keystore, got %v", err)
+	}
+	if decrypted, err := k.decryptKey("passphrase"); err != nil || decrypted.D.Cmp(key.D) != 0 {
+		t.Errorf("migrated key is different: %v", err)
+	}
+	if migrated, err := Migrate("passphrase"); err != nil || migrated {
+		t.Errorf("Expected nothing to migrate, got %v %v", migrated, err)
+	}
+}
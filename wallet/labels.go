@@ -0,0 +1,98 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+//address와 tx에 붙이는 이름이나 메모. 비밀이 아니므로 암호화하지 않고 wallet 파일 옆의 <name>.labels 파일에 저장함.
+//잠긴 wallet에도 붙일 수 있음.
+type Labels struct {
+	Addresses map[string]string `json:"addresses"` // key는 address. 내 address가 아니어도 됨
+	Txs       map[string]string `json:"txs"`       // key는 tx id
+}
+
+const (
+	labelsExt      string = ".labels"
+	maxLabelLength int    = 256
+)
+
+var ErrLabelTooLong = errors.New("label can be at most 256 characters")
+var ErrInvalidTxID = errors.New("tx id must be 64 hex characters")
+
+//wallet 파일과 같은 폴더의 labels 파일. MSSP.wallet은 MSSP.labels.
+func (w *wallet) labelsPath() string {
+	return strings.TrimSuffix(w.path, filepath.Ext(w.path)) + labelsExt
+}
+
+//저장된 label들. 파일이 없으면 빈 Labels.
+func (w *wallet) Labels() (*Labels, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return w.readLabels()
+}
+
+func (w *wallet) readLabels() (*Labels, error) {
+	labels := &Labels{Addresses: map[string]string{}, Txs: map[string]string{}}
+	data, err := os.ReadFile(w.labelsPath())
+	if os.IsNotExist(err) {
+		return labels, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, labels); err != nil {
+		return nil, err
+	}
+	if labels.Addresses == nil {
+		labels.Addresses = map[string]string{}
+	}
+	if labels.Txs == nil {
+		labels.Txs = map[string]string{}
+	}
+	return labels, nil
+}
+
+//address에 label을 붙임. label이 비어있으면 지움. 이전 hex address에도 붙일 수 있음.
+func (w *wallet) SetAddressLabel(address string, label string) error {
+	if err := ValidateAddress(address); err != nil && !errors.Is(err, ErrLegacyAddress) {
+		return err
+	}
+	return w.setLabel(func(l *Labels) map[string]string { return l.Addresses }, address, label)
+}
+
+//tx에 메모를 붙임. label이 비어있으면 지움. 아직 chain에 없는 tx에도 붙일 수 있음.
+func (w *wallet) SetTxLabel(txID string, label string) error {
+	if id, err := hex.DecodeString(txID); err != nil || len(id) != 32 {
+		return ErrInvalidTxID
+	}
+	return w.setLabel(func(l *Labels) map[string]string { return l.Txs }, txID, label)
+}
+
+func (w *wallet) setLabel(labelsOf func(*Labels) map[string]string, key string, label string) error {
+	label = strings.TrimSpace(label)
+	if utf8.RuneCountInString(label) > maxLabelLength {
+		return ErrLabelTooLong
+	}
+	w.m.Lock()
+	defer w.m.Unlock()
+	labels, err := w.readLabels()
+	if err != nil {
+		return err
+	}
+	if label == "" {
+		delete(labelsOf(labels), key)
+	} else {
+		labelsOf(labels)[key] = label
+	}
+	data, err := json.MarshalIndent(labels, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(w.labelsPath(), data)
+}
@@ -0,0 +1,46 @@
+package wallet
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLabels(t *testing.T) {
+	dir := t.TempDir()
+	key := createPublicKey()
+	w := &wallet{Name: "alice", path: filepath.Join(dir, "alice"+walletExt)}
+	address := addressFromKey(key)
+	txID := strings.Repeat("ab", 32)
+
+	if err := w.SetAddressLabel(address, " bob "); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetTxLabel(txID, "rent"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "alice"+labelsExt)); err != nil {
+		t.Fatalf("Expected the labels next to the wallet file, got %v", err)
+	}
+	labels, err := (&wallet{path: w.path}).Labels() // 파일에서 다시 읽음
+	if err != nil || labels.Addresses[address] != "bob" || labels.Txs[txID] != "rent" {
+		t.Errorf("Expected the saved labels, got %+v %v", labels, err)
+	}
+
+	if err := w.SetTxLabel(txID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if labels, _ := w.Labels(); len(labels.Txs) != 0 || len(labels.Addresses) != 1 {
+		t.Errorf("Expected the tx label to be removed, got %+v", labels)
+	}
+	if err := w.SetTxLabel("abc", "x"); err != ErrInvalidTxID {
+		t.Errorf("Expected ErrInvalidTxID, got %v", err)
+	}
+	if err := w.SetAddressLabel("M123", "x"); err == nil {
+		t.Error("Expected an invalid address to be rejected")
+	}
+	if err := w.SetAddressLabel(address, strings.Repeat("a", maxLabelLength+1)); err != ErrLabelTooLong {
+		t.Errorf("Expected ErrLabelTooLong, got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package wallet
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//한 node가 여러 사람이나 service를 위해 이름을 붙인 wallet들을 가질 수 있음.
+//기본 wallet은 이전처럼 MSSP.wallet 파일을 사용하고, 다른 wallet은 wallets 폴더에 <name>.wallet 파일로 저장함.
+const (
+	DefaultName string = "default" // node의 기본 wallet
+
+	walletsDir string = "wallets"
+	walletExt  string = ".wallet"
+)
+
+var ErrWalletExists = errors.New("wallet already exists")
+var ErrWalletNotFound = errors.New("wallet not found")
+var ErrWalletNotLoaded = errors.New("wallet is not loaded")
+var ErrWalletName = errors.New("wallet name can only have letters, numbers, '-' and '_' (at most 32)")
+var ErrDefaultWallet = errors.New("the default wallet cannot be unloaded")
+
+var walletNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+//불러온 wallet들. 불러온 wallet만 address를 만들고 tx에 서명할 수 있음.
+type manager struct {
+	wallets map[string]*wallet
+	m       sync.Mutex
+}
+
+//wallet 목록에서 보여주는 정보.
+type Info struct {
+	Name   string `json:"name"`
+	Loaded bool   `json:"loaded"`
+}
+
+var wm *manager
+var managerOnce sync.Once
+
+//singleton으로 wallet manager 생성.
+func Wallets() *manager {
+	managerOnce.Do(func() {
+		wm = &manager{wallets: make(map[string]*wallet)}
+	})
+	return wm
+}
+
+//name wallet의 keystore 파일. 기본 wallet은 MSSP.wallet.
+func walletPath(name string) (string, error) {
+	if name == DefaultName {
+		return walletName, nil
+	}
+	if !walletNamePattern.MatchString(name) {
+		return "", ErrWalletName
+	}
+	return filepath.Join(walletsDir, name+walletExt), nil
+}
+
+//새 mnemonic으로 name HD wallet을 만들어서 불러옴. mnemonic은 이때 한 번만 리턴함.
+func (m *manager) Create(name string, passphrase string) (string, *wallet, error) {
+	path, err := walletPath(name)
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return "", nil, ErrWalletExists
+	}
+	mnemonic, err := newMnemonic()
+	if err != nil {
+		return "", nil, err
+	}
+	if err := Restore(name, mnemonic, passphrase); err != nil {
+		return "", nil, err
+	}
+	w, err := m.Load(name)
+	return mnemonic, w, err
+}
+
+//name wallet의 파일을 읽어서 잠긴 상태로 불러옴. 이미 불러왔으면 그 wallet을 리턴.
+func (m *manager) Load(name string) (*wallet, error) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	if w, ok := m.wallets[name]; ok {
+		return w, nil
+	}
+	path, err := walletPath(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, ErrWalletNotFound
+	}
+	w, err := openWallet(name, path)
+	if err != nil {
+		return nil, err
+	}
+	m.wallets[name] = w
+	return w, nil
+}
+
+//name wallet을 잠그고 목록에서 뺌. 파일은 지우지 않음. 기본 wallet은 뺄 수 없음.
+func (m *manager) Unload(name string) error {
+	if name == DefaultName {
+		return ErrDefaultWallet
+	}
+	m.m.Lock()
+	defer m.m.Unlock()
+	w, ok := m.wallets[name]
+	if !ok {
+		return ErrWalletNotLoaded
+	}
+	w.Lock()
+	delete(m.wallets, name)
+	return nil
+}
+
+//불러온 name wallet. 기본 wallet은 불러오지 않았으면 불러옴.
+func (m *manager) Get(name string) (*wallet, error) {
+	if name == DefaultName {
+		return m.Load(name)
+	}
+	m.m.Lock()
+	defer m.m.Unlock()
+	w, ok := m.wallets[name]
+	if !ok {
+		if _, err := walletPath(name); err != nil {
+			return nil, err
+		}
+		return nil, ErrWalletNotLoaded
+	}
+	return w, nil
+}
+
+//불러온 wallet들을 이름 순서로 리턴.
+func (m *manager) Loaded() []*wallet {
+	m.m.Lock()
+	defer m.m.Unlock()
+	var wallets []*wallet
+	for _, w := range m.wallets {
+		wallets = append(wallets, w)
+	}
+	sort.Slice(wallets, func(i, j int) bool { return wallets[i].Name < wallets[j].Name })
+	return wallets
+}
+
+//파일이 있는 모든 wallet과 불러왔는지 여부.
+func (m *manager) List() ([]Info, error) {
+	names := []string{}
+	if _, err := os.Stat(walletName); err == nil {
+		names = append(names, DefaultName)
+	}
+	entries, err := os.ReadDir(walletsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), walletExt)
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), walletExt) && walletNamePattern.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	m.m.Lock()
+	defer m.m.Unlock()
+	infos := []Info{}
+	for _, name := range names {
+		_, loaded := m.wallets[name]
+		infos = append(infos, Info{Name: name, Loaded: loaded})
+	}
+	return infos, nil
+}
+
+//name wallet의 파일이 바뀌었을 때 불러온 wallet을 잠그고 목록에서 빼서 다음에 다시 읽게 함.
+func (m *manager) forget(name string) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	if w, ok := m.wallets[name]; ok {
+		w.Lock()
+		delete(m.wallets, name)
+	}
+}
@@ -0,0 +1,60 @@
+package wallet
+
+import (
+	"os"
+	"testing"
+)
+
+func TestManager(t *testing.T) {
+	scryptN = 1 << 10
+	wd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	defer os.Chdir(wd)
+	defer Wallets().forget("alice")
+
+	mnemonic, alice, err := Wallets().Create("alice", "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.Name != "alice" || !alice.HD() {
+		t.Errorf("Expected an HD wallet named alice, got %s", alice.Name)
+	}
+	if _, _, err := Wallets().Create("alice", "passphrase"); err != ErrWalletExists {
+		t.Errorf("Expected ErrWalletExists, got %v", err)
+	}
+	if _, _, err := Wallets().Create("../bob", "passphrase"); err != ErrWalletName {
+		t.Errorf("Expected ErrWalletName, got %v", err)
+	}
+
+	if err := Wallets().Unload("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Wallets().Get("alice"); err != ErrWalletNotLoaded {
+		t.Errorf("Expected ErrWalletNotLoaded, got %v", err)
+	}
+	if _, err := Wallets().Load("bob"); err != ErrWalletNotFound {
+		t.Errorf("Expected ErrWalletNotFound, got %v", err)
+	}
+	if err := Wallets().Unload(DefaultName); err != ErrDefaultWallet {
+		t.Errorf("Expected ErrDefaultWallet, got %v", err)
+	}
+	if infos, _ := Wallets().List(); len(infos) != 1 || infos[0] != (Info{Name: "alice", Loaded: false}) {
+		t.Errorf("Expected only alice which is not loaded, got %v", infos)
+	}
+
+	reloaded, err := Wallets().Load("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Address != alice.Address {
+		t.Error("reloaded wallet has a different address")
+	}
+	if err := Restore("carol", mnemonic, "other"); err != nil {
+		t.Fatal(err)
+	}
+	carol, err := Wallets().Load("carol")
+	if err != nil || carol.Address != alice.Address {
+		t.Errorf("Expected the same address from the same mnemonic, got %v", err)
+	}
+	Wallets().forget("carol")
+}
@@ -0,0 +1,110 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+)
+
+//signature는 r과 s를 각각 32 byte로 맞춰서 이어붙인 64 byte의 hex. 길이가 항상 같으므로 반으로 나눠도 틀리지 않음.
+//s와 N-s 모두 맞는 signature이므로 N/2 이하인 s(low-S)만 사용해서 signature를 하나로 정함.
+//nonce는 RFC6979로 private key와 payload에서 만들어서 같은 payload에 항상 같은 signature가 나오고 난수가 나빠도 key가 새지 않음.
+const signatureSize = 64
+
+var ErrNonCanonicalSignature = errors.New("signature is not 64 bytes with a low s")
+
+var halfOrder = new(big.Int).Rsh(elliptic.P256().Params().N, 1)
+
+//key로 hash에 서명. RFC6979 nonce를 사용하고 s를 low-S로 바꿈.
+func signDeterministic(key *ecdsa.PrivateKey, hash []byte) (*big.Int, *big.Int) {
+	n := elliptic.P256().Params().N
+	e := hashToInt(hash)
+	nonce := rfc6979(key.D, hash)
+	for {
+		k := nonce()
+		x, _ := elliptic.P256().ScalarBaseMult(paddedBytes(k))
+		r := new(big.Int).Mod(x, n)
+		if r.Sign() == 0 {
+			continue
+		}
+		s := new(big.Int).Mul(r, key.D)
+		s.Add(s, e)
+		s.Mul(s, new(big.Int).ModInverse(k, n))
+		s.Mod(s, n)
+		if s.Sign() == 0 {
+			continue
+		}
+		if s.Cmp(halfOrder) > 0 {
+			s.Sub(n, s)
+		}
+		return r, s
+	}
+}
+
+//RFC6979 3.2의 HMAC-SHA256 DRBG. 부를 때마다 1 이상 N 미만인 다음 nonce를 리턴.
+func rfc6979(d *big.Int, hash []byte) func() *big.Int {
+	n := elliptic.P256().Params().N
+	x := paddedBytes(d)
+	h1 := paddedBytes(new(big.Int).Mod(hashToInt(hash), n))
+	v := make([]byte, sha256.Size)
+	k := make([]byte, sha256.Size)
+	for i := range v {
+		v[i] = 0x01
+	}
+	mac := func(key []byte, data ...[]byte) []byte {
+		h := hmac.New(sha256.New, key)
+		for _, d := range data {
+			h.Write(d)
+		}
+		return h.Sum(nil)
+	}
+	k = mac(k, v, []byte{0x00}, x, h1)
+	v = mac(k, v)
+	k = mac(k, v, []byte{0x01}, x, h1)
+	v = mac(k, v)
+	first := true
+	return func() *big.Int {
+		for {
+			if !first { // 전의 nonce를 사용할 수 없었으면 다음 nonce를 만듬
+				k = mac(k, v, []byte{0x00})
+				v = mac(k, v)
+			}
+			first = false
+			v = mac(k, v) // qlen(256)과 hlen(256)이 같으므로 한번이면 충분
+			nonce := new(big.Int).SetBytes(v)
+			if nonce.Sign() > 0 && nonce.Cmp(n) < 0 {
+				return nonce
+			}
+		}
+	}
+}
+
+//hash의 앞 256 bit를 숫자로 바꿈. crypto/ecdsa가 검증할 때와 같은 방법.
+func hashToInt(hash []byte) *big.Int {
+	if len(hash) > 32 {
+		hash = hash[:32]
+	}
+	return new(big.Int).SetBytes(hash)
+}
+
+func encodeSignature(r *big.Int, s *big.Int) string {
+	return hex.EncodeToString(append(paddedBytes(r), paddedBytes(s)...))
+}
+
+//64 byte의 signature를 r, s로 나눔. 길이가 다르거나 r, s가 범위 밖이거나 s가 low-S가 아니면 ErrNonCanonicalSignature.
+func decodeSignature(signature string) (*big.Int, *big.Int, error) {
+	data, err := hex.DecodeString(signature)
+	if err != nil || len(data) != signatureSize {
+		return nil, nil, ErrNonCanonicalSignature
+	}
+	r := new(big.Int).SetBytes(data[:signatureSize/2])
+	s := new(big.Int).SetBytes(data[signatureSize/2:])
+	if r.Sign() == 0 || r.Cmp(elliptic.P256().Params().N) >= 0 || s.Sign() == 0 || s.Cmp(halfOrder) > 0 {
+		return nil, nil, ErrNonCanonicalSignature
+	}
+	return r, s, nil
+}
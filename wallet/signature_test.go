@@ -0,0 +1,85 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func hexInt(s string) *big.Int {
+	n, _ := new(big.Int).SetString(s, 16)
+	return n
+}
+
+func TestSignature(t *testing.T) {
+	t.Run("RFC6979 test vector", func(t *testing.T) { // RFC6979 A.2.5 P-256, SHA-256, "sample"
+		d := hexInt("C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721")
+		x, y := elliptic.P256().ScalarBaseMult(paddedBytes(d))
+		key := &ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, D: d}
+		hash := sha256.Sum256([]byte("sample"))
+
+		if k := rfc6979(d, hash[:])(); k.Cmp(hexInt("A6E3C57DD01ABE90086538398355DD4C3B17AA873382B0F24D6129493D8AAD60")) != 0 {
+			t.Errorf("Expected the nonce of the test vector, got %x", k)
+		}
+		r, s := signDeterministic(key, hash[:])
+		expectedS := hexInt("F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8")
+		expectedS.Sub(elliptic.P256().Params().N, expectedS) // test vector의 s는 high-S
+		if r.Cmp(hexInt("EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716")) != 0 || s.Cmp(expectedS) != 0 {
+			t.Errorf("Expected the signature of the test vector, got %x %x", r, s)
+		}
+	})
+
+	key := createPublicKey()
+	address := addressFromKey(key)
+	publicKey := encodePublicKey(&key.PublicKey)
+	w := &wallet{Address: address, privateKey: key, keystore: &keystore{Address: legacyAddress(&key.PublicKey)}}
+	payload := hex.EncodeToString([]byte("payload"))
+
+	t.Run("same payload gives the same signature", func(t *testing.T) {
+		first, _ := Sign(payload, address, w)
+		second, _ := Sign(payload, address, w)
+		if first != second || len(first) != signatureSize*2 {
+			t.Errorf("Expected the same 64 byte signature, got %s and %s", first, second)
+		}
+	})
+
+	t.Run("signatures are low-S and fixed width", func(t *testing.T) {
+		for i := 0; i < 200; i++ {
+			signature, _ := Sign(hex.EncodeToString([]byte{byte(i)}), address, w)
+			if _, _, err := decodeSignature(signature); err != nil {
+				t.Fatalf("signature %d is not canonical: %s", i, signature)
+			}
+		}
+	})
+
+	t.Run("rejects non-canonical signatures", func(t *testing.T) {
+		signature, _ := Sign(payload, address, w)
+		r, s, _ := decodeSignature(signature)
+		highS := encodeSignature(r, new(big.Int).Sub(elliptic.P256().Params().N, s))
+		if !ecdsa.Verify(&key.PublicKey, []byte("payload"), r, new(big.Int).Sub(elliptic.P256().Params().N, s)) {
+			t.Fatal("Expected the high-S signature to be mathematically valid")
+		}
+		for _, bad := range []string{highS, signature[2:], signature + "00", bytesToHex(r.Bytes(), s.Bytes())[:len(signature)-2]} {
+			if Verify(bad, payload, publicKey, address) {
+				t.Errorf("Expected %s to be rejected", bad)
+			}
+		}
+		if !Verify(signature, payload, publicKey, address) {
+			t.Error("Expected the canonical signature to be valid")
+		}
+	})
+
+	t.Run("legacy signatures only for legacy addresses", func(t *testing.T) {
+		r, s, _ := decodeSignature(func() string { sig, _ := Sign(payload, address, w); return sig }())
+		legacy := bytesToHex(r.Bytes(), s.Bytes())
+		if VerifyLegacy(legacy, payload, address) {
+			t.Error("Expected a new address to need a canonical signature")
+		}
+		if len(legacyAddress(&key.PublicKey)) == 128 && len(legacy) == 128 && !VerifyLegacy(legacy, payload, legacyAddress(&key.PublicKey)) {
+			t.Error("Expected the legacy signature to be valid")
+		}
+	})
+}
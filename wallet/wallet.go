@@ -4,11 +4,14 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/x509"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/big"
 	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/yyuurriiaa/ProjectMSSP/utils"
 )
@@ -18,56 +21,362 @@ import (
 
 const (
 	walletName string = "MSSP.wallet"
+
+	DefaultUnlockTimeout = 5 * time.Minute // unlock할 때 timeout을 주지 않으면 이 시간 후에 다시 잠금
 )
 
 type wallet struct {
-	privateKey *ecdsa.PrivateKey
-	Address    string
+	Name       string
+	path       string            // keystore 파일
+	privateKey *ecdsa.PrivateKey // key 하나인 wallet의 key. 잠겨있으면 nil
+	account    *extendedKey      // HD wallet의 account key. 잠겨있으면 public key만 있음
+	Address    string            // 받을 때 사용하는 address. HD wallet은 가장 최근에 만든 receive address
+	addresses  []string          // 지금까지 만든 address
+	paths      map[string]hdPath // HD wallet의 address마다 account key 아래의 경로
+	keystore   *keystore
+	lockTimer  *time.Timer // unlock한 후 다시 잠그는 timer
+	lockAt     time.Time
+	m          sync.Mutex
 }
 
-//walletName 이름의 파일이 존재하는지 확인 후 bool값 리턴. 있으면 true 없으면 false.
-func hasWalletFile() bool {
-	_, err := os.Stat(walletName) // wallet파일이 없으면 err 발생
-	return !os.IsNotExist(err)    // 에러가 'notexist'에러이면 true 반환이므로 역을 취함
+//HD wallet address의 경로. m/44'/0'/account'/change/index
+type hdPath struct {
+	change uint32
+	index  int
 }
 
-var w *wallet // singleton
-//singleton으로 wallet 생성. 만약 wallet 파일이 이미 존재할 경우 지갑파일로부터 복원. 존재하지 않을 시 새로 wallet 파일 생성. 그 후 *wallet 리턴
-func Wallet() *wallet { // wallet 생성
-	if w == nil {
-		w = &wallet{}
-		if hasWalletFile() { //지갑 파일이 있으면 지갑파일로부터 복원
-			w.privateKey = restoreKey(walletName)
-		} else { //지갑파일이 없으면 새로 생성
-			key := createPublicKey()
-			persistKey(key) // wallet 파일 r/w
-			w.privateKey = key
+//wallet의 잠금 상태. /wallet 에서 보여줌.
+type Status struct {
+	Name          string   `json:"name"`
+	Address       string   `json:"address"`
+	Locked        bool     `json:"locked"`
+	UnlockedUntil int      `json:"unlockedUntil,omitempty"` // 다시 잠기는 시간
+	HD            bool     `json:"hd"`
+	Addresses     []string `json:"addresses"`
+	WatchOnly     bool     `json:"watchOnly,omitempty"` // private key가 없는 wallet
+	Watched       []string `json:"watched,omitempty"`   // 가져온 address
+}
+
+var ErrWalletLocked = errors.New("wallet is locked")
+var ErrPlaintextWallet = errors.New("wallet file is not encrypted")
+var ErrUnknownAddress = errors.New("address is not in the wallet")
+var ErrInvalidMnemonic = errors.New("mnemonic is not valid")
+
+//기본 wallet 파일의 이름. backup할 때 사용.
+func File() string {
+	return walletName
+}
+
+//시작할 때 기본 wallet 파일을 준비. 파일이 없으면 새 mnemonic으로 HD wallet을 만들어서 passphrase로 암호화하고 mnemonic을 리턴함.
+//암호화하지 않은 이전 wallet 파일이면 암호화함. 이미 keystore면 passphrase를 사용하지 않음. wallet은 잠긴 상태로 시작함.
+func Prepare(passphrase string) (mnemonic string, migrated bool, err error) {
+	if _, err := os.Stat(walletName); os.IsNotExist(err) {
+		mnemonic, err = newMnemonic()
+		if err != nil {
+			return "", false, err
 		}
-		w.Address = addressFromKey(w.privateKey)
+		return mnemonic, false, Restore(DefaultName, mnemonic, passphrase)
 	}
-	return w
+	migrated, err = Migrate(passphrase)
+	return "", migrated, err
 }
 
-//타원 곡선을 이용해서 privateKey 생성.
-func createPublicKey() *ecdsa.PrivateKey {
-	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader) //랜덤한 수로 privateKey 생성
-	utils.HandleErr(err)
-	return privateKey
+//mnemonic의 seed로 name wallet의 HD wallet 파일을 만듬. 이미 wallet 파일이 있으면 .before-restore 파일로 옮겨둠.
+//복원한 wallet은 receive address 하나만 가지고 있으므로 Discover로 사용한 address를 찾아야함.
+func Restore(name string, mnemonic string, passphrase string) error {
+	path, err := walletPath(name)
+	if err != nil {
+		return err
+	}
+	seed, err := mnemonicSeed(mnemonic)
+	if err != nil {
+		return err
+	}
+	k, err := encryptSeed(seed, 0, passphrase)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		if err := os.Rename(path, path+".before-restore"); err != nil {
+			return err
+		}
+	}
+	if err := writeKeystore(path, k); err != nil {
+		return err
+	}
+	Wallets().forget(name)
+	return nil
 }
 
-//walletName 이름의 지갑 파일 생성.
-func persistKey(key *ecdsa.PrivateKey) {
-	bytes, err := x509.MarshalECPrivateKey(key) //privateKey 를 []byte로 변환
-	utils.HandleErr(err)
-	err = os.WriteFile(walletName, bytes, 0644) //0644 = r/w 파일 생성. walletName 이름을 가지고 []byte 형식의 privateKey를 내용으로 가지는 파일
-	utils.HandleErr(err)
+//암호화하지 않은 이전 기본 wallet 파일을 passphrase로 암호화한 keystore로 바꿈. 이미 keystore면 false.
+func Migrate(passphrase string) (bool, error) {
+	_, plaintext, err := readKeystore(walletName)
+	if err != nil || plaintext == nil {
+		return false, err
+	}
+	k, err := encryptKey(plaintext, passphrase)
+	if err != nil {
+		return false, err
+	}
+	return true, writeKeystore(walletName, k)
 }
 
-//walletName 파일 안의 privateKey 복원.
-func restoreKey(walletName string) *ecdsa.PrivateKey {
-	KeyAsBytes, err := os.ReadFile(walletName) //walletName 파일 안의 내용이 KeyAsBytes.
+//node의 기본 wallet. 채굴 보상을 받고 /wallet, /transactions 에서 사용함. private key는 Unlock해야 사용할 수 있음.
+//wallet 파일은 시작할 때 Prepare로 만들어둬야함.
+func Wallet() *wallet { // wallet 생성
+	w, err := Wallets().Load(DefaultName)
 	utils.HandleErr(err)
-	privateKey, err := x509.ParseECPrivateKey(KeyAsBytes)
+	return w
+}
+
+//path의 keystore에서 address를 가져와서 잠긴 wallet을 만듬.
+func openWallet(name string, path string) (*wallet, error) {
+	k, plaintext, err := readKeystore(path)
+	if plaintext != nil {
+		err = ErrPlaintextWallet
+	}
+	if err != nil {
+		return nil, err
+	}
+	w := &wallet{Name: name, path: path, Address: k.Address, keystore: k}
+	if k.Account != nil {
+		if err := w.loadAccount(); err != nil {
+			return nil, err
+		}
+	} else if k.Type == keystoreWatch { // address만 가져온 watch-only wallet
+		w.addresses = []string{}
+	} else { // 이전 address로 받은 TxOut도 사용할 수 있도록 같이 가지고 있음
+		key, err := legacyPublicKey(k.Address)
+		if err != nil {
+			return nil, ErrNotKeystore
+		}
+		w.Address = addressFromPublicKey(key)
+		w.addresses = []string{w.Address, k.Address}
+	}
+	return w, nil
+}
+
+//keystore의 account public key로 지금까지 만든 address들을 다시 만듬.
+func (w *wallet) loadAccount() error {
+	account, err := w.keystore.accountKey()
+	if err != nil {
+		return err
+	}
+	w.account = account
+	w.paths = map[string]hdPath{}
+	for i := 0; i < w.keystore.Account.Receive; i++ {
+		if err := w.addPath(receiveChain, i); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < w.keystore.Account.Change; i++ {
+		if err := w.addPath(changeChain, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//지금까지 만든 address들. key 하나인 wallet은 그 address 하나.
+func (w *wallet) Addresses() []string {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return append([]string{}, w.addresses...)
+}
+
+//HD wallet이면 true.
+func (w *wallet) HD() bool {
+	return w.account != nil
+}
+
+//다음 receive address를 만들어서 wallet의 Address로 사용함. key 하나인 wallet은 항상 같은 address.
+func (w *wallet) NewAddress() (string, error) {
+	return w.nextAddress(receiveChain)
+}
+
+//잔돈을 받을 새 change address. key 하나인 wallet은 Address.
+func (w *wallet) ChangeAddress() (string, error) {
+	return w.nextAddress(changeChain)
+}
+
+//change chain의 다음 address를 만들고 keystore에 만든 수를 저장.
+func (w *wallet) nextAddress(change uint32) (string, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if w.account == nil {
+		if w.WatchOnly() {
+			return "", ErrWatchOnly
+		}
+		return w.Address, nil
+	}
+	index := w.keystore.Account.Receive
+	if change == changeChain {
+		index = w.keystore.Account.Change
+	}
+	if err := w.setCount(change, index+1); err != nil {
+		return "", err
+	}
+	return w.addresses[len(w.addresses)-1], nil
+}
+
+//HD wallet address의 경로. 서명하지 않은 tx에 넣어서 offline wallet이 key를 찾을 수 있게 함. HD wallet이 아니거나 모르는 address면 "".
+func (w *wallet) Path(address string) string {
+	w.m.Lock()
+	defer w.m.Unlock()
+	path, ok := w.paths[address]
+	if w.account == nil || !ok {
+		return ""
+	}
+	return path.format(w.keystore.Account.Index)
+}
+
+//path의 address가 address이면 서명할 수 있는 address로 기억함. 파일에는 저장하지 않음.
+//offline wallet은 online wallet이 나중에 만든 change address를 모르므로 서명하지 않은 tx의 경로로 찾음.
+func (w *wallet) AddPath(address string, path string) error {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if w.account == nil {
+		return ErrInvalidPath
+	}
+	if _, ok := w.paths[address]; ok {
+		return nil
+	}
+	p, err := parsePath(path, w.keystore.Account.Index)
+	if err != nil {
+		return err
+	}
+	derived, err := w.deriveAddress(p.change, p.index)
+	if err != nil {
+		return err
+	}
+	if derived != address {
+		return ErrUnknownAddress
+	}
+	w.paths[address] = p
+	return nil
+}
+
+//change chain의 address를 count개까지 만들고 keystore 파일에 저장함.
+func (w *wallet) setCount(change uint32, count int) error {
+	counter := &w.keystore.Account.Receive
+	if change == changeChain {
+		counter = &w.keystore.Account.Change
+	}
+	from := *counter
+	*counter = count
+	if err := writeKeystore(w.path, w.keystore); err != nil {
+		*counter = from
+		return err
+	}
+	for i := from; i < count; i++ {
+		if err := w.addPath(change, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//change chain의 index번째 address를 wallet에 추가. receive address면 Address로 사용함.
+func (w *wallet) addPath(change uint32, index int) error {
+	address, err := w.deriveAddress(change, index)
+	if err != nil {
+		return err
+	}
+	w.paths[address] = hdPath{change: change, index: index}
+	w.addresses = append(w.addresses, address)
+	if change == receiveChain {
+		w.Address = address
+	}
+	return nil
+}
+
+//account key 아래 change/index 경로의 address.
+func (w *wallet) deriveAddress(change uint32, index int) (string, error) {
+	key, err := w.account.derive(change, uint32(index))
+	if err != nil {
+		return "", err
+	}
+	return key.address(), nil
+}
+
+//passphrase로 private key를 풀어서 timeout 동안 사용할 수 있게 함. 이미 풀려있으면 잠기는 시간만 바꿈.
+func (w *wallet) Unlock(passphrase string, timeout time.Duration) error {
+	if w.WatchOnly() {
+		return ErrWatchOnly
+	}
+	if timeout <= 0 {
+		timeout = DefaultUnlockTimeout
+	}
+	var key *ecdsa.PrivateKey
+	var account *extendedKey
+	var err error
+	if w.keystore.Type == keystoreHD {
+		account, err = w.keystore.decryptAccount(passphrase)
+	} else {
+		key, err = w.keystore.decryptKey(passphrase)
+	}
+	if err != nil {
+		return err
+	}
+	w.m.Lock()
+	defer w.m.Unlock()
+	if w.lockTimer != nil {
+		w.lockTimer.Stop()
+	}
+	if account != nil {
+		w.account = account
+	} else {
+		w.privateKey = key
+	}
+	w.lockAt = time.Now().Add(timeout)
+	w.lockTimer = time.AfterFunc(timeout, w.Lock)
+	return nil
+}
+
+//private key를 메모리에서 지우고 잠금.
+func (w *wallet) Lock() {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if w.lockTimer != nil {
+		w.lockTimer.Stop()
+		w.lockTimer = nil
+	}
+	if w.privateKey != nil {
+		w.privateKey.D.SetInt64(0)
+		w.privateKey = nil
+	}
+	if w.account != nil && w.account.key != nil {
+		w.account.key.SetInt64(0)
+		w.account = w.account.public()
+	}
+}
+
+//잠겨있으면 true. w.m을 가지고 있어야함.
+func (w *wallet) locked() bool {
+	if w.account != nil {
+		return w.account.key == nil
+	}
+	return w.privateKey == nil
+}
+
+//wallet의 잠금 상태.
+func (w *wallet) Status() Status {
+	w.m.Lock()
+	defer w.m.Unlock()
+	s := Status{Name: w.Name, Address: w.Address, Locked: w.locked(), HD: w.account != nil, Addresses: append([]string{}, w.addresses...),
+		WatchOnly: w.WatchOnly(), Watched: append([]string(nil), w.keystore.Watch...)}
+	if !s.Locked {
+		s.UnlockedUntil = int(w.lockAt.Unix())
+	}
+	return s
+}
+
+//타원 곡선을 이용해서 privateKey 생성.
+func createPublicKey() *ecdsa.PrivateKey {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader) //랜덤한 수로 privateKey 생성
 	utils.HandleErr(err)
 	return privateKey
 }
@@ -88,20 +397,80 @@ func bytesToHex(a []byte, b []byte) string {
 	return zHex
 }
 
-//key.X 값과 key.Y 값을 []byte로 받은 값을 Hex로 변환.
+//key의 address.
 func addressFromKey(key *ecdsa.PrivateKey) string {
-	z := bytesToHex(key.X.Bytes(), key.Y.Bytes())
-	return z
+	return addressFromPublicKey(&key.PublicKey)
 }
 
-//"data" + privateKey 로 signature 생성.
-func Sign(payload string, w *wallet) string { // payload : "Data"
+//"data" + address의 privateKey 로 64 byte low-S signature 생성. 같은 data에는 항상 같은 signature가 나옴.
+//wallet이 잠겨있으면 ErrWalletLocked, wallet의 address가 아니면 ErrUnknownAddress.
+func Sign(payload string, address string, w *wallet) (string, error) { // payload : "Data"
 	payloadAsBytes, err := hex.DecodeString(payload) //string -> []byte
 	utils.HandleErr(err)
-	r, s, err := ecdsa.Sign(rand.Reader, w.privateKey, payloadAsBytes)
-	utils.HandleErr(err)
-	signature := bytesToHex(r.Bytes(), s.Bytes())
-	return signature
+	w.m.Lock()
+	defer w.m.Unlock()
+	key, err := w.signingKey(address)
+	if err != nil {
+		return "", err
+	}
+	r, s := signDeterministic(key, payloadAsBytes)
+	if w.account != nil { // HD wallet은 서명할 때마다 key를 만드므로 지움
+		key.D.SetInt64(0)
+	}
+	return encodeSignature(r, s), nil
+}
+
+//address의 압축한 public key의 hex. TxIn에 넣어서 address와 signature를 검증함. 잠겨있어도 알 수 있음.
+func (w *wallet) PublicKey(address string) (string, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if w.account == nil {
+		if w.WatchOnly() || address != w.Address && address != w.keystore.Address {
+			return "", ErrUnknownAddress
+		}
+		key, err := legacyPublicKey(w.keystore.Address)
+		if err != nil {
+			return "", err
+		}
+		return encodePublicKey(key), nil
+	}
+	path, ok := w.paths[address]
+	if !ok {
+		return "", ErrUnknownAddress
+	}
+	key, err := w.account.derive(path.change, uint32(path.index))
+	if err != nil {
+		return "", err
+	}
+	return encodePublicKey(&ecdsa.PublicKey{Curve: elliptic.P256(), X: key.x, Y: key.y}), nil
+}
+
+//address의 private key. w.m을 가지고 있어야함.
+func (w *wallet) signingKey(address string) (*ecdsa.PrivateKey, error) {
+	if w.WatchOnly() {
+		return nil, ErrWatchOnly
+	}
+	if w.account == nil {
+		if address != w.Address && address != w.keystore.Address {
+			return nil, ErrUnknownAddress
+		}
+		if w.privateKey == nil {
+			return nil, ErrWalletLocked
+		}
+		return w.privateKey, nil
+	}
+	path, ok := w.paths[address]
+	if !ok {
+		return nil, ErrUnknownAddress
+	}
+	if w.account.key == nil {
+		return nil, ErrWalletLocked
+	}
+	key, err := w.account.derive(path.change, uint32(path.index))
+	if err != nil {
+		return nil, err
+	}
+	return key.privateKey(), nil
 }
 
 //두 원소를 합쳐서 만들었던 signature를 다시 두 원소로 분해.
@@ -117,29 +486,45 @@ func restoreBigInt(payload string) (*big.Int, *big.Int, error) {
 	BigB := big.Int{}
 	BigA.SetBytes(aBytes)
 	BigB.SetBytes(bBytes)
-	fmt.Println(BigA, BigB)
 	return &BigA, &BigB, nil
 }
 
-//"data" + signature + publickey 로 검증.
-func Verify(signature string, payload string, address string) bool {
-	r, s, err := restoreBigInt(signature)
-	utils.HandleErr(err)
-
+//"data" + signature + publickey 로 검증. address가 publicKey의 address여야하고 signature는 64 byte low-S여야함.
+//이전 hex address는 address가 public key이므로 publicKey를 사용하지 않음.
+func Verify(signature string, payload string, publicKey string, address string) bool {
+	var key *ecdsa.PublicKey
+	if isLegacyAddress(address) {
+		key, _ = legacyPublicKey(address)
+	} else if key = parsePublicKey(publicKey); key == nil || addressFromPublicKey(key) != address {
+		return false
+	}
+	r, s, err := decodeSignature(signature)
+	if err != nil {
+		return false
+	}
 	payloadBytes, err := hex.DecodeString(payload)
-	utils.HandleErr(err)
-
-	x, y, err := restoreBigInt(address) // address에서 x, y 구함
-	utils.HandleErr(err)
-	publicKey := ecdsa.PublicKey{ //x, y로 publicKey 복원
-		Curve: elliptic.P256(),
-		X:     x,
-		Y:     y,
+	if err != nil {
+		return false
 	}
+	return ecdsa.Verify(key, payloadBytes, r, s) // r,s가 signature에서 구한 두 숫자
+}
 
-	ok := ecdsa.Verify(&publicKey, payloadBytes, r, s) // r,s가 signature에서 구한 두 숫자
-	return ok
-
+//이전 형식의 signature를 이전 hex address로 검증. r, s의 byte를 그대로 이어붙였으므로 길이가 정해져 있지 않음.
+//이미 chain에 있는 tx를 검증할 때만 사용함.
+func VerifyLegacy(signature string, payload string, address string) bool {
+	if !isLegacyAddress(address) {
+		return false
+	}
+	key, _ := legacyPublicKey(address)
+	r, s, err := restoreBigInt(signature)
+	if err != nil {
+		return false
+	}
+	payloadBytes, err := hex.DecodeString(payload)
+	if err != nil {
+		return false
+	}
+	return ecdsa.Verify(key, payloadBytes, r, s)
 }
 
 // const (
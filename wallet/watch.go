@@ -0,0 +1,149 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+//watch-only wallet은 private key 없이 address만 가지고 있어서 잔액과 tx를 지켜보기만 함. 서명이 필요하면 서명하지 않은 tx를 만들어서
+//offline wallet으로 서명함. HD wallet의 account public key(xpub)를 가져오면 그 account의 address를 모두 만들 수 있고,
+//address만 가져올 수도 있음. 다른 wallet에도 address를 가져와서 같이 지켜볼 수 있음.
+//
+//xpub는 BIP32 형식. version(4) | depth(1) | 부모 fingerprint(4) | child(4) | chain code(32) | 압축한 public key(33) | checksum(4)
+const (
+	xpubVersion uint32 = 0x03a3fdc4 // "mpub"으로 시작하는 xpub
+	xpubDepth   byte   = 3          // m/44'/0'/account'
+	xpubSize    int    = 4 + 1 + 4 + 4 + 32 + 33
+)
+
+var ErrWatchOnly = errors.New("wallet is watch-only and has no private keys")
+var ErrInvalidXPub = errors.New("extended public key is not valid")
+var ErrNotHD = errors.New("wallet is not an HD wallet")
+
+//account key를 xpub 문자열로 씀. 부모 fingerprint는 알 수 없으므로 0.
+func encodeXPub(account uint32, key *extendedKey) string {
+	payload := make([]byte, 13, xpubSize+checksumSize)
+	binary.BigEndian.PutUint32(payload[:4], xpubVersion)
+	payload[4] = xpubDepth
+	binary.BigEndian.PutUint32(payload[9:13], account+hardened)
+	payload = append(payload, key.chainCode...)
+	payload = append(payload, elliptic.MarshalCompressed(elliptic.P256(), key.x, key.y)...)
+	return base58Encode(append(payload, addressChecksum(payload)...))
+}
+
+//xpub를 확인하고 account 번호와 account public key를 리턴.
+func decodeXPub(xpub string) (uint32, *extendedKey, error) {
+	decoded, err := base58Decode(xpub)
+	if err != nil || len(decoded) != xpubSize+checksumSize {
+		return 0, nil, ErrInvalidXPub
+	}
+	payload, checksum := decoded[:xpubSize], decoded[xpubSize:]
+	if !bytes.Equal(addressChecksum(payload), checksum) || binary.BigEndian.Uint32(payload[:4]) != xpubVersion || payload[4] != xpubDepth {
+		return 0, nil, ErrInvalidXPub
+	}
+	child := binary.BigEndian.Uint32(payload[9:13])
+	if child < hardened {
+		return 0, nil, ErrInvalidXPub
+	}
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), payload[45:])
+	if x == nil {
+		return 0, nil, ErrInvalidXPub
+	}
+	return child - hardened, &extendedKey{x: x, y: y, chainCode: append([]byte{}, payload[13:45]...)}, nil
+}
+
+//HD wallet의 account public key. watch-only node에 가져가서 address를 만들고 잔액을 볼 수 있음. 잠겨있어도 알 수 있음.
+func (w *wallet) XPub() (string, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if w.account == nil {
+		return "", ErrNotHD
+	}
+	return encodeXPub(w.keystore.Account.Index, w.account.public()), nil
+}
+
+//private key가 없는 wallet이면 true.
+func (w *wallet) WatchOnly() bool {
+	return w.keystore.Type == keystoreWatch
+}
+
+//address를 지켜볼 address로 keystore에 저장함. 이미 wallet의 address이거나 가져온 address면 아무것도 하지 않음.
+//지켜보기만 하므로 이 address의 TxOut은 보내는 tx에 사용하지 않음.
+func (w *wallet) ImportAddress(address string) error {
+	if err := ValidateAddress(address); err != nil && !isLegacyAddress(address) {
+		return err
+	}
+	w.m.Lock()
+	defer w.m.Unlock()
+	if _, ok := w.paths[address]; ok {
+		return nil
+	}
+	for _, a := range w.addresses {
+		if a == address {
+			return nil
+		}
+	}
+	for _, a := range w.keystore.Watch {
+		if a == address {
+			return nil
+		}
+	}
+	w.keystore.Watch = append(w.keystore.Watch, address)
+	if err := writeKeystore(w.path, w.keystore); err != nil {
+		w.keystore.Watch = w.keystore.Watch[:len(w.keystore.Watch)-1]
+		return err
+	}
+	return nil
+}
+
+//wallet이 지켜보는 address들. 가져온 address와, xpub로 만든 watch-only wallet이면 만든 address와 아직 만들지 않은 다음 address들.
+func (w *wallet) Watched() []string {
+	var lookahead []string
+	if w.WatchOnly() {
+		lookahead = w.Lookahead()
+	}
+	w.m.Lock()
+	defer w.m.Unlock()
+	watched := append([]string{}, w.keystore.Watch...)
+	if w.WatchOnly() {
+		watched = append(watched, w.addresses...)
+		watched = append(watched, lookahead...)
+	}
+	return watched
+}
+
+//name watch-only wallet을 만들어서 불러옴. xpub가 있으면 그 account의 address를 만들고, 비어있으면 ImportAddress로 가져온 address만 가짐.
+func (m *manager) CreateWatchOnly(name string, xpub string) (*wallet, error) {
+	path, err := walletPath(name)
+	if err != nil {
+		return nil, err
+	}
+	k := &keystore{Version: keystoreVersion, Type: keystoreWatch}
+	if xpub != "" {
+		index, key, err := decodeXPub(xpub)
+		if err != nil {
+			return nil, err
+		}
+		k.Account = &hdAccount{
+			Index:     index,
+			PublicKey: hex.EncodeToString(elliptic.MarshalCompressed(elliptic.P256(), key.x, key.y)),
+			ChainCode: hex.EncodeToString(key.chainCode),
+			Receive:   1,
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil, ErrWalletExists
+	}
+	if err := writeKeystore(path, k); err != nil {
+		return nil, err
+	}
+	return m.Load(name)
+}
@@ -0,0 +1,123 @@
+package wallet
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchOnly(t *testing.T) {
+	scryptN = 1 << 10
+	wd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	defer os.Chdir(wd)
+	defer Wallets().forget(DefaultName)
+	defer Wallets().forget("xpub")
+	defer Wallets().forget("addresses")
+
+	if err := Restore(DefaultName, testMnemonic, "passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	hd := Wallet()
+	xpub, err := hd.XPub()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(xpub, "mpub") || len(xpub) != 111 {
+		t.Errorf("Expected a 111 character xpub starting with mpub, got %s", xpub)
+	}
+
+	t.Run("xpub round trip", func(t *testing.T) {
+		account, key, err := decodeXPub(xpub)
+		if err != nil || account != 0 || key.address() != hd.account.address() {
+			t.Fatalf("Expected the account key back, got %d %v", account, err)
+		}
+		broken := xpub[:50] + string(xpub[50]^1) + xpub[51:]
+		if _, _, err := decodeXPub(broken); err != ErrInvalidXPub {
+			t.Errorf("Expected ErrInvalidXPub for a changed xpub, got %v", err)
+		}
+		if _, err := Wallets().CreateWatchOnly("broken", hd.Address); err != ErrInvalidXPub {
+			t.Errorf("Expected ErrInvalidXPub for an address, got %v", err)
+		}
+	})
+
+	watch, err := Wallets().CreateWatchOnly("xpub", xpub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Wallets().CreateWatchOnly("xpub", ""); err != ErrWalletExists {
+		t.Errorf("Expected ErrWalletExists, got %v", err)
+	}
+
+	t.Run("xpub wallet makes the same addresses", func(t *testing.T) {
+		if !watch.WatchOnly() || !watch.HD() || watch.Address != hd.Address {
+			t.Fatalf("Expected a watch-only HD wallet with %s, got %s", hd.Address, watch.Address)
+		}
+		next, err := watch.NewAddress()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, _ := hd.deriveAddress(receiveChain, 1); next != expected {
+			t.Errorf("Expected %s, got %s", expected, next)
+		}
+		if watched := watch.Watched(); len(watched) != 2+2*gapLimit {
+			t.Errorf("Expected the addresses and the lookahead to be watched, got %d", len(watched))
+		}
+		publicKey, err := watch.PublicKey(hd.Address)
+		if expected, _ := hd.PublicKey(hd.Address); err != nil || publicKey != expected {
+			t.Errorf("Expected the public key of the address, got %s %v", publicKey, err)
+		}
+	})
+
+	t.Run("watch-only wallets cannot sign", func(t *testing.T) {
+		if err := watch.Unlock("passphrase", time.Minute); err != ErrWatchOnly {
+			t.Errorf("Expected ErrWatchOnly, got %v", err)
+		}
+		if _, err := Sign("aa", watch.Address, watch); err != ErrWatchOnly {
+			t.Errorf("Expected ErrWatchOnly, got %v", err)
+		}
+	})
+
+	t.Run("import addresses", func(t *testing.T) {
+		addresses, err := Wallets().CreateWatchOnly("addresses", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := addresses.NewAddress(); err != ErrWatchOnly {
+			t.Errorf("Expected ErrWatchOnly, got %v", err)
+		}
+		other := addressFromKey(createPublicKey())
+		last := "1"
+		if strings.HasSuffix(other, last) { // 같은 글자로 바꾸면 checksum이 맞음
+			last = "2"
+		}
+		if err := addresses.ImportAddress(other[:len(other)-1] + last); !errors.Is(err, ErrAddressChecksum) {
+			t.Errorf("Expected ErrAddressChecksum, got %v", err)
+		}
+		for i := 0; i < 2; i++ {
+			if err := addresses.ImportAddress(other); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := hd.ImportAddress(hd.Address); err != nil {
+			t.Fatal(err)
+		}
+
+		Wallets().forget("addresses")
+		addresses, err = Wallets().Load("addresses")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if watched := addresses.Watched(); len(watched) != 1 || watched[0] != other || len(addresses.Addresses()) != 0 {
+			t.Errorf("Expected the imported address to be saved once, got %v", watched)
+		}
+		if status := addresses.Status(); !status.WatchOnly || status.HD || len(status.Watched) != 1 {
+			t.Errorf("Expected the status of an address-only wallet, got %+v", status)
+		}
+		if watched := hd.Watched(); len(watched) != 0 {
+			t.Errorf("Expected the address of the wallet not to be imported, got %v", watched)
+		}
+	})
+}